@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+
+	"github.com/spf13/cobra"
+	"gproc/internal/control"
+	"gproc/internal/pty"
+)
+
+type attachParams struct {
+	Name     string `json:"name"`
+	ReadOnly bool   `json:"read_only"`
+}
+
+func attachCmd() *cobra.Command {
+	var readOnly bool
+	var detachKeys string
+
+	cmd := &cobra.Command{
+		Use:   "attach <name>",
+		Short: "Attach the terminal to a process started with --tty",
+		Long: `Connect to the pseudo-terminal of a process running under the daemon.
+The detach key sequence (default ctrl-p,ctrl-q) leaves the process running.
+Any number of --read-only watchers may be attached next to one interactive client.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			keys, err := parseDetachKeys(detachKeys)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+
+			status, err := attach(args[0], readOnly, keys)
+			if err != nil {
+				fmt.Printf("Error attaching to %s: %v\n", args[0], err)
+				return
+			}
+			fmt.Printf("\n%s\n", status)
+		},
+	}
+
+	cmd.Flags().BoolVar(&readOnly, "read-only", false, "Watch output without sending input")
+	cmd.Flags().StringVar(&detachKeys, "detach-keys", "ctrl-p,ctrl-q", "Key sequence to detach (comma separated, e.g. ctrl-a,d)")
+
+	return cmd
+}
+
+func attach(name string, readOnly bool, detachKeys []byte) (string, error) {
+	client := control.NewClient(control.SocketPath())
+	conn, err := client.Stream("attach", &attachParams{Name: name, ReadOnly: readOnly}, nil)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	stdin := int(os.Stdin.Fd())
+	if !readOnly {
+		if pty.IsTerminal(stdin) {
+			state, err := pty.MakeRaw(stdin)
+			if err != nil {
+				return "", err
+			}
+			defer pty.Restore(stdin, state)
+
+			sendWindowSize(conn, stdin)
+			resize := make(chan os.Signal, 1)
+			pty.NotifyResize(resize)
+			defer signal.Stop(resize)
+			go func() {
+				for range resize {
+					sendWindowSize(conn, stdin)
+				}
+			}()
+		}
+		go forwardInput(conn, detachKeys)
+	}
+
+	for {
+		typ, payload, err := conn.ReadFrame()
+		if err != nil {
+			return fmt.Sprintf("[connection to %s closed]", name), nil
+		}
+
+		switch typ {
+		case control.FrameData:
+			os.Stdout.Write(payload)
+		case control.FrameDetach:
+			return fmt.Sprintf("[detached from %s]", name), nil
+		case control.FrameExit:
+			var exit control.ExitStatus
+			json.Unmarshal(payload, &exit)
+			return fmt.Sprintf("[%s: %s]", name, exit.Message), nil
+		}
+	}
+}
+
+func sendWindowSize(conn *control.Conn, fd int) {
+	rows, cols, err := pty.GetSize(fd)
+	if err != nil {
+		return
+	}
+	conn.WriteJSONFrame(control.FrameResize, &control.WindowSize{Rows: rows, Cols: cols})
+}
+
+// forwardInput copies stdin to the process, watching for the detach sequence.
+// Bytes that start a sequence are held back until it either completes or
+// diverges.
+func forwardInput(conn *control.Conn, detachKeys []byte) {
+	buf := make([]byte, 1024)
+	matched := 0
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			conn.WriteFrame(control.FrameDetach, nil)
+			return
+		}
+
+		out := make([]byte, 0, n+matched)
+		for _, b := range buf[:n] {
+			if len(detachKeys) > 0 && b == detachKeys[matched] {
+				matched++
+				if matched == len(detachKeys) {
+					if len(out) > 0 {
+						conn.WriteFrame(control.FrameData, out)
+					}
+					conn.WriteFrame(control.FrameDetach, nil)
+					return
+				}
+				continue
+			}
+			if matched > 0 {
+				out = append(out, detachKeys[:matched]...)
+				matched = 0
+				// The byte that broke the sequence may start it again, as
+				// the second ctrl-p of ctrl-p ctrl-p ctrl-q does.
+				if b == detachKeys[0] {
+					matched = 1
+					continue
+				}
+			}
+			out = append(out, b)
+		}
+
+		if len(out) > 0 {
+			if err := conn.WriteFrame(control.FrameData, out); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// parseDetachKeys turns "ctrl-p,ctrl-q" into the raw bytes a terminal sends.
+func parseDetachKeys(spec string) ([]byte, error) {
+	var keys []byte
+	for _, key := range strings.Split(spec, ",") {
+		key = strings.TrimSpace(key)
+		switch {
+		case key == "":
+			continue
+		case len(key) == 1:
+			keys = append(keys, key[0])
+		case strings.HasPrefix(strings.ToLower(key), "ctrl-") && len(key) == 6:
+			c := key[5]
+			switch {
+			case c >= 'a' && c <= 'z':
+				keys = append(keys, c-'a'+1)
+			case c >= '@' && c <= '_':
+				keys = append(keys, c-'@')
+			default:
+				return nil, fmt.Errorf("invalid detach key %q", key)
+			}
+		default:
+			return nil, fmt.Errorf("invalid detach key %q", key)
+		}
+	}
+	return keys, nil
+}
+
+// attachHandler serves "attach" on the daemon side.
+func attachHandler(conn *control.Conn, req *control.Request) error {
+	var params attachParams
+	if err := req.Decode(&params); err != nil {
+		return err
+	}
+
+	console, err := manager.Console(params.Name)
+	if err != nil {
+		return err
+	}
+
+	client, scrollback, err := console.Attach(params.ReadOnly)
+	if err != nil {
+		return err
+	}
+	defer client.Detach()
+
+	if err := conn.Reply(nil); err != nil {
+		return err
+	}
+	if len(scrollback) > 0 {
+		conn.WriteFrame(control.FrameData, scrollback)
+	}
+
+	var detached atomic.Bool
+	go func() {
+		for {
+			typ, payload, err := conn.ReadFrame()
+			if err != nil {
+				client.Detach()
+				return
+			}
+
+			switch typ {
+			case control.FrameData:
+				client.Write(payload)
+			case control.FrameResize:
+				var size control.WindowSize
+				if !client.ReadOnly() && json.Unmarshal(payload, &size) == nil {
+					console.Resize(size.Rows, size.Cols)
+				}
+			case control.FrameDetach:
+				detached.Store(true)
+				client.Detach()
+				return
+			}
+		}
+	}()
+
+	for chunk := range client.Output() {
+		if err := conn.WriteFrame(control.FrameData, chunk); err != nil {
+			return nil
+		}
+	}
+
+	switch {
+	case detached.Load():
+		return conn.WriteFrame(control.FrameDetach, nil)
+	case console.Closed():
+		return conn.WriteJSONFrame(control.FrameExit, &control.ExitStatus{Message: "process exited"})
+	default:
+		return conn.WriteJSONFrame(control.FrameExit, &control.ExitStatus{Code: 1, Message: "disconnected, client could not keep up with output"})
+	}
+}
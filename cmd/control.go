@@ -0,0 +1,102 @@
+package main
+
+import (
+	"gproc/internal/control"
+	"gproc/pkg/types"
+)
+
+// registerControlHandlers wires the daemon's control socket actions.
+func registerControlHandlers(srv *control.Server) {
+	srv.Handle("start", startHandler)
+	srv.Handle("stop", stopHandler)
+	srv.Handle("restart", restartHandler)
+	srv.Handle("reload", reloadHandler)
+	srv.Handle("list", listHandler)
+	srv.Handle("describe", describeHandler)
+	srv.Handle("ps", psHandler)
+	srv.Handle("exec.context", execContextHandler)
+	srv.Handle("bulk", bulkHandler)
+	srv.Handle("label", labelHandler)
+	srv.Handle("attach", attachHandler)
+	srv.Handle("job.run", jobRunHandler)
+	srv.Handle("job.list", jobListHandler)
+	srv.Handle("job.logs", jobLogsHandler)
+	srv.Handle("job.cancel", jobCancelHandler)
+	srv.Handle("schedule.add", scheduleAddHandler)
+	srv.Handle("schedule.list", scheduleListHandler)
+	srv.Handle("schedule.history", scheduleHistoryHandler)
+	srv.Handle("schedule.run-now", scheduleRunNowHandler)
+	srv.Handle("schedule.pause", schedulePauseHandler)
+	srv.Handle("schedule.resume", scheduleResumeHandler)
+	srv.Handle("schedule.remove", scheduleRemoveHandler)
+	srv.Handle("metrics.show", metricsShowHandler)
+	srv.Handle("alerts.list", alertsListHandler)
+	srv.Handle("alerts.ack", alertsAckHandler)
+	srv.Handle("alerts.clear", alertsClearHandler)
+	srv.Handle("alerts.rules", alertsRulesHandler)
+	srv.Handle("alerts.rules.add", alertsRulesAddHandler)
+	srv.Handle("alerts.rules.remove", alertsRulesRemoveHandler)
+}
+
+func startHandler(conn *control.Conn, req *control.Request) error {
+	var proc types.Process
+	if err := req.Decode(&proc); err != nil {
+		return err
+	}
+	if err := manager.Start(&proc); err != nil {
+		return err
+	}
+	return conn.Reply(&proc)
+}
+
+type processParams struct {
+	ID string `json:"id"`
+}
+
+func stopHandler(conn *control.Conn, req *control.Request) error {
+	var params processParams
+	if err := req.Decode(&params); err != nil {
+		return err
+	}
+	if err := manager.Stop(params.ID); err != nil {
+		return err
+	}
+	return conn.Reply(nil)
+}
+
+func restartHandler(conn *control.Conn, req *control.Request) error {
+	var params processParams
+	if err := req.Decode(&params); err != nil {
+		return err
+	}
+	if err := manager.Restart(params.ID); err != nil {
+		return err
+	}
+	return conn.Reply(nil)
+}
+
+func reloadHandler(conn *control.Conn, req *control.Request) error {
+	var params processParams
+	if err := req.Decode(&params); err != nil {
+		return err
+	}
+	if err := manager.ZeroDowntimeReload(params.ID); err != nil {
+		return err
+	}
+	return conn.Reply(nil)
+}
+
+func listHandler(conn *control.Conn, req *control.Request) error {
+	return conn.Reply(manager.Processes())
+}
+
+// daemonCall forwards action to the daemon when one is running. It
+// returns false, and the caller falls back to the local manager, when
+// there is no daemon.
+func daemonCall(action string, params, result interface{}) (bool, error) {
+	err := control.NewClient(control.SocketPath()).Call(action, params, result)
+	if err == control.ErrDaemonNotRunning {
+		return false, nil
+	}
+	return true, err
+}
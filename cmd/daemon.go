@@ -10,6 +10,8 @@ import (
 
 	"github.com/spf13/cobra"
 	"gproc/internal/api"
+	"gproc/internal/control"
+	"gproc/internal/observability"
 	"gproc/internal/security"
 	"gproc/pkg/types"
 )
@@ -21,6 +23,36 @@ func daemonCmd() *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			fmt.Println("Starting GProc daemon with API server...")
 			
+			// Control socket used by the CLI (attach, ...)
+			controlServer := control.NewServer(control.SocketPath())
+			registerControlHandlers(controlServer)
+			if err := controlServer.Start(); err != nil {
+				fmt.Printf("Failed to start control socket: %v\n", err)
+				return
+			}
+			defer controlServer.Stop()
+
+			// Capture process output as timestamped log entries
+			manager.EnableLogCapture()
+
+			// Reap and attribute the orphans of managed processes
+			if err := manager.StartReaper(); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+			
+			// Receive the StatsD metrics of the processes
+			if err := manager.StartStatsD(); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+			defer manager.StopStatsD()
+			
+			// Roll up and expire the metrics history
+			manager.StartMetricsCompaction()
+			
+			// Run scheduled tasks through the process manager
+			startScheduler()
+			defer cronScheduler.Stop()
+			
 			// Initialize RBAC and security
 			rbacConfig := &types.RBACConfig{
 				Enabled: true,
@@ -45,14 +77,34 @@ func daemonCmd() *cobra.Command {
 			}
 			
 			apiServer := api.NewRESTServer(apiConfig, manager, rbacManager, tokenManager)
+			ctx := context.Background()
+			
+			// Export process and host metrics, at /metrics of the API server
+			// (with a token unless public_endpoint is set) and on the
+			// Prometheus port of the configuration if it has one
+			if metricsConfig := manager.MetricsConfig(); metricsConfig.Enabled {
+				metricsManager := observability.NewMetricsManager(metricsConfig, manager)
+				if err := metricsManager.Start(ctx); err != nil {
+					fmt.Printf("Warning: %v\n", err)
+				}
+				defer metricsManager.Stop()
+				apiServer.SetMetrics(metricsManager)
+			}
 			
 			// Start API server
-			ctx := context.Background()
 			if err := apiServer.Start(ctx); err != nil {
 				fmt.Printf("Failed to start API server: %v\n", err)
 				return
 			}
-			
+
+			// Start the gRPC API if api.grpc of the configuration enables it
+			grpcServer := api.NewGRPCServer(manager.GRPCConfig(), manager, rbacManager, tokenManager)
+			if err := grpcServer.Start(ctx); err != nil {
+				fmt.Printf("Failed to start gRPC server: %v\n", err)
+				apiServer.Stop()
+				return
+			}
+
 			// Handle shutdown signals
 			sigChan := make(chan os.Signal, 1)
 			signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -70,7 +122,8 @@ func daemonCmd() *cobra.Command {
 			if err := apiServer.Stop(); err != nil {
 				fmt.Printf("Error stopping API server: %v\n", err)
 			}
-			
+			grpcServer.Stop()
+
 			// Stop all processes gracefully
 			processes := manager.List()
 			for _, proc := range processes {
@@ -78,6 +131,7 @@ func daemonCmd() *cobra.Command {
 					manager.Stop(proc.ID)
 				}
 			}
+			manager.CloseLogs()
 			
 			fmt.Println("Daemon stopped.")
 		},
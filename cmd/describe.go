@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gproc/internal/control"
+	"gproc/internal/monitor"
+	"gproc/internal/process"
+	"gproc/pkg/types"
+)
+
+// describeEvents is how many recent events the table view shows.
+const describeEvents = 15
+
+func describeCmd() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "describe <name>",
+		Short: "Show the spec, process tree, resources, health and history of a process",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := validOutput(output); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+
+			var desc *process.Description
+			ok, err := daemonCall("describe", &processParams{ID: args[0]}, &desc)
+			if !ok {
+				desc, err = manager.Describe(args[0])
+			}
+			if err != nil {
+				fmt.Printf("Error describing process: %v\n", err)
+				return
+			}
+
+			if err := printOutput(output, desc, func(wide bool) { printDescription(desc, wide) }); err != nil {
+				fmt.Printf("Error describing process: %v\n", err)
+			}
+		},
+	}
+
+	addOutputFlag(cmd, &output)
+	return cmd
+}
+
+func printDescription(desc *process.Description, wide bool) {
+	proc := desc.Process
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	status := string(proc.Status)
+	if proc.Readiness != "" && proc.Status == types.StatusRunning {
+		status += " (" + string(proc.Readiness) + ")"
+	}
+	fmt.Fprintf(w, "Name:\t%s\n", proc.Name)
+	fmt.Fprintf(w, "Status:\t%s\n", status)
+	if proc.StatusText != "" {
+		fmt.Fprintf(w, "Status text:\t%s\n", proc.StatusText)
+	}
+	if proc.Status == types.StatusRunning {
+		fmt.Fprintf(w, "PID:\t%d\n", proc.PID)
+		fmt.Fprintf(w, "Started:\t%s (%s ago)\n", proc.StartTime.Local().Format("2006-01-02 15:04:05"),
+			time.Since(proc.StartTime).Round(time.Second))
+	}
+	restarts := fmt.Sprintf("%d", proc.Restarts)
+	if proc.AutoRestart {
+		restarts += fmt.Sprintf(" (auto-restart, at most %d)", proc.MaxRestarts)
+	}
+	fmt.Fprintf(w, "Restarts:\t%s\n", restarts)
+	fmt.Fprintf(w, "Type:\t%s\n", orDefault(proc.Type, types.ProcessTypeSimple))
+	fmt.Fprintf(w, "Command:\t%s\n", oneLine(strings.Join(append([]string{proc.Command}, proc.Args...), " ")))
+	fmt.Fprintf(w, "Working dir:\t%s\n", orDefault(proc.WorkingDir, "-"))
+	fmt.Fprintf(w, "Group:\t%s\n", orDefault(proc.Group, "-"))
+	fmt.Fprintf(w, "Labels:\t%s\n", orDefault(process.FormatLabels(proc.Labels), "-"))
+
+	// Only the names: values may be secrets.
+	var env []string
+	for key := range proc.Env {
+		env = append(env, key)
+	}
+	sort.Strings(env)
+	fmt.Fprintf(w, "Env:\t%s\n", orDefault(strings.Join(env, ", "), "-"))
+
+	var sockets []string
+	for _, socket := range proc.Sockets {
+		s := socket.Network + "://" + socket.Address
+		if socket.Name != "" {
+			s = socket.Name + "=" + s
+		}
+		sockets = append(sockets, s)
+	}
+	fmt.Fprintf(w, "Sockets:\t%s\n", orDefault(strings.Join(sockets, ", "), "-"))
+	if proc.Lazy {
+		fmt.Fprintf(w, "Lazy:\tyes, idle timeout %s\n", orDefault(durationString(proc.IdleTimeout), "default"))
+	}
+	if proc.Type == types.ProcessTypeForking {
+		fmt.Fprintf(w, "PID file:\t%s\n", proc.PIDFile)
+	}
+	if proc.Type == types.ProcessTypeNotify {
+		fmt.Fprintf(w, "Watchdog:\t%s\n", orDefault(durationString(proc.Watchdog), "-"))
+		fmt.Fprintf(w, "Ready timeout:\t%s\n", orDefault(durationString(proc.ReadyTimeout), "default"))
+	}
+	if proc.ResourceLimit != nil {
+		fmt.Fprintf(w, "Limits:\tmemory %d MB, cpu %.1f%%\n", proc.ResourceLimit.MemoryMB, proc.ResourceLimit.CPULimit)
+	}
+	fmt.Fprintf(w, "Log file:\t%s\n", orDefault(proc.LogFile, "-"))
+	if len(desc.LogRedactions) > 0 {
+		var counts []string
+		for rule, n := range desc.LogRedactions {
+			counts = append(counts, fmt.Sprintf("%s=%d", rule, n))
+		}
+		sort.Strings(counts)
+		fmt.Fprintf(w, "Log redactions:\t%s\n", strings.Join(counts, ", "))
+	}
+
+	health := desc.Health.Status
+	if desc.Health.Source != "" {
+		health += " [" + desc.Health.Source + "]"
+	}
+	if desc.Health.Detail != "" {
+		health += " " + desc.Health.Detail
+	}
+	fmt.Fprintf(w, "Health:\t%s\n", health)
+	if desc.Resources != nil {
+		fmt.Fprintf(w, "CPU:\t%.1f%%\n", desc.Resources.CPUPercent)
+		fmt.Fprintf(w, "Memory:\t%.1f MB (%.1f%%)\n", desc.Resources.MemoryMB, desc.Resources.MemoryPercent)
+	}
+	w.Flush()
+
+	if desc.Tree != nil {
+		fmt.Println("\nProcess tree:")
+		printProcessTree([]*monitor.ProcessInfo{desc.Tree}, wide)
+	}
+	if len(desc.Orphans) > 0 {
+		fmt.Println("\nAdopted orphans:")
+		printProcessTree(desc.Orphans, wide)
+	}
+
+	events := desc.Events
+	if !wide && len(events) > describeEvents {
+		events = events[len(events)-describeEvents:]
+	}
+	fmt.Println("\nEvents:")
+	printEvents(events)
+
+	fmt.Println("\nRestart history:")
+	printEvents(desc.RestartHistory)
+}
+
+func printProcessTree(trees []*monitor.ProcessInfo, wide bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := "  PID\tCPU%\tRSS\tTHREADS\tFDS\tCOMMAND"
+	if wide {
+		header = "  PID\tPPID\tSTATE\tCPU%\tCPU TIME\tRSS\tTHREADS\tFDS\tSTARTED\tCOMMAND"
+	}
+	fmt.Fprintln(w, header)
+	for _, tree := range trees {
+		tree.Walk(func(p *monitor.ProcessInfo, depth int) {
+			pid := fmt.Sprintf("  %s%d", strings.Repeat("  ", depth), p.PID)
+			rss := fmt.Sprintf("%.1fM", float64(p.RSSBytes)/(1024*1024))
+			if wide {
+				fmt.Fprintf(w, "%s\t%d\t%s\t%.1f\t%s\t%s\t%d\t%d\t%s\t%s\n", pid, p.PPID, p.State, p.CPUPercent,
+					p.CPUTime.Round(time.Millisecond), rss, p.Threads, p.FDs,
+					p.StartTime.Local().Format("15:04:05"), oneLine(p.Command))
+				return
+			}
+			fmt.Fprintf(w, "%s\t%.1f\t%s\t%d\t%d\t%s\n", pid, p.CPUPercent, rss, p.Threads, p.FDs, oneLine(p.Command))
+		})
+	}
+	w.Flush()
+}
+
+func printEvents(events []types.ProcessEvent) {
+	if len(events) == 0 {
+		fmt.Println("  <none>")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  TIME\tTYPE\tPID\tMESSAGE")
+	for _, event := range events {
+		pid := "-"
+		if event.PID > 0 {
+			pid = fmt.Sprintf("%d", event.PID)
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", event.Time.Local().Format("2006-01-02 15:04:05"), event.Type, pid, event.Message)
+	}
+	w.Flush()
+}
+
+// oneLine folds a command line that contains newlines into one line for
+// tables.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func durationString(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return d.String()
+}
+
+func describeHandler(conn *control.Conn, req *control.Request) error {
+	var params processParams
+	if err := req.Decode(&params); err != nil {
+		return err
+	}
+	desc, err := manager.Describe(params.ID)
+	if err != nil {
+		return err
+	}
+	return conn.Reply(desc)
+}
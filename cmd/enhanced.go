@@ -2,9 +2,13 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"os/signal"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"gproc/internal/control"
 	"gproc/internal/deployment"
 	"gproc/internal/probes"
 	"gproc/internal/scheduler"
@@ -172,46 +176,115 @@ func scheduleCmd() *cobra.Command {
 	var cronExpr string
 	var description string
 	var timeout string
+	var retries int
+	var workingDir string
+	var envVars []string
+	var timeZone string
+	var concurrency string
+	var missedRuns string
+	var maxMissed int
 	
 	cmd := &cobra.Command{
 		Use:   "schedule <task-name> <command> [args...]",
 		Short: "Schedule cron-style tasks",
-		Long: `Schedule tasks to run on a cron schedule.
+		Long: `Schedule tasks to run on a cron schedule. Tasks are executed by the daemon.
+Expressions take 5 fields (minute hour day month weekday), or 6 with a leading
+seconds field, and support ranges, steps, lists and month/weekday names.
 Examples:
-  gproc schedule backup ./backup.sh --cron "0 2 * * *"  # Daily at 2 AM
-  gproc schedule cleanup ./cleanup.py --cron "@hourly"   # Every hour`,
+  gproc schedule backup ./backup.sh --cron "0 2 * * *"              # Daily at 2 AM
+  gproc schedule cleanup ./cleanup.py --cron "@hourly"              # Every hour
+  gproc schedule report ./report.sh --cron "30 9 * * mon-fri" --tz Europe/Paris
+  gproc schedule ping ./ping.sh --cron "*/15 * * * * *"             # Every 15 seconds
+  gproc schedule sync ./sync.sh --cron "@every 90s"
+
+--concurrency decides what happens when a run is due while the previous one is
+still going: allow overlapping runs, forbid (skip the new run) or replace
+(cancel the old run). --missed decides what happens to runs that fell due while
+the daemon was down: skip them, run-once, or run-all (the most recent
+--max-missed of them, in order).
+
+Use 'gproc schedule list|history|run-now|pause|resume|remove' to manage tasks.`,
 		Args: cobra.MinimumNArgs(2),
 		Run: func(cmd *cobra.Command, args []string) {
 			taskName := args[0]
 			command := args[1]
 			taskArgs := args[2:]
 			
-			scheduler := scheduler.NewCronScheduler()
+			env := make(map[string]string)
+			for _, e := range envVars {
+				if parts := strings.SplitN(e, "=", 2); len(parts) == 2 {
+					env[parts[0]] = parts[1]
+				}
+			}
+			
+			var taskTimeout time.Duration
+			if timeout != "" && timeout != "0" {
+				d, err := time.ParseDuration(timeout)
+				if err != nil {
+					fmt.Printf("❌ Invalid timeout %q: %v\n", timeout, err)
+					return
+				}
+				taskTimeout = d
+			}
 			
 			task := &types.ScheduledTask{
-				Name:        taskName,
-				Command:     command,
-				Args:        taskArgs,
-				Cron:        cronExpr,
-				Enabled:     true,
-				Description: description,
+				Name:          taskName,
+				Command:       command,
+				Args:          taskArgs,
+				Cron:          cronExpr,
+				TimeZone:      timeZone,
+				Enabled:       true,
+				Timeout:       taskTimeout,
+				Retries:       retries,
+				Env:           env,
+				WorkingDir:    workingDir,
+				Description:   description,
+				Concurrency:   types.ConcurrencyPolicy(concurrency),
+				MissedRuns:    types.MissedRunPolicy(missedRuns),
+				MaxMissedRuns: maxMissed,
 			}
 			
-			err := scheduler.AddTask(task)
+			err := control.NewClient(control.SocketPath()).Call("schedule.add", task, task)
+			if err == control.ErrDaemonNotRunning {
+				// Validate and persist; the daemon picks the task up when it starts.
+				schedule, perr := scheduler.Validate(task)
+				if perr != nil {
+					fmt.Printf("❌ Error scheduling task: %v\n", perr)
+					return
+				}
+				task.NextRun = schedule.Next(time.Now())
+				err = manager.AddScheduledTask(task)
+				if err == nil {
+					fmt.Println("⚠️  Daemon is not running; the task will run once 'gproc daemon' is started")
+				}
+			}
 			if err != nil {
 				fmt.Printf("❌ Error scheduling task: %v\n", err)
 				return
 			}
 			
 			fmt.Printf("✅ Scheduled task '%s' with cron '%s'\n", taskName, cronExpr)
-			fmt.Printf("📅 Next run: %s\n", task.NextRun.Format("2006-01-02 15:04:05"))
+			if task.NextRun.IsZero() {
+				fmt.Println("📅 Next run: never")
+			} else {
+				fmt.Printf("📅 Next run: %s\n", task.NextRun.Format("2006-01-02 15:04:05 MST"))
+			}
 		},
 	}
 	
-	cmd.Flags().StringVar(&cronExpr, "cron", "@daily", "Cron expression (@hourly, @daily, @weekly, or custom)")
+	cmd.Flags().StringVar(&cronExpr, "cron", "@daily", "Cron expression (5 or 6 fields, @hourly, @daily, @weekly, @every <duration>)")
 	cmd.Flags().StringVar(&description, "desc", "", "Task description")
-	cmd.Flags().StringVar(&timeout, "timeout", "1h", "Task timeout")
+	cmd.Flags().StringVar(&timeout, "timeout", "1h", "Task timeout (0 for none)")
+	cmd.Flags().IntVar(&retries, "retries", 0, "Retry a failed run up to N times")
+	cmd.Flags().StringVar(&workingDir, "cwd", "", "Working directory")
+	cmd.Flags().StringSliceVar(&envVars, "env", []string{}, "Environment variables (KEY=VALUE)")
+	cmd.Flags().StringVar(&timeZone, "tz", "", "Time zone the expression is evaluated in (default: local)")
+	cmd.Flags().StringVar(&concurrency, "concurrency", "forbid", "Overlapping runs: allow, forbid or replace")
+	cmd.Flags().StringVar(&missedRuns, "missed", "skip", "Runs missed while the daemon was down: skip, run-once or run-all")
+	cmd.Flags().IntVar(&maxMissed, "max-missed", 10, "Maximum number of missed runs executed with --missed run-all")
 	
+	cmd.AddCommand(scheduleListCmd(), scheduleHistoryCmd(), scheduleRunNowCmd(),
+		schedulePauseCmd(), scheduleResumeCmd(), scheduleRemoveCmd())
 	return cmd
 }
 
@@ -219,11 +292,18 @@ func runOnceCmd() *cobra.Command {
 	var timeout string
 	var workingDir string
 	var envVars []string
+	var retries int
+	var backoff time.Duration
+	var grace time.Duration
+	var detach bool
 	
 	cmd := &cobra.Command{
 		Use:   "run <job-name> <command> [args...]",
 		Short: "Run one-off jobs",
-		Long:  "Execute one-time jobs with optional timeout and environment",
+		Long: `Execute one-time jobs under the daemon with captured logs, a timeout
+(graceful stop, then kill after --grace) and optional retries with exponential backoff.
+The command exits with the job's exit code; use --detach to print the job ID and
+manage the job with 'gproc jobs'.`,
 		Args:  cobra.MinimumNArgs(2),
 		Run: func(cmd *cobra.Command, args []string) {
 			jobName := args[0]
@@ -238,19 +318,76 @@ func runOnceCmd() *cobra.Command {
 				}
 			}
 			
-			fmt.Printf("🚀 Running one-off job: %s\n", jobName)
-			fmt.Printf("📝 Command: %s %s\n", command, strings.Join(jobArgs, " "))
+			var jobTimeout time.Duration
+			if timeout != "" && timeout != "0" {
+				d, err := time.ParseDuration(timeout)
+				if err != nil {
+					fmt.Printf("❌ Invalid timeout %q: %v\n", timeout, err)
+					os.Exit(2)
+				}
+				jobTimeout = d
+			}
 			
-			// This would integrate with the process manager to run the job
-			// For now, just show what would be executed
+			job := &types.Job{
+				Name:        jobName,
+				Command:     command,
+				Args:        jobArgs,
+				WorkingDir:  workingDir,
+				Env:         env,
+				Timeout:     jobTimeout,
+				GracePeriod: grace,
+				Retries:     retries,
+				Backoff:     backoff,
+			}
+			params := &jobRunParams{Job: job, Detach: detach}
+			client := control.NewClient(control.SocketPath())
 			
-			fmt.Printf("✅ Job '%s' completed\n", jobName)
+			if detach {
+				var started types.Job
+				if err := client.Call("job.run", params, &started); err != nil {
+					fmt.Printf("❌ Error starting job: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Println(started.ID)
+				return
+			}
+			
+			var started types.Job
+			conn, err := client.Stream("job.run", params, &started)
+			if err != nil {
+				fmt.Printf("❌ Error starting job: %v\n", err)
+				os.Exit(1)
+			}
+			defer conn.Close()
+			
+			fmt.Fprintf(os.Stderr, "🚀 Running one-off job %s: %s %s\n", started.ID, command, strings.Join(jobArgs, " "))
+			
+			// Ctrl+C cancels the job instead of abandoning it.
+			interrupt := make(chan os.Signal, 1)
+			signal.Notify(interrupt, os.Interrupt)
+			go func() {
+				<-interrupt
+				client.Call("job.cancel", &jobParams{ID: started.ID}, nil)
+			}()
+			
+			exit := copyJobOutput(conn)
+			if exit.Code == 0 {
+				fmt.Fprintf(os.Stderr, "✅ Job '%s' %s\n", started.ID, exit.Message)
+			} else {
+				fmt.Fprintf(os.Stderr, "❌ Job '%s' %s (exit code %d)\n", started.ID, exit.Message, exit.Code)
+			}
+			conn.Close()
+			os.Exit(exit.Code)
 		},
 	}
 	
-	cmd.Flags().StringVar(&timeout, "timeout", "1h", "Job timeout")
+	cmd.Flags().StringVar(&timeout, "timeout", "1h", "Job timeout (0 for none)")
 	cmd.Flags().StringVar(&workingDir, "cwd", "", "Working directory")
 	cmd.Flags().StringSliceVar(&envVars, "env", []string{}, "Environment variables (KEY=VALUE)")
+	cmd.Flags().IntVar(&retries, "retries", 0, "Retry a failed job up to N times")
+	cmd.Flags().DurationVar(&backoff, "backoff", time.Second, "Delay before the first retry, doubled on each further retry")
+	cmd.Flags().DurationVar(&grace, "grace", 10*time.Second, "Time between the stop signal and a forced kill on timeout or cancel")
+	cmd.Flags().BoolVarP(&detach, "detach", "d", false, "Start the job in the background and print its ID")
 	
 	return cmd
 }
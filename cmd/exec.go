@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gproc/internal/control"
+	"gproc/internal/process"
+)
+
+func execCmd() *cobra.Command {
+	var enterNS bool
+	var cgroup bool
+
+	cmd := &cobra.Command{
+		Use:   "exec <name> -- <command> [args...]",
+		Short: "Run a command with the environment, working directory and user of a process",
+		Long: `Run a command the way a managed process runs: with the environment,
+working directory and user of the running process or, when it is not
+running, those its spec resolves to. --ns also enters the namespaces of the
+running process (through nsenter) and --cgroup its cgroup.`,
+		Args: cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, err := execContext(args[0])
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			c, err := ctx.Command(args[1], args[2:], enterNS, cgroup)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			c.Stdin = os.Stdin
+			c.Stdout = os.Stdout
+			c.Stderr = os.Stderr
+
+			// The terminal sends ctrl-c to the command as well; the exit
+			// status is the command's.
+			interrupts := make(chan os.Signal, 1)
+			signal.Notify(interrupts, os.Interrupt)
+			go func() {
+				for range interrupts {
+				}
+			}()
+
+			err = c.Run()
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				os.Exit(exitErr.ExitCode())
+			}
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&enterNS, "ns", false, "Enter the namespaces of the running process")
+	cmd.Flags().BoolVar(&cgroup, "cgroup", false, "Run the command in the cgroup of the running process")
+	return cmd
+}
+
+func envCmd() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "env <name>",
+		Short: "Show the effective environment of a process, with secrets redacted",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := validOutput(output); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+
+			ctx, err := execContext(args[0])
+			if err != nil {
+				fmt.Printf("Error reading environment: %v\n", err)
+				return
+			}
+			ctx.Env = process.RedactEnv(ctx.Env)
+
+			err = printOutput(output, ctx, func(wide bool) {
+				if wide {
+					w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+					source := "spec (not running)"
+					if ctx.Source == "process" {
+						source = fmt.Sprintf("running process, PID %d", ctx.PID)
+					}
+					fmt.Fprintf(w, "# Source:\t%s\n", source)
+					fmt.Fprintf(w, "# Working dir:\t%s\n", ctx.Dir)
+					fmt.Fprintf(w, "# User:\tuid %d, gid %d\n", ctx.UID, ctx.GID)
+					w.Flush()
+				}
+				fmt.Println(strings.Join(ctx.Env, "\n"))
+			})
+			if err != nil {
+				fmt.Printf("Error reading environment: %v\n", err)
+			}
+		},
+	}
+
+	addOutputFlag(cmd, &output)
+	return cmd
+}
+
+// execContext asks the daemon for the context of a process: the daemon
+// environment is part of what a process is started with.
+func execContext(name string) (*process.ExecContext, error) {
+	var ctx *process.ExecContext
+	ok, err := daemonCall("exec.context", &processParams{ID: name}, &ctx)
+	if !ok {
+		ctx, err = manager.ExecContext(name)
+	}
+	return ctx, err
+}
+
+func execContextHandler(conn *control.Conn, req *control.Request) error {
+	var params processParams
+	if err := req.Decode(&params); err != nil {
+		return err
+	}
+	ctx, err := manager.ExecContext(params.ID)
+	if err != nil {
+		return err
+	}
+	return conn.Reply(ctx)
+}
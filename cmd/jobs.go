@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gproc/internal/control"
+	"gproc/pkg/types"
+)
+
+type jobRunParams struct {
+	Job    *types.Job `json:"job"`
+	Detach bool       `json:"detach"`
+}
+
+type jobParams struct {
+	ID     string `json:"id"`
+	Follow bool   `json:"follow,omitempty"`
+}
+
+func jobsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "jobs",
+		Short: "Manage one-off jobs started with 'gproc run'",
+	}
+
+	cmd.AddCommand(jobsListCmd(), jobsLogsCmd(), jobsCancelCmd())
+	return cmd
+}
+
+func jobsListCmd() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List recent jobs",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := validOutput(output); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			jobs := []*types.Job{}
+			if err := control.NewClient(control.SocketPath()).Call("job.list", nil, &jobs); err != nil {
+				fmt.Printf("Error listing jobs: %v\n", err)
+				return
+			}
+
+			err := printOutput(output, jobs, func(wide bool) {
+				if len(jobs) == 0 {
+					fmt.Println("No jobs")
+					return
+				}
+
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				header := "ID\tSTATUS\tATTEMPTS\tEXIT\tSTARTED\tDURATION"
+				if wide {
+					header += "\tPID\tCOMMAND\tERROR"
+				}
+				fmt.Fprintln(w, header)
+				for _, job := range jobs {
+					end := job.EndTime
+					if job.Status == types.JobRunning {
+						end = time.Now()
+					}
+					exit := ""
+					if job.Status != types.JobRunning {
+						exit = fmt.Sprintf("%d", job.ExitCode)
+					}
+					fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s",
+						job.ID, job.Status, job.Attempts, exit,
+						job.StartTime.Format("2006-01-02 15:04:05"),
+						end.Sub(job.StartTime).Round(time.Second))
+					if wide {
+						fmt.Fprintf(w, "\t%d\t%s\t%s", job.PID,
+							oneLine(strings.Join(append([]string{job.Command}, job.Args...), " ")), job.Error)
+					}
+					fmt.Fprintln(w)
+				}
+				w.Flush()
+			})
+			if err != nil {
+				fmt.Printf("Error listing jobs: %v\n", err)
+			}
+		},
+	}
+
+	addOutputFlag(cmd, &output)
+	return cmd
+}
+
+func jobsLogsCmd() *cobra.Command {
+	var follow bool
+
+	cmd := &cobra.Command{
+		Use:   "logs <job-id|job-name>",
+		Short: "Show the output of a job",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := control.NewClient(control.SocketPath())
+			conn, err := client.Stream("job.logs", &jobParams{ID: args[0], Follow: follow}, nil)
+			if err != nil {
+				fmt.Printf("Error reading job logs: %v\n", err)
+				return
+			}
+			defer conn.Close()
+			copyJobOutput(conn)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Keep streaming output until the job ends")
+	return cmd
+}
+
+func jobsCancelCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "cancel <job-id|job-name>",
+		Short: "Cancel a running job",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var job types.Job
+			if err := control.NewClient(control.SocketPath()).Call("job.cancel", &jobParams{ID: args[0]}, &job); err != nil {
+				fmt.Printf("Error cancelling job: %v\n", err)
+				return
+			}
+			fmt.Printf("Cancelled job %s (exit code %d)\n", job.ID, job.ExitCode)
+		},
+	}
+}
+
+// copyJobOutput writes streamed job output to stdout and returns the exit
+// status sent when the stream ends.
+func copyJobOutput(conn *control.Conn) *control.ExitStatus {
+	for {
+		typ, payload, err := conn.ReadFrame()
+		if err != nil {
+			return &control.ExitStatus{Code: 1, Message: "connection to daemon lost"}
+		}
+
+		switch typ {
+		case control.FrameData:
+			os.Stdout.Write(payload)
+		case control.FrameExit:
+			var exit control.ExitStatus
+			json.Unmarshal(payload, &exit)
+			return &exit
+		}
+	}
+}
+
+func jobRunHandler(conn *control.Conn, req *control.Request) error {
+	var params jobRunParams
+	if err := req.Decode(&params); err != nil {
+		return err
+	}
+	if params.Job == nil {
+		return fmt.Errorf("missing job")
+	}
+
+	job, err := manager.RunJob(params.Job)
+	if err != nil {
+		return err
+	}
+	if err := conn.Reply(job); err != nil || params.Detach {
+		return err
+	}
+	return streamJobOutput(conn, job.ID, true)
+}
+
+func jobListHandler(conn *control.Conn, req *control.Request) error {
+	return conn.Reply(manager.ListJobs())
+}
+
+func jobLogsHandler(conn *control.Conn, req *control.Request) error {
+	var params jobParams
+	if err := req.Decode(&params); err != nil {
+		return err
+	}
+
+	job, err := manager.GetJob(params.ID)
+	if err != nil {
+		return err
+	}
+	if err := conn.Reply(job); err != nil {
+		return err
+	}
+	return streamJobOutput(conn, job.ID, params.Follow)
+}
+
+func jobCancelHandler(conn *control.Conn, req *control.Request) error {
+	var params jobParams
+	if err := req.Decode(&params); err != nil {
+		return err
+	}
+
+	job, err := manager.CancelJob(params.ID)
+	if err != nil {
+		return err
+	}
+	return conn.Reply(job)
+}
+
+// streamJobOutput sends the job's log so far and, when following, its live
+// output, then an exit frame with the job's exit code.
+func streamJobOutput(conn *control.Conn, id string, follow bool) error {
+	job, offset, live, stop, err := manager.FollowJob(id)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	file, err := os.Open(job.LogFile)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(conn.FrameWriter(control.FrameData), io.LimitReader(file, offset))
+	file.Close()
+	if err != nil {
+		return nil
+	}
+
+	if !follow || live == nil {
+		if job, err = manager.GetJob(id); err != nil {
+			return err
+		}
+		return conn.WriteJSONFrame(control.FrameExit, jobExit(job))
+	}
+
+	for chunk := range live {
+		if err := conn.WriteFrame(control.FrameData, chunk); err != nil {
+			return nil
+		}
+	}
+
+	job, err = manager.WaitJob(id)
+	if err != nil {
+		return err
+	}
+	return conn.WriteJSONFrame(control.FrameExit, jobExit(job))
+}
+
+func jobExit(job *types.Job) *control.ExitStatus {
+	if job.Status == types.JobRunning {
+		return &control.ExitStatus{Message: string(job.Status)}
+	}
+	return &control.ExitStatus{Code: job.ExitCode, Message: string(job.Status)}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gproc/internal/control"
+	"gproc/internal/process"
+	"gproc/pkg/types"
+)
+
+type bulkParams struct {
+	Action   string `json:"action"`
+	Selector string `json:"selector"`
+	Parallel int    `json:"parallel,omitempty"`
+}
+
+type labelParams struct {
+	ID     string            `json:"id"`
+	Set    map[string]string `json:"set,omitempty"`
+	Remove []string          `json:"remove,omitempty"`
+}
+
+// selectProcesses returns the processes matching selector, from the daemon
+// when it is running.
+func selectProcesses(selector string) ([]types.Process, error) {
+	sel, err := process.ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	var processes []types.Process
+	if ok, err := daemonCall("list", nil, &processes); !ok {
+		return manager.Select(sel), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var matched []types.Process
+	for _, proc := range processes {
+		if sel.Matches(proc.Labels) {
+			matched = append(matched, proc)
+		}
+	}
+	return matched, nil
+}
+
+// runBulk runs action on every process matching selector and prints a
+// summary line per process.
+func runBulk(action, selector string, parallel int) {
+	if _, err := process.ParseSelector(selector); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	var results []process.BulkResult
+	ok, err := daemonCall("bulk", &bulkParams{Action: action, Selector: selector, Parallel: parallel}, &results)
+	if !ok {
+		sel, _ := process.ParseSelector(selector)
+		var ids []string
+		for _, proc := range manager.Select(sel) {
+			ids = append(ids, proc.ID)
+		}
+		results, err = manager.Bulk(action, ids, parallel)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if len(results) == 0 {
+		fmt.Printf("No processes match %q\n", selector)
+		return
+	}
+
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tRESULT")
+	for _, result := range results {
+		outcome := "ok"
+		if result.Error != "" {
+			outcome = "error: " + result.Error
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\n", result.Process, outcome)
+	}
+	w.Flush()
+	fmt.Printf("%s: %d succeeded, %d failed\n", action, len(results)-failed, failed)
+}
+
+func labelCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "label <name> key=value... [key-...]",
+		Short: "Add, change or remove labels of a process",
+		Long: `Add, change or remove labels of a process.
+
+  gproc label api app=api tier=web   set app and tier
+  gproc label api tier-              remove tier
+
+Labels are matched by the -l/--selector flag of list, stop, restart, logs
+and metrics.`,
+		Args: cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			params := labelParams{ID: args[0]}
+			var pairs []string
+			for _, arg := range args[1:] {
+				if key, ok := strings.CutSuffix(arg, "-"); ok && !strings.Contains(arg, "=") {
+					params.Remove = append(params.Remove, key)
+					continue
+				}
+				pairs = append(pairs, arg)
+			}
+			set, err := process.ParseLabels(pairs)
+			if err != nil {
+				fmt.Printf("Error labelling process: %v\n", err)
+				return
+			}
+			params.Set = set
+
+			var proc types.Process
+			ok, err := daemonCall("label", &params, &proc)
+			if !ok {
+				proc, err = manager.SetLabels(params.ID, params.Set, params.Remove)
+			}
+			if err != nil {
+				fmt.Printf("Error labelling process: %v\n", err)
+				return
+			}
+			fmt.Printf("Labels of %s: %s\n", proc.Name, orDefault(process.FormatLabels(proc.Labels), "<none>"))
+		},
+	}
+}
+
+func bulkHandler(conn *control.Conn, req *control.Request) error {
+	var params bulkParams
+	if err := req.Decode(&params); err != nil {
+		return err
+	}
+	sel, err := process.ParseSelector(params.Selector)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for _, proc := range manager.Select(sel) {
+		ids = append(ids, proc.ID)
+	}
+	results, err := manager.Bulk(params.Action, ids, params.Parallel)
+	if err != nil {
+		return err
+	}
+	return conn.Reply(results)
+}
+
+func labelHandler(conn *control.Conn, req *control.Request) error {
+	var params labelParams
+	if err := req.Decode(&params); err != nil {
+		return err
+	}
+	proc, err := manager.SetLabels(params.ID, params.Set, params.Remove)
+	if err != nil {
+		return err
+	}
+	return conn.Reply(&proc)
+}
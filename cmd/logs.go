@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gproc/internal/logger"
+	"gproc/internal/pty"
+	"gproc/pkg/types"
+)
+
+// prefixColors are the ANSI colors of the process name prefixes, assigned
+// in order.
+var prefixColors = []string{"36", "33", "32", "35", "34", "91", "92", "93", "94", "95", "96"}
+
+type logsOptions struct {
+	selector   string
+	all        bool
+	follow     bool
+	lines      int
+	since      string
+	until      string
+	grep       []string
+	exclude    []string
+	stream     string
+	level      string
+	fields     []string
+	timestamps bool
+	noColor    bool
+}
+
+func logsCmd() *cobra.Command {
+	var opts logsOptions
+
+	cmd := &cobra.Command{
+		Use:   "logs [name...] | -l <selector> | --all",
+		Short: "View process logs",
+		Long: `Show the logs of one or more processes, interleaved in time order with
+the name of the process in front of each line when there are several.
+Rotated files, compressed or not, are read as well; --follow keeps
+reading across rotations.
+
+Processes started with --log-format have their lines parsed into a
+level, a message and fields, which --level and --field select on. The
+daemon indexes them as it captures them, so such queries do not read the
+files unless they --follow.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			given := 0
+			for _, set := range []bool{len(args) > 0, opts.selector != "", opts.all} {
+				if set {
+					given++
+				}
+			}
+			if given != 1 {
+				return fmt.Errorf("give process names, a selector or --all")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			query, processes, err := logsQuery(cmd, args, &opts)
+			if err != nil {
+				fmt.Printf("Error reading logs: %v\n", err)
+				return
+			}
+			if len(query.Sources) == 0 {
+				fmt.Println("No processes match")
+				return
+			}
+
+			out := bufio.NewWriter(os.Stdout)
+			defer out.Flush()
+			prefixes := logPrefixes(query.Sources, !opts.noColor && os.Getenv("NO_COLOR") == "" && pty.IsTerminal(int(os.Stdout.Fd())))
+			print := func(e logger.Entry) error {
+				if opts.timestamps {
+					if e.Time.IsZero() {
+						fmt.Fprintf(out, "%-35s ", "-")
+					} else {
+						fmt.Fprintf(out, "%-35s ", e.Time.Local().Format(time.RFC3339Nano))
+					}
+				}
+				// Every line of a multi-line event gets the prefix.
+				prefix := prefixes[e.Process]
+				fmt.Fprintf(out, "%s%s\n", prefix, strings.ReplaceAll(formatEntry(&e), "\n", "\n"+prefix))
+				if opts.follow {
+					return out.Flush()
+				}
+				return nil
+			}
+			if (query.Filter.Level != "" || len(query.Filter.Fields) > 0) && !opts.follow {
+				// The daemon indexed the parsed entries.
+				entries, err := manager.QueryLogs(processes, query.Filter, query.Lines)
+				for _, e := range entries {
+					print(e)
+				}
+				if err != nil {
+					fmt.Printf("Error reading logs: %v\n", err)
+				}
+				return
+			}
+			if err := query.Run(print); err != nil {
+				fmt.Printf("Error reading logs: %v\n", err)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.follow, "follow", "f", false, "Keep printing new lines, across log rotations")
+	cmd.Flags().IntVarP(&opts.lines, "lines", "n", 20, "Number of lines to show per process, -1 for all (default all with --since or --until)")
+	cmd.Flags().BoolVar(&opts.all, "all", false, "Show the logs of every process")
+	cmd.Flags().StringVar(&opts.since, "since", "", "Only lines after this time: a duration ago (15m), a date, a time or RFC 3339")
+	cmd.Flags().StringVar(&opts.until, "until", "", "Only lines before this time, in the same forms as --since")
+	cmd.Flags().StringArrayVar(&opts.grep, "grep", nil, "Only lines matching this regular expression, repeatable (any matches)")
+	cmd.Flags().StringArrayVar(&opts.exclude, "exclude", nil, "Leave out lines matching this regular expression, repeatable")
+	cmd.Flags().StringVar(&opts.stream, "stream", "", "Only lines from this output stream: stdout or stderr")
+	cmd.Flags().StringVar(&opts.level, "level", "", "Only parsed lines at least this severe: trace, debug, info, warn, error or fatal")
+	cmd.Flags().StringArrayVar(&opts.fields, "field", nil, "Only parsed lines with this field value, key=value, repeatable (all must match)")
+	cmd.Flags().BoolVarP(&opts.timestamps, "timestamps", "t", false, "Show the time of each line")
+	cmd.Flags().BoolVar(&opts.noColor, "no-color", false, "Do not color the process names")
+	addSelectorFlag(cmd, &opts.selector)
+	cmd.AddCommand(logsSearchCmd())
+	return cmd
+}
+
+func logsSearchCmd() *cobra.Command {
+	var opts logsOptions
+	var limit, context int
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "search <text> [name...]",
+		Short: "Search the logs of indexed processes",
+		Long: `Search the full-text index of the logs of processes started with
+--log-search, best matches first, with the lines around each. All words
+of text must appear; "quoted words" match a phrase, and OR, NOT and
+prefix* work too. Without names or a selector every indexed process is
+searched.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := validOutput(output); err != nil {
+				fmt.Printf("Error searching logs: %v\n", err)
+				return
+			}
+			filter, err := logsFilter(&opts)
+			if err != nil {
+				fmt.Printf("Error searching logs: %v\n", err)
+				return
+			}
+			processes, err := logProcesses(args[1:], opts.selector)
+			if err != nil {
+				fmt.Printf("Error searching logs: %v\n", err)
+				return
+			}
+			if len(args) == 1 {
+				indexed := processes[:0]
+				for _, proc := range processes {
+					if proc.LogSearch != nil {
+						indexed = append(indexed, proc)
+					}
+				}
+				if processes = indexed; len(processes) == 0 {
+					fmt.Println("No processes are indexed for search, start them with --log-search")
+					return
+				}
+			}
+
+			hits, err := manager.SearchLogs(processes, args[0], filter, limit, context)
+			if err != nil {
+				fmt.Printf("Error searching logs: %v\n", err)
+				return
+			}
+			if hits == nil {
+				hits = []logger.Hit{}
+			}
+			err = printOutput(output, hits, func(wide bool) {
+				if len(hits) == 0 {
+					fmt.Println("No matches")
+					return
+				}
+				for i, hit := range hits {
+					if i > 0 {
+						fmt.Println()
+					}
+					header := hit.Process
+					if wide {
+						header += fmt.Sprintf("  rank %.2f", hit.Rank)
+					}
+					fmt.Println(header)
+					for _, e := range hit.Before {
+						printSearchLine(" ", &e)
+					}
+					printSearchLine(">", &hit.Entry)
+					for _, e := range hit.After {
+						printSearchLine(" ", &e)
+					}
+				}
+			})
+			if err != nil {
+				fmt.Printf("Error searching logs: %v\n", err)
+			}
+		},
+	}
+
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "Number of matches to show, -1 for all")
+	cmd.Flags().IntVarP(&context, "context", "C", 2, "Number of lines to show before and after each match")
+	cmd.Flags().StringVar(&opts.since, "since", "", "Only lines after this time: a duration ago (15m), a date, a time or RFC 3339")
+	cmd.Flags().StringVar(&opts.until, "until", "", "Only lines before this time, in the same forms as --since")
+	cmd.Flags().StringVar(&opts.stream, "stream", "", "Only lines from this output stream: stdout or stderr")
+	cmd.Flags().StringVar(&opts.level, "level", "", "Only parsed lines at least this severe: trace, debug, info, warn, error or fatal")
+	cmd.Flags().StringArrayVar(&opts.fields, "field", nil, "Only parsed lines with this field value, key=value, repeatable (all must match)")
+	addSelectorFlag(cmd, &opts.selector)
+	addOutputFlag(cmd, &output)
+	return cmd
+}
+
+// printSearchLine prints an entry of a search result, marked as a hit or
+// not, with the lines of a multi-line event aligned.
+func printSearchLine(marker string, e *logger.Entry) {
+	prefix := fmt.Sprintf("%s %-30s  ", marker, e.Time.Local().Format(time.RFC3339Nano))
+	indent := "\n" + strings.Repeat(" ", len(prefix))
+	fmt.Println(prefix + strings.ReplaceAll(formatEntry(e), "\n", indent))
+}
+
+// logsQuery turns the arguments and flags of 'gproc logs' into a query.
+func logsQuery(cmd *cobra.Command, names []string, opts *logsOptions) (*logger.Query, []types.Process, error) {
+	if opts.until != "" && opts.follow {
+		return nil, nil, fmt.Errorf("--until cannot be used with --follow")
+	}
+	filter, err := logsFilter(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	query := &logger.Query{Filter: filter, Lines: opts.lines, Follow: opts.follow}
+	if (opts.since != "" || opts.until != "") && !cmd.Flags().Changed("lines") {
+		query.Lines = -1
+	}
+
+	processes, err := logProcesses(names, opts.selector)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range processes {
+		query.Sources = append(query.Sources, manager.LogSource(&processes[i]))
+	}
+	return query, processes, nil
+}
+
+// logsFilter turns the filter flags of 'gproc logs' into a filter.
+func logsFilter(opts *logsOptions) (logger.Filter, error) {
+	var filter logger.Filter
+	now := time.Now()
+	var err error
+	if opts.since != "" {
+		if filter.Since, err = logger.ParseTime(opts.since, now); err != nil {
+			return filter, err
+		}
+	}
+	if opts.until != "" {
+		if filter.Until, err = logger.ParseTime(opts.until, now); err != nil {
+			return filter, err
+		}
+	}
+	switch opts.stream {
+	case "", logger.StreamStdout, logger.StreamStderr:
+		filter.Stream = opts.stream
+	default:
+		return filter, fmt.Errorf("unknown stream %q, expected stdout or stderr", opts.stream)
+	}
+	if opts.level != "" {
+		level := logger.NormalizeLevel(opts.level)
+		known := false
+		for _, l := range logger.Levels {
+			known = known || l == level
+		}
+		if !known {
+			return filter, fmt.Errorf("unknown level %q, expected one of %s", opts.level, strings.Join(logger.Levels, ", "))
+		}
+		filter.Level = level
+	}
+	for _, field := range opts.fields {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || key == "" {
+			return filter, fmt.Errorf("invalid --field %q, expected key=value", field)
+		}
+		if filter.Fields == nil {
+			filter.Fields = make(map[string]string)
+		}
+		filter.Fields[key] = value
+	}
+	for _, pattern := range opts.grep {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return filter, fmt.Errorf("invalid --grep pattern: %v", err)
+		}
+		filter.Include = append(filter.Include, re)
+	}
+	for _, pattern := range opts.exclude {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return filter, fmt.Errorf("invalid --exclude pattern: %v", err)
+		}
+		filter.Exclude = append(filter.Exclude, re)
+	}
+	return filter, nil
+}
+
+// logProcesses returns the processes named, by name or ID, among those
+// matching selector.
+func logProcesses(names []string, selector string) ([]types.Process, error) {
+	processes, err := selectProcesses(selector)
+	if err != nil || len(names) == 0 {
+		return processes, err
+	}
+	byName := make(map[string]types.Process)
+	for _, proc := range processes {
+		byName[proc.ID] = proc
+		byName[proc.Name] = proc
+	}
+	processes = processes[:0]
+	for _, name := range names {
+		proc, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("process %s not found", name)
+		}
+		processes = append(processes, proc)
+	}
+	return processes, nil
+}
+
+// formatEntry renders an entry, with its level and fields when it was
+// parsed.
+func formatEntry(e *logger.Entry) string {
+	line := e.Message
+	if e.Level != "" {
+		line = fmt.Sprintf("%-5s %s", strings.ToUpper(e.Level), line)
+	}
+	if len(e.Fields) > 0 {
+		line += " " + logger.FormatFields(e.Fields)
+	}
+	return line
+}
+
+// logPrefixes returns the name prefix of each process, padded to the
+// longest name, or no prefixes for a single process.
+func logPrefixes(sources []logger.Source, color bool) map[string]string {
+	prefixes := make(map[string]string)
+	if len(sources) < 2 {
+		return prefixes
+	}
+	width := 0
+	for _, src := range sources {
+		if len(src.Process) > width {
+			width = len(src.Process)
+		}
+	}
+	for i, src := range sources {
+		prefix := fmt.Sprintf("%-*s | ", width, src.Process)
+		if color {
+			prefix = "\x1b[" + prefixColors[i%len(prefixColors)] + "m" + prefix + "\x1b[0m"
+		}
+		prefixes[src.Process] = prefix
+	}
+	return prefixes
+}
@@ -4,13 +4,16 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"text/tabwriter"
 	"time"
 
 	"github.com/spf13/cobra"
 
+	"gproc/internal/control"
 	"gproc/internal/logger"
+	"gproc/internal/logging"
 	"gproc/internal/process"
 	"gproc/pkg/types"
 )
@@ -18,7 +21,12 @@ import (
 var manager *process.Manager
 
 func main() {
-	logDir := "./logs"
+	// Absolute, so that log paths recorded by the daemon work from any
+	// directory.
+	logDir, err := filepath.Abs("./logs")
+	if err != nil {
+		logDir = "./logs"
+	}
 	os.MkdirAll(logDir, 0755)
 	manager = process.NewManager(logDir)
 
@@ -32,9 +40,21 @@ func main() {
 		startCmd(),
 		stopCmd(),
 		listCmd(),
+		describeCmd(),
+		psCmd(),
+		execCmd(),
+		envCmd(),
 		logsCmd(),
 		restartCmd(),
+		reloadCmd(),
 		daemonCmd(),
+		attachCmd(),
+		runOnceCmd(),
+		jobsCmd(),
+		scheduleCmd(),
+		labelCmd(),
+		metricsCmd(),
+		alertsCmd(),
 	)
 
 	if err := rootCmd.Execute(); err != nil {
@@ -57,6 +77,28 @@ func startCmd() *cobra.Command {
 	var cpuLimit float64
 	var notifyEmail string
 	var notifySlack string
+	var tty bool
+	var procType string
+	var watchdog time.Duration
+	var readyTimeout time.Duration
+	var sockets []string
+	var lazy bool
+	var idleTimeout time.Duration
+	var labels []string
+	var pidFile string
+	var logFormat string
+	var logPattern string
+	var logSearch bool
+	var logRetention time.Duration
+	var multilineStart string
+	var multilineContinue string
+	var multilineTimeout time.Duration
+	var logOutput string
+	var syslogAddress string
+	var syslogFacility string
+	var syslogAppName string
+	var logRedact []string
+	var metricsEndpoint string
 
 	cmd := &cobra.Command{
 		Use:   "start <name> <command> [args...]",
@@ -95,6 +137,51 @@ func startCmd() *cobra.Command {
 				}
 			}
 			
+			// Parse the log format
+			var parser *types.LogParser
+			if logFormat != "" {
+				parser = &types.LogParser{Format: logFormat, Pattern: logPattern}
+			} else if logPattern != "" {
+				parser = &types.LogParser{Format: logger.FormatRegex, Pattern: logPattern}
+			}
+			
+			var multiline *types.LogMultiline
+			if multilineStart != "" || multilineContinue != "" {
+				multiline = &types.LogMultiline{
+					Start:        multilineStart,
+					Continuation: multilineContinue,
+					Timeout:      multilineTimeout,
+				}
+			}
+			var search *types.LogSearch
+			if logSearch || logRetention > 0 {
+				search = &types.LogSearch{Retention: logRetention}
+			}
+			var output *types.LogOutput
+			if logOutput != "" || syslogAddress != "" || syslogFacility != "" || syslogAppName != "" {
+				output = &types.LogOutput{Type: logOutput, Facility: syslogFacility, AppName: syslogAppName}
+				if output.Type == "" {
+					output.Type = logging.OutputSyslog
+				}
+				if network, address, ok := strings.Cut(syslogAddress, "://"); ok {
+					output.Network, output.Address = network, address
+				} else {
+					output.Address = syslogAddress
+				}
+			}
+			
+			var redaction *types.LogRedaction
+			for _, rule := range logRedact {
+				if redaction == nil {
+					redaction = &types.LogRedaction{}
+				}
+				if name, pattern, ok := strings.Cut(rule, "="); ok {
+					redaction.Rules = append(redaction.Rules, types.RedactionRule{Name: name, Pattern: pattern})
+				} else {
+					redaction.Detectors = append(redaction.Detectors, rule)
+				}
+			}
+			
 			// Parse resource limits
 			var rl *types.ResourceLimit
 			if memoryLimit != "" || cpuLimit > 0 {
@@ -111,6 +198,24 @@ func startCmd() *cobra.Command {
 				}
 			}
 			
+			// Parse listening sockets
+			var socketSpecs []types.Socket
+			for _, s := range sockets {
+				spec, err := process.ParseSocket(s)
+				if err != nil {
+					fmt.Printf("Error starting process: %v\n", err)
+					return
+				}
+				socketSpecs = append(socketSpecs, spec)
+			}
+			
+			// Parse labels
+			labelMap, err := process.ParseLabels(labels)
+			if err != nil {
+				fmt.Printf("Error starting process: %v\n", err)
+				return
+			}
+			
 			// Parse notifications
 			var notif *types.Notifications
 			if notifyEmail != "" || notifySlack != "" {
@@ -128,12 +233,55 @@ func startCmd() *cobra.Command {
 				WorkingDir:    workingDir,
 				Env:           env,
 				Group:         group,
+				Labels:        labelMap,
 				AutoRestart:   autoRestart,
 				MaxRestarts:   maxRestarts,
 				HealthCheck:   hc,
 				LogRotation:   lr,
+				LogParser:     parser,
+				LogSearch:     search,
+				LogMultiline:  multiline,
+				LogOutput:     output,
+				LogRedaction:  redaction,
+				MetricsEndpoint: metricsEndpoint,
 				ResourceLimit: rl,
 				Notifications: notif,
+				TTY:           tty,
+				Type:          procType,
+				Watchdog:      watchdog,
+				ReadyTimeout:  readyTimeout,
+				Sockets:       socketSpecs,
+				Lazy:          lazy,
+				IdleTimeout:   idleTimeout,
+				PIDFile:       pidFile,
+			}
+
+			// The daemon supervises the process when it is running. A pty,
+			// notify socket, listening sockets or a forked service must
+			// outlive this command, so those need it. So do parsing, joining,
+			// redacting, indexing and forwarding the output: without the
+			// daemon it goes straight to the log file.
+			if ok, err := daemonCall("start", proc, nil); ok || err != nil {
+				if err != nil {
+					fmt.Printf("Error starting process: %v\n", err)
+					return
+				}
+				if tty {
+					fmt.Printf("Started process %s with a tty, use 'gproc attach %s' to connect\n", args[0], args[0])
+					return
+				}
+				if lazy {
+					fmt.Printf("Process %s will start on the first connection\n", args[0])
+					return
+				}
+				fmt.Printf("Started process %s\n", args[0])
+				return
+			}
+			if tty || lazy || procType == types.ProcessTypeNotify || procType == types.ProcessTypeForking || len(socketSpecs) > 0 ||
+				parser != nil || multiline != nil || multilineTimeout > 0 || redaction != nil ||
+				search != nil || output != nil {
+				fmt.Printf("Error starting process: %v\n", control.ErrDaemonNotRunning)
+				return
 			}
 
 			if err := manager.Start(proc); err != nil {
@@ -149,93 +297,198 @@ func startCmd() *cobra.Command {
 	cmd.Flags().StringVar(&workingDir, "cwd", "", "Working directory")
 	cmd.Flags().StringSliceVar(&envVars, "env", []string{}, "Environment variables (KEY=VALUE)")
 	cmd.Flags().StringVar(&group, "group", "", "Process group name")
+	cmd.Flags().StringSliceVar(&labels, "label", []string{}, "Labels (KEY=VALUE), repeatable")
 	cmd.Flags().StringVar(&healthCheck, "health-check", "", "Health check URL")
 	cmd.Flags().StringVar(&healthInterval, "health-interval", "30s", "Health check interval")
 	cmd.Flags().StringVar(&logMaxSize, "log-max-size", "", "Maximum log file size (e.g., 100MB)")
 	cmd.Flags().IntVar(&logMaxFiles, "log-max-files", 5, "Maximum number of log files")
+	cmd.Flags().StringVar(&logFormat, "log-format", "", "Parse the output for level, message and fields: json, logfmt or regex (daemon only)")
+	cmd.Flags().StringVar(&multilineStart, "log-multiline-start", "", "Join multi-line events such as stack traces: regular expression of their first line, e.g. '^\\S' (daemon only)")
+	cmd.Flags().StringVar(&multilineContinue, "log-multiline-continue", "", "Regular expression of the following lines of a multi-line event, e.g. '^\\s+at |^Caused by:' (daemon only)")
+	cmd.Flags().DurationVar(&multilineTimeout, "log-multiline-timeout", 0, "End a multi-line event after this long without more lines (default 1s, daemon only)")
+	cmd.Flags().BoolVar(&logSearch, "log-search", false, "Index the output for 'gproc logs search' (daemon only)")
+	cmd.Flags().DurationVar(&logRetention, "log-retention", 0, "How long indexed output stays searchable, implies --log-search (default 168h, daemon only)")
+	cmd.Flags().StringVar(&logOutput, "log-output", "", "Also forward the output to syslog or journald, or none to ignore the output of the logging configuration (daemon only)")
+	cmd.Flags().StringVar(&syslogAddress, "syslog-address", "", "Syslog daemon as [network://]address, network unix, udp or tcp (default unix:///dev/log), implies --log-output syslog (daemon only)")
+	cmd.Flags().StringVar(&syslogFacility, "syslog-facility", "", "Syslog facility, e.g. daemon (the default), user or local0")
+	cmd.Flags().StringVar(&syslogAppName, "syslog-app-name", "", "Syslog app name or journal identifier (default the process name)")
+	cmd.Flags().StringArrayVar(&logRedact, "log-redact", nil, "Mask secrets in the output before it is logged: jwt, bearer, email, credit_card, all, or name=regex, repeatable (daemon only)")
+	cmd.Flags().StringVar(&logPattern, "log-pattern", "", "Regular expression with named groups (time, level, msg, others become fields) for --log-format regex")
+	cmd.Flags().StringVar(&metricsEndpoint, "metrics-endpoint", "", "Prometheus endpoint of the process to scrape and export with the daemon's metrics, a URL or [host]:port[/path] (default path /metrics), ${VAR} from its environment")
 	cmd.Flags().StringVar(&memoryLimit, "memory-limit", "", "Memory limit (e.g., 512MB)")
 	cmd.Flags().Float64Var(&cpuLimit, "cpu-limit", 0, "CPU limit percentage (e.g., 50.0)")
 	cmd.Flags().StringVar(&notifyEmail, "notify-email", "", "Email for notifications")
 	cmd.Flags().StringVar(&notifySlack, "notify-slack", "", "Slack webhook for notifications")
+	cmd.Flags().BoolVar(&tty, "tty", false, "Run under a pseudo-terminal in the daemon (see 'gproc attach')")
+	cmd.Flags().StringVar(&procType, "type", types.ProcessTypeSimple, "Process type: simple, notify to report readiness over NOTIFY_SOCKET (sd_notify), or forking for daemons that fork into the background")
+	cmd.Flags().StringVar(&pidFile, "pid-file", "", "Forking processes: file the service writes its PID to")
+	cmd.Flags().DurationVar(&watchdog, "watchdog", 0, "Notify processes: maximum time between WATCHDOG=1 pings before the process is restarted")
+	cmd.Flags().DurationVar(&readyTimeout, "ready-timeout", 0, "Notify processes: maximum time to send READY=1; forking processes: to write the PID file (default 90s)")
+	cmd.Flags().StringArrayVar(&sockets, "socket", nil, "Listening socket passed as LISTEN_FDS, [name=]network://address (e.g. http=tcp://:8080), repeatable")
+	cmd.Flags().BoolVar(&lazy, "lazy", false, "Hold the sockets and start the process on the first connection")
+	cmd.Flags().DurationVar(&idleTimeout, "idle-timeout", 0, "Lazy processes: stop after this long without connections (default 10m)")
 
 	return cmd
 }
 
 func stopCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "stop <name>",
+	var selector string
+	var parallel int
+
+	cmd := &cobra.Command{
+		Use:   "stop <name> | -l <selector>",
 		Short: "Stop a running process",
-		Args:  cobra.ExactArgs(1),
+		Args:  nameOrSelector(&selector),
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := manager.Stop(args[0]); err != nil {
+			if selector != "" {
+				runBulk("stop", selector, parallel)
+				return
+			}
+			ok, err := daemonCall("stop", &processParams{ID: args[0]}, nil)
+			if !ok {
+				err = manager.Stop(args[0])
+			}
+			if err != nil {
 				fmt.Printf("Error stopping process: %v\n", err)
 				return
 			}
 			fmt.Printf("Stopped process %s\n", args[0])
 		},
 	}
+
+	addSelectorFlag(cmd, &selector)
+	cmd.Flags().IntVar(&parallel, "parallel", process.DefaultBulkParallel, "With a selector: processes to stop at once")
+	return cmd
 }
 
 func listCmd() *cobra.Command {
-	return &cobra.Command{
+	var selector string
+	var showLabels bool
+	var output string
+
+	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List all processes",
 		Run: func(cmd *cobra.Command, args []string) {
-			processes := manager.List()
-			if len(processes) == 0 {
-				fmt.Println("No processes running")
+			if err := validOutput(output); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			processes, err := selectProcesses(selector)
+			if err != nil {
+				fmt.Printf("Error listing processes: %v\n", err)
 				return
 			}
+			sort.Slice(processes, func(i, j int) bool { return processes[i].Name < processes[j].Name })
 
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-			fmt.Fprintln(w, "NAME\tSTATUS\tPID\tRESTARTS\tUPTIME")
-			
-			for _, proc := range processes {
-				uptime := ""
-				if proc.Status == types.StatusRunning {
-					uptime = time.Since(proc.StartTime).Round(time.Second).String()
+			err = printOutput(output, processes, func(wide bool) {
+				if len(processes) == 0 {
+					if selector != "" {
+						fmt.Printf("No processes match %q\n", selector)
+						return
+					}
+					fmt.Println("No processes running")
+					return
 				}
-				
-				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n",
-					proc.Name, proc.Status, proc.PID, proc.Restarts, uptime)
-			}
-			w.Flush()
-		},
-	}
-}
 
-func logsCmd() *cobra.Command {
-	var lines int
-	
-	cmd := &cobra.Command{
-		Use:   "logs <name>",
-		Short: "View process logs",
-		Args:  cobra.ExactArgs(1),
-		Run: func(cmd *cobra.Command, args []string) {
-			logFile := filepath.Join("./logs", args[0]+".log")
-			if err := logger.TailFile(logFile, lines); err != nil {
-				fmt.Printf("Error reading logs: %v\n", err)
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				header := "NAME\tSTATUS\tPID\tRESTARTS\tUPTIME\tINFO"
+				if wide {
+					header += "\tTYPE\tGROUP\tSOCKETS\tCOMMAND"
+				}
+				if showLabels || wide {
+					header += "\tLABELS"
+				}
+				fmt.Fprintln(w, header)
+
+				for _, proc := range processes {
+					uptime := ""
+					status := string(proc.Status)
+					if proc.Status == types.StatusRunning {
+						uptime = time.Since(proc.StartTime).Round(time.Second).String()
+						if proc.Readiness != "" && proc.Readiness != types.ReadinessReady {
+							status += " (" + string(proc.Readiness) + ")"
+						}
+					}
+
+					fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s",
+						proc.Name, status, proc.PID, proc.Restarts, uptime, proc.StatusText)
+					if wide {
+						var sockets []string
+						for _, socket := range proc.Sockets {
+							sockets = append(sockets, socket.Network+"://"+socket.Address)
+						}
+						fmt.Fprintf(w, "\t%s\t%s\t%s\t%s",
+							orDefault(proc.Type, types.ProcessTypeSimple), orDefault(proc.Group, "-"),
+							orDefault(strings.Join(sockets, ","), "-"),
+							oneLine(strings.Join(append([]string{proc.Command}, proc.Args...), " ")))
+					}
+					if showLabels || wide {
+						fmt.Fprintf(w, "\t%s", process.FormatLabels(proc.Labels))
+					}
+					fmt.Fprintln(w)
+				}
+				w.Flush()
+			})
+			if err != nil {
+				fmt.Printf("Error listing processes: %v\n", err)
 			}
 		},
 	}
-	
-	cmd.Flags().IntVar(&lines, "lines", 20, "Number of lines to show")
+
+	addSelectorFlag(cmd, &selector)
+	addOutputFlag(cmd, &output)
+	cmd.Flags().BoolVar(&showLabels, "show-labels", false, "Show the labels of each process")
 	return cmd
 }
 
 func restartCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "restart <name>",
+	var selector string
+	var parallel int
+
+	cmd := &cobra.Command{
+		Use:   "restart <name> | -l <selector>",
 		Short: "Restart a process",
-		Args:  cobra.ExactArgs(1),
+		Args:  nameOrSelector(&selector),
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := manager.Restart(args[0]); err != nil {
+			if selector != "" {
+				runBulk("restart", selector, parallel)
+				return
+			}
+			ok, err := daemonCall("restart", &processParams{ID: args[0]}, nil)
+			if !ok {
+				err = manager.Restart(args[0])
+			}
+			if err != nil {
 				fmt.Printf("Error restarting process: %v\n", err)
 				return
 			}
 			fmt.Printf("Restarted process %s\n", args[0])
 		},
 	}
+
+	addSelectorFlag(cmd, &selector)
+	cmd.Flags().IntVar(&parallel, "parallel", process.DefaultBulkParallel, "With a selector: processes to restart at once")
+	return cmd
+}
+
+// addSelectorFlag adds the -l/--selector flag shared by the commands that
+// act on processes by label.
+func addSelectorFlag(cmd *cobra.Command, selector *string) {
+	cmd.Flags().StringVarP(selector, "selector", "l", "", "Label selector, e.g. app=api,tier!=batch")
+}
+
+// nameOrSelector accepts either a process name or a selector, not both.
+func nameOrSelector(selector *string) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if *selector != "" {
+			if len(args) > 0 {
+				return fmt.Errorf("give either a process name or a selector, not both")
+			}
+			return nil
+		}
+		return cobra.ExactArgs(1)(cmd, args)
+	}
 }
 
 // Command functions implemented in other files
\ No newline at end of file
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"go.yaml.in/yaml/v2"
+)
+
+// addOutputFlag adds the -o/--output flag of the read commands.
+func addOutputFlag(cmd *cobra.Command, output *string) {
+	cmd.Flags().StringVarP(output, "output", "o", "table", "Output format: table, wide, json, yaml or template=<go-template>")
+}
+
+// validOutput checks an -o value before any work is done.
+func validOutput(output string) error {
+	switch output {
+	case "table", "wide", "json", "yaml":
+		return nil
+	}
+	if text, ok := strings.CutPrefix(output, "template="); ok {
+		_, err := newOutputTemplate(text)
+		return err
+	}
+	return fmt.Errorf("unknown output format %q, expected table, wide, json, yaml or template=<go-template>", output)
+}
+
+// printOutput writes data in the machine-readable formats, or calls table
+// for table and wide.
+func printOutput(output string, data interface{}, table func(wide bool)) error {
+	switch output {
+	case "table", "":
+		table(false)
+		return nil
+	case "wide":
+		table(true)
+		return nil
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(data)
+	case "yaml":
+		out, err := toYAML(data)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+
+	text, ok := strings.CutPrefix(output, "template=")
+	if !ok {
+		return validOutput(output)
+	}
+	tmpl, err := newOutputTemplate(text)
+	if err != nil {
+		return err
+	}
+	// Templates see the JSON field names, like the json and yaml formats.
+	var generic interface{}
+	if err := roundTrip(data, &generic); err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, generic); err != nil {
+		return err
+	}
+	if out.Len() > 0 && !bytes.HasSuffix(out.Bytes(), []byte("\n")) {
+		out.WriteByte('\n')
+	}
+	_, err = out.WriteTo(os.Stdout)
+	return err
+}
+
+func newOutputTemplate(text string) (*template.Template, error) {
+	return template.New("output").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			out, err := json.Marshal(v)
+			return string(out), err
+		},
+		"join": func(sep string, values []interface{}) string {
+			parts := make([]string, len(values))
+			for i, v := range values {
+				parts[i] = fmt.Sprint(v)
+			}
+			return strings.Join(parts, sep)
+		},
+	}).Parse(text)
+}
+
+func roundTrip(data, v interface{}) error {
+	out, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(out))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// toYAML renders data as YAML with the JSON field names, in JSON order.
+func toYAML(data interface{}) ([]byte, error) {
+	out, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(out))
+	dec.UseNumber()
+	value, err := yamlValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(value)
+}
+
+// yamlValue reads the next JSON value, keeping the order of object keys.
+func yamlValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok := tok.(type) {
+	case json.Delim:
+		if tok == '{' {
+			object := yaml.MapSlice{}
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := yamlValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				object = append(object, yaml.MapItem{Key: key, Value: value})
+			}
+			_, err := dec.Token()
+			return object, err
+		}
+		array := []interface{}{}
+		for dec.More() {
+			value, err := yamlValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		_, err := dec.Token()
+		return array, err
+	case json.Number:
+		if n, err := tok.Int64(); err == nil {
+			return n, nil
+		}
+		return tok.Float64()
+	default:
+		return tok, nil
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/spf13/cobra"
+	"gproc/internal/control"
 	"gproc/pkg/types"
 )
 
@@ -14,8 +15,16 @@ func reloadCmd() *cobra.Command {
 		Use:   "reload <name>",
 		Short: "Zero-downtime reload of a process",
 		Args:  cobra.ExactArgs(1),
+		Long: `Start a new instance of the process on the same listening sockets, wait until
+it is ready (READY=1 for --type notify, otherwise 2 seconds up) and only then
+stop the old instance gracefully. The old instance keeps running if the new one
+fails to become ready. Requires the daemon.`,
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := manager.ZeroDowntimeReload(args[0]); err != nil {
+			ok, err := daemonCall("reload", &processParams{ID: args[0]}, nil)
+			if !ok {
+				err = control.ErrDaemonNotRunning
+			}
+			if err != nil {
 				fmt.Printf("Error reloading process: %v\n", err)
 				return
 			}
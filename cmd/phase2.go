@@ -2,35 +2,43 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
+	"gproc/internal/control"
+	"gproc/internal/process"
+	"gproc/pkg/types"
 )
 
 // Phase 2: Monitoring, Observability, Alerts, Metrics
 
 func metricsCmd() *cobra.Command {
+	var selector, output string
+
 	cmd := &cobra.Command{
 		Use:   "metrics <action> [process]",
 		Short: "View process metrics and historical data",
 		Args:  cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			action := args[0]
+			if err := validOutput(output); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
 			
 			switch action {
 			case "show":
-				if len(args) < 2 {
-					// Show all processes metrics
-					if err := manager.ShowAllMetrics(); err != nil {
-						fmt.Printf("Error showing metrics: %v\n", err)
-						return
-					}
-				} else {
-					// Show specific process metrics
-					processName := args[1]
-					if err := manager.ShowProcessMetrics(processName); err != nil {
-						fmt.Printf("Error showing metrics for %s: %v\n", processName, err)
-						return
-					}
+				processName := ""
+				if len(args) >= 2 {
+					processName = args[1]
+				}
+				if err := showMetrics(processName, selector, output); err != nil {
+					fmt.Printf("Error showing metrics: %v\n", err)
+					return
 				}
 				
 			case "history":
@@ -57,33 +65,138 @@ func metricsCmd() *cobra.Command {
 		},
 	}
 	
+	cmd.Flags().StringVarP(&selector, "selector", "l", "", "Label selector for show, e.g. app=api,tier!=batch")
+	addOutputFlag(cmd, &output)
 	return cmd
 }
 
+// showMetrics prints what the processes use now: all of them, the one
+// named or those matching selector, in the format of output.
+func showMetrics(processName, selector, output string) error {
+	var samples []process.ProcessSample
+	if ok, err := daemonCall("metrics.show", nil, &samples); !ok {
+		samples = manager.Measure()
+	} else if err != nil {
+		return err
+	}
+	
+	if selector != "" {
+		processes, err := selectProcesses(selector)
+		if err != nil {
+			return err
+		}
+		if len(processes) == 0 {
+			return fmt.Errorf("no processes match %q", selector)
+		}
+		selected := make(map[string]bool)
+		for _, proc := range processes {
+			selected[proc.ID] = true
+		}
+		samples = slices.DeleteFunc(samples, func(s process.ProcessSample) bool { return !selected[s.ID] })
+	} else if processName != "" {
+		samples = slices.DeleteFunc(samples, func(s process.ProcessSample) bool {
+			return s.Name != processName && s.ID != processName
+		})
+		if len(samples) == 0 {
+			return fmt.Errorf("process %s not found", processName)
+		}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].Name < samples[j].Name })
+	
+	return printOutput(output, samples, func(wide bool) {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		header := "NAME\tSTATUS\tPID\tCPU\tMEMORY\tTHREADS\tFDS\tRESTARTS\tUPTIME\tHEALTH"
+		if wide {
+			header += "\tGROUP\tMETRICS URL"
+		}
+		fmt.Fprintln(w, header)
+		for _, s := range samples {
+			if s.Status != types.StatusRunning {
+				fmt.Fprintf(w, "%s\t%s\t-\t-\t-\t-\t-\t%d\t-\t%s", s.Name, s.Status, s.Restarts, s.Health)
+			} else {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%.1f%%\t%.1f MB\t%d\t%d\t%d\t%s\t%s",
+					s.Name, s.Status, s.PID, s.CPUPercent, float64(s.RSSBytes)/(1024*1024),
+					s.Threads, s.FDs, s.Restarts, s.Uptime.Round(time.Second), s.Health)
+			}
+			if wide {
+				fmt.Fprintf(w, "\t%s\t%s", orDefault(s.Group, "-"), orDefault(s.MetricsURL, "-"))
+			}
+			fmt.Fprintln(w)
+		}
+		w.Flush()
+	})
+}
+
+func metricsShowHandler(conn *control.Conn, req *control.Request) error {
+	return conn.Reply(manager.Measure())
+}
+
 func alertsCmd() *cobra.Command {
+	var rule types.LogAlertRule
+	var verbose bool
+	var output string
+
 	cmd := &cobra.Command{
 		Use:   "alerts <action> [options]",
-		Short: "Manage alerts and notifications",
-		Args:  cobra.MinimumNArgs(1),
+		Short: "Manage alerts, notifications and log alert rules",
+		Long: `Manage alerts, notifications and log alert rules.
+
+Actions:
+  list                         Alerts raised, -v or -o wide with the log lines that raised them
+  ack <alert-id>               Acknowledge an alert
+  clear                        Clear all alerts
+  rules                        Log alert rules
+  add-rule <name> <pattern>    Alert when lines of the output match a regular expression
+  remove-rule <name>           Remove a log alert rule
+
+For example, alert on more than 50 timeouts of any api process in 5 minutes:
+
+  gproc alerts add-rule api-timeouts timeout --threshold 50 --window 5m -l app=api`,
+		Args: cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			action := args[0]
+			if err := validOutput(output); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
 			
 			switch action {
 			case "list":
-				alerts := manager.ListAlerts()
-				if len(alerts) == 0 {
-					fmt.Println("No active alerts")
+				var alerts []types.Alert
+				ok, err := daemonCall("alerts.list", nil, &alerts)
+				if !ok {
+					alerts = manager.ListAlerts()
+				} else if err != nil {
+					fmt.Printf("Error listing alerts: %v\n", err)
 					return
 				}
-				fmt.Println("Active alerts:")
-				for _, alert := range alerts {
-					status := "ACTIVE"
-					if alert.Acknowledged {
-						status = "ACK"
+				err = printOutput(output, alerts, func(wide bool) {
+					if len(alerts) == 0 {
+						fmt.Println("No active alerts")
+						return
+					}
+					fmt.Println("Active alerts:")
+					for _, alert := range alerts {
+						status := "ACTIVE"
+						if alert.Acknowledged {
+							status = "ACK"
+						}
+						name := ""
+						if alert.Name != "" {
+							name = alert.Name + " "
+						}
+						fmt.Printf("  [%s] %s %s%s - %s: %s (%s)\n", 
+							status, alert.ID, name, alert.Severity, alert.ProcessID, alert.Message, 
+							alert.Timestamp.Format("15:04:05"))
+						if verbose || wide {
+							for _, line := range alert.Lines {
+								fmt.Printf("      %s\n", line)
+							}
+						}
 					}
-					fmt.Printf("  [%s] %s - %s: %s (%s)\n", 
-						status, alert.Severity, alert.ProcessID, alert.Message, 
-						alert.Timestamp.Format("15:04:05"))
+				})
+				if err != nil {
+					fmt.Printf("Error listing alerts: %v\n", err)
 				}
 				
 			case "ack":
@@ -92,19 +205,90 @@ func alertsCmd() *cobra.Command {
 					return
 				}
 				alertID := args[1]
-				if err := manager.AcknowledgeAlert(alertID); err != nil {
+				ok, err := daemonCall("alerts.ack", &alertParams{ID: alertID}, nil)
+				if !ok {
+					err = manager.AcknowledgeAlert(alertID)
+				}
+				if err != nil {
 					fmt.Printf("Error acknowledging alert: %v\n", err)
 					return
 				}
 				fmt.Printf("Acknowledged alert %s\n", alertID)
 				
 			case "clear":
-				if err := manager.ClearAlerts(); err != nil {
+				ok, err := daemonCall("alerts.clear", nil, nil)
+				if !ok {
+					err = manager.ClearAlerts()
+				}
+				if err != nil {
 					fmt.Printf("Error clearing alerts: %v\n", err)
 					return
 				}
 				fmt.Println("All alerts cleared")
 				
+			case "rules":
+				var rules []types.LogAlertRule
+				ok, err := daemonCall("alerts.rules", nil, &rules)
+				if !ok {
+					rules = manager.LogAlertRules()
+				} else if err != nil {
+					fmt.Printf("Error listing log alert rules: %v\n", err)
+					return
+				}
+				err = printOutput(output, rules, func(wide bool) {
+					if len(rules) == 0 {
+						fmt.Println("No log alert rules")
+						return
+					}
+					w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(w, "NAME\tPATTERN\tTHRESHOLD\tWINDOW\tSCOPE\tSEVERITY")
+					for _, r := range rules {
+						scope := "all"
+						if r.Process != "" {
+							scope = r.Process
+						} else if r.Selector != "" {
+							scope = "-l " + r.Selector
+						}
+						fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", r.Name, r.Pattern, max(r.Threshold, 1),
+							orDefault(durationString(r.Window), "1m0s"), scope, orDefault(r.Severity, "warning"))
+					}
+					w.Flush()
+				})
+				if err != nil {
+					fmt.Printf("Error listing log alert rules: %v\n", err)
+				}
+				
+			case "add-rule":
+				if len(args) != 3 {
+					fmt.Println("Usage: alerts add-rule <name> <pattern> [--threshold n] [--window d] [--process name | -l selector] [--severity s]")
+					return
+				}
+				rule.Name, rule.Pattern = args[1], args[2]
+				ok, err := daemonCall("alerts.rules.add", &rule, nil)
+				if !ok {
+					err = manager.AddLogAlertRule(rule)
+				}
+				if err != nil {
+					fmt.Printf("Error adding log alert rule: %v\n", err)
+					return
+				}
+				fmt.Printf("Added log alert rule %s\n", rule.Name)
+				
+			case "remove-rule":
+				if len(args) != 2 {
+					fmt.Println("Usage: alerts remove-rule <name>")
+					return
+				}
+				ok, err := daemonCall("alerts.rules.remove", &alertParams{Name: args[1]}, nil)
+				if !ok {
+					err = manager.RemoveLogAlertRule(args[1])
+				}
+				if err != nil {
+					fmt.Printf("Error removing log alert rule: %v\n", err)
+					return
+				}
+				fmt.Printf("Removed log alert rule %s\n", args[1])
+				
 			case "config":
 				if err := manager.ConfigureAlerting(); err != nil {
 					fmt.Printf("Error configuring alerts: %v\n", err)
@@ -113,14 +297,74 @@ func alertsCmd() *cobra.Command {
 				fmt.Println("Alert configuration updated")
 				
 			default:
-				fmt.Println("Usage: alerts <list|ack|clear|config>")
+				fmt.Println("Usage: alerts <list|ack|clear|rules|add-rule|remove-rule|config>")
 			}
 		},
 	}
 	
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "list: show the log lines that raised each alert")
+	cmd.Flags().IntVar(&rule.Threshold, "threshold", 1, "add-rule: number of matching lines that raises the alert")
+	cmd.Flags().DurationVar(&rule.Window, "window", time.Minute, "add-rule: time within which the lines must match")
+	cmd.Flags().StringVar(&rule.Process, "process", "", "add-rule: watch only this process")
+	cmd.Flags().StringVarP(&rule.Selector, "selector", "l", "", "add-rule: watch the processes matching this label selector")
+	cmd.Flags().StringVar(&rule.Severity, "severity", "warning", "add-rule: severity of the alerts")
+	addOutputFlag(cmd, &output)
 	return cmd
 }
 
+type alertParams struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+func alertsListHandler(conn *control.Conn, req *control.Request) error {
+	return conn.Reply(manager.ListAlerts())
+}
+
+func alertsAckHandler(conn *control.Conn, req *control.Request) error {
+	var params alertParams
+	if err := req.Decode(&params); err != nil {
+		return err
+	}
+	if err := manager.AcknowledgeAlert(params.ID); err != nil {
+		return err
+	}
+	return conn.Reply(nil)
+}
+
+func alertsClearHandler(conn *control.Conn, req *control.Request) error {
+	if err := manager.ClearAlerts(); err != nil {
+		return err
+	}
+	return conn.Reply(nil)
+}
+
+func alertsRulesHandler(conn *control.Conn, req *control.Request) error {
+	return conn.Reply(manager.LogAlertRules())
+}
+
+func alertsRulesAddHandler(conn *control.Conn, req *control.Request) error {
+	var rule types.LogAlertRule
+	if err := req.Decode(&rule); err != nil {
+		return err
+	}
+	if err := manager.AddLogAlertRule(rule); err != nil {
+		return err
+	}
+	return conn.Reply(nil)
+}
+
+func alertsRulesRemoveHandler(conn *control.Conn, req *control.Request) error {
+	var params alertParams
+	if err := req.Decode(&params); err != nil {
+		return err
+	}
+	if err := manager.RemoveLogAlertRule(params.Name); err != nil {
+		return err
+	}
+	return conn.Reply(nil)
+}
+
 func profileCmd() *cobra.Command {
 	var duration string
 	var output string
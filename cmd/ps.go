@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gproc/internal/control"
+	"gproc/internal/monitor"
+	"gproc/internal/process"
+)
+
+func psCmd() *cobra.Command {
+	var tree bool
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "ps <name>",
+		Short: "Show every OS process of a process with its CPU and memory",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := validOutput(output); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+
+			var pt *process.ProcessTree
+			ok, err := daemonCall("ps", &processParams{ID: args[0]}, &pt)
+			if !ok {
+				pt, err = manager.Tree(args[0])
+			}
+			if err != nil {
+				fmt.Printf("Error listing process tree: %v\n", err)
+				return
+			}
+
+			err = printOutput(output, pt, func(wide bool) {
+				if pt.Tree == nil && len(pt.Orphans) == 0 {
+					fmt.Printf("Process %s is not running\n", pt.Process)
+					return
+				}
+				if pt.Tree != nil {
+					printPS([]*monitor.ProcessInfo{pt.Tree}, tree, wide)
+				}
+				if len(pt.Orphans) > 0 {
+					fmt.Println("\nAdopted orphans:")
+					printPS(pt.Orphans, tree, wide)
+				}
+				if pt.Resources != nil {
+					fmt.Printf("\nTotal: %.1f%% CPU, %.1f MB (%.1f%%)\n",
+						pt.Resources.CPUPercent, pt.Resources.MemoryMB, pt.Resources.MemoryPercent)
+				}
+			})
+			if err != nil {
+				fmt.Printf("Error listing process tree: %v\n", err)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&tree, "tree", false, "Indent each process under its parent")
+	addOutputFlag(cmd, &output)
+	return cmd
+}
+
+// printPS lists the processes of trees, flat with their parent PID or
+// indented as a tree.
+func printPS(trees []*monitor.ProcessInfo, tree, wide bool) {
+	if tree {
+		printProcessTree(trees, wide)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := "PID\tPPID\tSTATE\tCPU%\tRSS\tMEM%\tCOMMAND"
+	if wide {
+		header = "PID\tPPID\tPGID\tSID\tSTATE\tCPU%\tCPU TIME\tRSS\tMEM%\tTHREADS\tFDS\tSTARTED\tCOMMAND"
+	}
+	fmt.Fprintln(w, header)
+	for _, t := range trees {
+		t.Walk(func(p *monitor.ProcessInfo, depth int) {
+			rss := fmt.Sprintf("%.1fM", float64(p.RSSBytes)/(1024*1024))
+			if wide {
+				fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%s\t%.1f\t%s\t%s\t%.1f\t%d\t%d\t%s\t%s\n", p.PID, p.PPID, p.PGID, p.SID,
+					p.State, p.CPUPercent, p.CPUTime.Round(time.Millisecond), rss, p.MemoryPercent, p.Threads, p.FDs,
+					p.StartTime.Local().Format("15:04:05"), oneLine(p.Command))
+				return
+			}
+			fmt.Fprintf(w, "%d\t%d\t%s\t%.1f\t%s\t%.1f\t%s\n", p.PID, p.PPID, p.State, p.CPUPercent, rss,
+				p.MemoryPercent, oneLine(p.Command))
+		})
+	}
+	w.Flush()
+}
+
+func psHandler(conn *control.Conn, req *control.Request) error {
+	var params processParams
+	if err := req.Decode(&params); err != nil {
+		return err
+	}
+	pt, err := manager.Tree(params.ID)
+	if err != nil {
+		return err
+	}
+	return conn.Reply(pt)
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gproc/internal/control"
+	"gproc/internal/scheduler"
+	"gproc/pkg/types"
+)
+
+// scheduleHistoryFile holds the execution history of scheduled tasks.
+const scheduleHistoryFile = "gproc_schedule_history.json"
+
+// cronScheduler runs scheduled tasks inside the daemon.
+var cronScheduler = scheduler.NewCronScheduler()
+
+type scheduleParams struct {
+	Name  string `json:"name"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+// scheduleEntry is a task as shown by 'gproc schedule list'.
+type scheduleEntry struct {
+	Task    *types.ScheduledTask `json:"task"`
+	Running int                  `json:"running"`
+	Last    *types.TaskRun       `json:"last,omitempty"`
+}
+
+// startScheduler loads the persisted tasks, catching up on runs missed
+// while the daemon was down, and starts the scheduler.
+func startScheduler() {
+	history, err := scheduler.LoadHistory(scheduleHistoryFile)
+	if err != nil {
+		fmt.Printf("Failed to load schedule history: %v\n", err)
+		history, _ = scheduler.LoadHistory("")
+	}
+	cronScheduler.SetHistory(history)
+	cronScheduler.SetRunner(manager)
+	cronScheduler.SetStore(manager)
+
+	for _, task := range manager.ScheduledTasks() {
+		task := task
+		if err := cronScheduler.LoadTask(&task); err != nil {
+			fmt.Printf("Skipping scheduled task %s: %v\n", task.Name, err)
+		}
+	}
+	cronScheduler.Start()
+}
+
+func scheduleListCmd() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List scheduled tasks",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := validOutput(output); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			entries := []scheduleEntry{}
+			err := control.NewClient(control.SocketPath()).Call("schedule.list", nil, &entries)
+			if err == control.ErrDaemonNotRunning {
+				entries, err = localScheduleEntries()
+			}
+			if err != nil {
+				fmt.Printf("Error listing scheduled tasks: %v\n", err)
+				return
+			}
+
+			err = printOutput(output, entries, func(wide bool) {
+				if len(entries) == 0 {
+					fmt.Println("No scheduled tasks")
+					return
+				}
+
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				header := "NAME\tSCHEDULE\tSTATE\tNEXT RUN\tLAST RUN\tLAST STATUS\tCONCURRENCY\tMISSED RUNS"
+				if wide {
+					header += "\tTIMEOUT\tRETRIES\tCOMMAND"
+				}
+				fmt.Fprintln(w, header)
+				for _, entry := range entries {
+					task := entry.Task
+					state := "active"
+					if !task.Enabled {
+						state = "paused"
+					}
+					if entry.Running > 0 {
+						state = fmt.Sprintf("running (%d)", entry.Running)
+					}
+					schedule := task.Cron
+					if task.TimeZone != "" {
+						schedule += " (" + task.TimeZone + ")"
+					}
+					next := "-"
+					if task.Enabled && !task.NextRun.IsZero() {
+						next = task.NextRun.Local().Format("2006-01-02 15:04:05")
+					}
+					last, lastStatus := "-", "-"
+					if entry.Last != nil {
+						last = entry.Last.ScheduledAt.Local().Format("2006-01-02 15:04:05")
+						lastStatus = string(entry.Last.Status)
+						if entry.Last.Status != types.JobSkipped {
+							lastStatus = fmt.Sprintf("%s (%d)", entry.Last.Status, entry.Last.ExitCode)
+						}
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s",
+						task.Name, schedule, state, next, last, lastStatus,
+						orDefault(string(task.Concurrency), string(types.ConcurrencyForbid)),
+						orDefault(string(task.MissedRuns), string(types.MissedRunSkip)))
+					if wide {
+						timeout := "-"
+						if task.Timeout > 0 {
+							timeout = task.Timeout.String()
+						}
+						fmt.Fprintf(w, "\t%s\t%d\t%s", timeout, task.Retries,
+							oneLine(strings.Join(append([]string{task.Command}, task.Args...), " ")))
+					}
+					fmt.Fprintln(w)
+				}
+				w.Flush()
+			})
+			if err != nil {
+				fmt.Printf("Error listing scheduled tasks: %v\n", err)
+			}
+		},
+	}
+
+	addOutputFlag(cmd, &output)
+	return cmd
+}
+
+// localScheduleEntries reads the tasks and their history from disk when
+// the daemon is not running.
+func localScheduleEntries() ([]scheduleEntry, error) {
+	history, err := scheduler.LoadHistory(scheduleHistoryFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []scheduleEntry
+	for _, task := range manager.ScheduledTasks() {
+		task := task
+		entry := scheduleEntry{Task: &task}
+		if last, ok := history.Last(task.Name); ok {
+			entry.Last = &last
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Task.Name < entries[j].Task.Name })
+	return entries, nil
+}
+
+func scheduleHistoryCmd() *cobra.Command {
+	var limit int
+	var showLogs bool
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "history <task-name>",
+		Short: "Show past runs of a scheduled task",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := validOutput(output); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			runs := []types.TaskRun{}
+			err := control.NewClient(control.SocketPath()).Call("schedule.history", &scheduleParams{Name: args[0], Limit: limit}, &runs)
+			if err == control.ErrDaemonNotRunning {
+				var history *scheduler.History
+				if history, err = scheduler.LoadHistory(scheduleHistoryFile); err == nil {
+					runs = history.Runs(args[0], limit)
+				}
+			}
+			if err != nil {
+				fmt.Printf("Error reading history: %v\n", err)
+				return
+			}
+			if output != "table" && output != "wide" {
+				if runs == nil {
+					runs = []types.TaskRun{}
+				}
+				if err := printOutput(output, runs, nil); err != nil {
+					fmt.Printf("Error reading history: %v\n", err)
+				}
+				return
+			}
+			if len(runs) == 0 {
+				fmt.Printf("No runs recorded for %s\n", args[0])
+				return
+			}
+
+			if showLogs {
+				for _, run := range runs {
+					fmt.Printf("=== %s %s %s (exit code %d, %s) job %s\n",
+						run.ScheduledAt.Local().Format("2006-01-02 15:04:05"), run.Trigger, run.Status,
+						run.ExitCode, run.Duration.Round(time.Millisecond), orDefault(run.JobID, "-"))
+					if run.Error != "" {
+						fmt.Printf("error: %s\n", run.Error)
+					}
+					if run.LogExcerpt != "" {
+						fmt.Print(strings.TrimRight(run.LogExcerpt, "\n") + "\n")
+					}
+				}
+				return
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "SCHEDULED\tTRIGGER\tSTATUS\tEXIT\tDURATION\tJOB\tERROR")
+			for _, run := range runs {
+				exit := "-"
+				if run.Status != types.JobSkipped {
+					exit = fmt.Sprintf("%d", run.ExitCode)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					run.ScheduledAt.Local().Format("2006-01-02 15:04:05"), run.Trigger, run.Status, exit,
+					run.Duration.Round(time.Millisecond), orDefault(run.JobID, "-"), run.Error)
+			}
+			w.Flush()
+		},
+	}
+
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "Number of most recent runs to show (0 for all)")
+	cmd.Flags().BoolVar(&showLogs, "logs", false, "Show the end of each run's output")
+	addOutputFlag(cmd, &output)
+	return cmd
+}
+
+func scheduleRunNowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "run-now <task-name>",
+		Short: "Run a scheduled task immediately",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var job types.Job
+			if err := control.NewClient(control.SocketPath()).Call("schedule.run-now", &scheduleParams{Name: args[0]}, &job); err != nil {
+				fmt.Printf("❌ Error running task: %v\n", err)
+				return
+			}
+			fmt.Printf("🚀 Started %s as job %s\n", args[0], job.ID)
+			fmt.Printf("Follow its output with: gproc jobs logs -f %s\n", job.ID)
+		},
+	}
+}
+
+func schedulePauseCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "pause <task-name>",
+		Short: "Stop scheduling a task until it is resumed",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := control.NewClient(control.SocketPath()).Call("schedule.pause", &scheduleParams{Name: args[0]}, nil); err != nil {
+				fmt.Printf("❌ Error pausing task: %v\n", err)
+				return
+			}
+			fmt.Printf("⏸️  Paused scheduled task '%s'\n", args[0])
+		},
+	}
+}
+
+func scheduleResumeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "resume <task-name>",
+		Short: "Resume a paused task",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var task types.ScheduledTask
+			if err := control.NewClient(control.SocketPath()).Call("schedule.resume", &scheduleParams{Name: args[0]}, &task); err != nil {
+				fmt.Printf("❌ Error resuming task: %v\n", err)
+				return
+			}
+			fmt.Printf("▶️  Resumed scheduled task '%s'\n", args[0])
+			fmt.Printf("📅 Next run: %s\n", task.NextRun.Local().Format("2006-01-02 15:04:05 MST"))
+		},
+	}
+}
+
+func scheduleRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <task-name>",
+		Short: "Remove a scheduled task and its history",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := control.NewClient(control.SocketPath()).Call("schedule.remove", &scheduleParams{Name: args[0]}, nil); err != nil {
+				fmt.Printf("❌ Error removing task: %v\n", err)
+				return
+			}
+			fmt.Printf("🗑️  Removed scheduled task '%s'\n", args[0])
+		},
+	}
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+func scheduleAddHandler(conn *control.Conn, req *control.Request) error {
+	var task types.ScheduledTask
+	if err := req.Decode(&task); err != nil {
+		return err
+	}
+	if err := cronScheduler.AddTask(&task); err != nil {
+		return err
+	}
+	return conn.Reply(&task)
+}
+
+func scheduleListHandler(conn *control.Conn, req *control.Request) error {
+	history := cronScheduler.History()
+
+	entries := []scheduleEntry{}
+	for _, task := range cronScheduler.ListTasks() {
+		entry := scheduleEntry{Task: task, Running: cronScheduler.Running(task.Name)}
+		if last, ok := history.Last(task.Name); ok {
+			entry.Last = &last
+		}
+		entries = append(entries, entry)
+	}
+	return conn.Reply(entries)
+}
+
+func scheduleHistoryHandler(conn *control.Conn, req *control.Request) error {
+	var params scheduleParams
+	if err := req.Decode(&params); err != nil {
+		return err
+	}
+	if _, err := cronScheduler.GetTask(params.Name); err != nil {
+		return err
+	}
+	return conn.Reply(cronScheduler.History().Runs(params.Name, params.Limit))
+}
+
+func scheduleRunNowHandler(conn *control.Conn, req *control.Request) error {
+	var params scheduleParams
+	if err := req.Decode(&params); err != nil {
+		return err
+	}
+	job, err := cronScheduler.RunNow(params.Name)
+	if err != nil {
+		return err
+	}
+	return conn.Reply(job)
+}
+
+func schedulePauseHandler(conn *control.Conn, req *control.Request) error {
+	var params scheduleParams
+	if err := req.Decode(&params); err != nil {
+		return err
+	}
+	task, err := cronScheduler.Pause(params.Name)
+	if err != nil {
+		return err
+	}
+	return conn.Reply(task)
+}
+
+func scheduleResumeHandler(conn *control.Conn, req *control.Request) error {
+	var params scheduleParams
+	if err := req.Decode(&params); err != nil {
+		return err
+	}
+	task, err := cronScheduler.Resume(params.Name)
+	if err != nil {
+		return err
+	}
+	return conn.Reply(task)
+}
+
+func scheduleRemoveHandler(conn *control.Conn, req *control.Request) error {
+	var params scheduleParams
+	if err := req.Decode(&params); err != nil {
+		return err
+	}
+	if err := cronScheduler.RemoveTask(params.Name); err != nil {
+		return err
+	}
+	return conn.Reply(nil)
+}
@@ -104,10 +104,13 @@ export const useProcessStore = defineStore('processes', () => {
     }
   }
 
-  const getProcessLogs = async (processId: string, lines: number = 100) => {
+  // Pass the nextCursor of a page to get the lines before it.
+  const getProcessLogs = async (processId: string, lines: number = 100, cursor?: string) => {
     try {
-      const response = await axios.get(`/api/v1/processes/${processId}/logs?lines=${lines}`)
-      return { success: true, logs: response.data.logs }
+      const params: Record<string, string | number> = { tail: lines }
+      if (cursor) params.cursor = cursor
+      const response = await axios.get(`/api/v1/processes/${processId}/logs`, { params })
+      return { success: true, logs: response.data.entries, nextCursor: response.data.next_cursor }
     } catch (error: any) {
       return { success: false, error: error.response?.data?.message }
     }
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/smtp"
+	"strings"
+	"sync"
 	"time"
 
 	"gproc/pkg/types"
@@ -15,6 +17,8 @@ type AlertManager struct {
 	alerts    []types.Alert
 	config    *AlertConfig
 	notifiers map[string]Notifier
+	mutex     sync.Mutex
+	seq       int
 }
 
 type AlertConfig struct {
@@ -70,17 +74,27 @@ func NewAlertManager(config *AlertConfig) *AlertManager {
 }
 
 func (am *AlertManager) TriggerAlert(processID, alertType, message, severity string) error {
-	alert := types.Alert{
-		ID:           fmt.Sprintf("alert-%d", time.Now().Unix()),
-		ProcessID:    processID,
-		Type:         alertType,
-		Message:      message,
-		Severity:     severity,
-		Timestamp:    time.Now(),
-		Acknowledged: false,
+	return am.Raise(types.Alert{
+		ProcessID: processID,
+		Type:      alertType,
+		Message:   message,
+		Severity:  severity,
+	})
+}
+
+// Raise records an alert and notifies about it. It sets the ID and the
+// time of the alert when they are missing.
+func (am *AlertManager) Raise(alert types.Alert) error {
+	if alert.Timestamp.IsZero() {
+		alert.Timestamp = time.Now()
+	}
+	am.mutex.Lock()
+	if alert.ID == "" {
+		am.seq++
+		alert.ID = fmt.Sprintf("alert-%d-%d", alert.Timestamp.Unix(), am.seq)
 	}
-	
 	am.alerts = append(am.alerts, alert)
+	am.mutex.Unlock()
 	
 	// Send notifications
 	for _, notifier := range am.notifiers {
@@ -91,10 +105,14 @@ func (am *AlertManager) TriggerAlert(processID, alertType, message, severity str
 }
 
 func (am *AlertManager) GetAlerts() []types.Alert {
-	return am.alerts
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+	return append([]types.Alert{}, am.alerts...)
 }
 
 func (am *AlertManager) AcknowledgeAlert(alertID string) error {
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
 	for i := range am.alerts {
 		if am.alerts[i].ID == alertID {
 			am.alerts[i].Acknowledged = true
@@ -105,6 +123,8 @@ func (am *AlertManager) AcknowledgeAlert(alertID string) error {
 }
 
 func (am *AlertManager) ClearAlerts() {
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
 	am.alerts = []types.Alert{}
 }
 
@@ -122,9 +142,10 @@ Alert Details:
 - Severity: %s
 - Message: %s
 - Time: %s
-
+%s
 This is an automated alert from GProc.
-`, alert.ProcessID, alert.Type, alert.Severity, alert.Message, alert.Timestamp.Format("2006-01-02 15:04:05"))
+`, alert.ProcessID, alert.Type, alert.Severity, alert.Message, alert.Timestamp.Format("2006-01-02 15:04:05"),
+		alertLines(alert, "\nLog lines:\n", "  ", ""))
 	
 	msg := fmt.Sprintf("Subject: %s\r\n\r\n%s", subject, body)
 	
@@ -134,11 +155,26 @@ This is an automated alert from GProc.
 	return smtp.SendMail(addr, auth, e.config.SMTPUser, []string{"admin@example.com"}, []byte(msg))
 }
 
+// alertLines formats the log lines that raised an alert as a block with
+// each line indented, or returns "" for alerts without lines.
+func alertLines(alert *types.Alert, open, indent, close string) string {
+	if len(alert.Lines) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(open)
+	for _, line := range alert.Lines {
+		b.WriteString(indent + line + "\n")
+	}
+	b.WriteString(close)
+	return b.String()
+}
+
 // Slack Notifier Implementation
 func (s *SlackNotifier) Send(alert *types.Alert) error {
 	payload := map[string]interface{}{
-		"text": fmt.Sprintf("🚨 *GProc Alert*\n*Process:* %s\n*Severity:* %s\n*Message:* %s", 
-			alert.ProcessID, alert.Severity, alert.Message),
+		"text": fmt.Sprintf("🚨 *GProc Alert*\n*Process:* %s\n*Severity:* %s\n*Message:* %s%s", 
+			alert.ProcessID, alert.Severity, alert.Message, alertLines(alert, "\n```", "", "```")),
 		"username": "GProc",
 		"icon_emoji": ":warning:",
 	}
@@ -2,14 +2,18 @@ package api
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net"
+	"regexp"
 	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"gproc/internal/logger"
 	"gproc/internal/process"
 	"gproc/internal/security"
 	"gproc/pkg/types"
@@ -64,9 +68,21 @@ func (gs *GRPCServer) Start(ctx context.Context) error {
 	return nil
 }
 
+// Stop waits up to 5 seconds for the calls in progress, then closes the
+// ones left, such as the streams that follow logs or events.
 func (gs *GRPCServer) Stop() {
-	if gs.server != nil {
+	if gs.server == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
 		gs.server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		gs.server.Stop()
 	}
 }
 
@@ -205,28 +221,150 @@ func (gs *GRPCServer) RestartProcess(ctx context.Context, req *RestartProcessReq
 	return &RestartProcessResponse{Success: true, Message: "Process restarted"}, nil
 }
 
+// StreamLogs sends the last req.Lines entries of the log of a process that
+// pass the filters, all of them when negative, then with req.Follow the
+// new ones as the process writes them, across log rotations, until the
+// client goes away. Without req.Follow, 0 lines means 100, as in the REST
+// API.
 func (gs *GRPCServer) StreamLogs(req *StreamLogsRequest, stream ProcessService_StreamLogsServer) error {
 	user := stream.Context().Value("user").(*types.User)
 	if !gs.rbac.Authorize(user, "process", "read", fmt.Sprintf("process:%s", req.ProcessId)) {
 		return status.Errorf(codes.PermissionDenied, "insufficient permissions")
 	}
 
-	// Simulate log streaming
-	ticker := time.NewTicker(time.Second)
-	defer ticker.Stop()
+	proc := gs.manager.Get(req.ProcessId)
+	if proc == nil {
+		return status.Errorf(codes.NotFound, "process not found")
+	}
+
+	var filter logger.Filter
+	switch req.Stream {
+	case "", logger.StreamStdout, logger.StreamStderr:
+		filter.Stream = req.Stream
+	default:
+		return status.Errorf(codes.InvalidArgument, "unknown stream %q, expected stdout or stderr", req.Stream)
+	}
+	if req.Level != "" {
+		filter.Level = logger.NormalizeLevel(req.Level)
+	}
+	if req.Pattern != "" {
+		re, err := regexp.Compile(req.Pattern)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid pattern: %v", err)
+		}
+		filter.Include = []*regexp.Regexp{re}
+	}
+
+	send := func(e logger.Entry) error {
+		return stream.Send(&LogEntry{
+			ProcessId: proc.ID,
+			Timestamp: e.Time.Unix(),
+			Nanos:     int32(e.Time.Nanosecond()),
+			Stream:    e.Stream,
+			Level:     e.Level,
+			Message:   e.Message,
+			Fields:    e.Fields,
+		})
+	}
+
+	if !req.Follow {
+		lines := int(req.Lines)
+		if lines == 0 {
+			lines = defaultLogLines
+		}
+		entries, err := gs.manager.QueryLogs([]types.Process{*proc}, filter, lines)
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to read logs: %v", err)
+		}
+		for _, e := range entries {
+			if err := send(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	query := &logger.Query{
+		Sources: []logger.Source{gs.manager.LogSource(proc)},
+		Filter:  filter,
+		Lines:   int(req.Lines),
+		Follow:  true,
+		Stop:    stream.Context().Done(),
+	}
+	return query.Run(send)
+}
+
+// StreamEvents sends the lifecycle events of a process, or of every
+// process when req.ProcessId is empty, as they happen until the client
+// goes away: starts, exits, restarts, stops, reloads and the like. With
+// req.History the recorded events come first; req.Types limits the
+// events to those types.
+func (gs *GRPCServer) StreamEvents(req *StreamEventsRequest, stream ProcessService_StreamEventsServer) error {
+	user := stream.Context().Value("user").(*types.User)
+	resource := "*"
+	if req.ProcessId != "" {
+		resource = fmt.Sprintf("process:%s", req.ProcessId)
+	}
+	if !gs.rbac.Authorize(user, "process", "read", resource) {
+		return status.Errorf(codes.PermissionDenied, "insufficient permissions")
+	}
+
+	id := ""
+	if req.ProcessId != "" {
+		proc := gs.manager.Get(req.ProcessId)
+		if proc == nil {
+			return status.Errorf(codes.NotFound, "process not found")
+		}
+		id = proc.ID
+	}
+
+	history, live, stop := gs.manager.SubscribeEvents(id)
+	defer stop()
+
+	send := func(event types.ProcessEvent) error {
+		if len(req.Types) > 0 {
+			wanted := false
+			for _, kind := range req.Types {
+				if kind == event.Type {
+					wanted = true
+					break
+				}
+			}
+			if !wanted {
+				return nil
+			}
+		}
+		msg := &Event{
+			ProcessId: event.Process,
+			Timestamp: event.Time.Unix(),
+			Nanos:     int32(event.Time.Nanosecond()),
+			Type:      event.Type,
+			Message:   event.Message,
+			Pid:       int32(event.PID),
+		}
+		if event.ExitCode != nil {
+			msg.ExitCode = int32(*event.ExitCode)
+			msg.Exited = true
+		}
+		return stream.Send(msg)
+	}
 
+	if req.History {
+		for _, event := range history {
+			if err := send(event); err != nil {
+				return err
+			}
+		}
+	}
 	for {
 		select {
 		case <-stream.Context().Done():
 			return nil
-		case <-ticker.C:
-			logEntry := &LogEntry{
-				Timestamp: time.Now().Unix(),
-				Level:     "INFO",
-				Message:   fmt.Sprintf("Log message for process %s", req.ProcessId),
+		case event, ok := <-live:
+			if !ok {
+				return status.Errorf(codes.ResourceExhausted, "client fell behind the events")
 			}
-
-			if err := stream.Send(logEntry); err != nil {
+			if err := send(event); err != nil {
 				return err
 			}
 		}
@@ -317,114 +455,154 @@ func (w *wrappedStream) Context() context.Context {
 	return w.ctx
 }
 
-// Protocol Buffer message definitions would typically be in separate .proto files
-// For this example, I'm defining them as Go structs
+// The messages are plain Go structs rather than types generated from .proto
+// files, and go over the wire as JSON: clients call with
+// grpc.CallContentSubtype("json"), as the clients below do.
+
+// jsonCodec marshals the messages of the services as JSON.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+func (jsonCodec) Name() string { return "json" }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
 
 type ListProcessesRequest struct{}
 
 type ListProcessesResponse struct {
-	Processes []*Process
+	Processes []*Process `json:"processes"`
 }
 
 type Process struct {
-	Id        string
-	Name      string
-	Command   string
-	Args      []string
-	Status    string
-	Pid       int32
-	StartTime int64
-	Restarts  int32
+	Id        string   `json:"id"`
+	Name      string   `json:"name"`
+	Command   string   `json:"command"`
+	Args      []string `json:"args,omitempty"`
+	Status    string   `json:"status"`
+	Pid       int32    `json:"pid"`
+	StartTime int64    `json:"start_time"`
+	Restarts  int32    `json:"restarts"`
 }
 
 type GetProcessRequest struct {
-	Id string
+	Id string `json:"id"`
 }
 
 type GetProcessResponse struct {
-	Process *Process
+	Process *Process `json:"process"`
 }
 
 type StartProcessRequest struct {
-	Id string
+	Id string `json:"id"`
 }
 
 type StartProcessResponse struct {
-	Success bool
-	Message string
+	Success bool   `json:"success"`
+	Message string `json:"message"`
 }
 
 type StopProcessRequest struct {
-	Id string
+	Id string `json:"id"`
 }
 
 type StopProcessResponse struct {
-	Success bool
-	Message string
+	Success bool   `json:"success"`
+	Message string `json:"message"`
 }
 
 type RestartProcessRequest struct {
-	Id string
+	Id string `json:"id"`
 }
 
 type RestartProcessResponse struct {
-	Success bool
-	Message string
+	Success bool   `json:"success"`
+	Message string `json:"message"`
 }
 
 type StreamLogsRequest struct {
-	ProcessId string
+	ProcessId string `json:"process_id"`
+	Lines     int32  `json:"lines,omitempty"`   // entries of history to send first, -1 for all; 100 when 0 without Follow
+	Follow    bool   `json:"follow,omitempty"`  // then keep sending new entries
+	Level     string `json:"level,omitempty"`   // at least this severe, for processes with a log format
+	Pattern   string `json:"pattern,omitempty"` // regular expression the message must match
+	Stream    string `json:"stream,omitempty"`  // stdout or stderr, both when empty
 }
 
 type LogEntry struct {
-	Timestamp int64
-	Level     string
-	Message   string
+	ProcessId string            `json:"process_id"`
+	Timestamp int64             `json:"timestamp"` // Unix seconds
+	Nanos     int32             `json:"nanos"`
+	Stream    string            `json:"stream"`
+	Level     string            `json:"level,omitempty"`
+	Message   string            `json:"message"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
+type StreamEventsRequest struct {
+	ProcessId string   `json:"process_id,omitempty"` // all processes when empty
+	Types     []string `json:"types,omitempty"`      // started, exited, restarted, stopped, ...; all when empty
+	History   bool     `json:"history,omitempty"`    // send the recorded events first
+}
+
+type Event struct {
+	ProcessId string `json:"process_id"`
+	Timestamp int64  `json:"timestamp"` // Unix seconds
+	Nanos     int32  `json:"nanos"`
+	Type      string `json:"type"`
+	Message   string `json:"message"`
+	Pid       int32  `json:"pid,omitempty"`
+	ExitCode  int32  `json:"exit_code,omitempty"`
+	Exited    bool   `json:"exited,omitempty"` // ExitCode is set
 }
 
 type GetClusterStatusRequest struct{}
 
 type GetClusterStatusResponse struct {
-	Leader       string
-	NodeCount    int32
-	Healthy      bool
-	LastElection int64
+	Leader       string `json:"leader"`
+	NodeCount    int32  `json:"node_count"`
+	Healthy      bool   `json:"healthy"`
+	LastElection int64  `json:"last_election"`
 }
 
 type ListNodesRequest struct{}
 
 type ListNodesResponse struct {
-	Nodes []*ClusterNode
+	Nodes []*ClusterNode `json:"nodes"`
 }
 
 type ClusterNode struct {
-	Id      string
-	Address string
-	Role    string
-	Status  string
+	Id      string `json:"id"`
+	Address string `json:"address"`
+	Role    string `json:"role"`
+	Status  string `json:"status"`
 }
 
 type GetMetricsRequest struct{}
 
 type GetMetricsResponse struct {
-	ProcessesRunning int32
-	ProcessesTotal   int32
-	CpuUsage        float32
-	MemoryUsage     float32
-	Uptime          string
+	ProcessesRunning int32   `json:"processes_running"`
+	ProcessesTotal   int32   `json:"processes_total"`
+	CpuUsage         float32 `json:"cpu_usage"`
+	MemoryUsage      float32 `json:"memory_usage"`
+	Uptime           string  `json:"uptime"`
 }
 
 type StreamMetricsRequest struct{}
 
 type MetricsSnapshot struct {
-	Timestamp        int64
-	ProcessesRunning int32
-	ProcessesTotal   int32
-	CpuUsage        float32
-	MemoryUsage     float32
+	Timestamp        int64   `json:"timestamp"`
+	ProcessesRunning int32   `json:"processes_running"`
+	ProcessesTotal   int32   `json:"processes_total"`
+	CpuUsage         float32 `json:"cpu_usage"`
+	MemoryUsage      float32 `json:"memory_usage"`
 }
 
-// Service interfaces (would be generated from .proto files)
+// Service interfaces
 type ProcessServiceServer interface {
 	ListProcesses(context.Context, *ListProcessesRequest) (*ListProcessesResponse, error)
 	GetProcess(context.Context, *GetProcessRequest) (*GetProcessResponse, error)
@@ -432,6 +610,7 @@ type ProcessServiceServer interface {
 	StopProcess(context.Context, *StopProcessRequest) (*StopProcessResponse, error)
 	RestartProcess(context.Context, *RestartProcessRequest) (*RestartProcessResponse, error)
 	StreamLogs(*StreamLogsRequest, ProcessService_StreamLogsServer) error
+	StreamEvents(*StreamEventsRequest, ProcessService_StreamEventsServer) error
 }
 
 type ProcessService_StreamLogsServer interface {
@@ -439,6 +618,11 @@ type ProcessService_StreamLogsServer interface {
 	grpc.ServerStream
 }
 
+type ProcessService_StreamEventsServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
 type ClusterServiceServer interface {
 	GetClusterStatus(context.Context, *GetClusterStatusRequest) (*GetClusterStatusResponse, error)
 	ListNodes(context.Context, *ListNodesRequest) (*ListNodesResponse, error)
@@ -454,15 +638,202 @@ type MetricsService_StreamMetricsServer interface {
 	grpc.ServerStream
 }
 
-// Registration functions (would be generated)
+// unaryMethod describes a unary method of service that decodes a Req and
+// calls call on the implementation.
+func unaryMethod[S, Req any](service, name string, call func(S, context.Context, *Req) (interface{}, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := new(Req)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(srv.(S), ctx, req.(*Req))
+			}
+			if interceptor == nil {
+				return handler(ctx, in)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + service + "/" + name}
+			return interceptor(ctx, in, info, handler)
+		},
+	}
+}
+
+// serverStream sends the messages of a server-streaming method.
+type serverStream[Resp any] struct {
+	grpc.ServerStream
+}
+
+func (s *serverStream[Resp]) Send(m *Resp) error {
+	return s.ServerStream.SendMsg(m)
+}
+
+// streamMethod describes a server-streaming method of a service that
+// decodes a Req and calls call on the implementation.
+func streamMethod[S, Req, Resp any](name string, call func(S, *Req, *serverStream[Resp]) error) grpc.StreamDesc {
+	return grpc.StreamDesc{
+		StreamName:    name,
+		ServerStreams: true,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			in := new(Req)
+			if err := stream.RecvMsg(in); err != nil {
+				return err
+			}
+			return call(srv.(S), in, &serverStream[Resp]{stream})
+		},
+	}
+}
+
+const (
+	processServiceName = "gproc.ProcessService"
+	clusterServiceName = "gproc.ClusterService"
+	metricsServiceName = "gproc.MetricsService"
+)
+
+var ProcessService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: processServiceName,
+	HandlerType: (*ProcessServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unaryMethod(processServiceName, "ListProcesses", func(s ProcessServiceServer, ctx context.Context, req *ListProcessesRequest) (interface{}, error) {
+			return s.ListProcesses(ctx, req)
+		}),
+		unaryMethod(processServiceName, "GetProcess", func(s ProcessServiceServer, ctx context.Context, req *GetProcessRequest) (interface{}, error) {
+			return s.GetProcess(ctx, req)
+		}),
+		unaryMethod(processServiceName, "StartProcess", func(s ProcessServiceServer, ctx context.Context, req *StartProcessRequest) (interface{}, error) {
+			return s.StartProcess(ctx, req)
+		}),
+		unaryMethod(processServiceName, "StopProcess", func(s ProcessServiceServer, ctx context.Context, req *StopProcessRequest) (interface{}, error) {
+			return s.StopProcess(ctx, req)
+		}),
+		unaryMethod(processServiceName, "RestartProcess", func(s ProcessServiceServer, ctx context.Context, req *RestartProcessRequest) (interface{}, error) {
+			return s.RestartProcess(ctx, req)
+		}),
+	},
+	Streams: []grpc.StreamDesc{
+		streamMethod("StreamLogs", func(s ProcessServiceServer, req *StreamLogsRequest, stream *serverStream[LogEntry]) error {
+			return s.StreamLogs(req, stream)
+		}),
+		streamMethod("StreamEvents", func(s ProcessServiceServer, req *StreamEventsRequest, stream *serverStream[Event]) error {
+			return s.StreamEvents(req, stream)
+		}),
+	},
+}
+
+var ClusterService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: clusterServiceName,
+	HandlerType: (*ClusterServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unaryMethod(clusterServiceName, "GetClusterStatus", func(s ClusterServiceServer, ctx context.Context, req *GetClusterStatusRequest) (interface{}, error) {
+			return s.GetClusterStatus(ctx, req)
+		}),
+		unaryMethod(clusterServiceName, "ListNodes", func(s ClusterServiceServer, ctx context.Context, req *ListNodesRequest) (interface{}, error) {
+			return s.ListNodes(ctx, req)
+		}),
+	},
+}
+
+var MetricsService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: metricsServiceName,
+	HandlerType: (*MetricsServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unaryMethod(metricsServiceName, "GetMetrics", func(s MetricsServiceServer, ctx context.Context, req *GetMetricsRequest) (interface{}, error) {
+			return s.GetMetrics(ctx, req)
+		}),
+	},
+	Streams: []grpc.StreamDesc{
+		streamMethod("StreamMetrics", func(s MetricsServiceServer, req *StreamMetricsRequest, stream *serverStream[MetricsSnapshot]) error {
+			return s.StreamMetrics(req, stream)
+		}),
+	},
+}
+
+// Registration functions
 func RegisterProcessServiceServer(s *grpc.Server, srv ProcessServiceServer) {
-	// Implementation would be generated from .proto files
+	s.RegisterService(&ProcessService_ServiceDesc, srv)
 }
 
 func RegisterClusterServiceServer(s *grpc.Server, srv ClusterServiceServer) {
-	// Implementation would be generated from .proto files
+	s.RegisterService(&ClusterService_ServiceDesc, srv)
 }
 
 func RegisterMetricsServiceServer(s *grpc.Server, srv MetricsServiceServer) {
-	// Implementation would be generated from .proto files
-}
\ No newline at end of file
+	s.RegisterService(&MetricsService_ServiceDesc, srv)
+}
+
+// ClientStream receives the messages of a server-streaming method.
+type ClientStream[Resp any] struct {
+	grpc.ClientStream
+}
+
+func (s *ClientStream[Resp]) Recv() (*Resp, error) {
+	m := new(Resp)
+	if err := s.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ProcessServiceClient calls the process service of a daemon.
+type ProcessServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewProcessServiceClient(cc grpc.ClientConnInterface) *ProcessServiceClient {
+	return &ProcessServiceClient{cc: cc}
+}
+
+func (c *ProcessServiceClient) invoke(ctx context.Context, method string, in, out interface{}, opts []grpc.CallOption) error {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(jsonCodec{}.Name())}, opts...)
+	return c.cc.Invoke(ctx, "/"+processServiceName+"/"+method, in, out, opts...)
+}
+
+func (c *ProcessServiceClient) ListProcesses(ctx context.Context, in *ListProcessesRequest, opts ...grpc.CallOption) (*ListProcessesResponse, error) {
+	out := new(ListProcessesResponse)
+	return out, c.invoke(ctx, "ListProcesses", in, out, opts)
+}
+
+func (c *ProcessServiceClient) GetProcess(ctx context.Context, in *GetProcessRequest, opts ...grpc.CallOption) (*GetProcessResponse, error) {
+	out := new(GetProcessResponse)
+	return out, c.invoke(ctx, "GetProcess", in, out, opts)
+}
+
+func (c *ProcessServiceClient) StartProcess(ctx context.Context, in *StartProcessRequest, opts ...grpc.CallOption) (*StartProcessResponse, error) {
+	out := new(StartProcessResponse)
+	return out, c.invoke(ctx, "StartProcess", in, out, opts)
+}
+
+func (c *ProcessServiceClient) StopProcess(ctx context.Context, in *StopProcessRequest, opts ...grpc.CallOption) (*StopProcessResponse, error) {
+	out := new(StopProcessResponse)
+	return out, c.invoke(ctx, "StopProcess", in, out, opts)
+}
+
+func (c *ProcessServiceClient) RestartProcess(ctx context.Context, in *RestartProcessRequest, opts ...grpc.CallOption) (*RestartProcessResponse, error) {
+	out := new(RestartProcessResponse)
+	return out, c.invoke(ctx, "RestartProcess", in, out, opts)
+}
+
+func (c *ProcessServiceClient) StreamLogs(ctx context.Context, in *StreamLogsRequest, opts ...grpc.CallOption) (*ClientStream[LogEntry], error) {
+	return openStream[LogEntry](ctx, c.cc, &ProcessService_ServiceDesc.Streams[0], "/"+processServiceName+"/StreamLogs", in, opts)
+}
+
+func (c *ProcessServiceClient) StreamEvents(ctx context.Context, in *StreamEventsRequest, opts ...grpc.CallOption) (*ClientStream[Event], error) {
+	return openStream[Event](ctx, c.cc, &ProcessService_ServiceDesc.Streams[1], "/"+processServiceName+"/StreamEvents", in, opts)
+}
+
+// openStream calls a server-streaming method with in.
+func openStream[Resp any](ctx context.Context, cc grpc.ClientConnInterface, desc *grpc.StreamDesc, method string, in interface{}, opts []grpc.CallOption) (*ClientStream[Resp], error) {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(jsonCodec{}.Name())}, opts...)
+	stream, err := cc.NewStream(ctx, desc, method, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return &ClientStream[Resp]{stream}, nil
+}
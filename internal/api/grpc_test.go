@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"gproc/internal/process"
+	"gproc/internal/security"
+	"gproc/pkg/types"
+)
+
+// newTestManager returns a manager capturing logs with a finished process
+// "hello", which printed one and two.
+func newTestManager(t *testing.T) *process.Manager {
+	t.Helper()
+
+	// The manager keeps its configuration and metrics in the working
+	// directory.
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	logDir := filepath.Join(dir, "logs")
+	if err := os.Mkdir(logDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	manager := process.NewManager(logDir)
+	manager.EnableLogCapture()
+	t.Cleanup(manager.CloseLogs)
+	err = manager.Start(&types.Process{
+		ID:      "hello",
+		Name:    "hello",
+		Command: "sh",
+		Args:    []string{"-c", "echo one; echo two"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for manager.Get("hello").Status == types.StatusRunning {
+		if time.Now().After(deadline) {
+			t.Fatal("process hello did not exit")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return manager
+}
+
+// newTestGRPC serves the gRPC services of newTestManager over an in-memory
+// listener and returns a connection to it and a valid token.
+func newTestGRPC(t *testing.T) (*grpc.ClientConn, string) {
+	t.Helper()
+
+	manager := newTestManager(t)
+	jwt := &types.JWTConfig{Secret: "test", Expiration: time.Hour, Issuer: "gproc"}
+	tokens := security.NewTokenManager(jwt)
+	gs := NewGRPCServer(&types.GRPCConfig{Enabled: true}, manager, security.NewRBACManager(nil), tokens)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(gs.authInterceptor),
+		grpc.StreamInterceptor(gs.streamAuthInterceptor),
+	)
+	RegisterProcessServiceServer(server, gs)
+	lis := bufconn.Listen(1 << 20)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	token, err := tokens.GenerateToken(&types.User{ID: "1", Username: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, token
+}
+
+func TestStreamLogs(t *testing.T) {
+	conn, token := newTestGRPC(t)
+	client := NewProcessServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+
+	// Lines left at 0 gets the default tail rather than nothing.
+	stream, err := client.StreamLogs(ctx, &StreamLogsRequest{ProcessId: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	for {
+		entry, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.ProcessId != "hello" || entry.Stream != "stdout" || entry.Timestamp == 0 {
+			t.Errorf("unexpected entry %+v", entry)
+		}
+		messages = append(messages, entry.Message)
+	}
+	if len(messages) != 2 || messages[0] != "one" || messages[1] != "two" {
+		t.Fatalf("got messages %q, want one and two", messages)
+	}
+
+	stream, err = client.StreamLogs(ctx, &StreamLogsRequest{ProcessId: "hello", Lines: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := stream.Recv()
+	if err != nil || entry.Message != "two" {
+		t.Fatalf("got %+v, %v, want the last entry two", entry, err)
+	}
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Fatalf("got %v after the last entry, want EOF", err)
+	}
+}
+
+func TestStreamLogsErrors(t *testing.T) {
+	conn, token := newTestGRPC(t)
+	client := NewProcessServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, test := range []struct {
+		name string
+		ctx  context.Context
+		req  *StreamLogsRequest
+		code codes.Code
+	}{
+		{"no token", ctx, &StreamLogsRequest{ProcessId: "hello"}, codes.Unauthenticated},
+		{"unknown process", metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token),
+			&StreamLogsRequest{ProcessId: "nope"}, codes.NotFound},
+		{"bad pattern", metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token),
+			&StreamLogsRequest{ProcessId: "hello", Pattern: "("}, codes.InvalidArgument},
+	} {
+		stream, err := client.StreamLogs(test.ctx, test.req)
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		if status.Code(err) != test.code {
+			t.Errorf("%s: got %v, want %s", test.name, err, test.code)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gproc/internal/logger"
+	"gproc/internal/process"
+	"gproc/pkg/types"
+)
+
+// defaultLogLines is how many entries of each process a log query returns
+// when it does not say.
+const defaultLogLines = 100
+
+// handleQueryLogs answers GET /logs/query, the REST form of 'gproc logs'
+// without --follow:
+//
+//	/logs/query?process=api&level=error&field=request_id=abc&since=1h
+//
+// process is repeatable and defaults to the processes matching selector,
+// or all of them, that the user can read. field is repeatable; grep and
+// exclude are regular expressions on the message; lines limits the
+// entries per process, -1 for all.
+func (rs *RESTServer) handleQueryLogs(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	filter, err := parseLogFilter(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lines := defaultLogLines
+	if value := params.Get("lines"); value != "" {
+		if lines, err = strconv.Atoi(value); err != nil {
+			http.Error(w, fmt.Sprintf("invalid lines %q", value), http.StatusBadRequest)
+			return
+		}
+	}
+
+	processes, ok := rs.logProcesses(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := rs.manager.QueryLogs(processes, filter, lines)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []logger.Entry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"entries": entries})
+}
+
+// handleGetLogs answers GET /processes/{id}/logs with the log of one
+// process, newest page first:
+//
+//	/processes/api/logs?tail=200&grep=timeout
+//	/processes/api/logs?tail=200&grep=timeout&cursor=<next_cursor>
+//
+// tail (or lines) is the number of entries of a page, -1 for all of them,
+// and cursor the next_cursor of the previous page, which continues with
+// the entries before it; the filters are those of /logs/query. With
+// follow=true the last tail entries are followed by the new ones as the
+// process writes them, as Server-Sent Events when the client accepts
+// text/event-stream and as newline-delimited JSON otherwise, until the
+// client goes away.
+func (rs *RESTServer) handleGetLogs(w http.ResponseWriter, r *http.Request) {
+	processID := mux.Vars(r)["id"]
+	user := r.Context().Value("user").(*types.User)
+	if !rs.rbac.Authorize(user, "process", "read", fmt.Sprintf("process:%s", processID)) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	proc := rs.manager.Get(processID)
+	if proc == nil {
+		http.Error(w, fmt.Sprintf("Process %s not found", processID), http.StatusNotFound)
+		return
+	}
+
+	params := r.URL.Query()
+	filter, err := parseLogFilter(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tail := defaultLogLines
+	value := params.Get("tail")
+	if value == "" {
+		// lines, as in /logs/query, for older clients.
+		value = params.Get("lines")
+	}
+	if value != "" {
+		if tail, err = strconv.Atoi(value); err != nil || tail < -1 {
+			http.Error(w, fmt.Sprintf("invalid tail %q", value), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if follow, _ := strconv.ParseBool(params.Get("follow")); follow {
+		if !filter.Until.IsZero() || params.Get("cursor") != "" {
+			http.Error(w, "until and cursor cannot be used with follow", http.StatusBadRequest)
+			return
+		}
+		rs.followLogs(w, r, proc, filter, tail)
+		return
+	}
+
+	var cursor logCursor
+	if value := params.Get("cursor"); value != "" {
+		if cursor, err = parseLogCursor(value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		until := cursor.time
+		if until.IsZero() {
+			// A zero Until is no bound at all. Entries without a time
+			// are the only ones not after the next instant.
+			until = until.Add(time.Nanosecond)
+		}
+		if filter.Until.IsZero() || until.Before(filter.Until) {
+			filter.Until = until
+		}
+	}
+
+	// Entries at the time of the cursor that the previous page already
+	// returned come last; read them and one more entry to know whether
+	// there are older pages.
+	lines := tail
+	if lines >= 0 {
+		lines += cursor.skip + 1
+	}
+	entries, err := rs.manager.QueryLogs([]types.Process{*proc}, filter, lines)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if cursor.skip > 0 {
+		entries = entries[:max(len(entries)-cursor.skip, 0)]
+	}
+	response := map[string]interface{}{"process": proc.ID}
+	if tail >= 0 && len(entries) > tail {
+		entries = entries[len(entries)-tail:]
+		if len(entries) > 0 {
+			response["next_cursor"] = newLogCursor(entries, cursor).String()
+		}
+	}
+	if entries == nil {
+		entries = []logger.Entry{}
+	}
+	response["entries"] = entries
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// followLogs streams the last tail entries of the log of proc that pass
+// the filter and then the new ones.
+func (rs *RESTServer) followLogs(w http.ResponseWriter, r *http.Request, proc *types.Process, filter logger.Filter, tail int) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	sse := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	query := &logger.Query{
+		Sources: []logger.Source{rs.manager.LogSource(proc)},
+		Filter:  filter,
+		Lines:   tail,
+		Follow:  true,
+		Stop:    r.Context().Done(),
+	}
+	query.Run(func(e logger.Entry) error {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if sse {
+			_, err = fmt.Fprintf(w, "event: log\ndata: %s\n\n", data)
+		} else {
+			_, err = fmt.Fprintf(w, "%s\n", data)
+		}
+		if err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+}
+
+// logCursor is where a page of a log ends: before the entries at time,
+// leaving out the last skip of those, which earlier pages returned. Lines
+// logged without a time, by a process started without the daemon, are
+// all at the zero time, so that skip is their offset from the last one.
+type logCursor struct {
+	time time.Time
+	skip int
+}
+
+// newLogCursor returns the cursor continuing before a page of entries in
+// time order, read from prev.
+func newLogCursor(page []logger.Entry, prev logCursor) logCursor {
+	c := logCursor{time: page[0].Time}
+	if c.time.Equal(prev.time) {
+		// More than a page at one time: skip those of earlier pages too.
+		c.skip = prev.skip
+	}
+	for _, e := range page {
+		if e.Time.Equal(c.time) {
+			c.skip++
+		}
+	}
+	return c
+}
+
+// zeroCursorTime stands for the zero time in a cursor, which has no
+// UnixNano.
+const zeroCursorTime = "z"
+
+func (c logCursor) String() string {
+	at := zeroCursorTime
+	if !c.time.IsZero() {
+		at = strconv.FormatInt(c.time.UnixNano(), 10)
+	}
+	value := fmt.Sprintf("%s.%d", at, c.skip)
+	return base64.RawURLEncoding.EncodeToString([]byte(value))
+}
+
+func parseLogCursor(value string) (logCursor, error) {
+	var c logCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return c, fmt.Errorf("invalid cursor %q", value)
+	}
+	at, skip, ok := strings.Cut(string(data), ".")
+	if !ok {
+		return c, fmt.Errorf("invalid cursor %q", value)
+	}
+	if c.skip, err = strconv.Atoi(skip); err != nil || c.skip < 0 {
+		return c, fmt.Errorf("invalid cursor %q", value)
+	}
+	if at != zeroCursorTime {
+		n, err := strconv.ParseInt(at, 10, 64)
+		if err != nil {
+			return c, fmt.Errorf("invalid cursor %q", value)
+		}
+		c.time = time.Unix(0, n)
+	}
+	return c, nil
+}
+
+// handleSearchLogs answers GET /logs/search, the REST form of 'gproc logs
+// search':
+//
+//	/logs/search?q=connection+reset&since=24h&context=2
+//
+// q is in the full-text query syntax; the processes are chosen as for
+// /logs/query, except that without process only the indexed ones are
+// searched. limit is the number of hits, context the entries before and
+// after each, and the filters are those of /logs/query.
+func (rs *RESTServer) handleSearchLogs(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	text := params.Get("q")
+	if text == "" {
+		http.Error(w, "Missing q parameter", http.StatusBadRequest)
+		return
+	}
+	filter, err := parseLogFilter(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, context := 20, 2
+	for name, value := range map[string]*int{"limit": &limit, "context": &context} {
+		if param := params.Get(name); param != "" {
+			if *value, err = strconv.Atoi(param); err != nil {
+				http.Error(w, fmt.Sprintf("invalid %s %q", name, param), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	processes, ok := rs.logProcesses(w, r)
+	if !ok {
+		return
+	}
+	if len(params["process"]) == 0 {
+		indexed := processes[:0]
+		for _, proc := range processes {
+			if proc.LogSearch != nil {
+				indexed = append(indexed, proc)
+			}
+		}
+		processes = indexed
+	}
+
+	hits := []logger.Hit{}
+	if len(processes) > 0 {
+		found, err := rs.manager.SearchLogs(processes, text, filter, limit, context)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		hits = append(hits, found...)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"hits": hits})
+}
+
+// logProcesses returns the processes of a log request the user may read:
+// those given by process, or those matching selector, or all of them. It
+// answers the request itself when it cannot.
+func (rs *RESTServer) logProcesses(w http.ResponseWriter, r *http.Request) ([]types.Process, bool) {
+	user := r.Context().Value("user").(*types.User)
+	params := r.URL.Query()
+
+	var processes []types.Process
+	if ids := params["process"]; len(ids) > 0 {
+		for _, id := range ids {
+			if !rs.rbac.Authorize(user, "process", "read", fmt.Sprintf("process:%s", id)) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return nil, false
+			}
+			proc := rs.manager.Get(id)
+			if proc == nil {
+				http.Error(w, fmt.Sprintf("Process %s not found", id), http.StatusNotFound)
+				return nil, false
+			}
+			processes = append(processes, *proc)
+		}
+		return processes, true
+	}
+
+	selector, err := process.ParseSelector(params.Get("selector"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	for _, proc := range rs.manager.Select(selector) {
+		if rs.rbac.Authorize(user, "process", "read", fmt.Sprintf("process:%s", proc.ID)) {
+			processes = append(processes, proc)
+		}
+	}
+	return processes, true
+}
+
+// parseLogFilter reads a log filter from query parameters: since, until,
+// stream, level, field (key=value), grep and exclude.
+func parseLogFilter(params url.Values) (logger.Filter, error) {
+	var filter logger.Filter
+	now := time.Now()
+	var err error
+	if value := params.Get("since"); value != "" {
+		if filter.Since, err = logger.ParseTime(value, now); err != nil {
+			return filter, err
+		}
+	}
+	if value := params.Get("until"); value != "" {
+		if filter.Until, err = logger.ParseTime(value, now); err != nil {
+			return filter, err
+		}
+	}
+	switch stream := params.Get("stream"); stream {
+	case "", logger.StreamStdout, logger.StreamStderr:
+		filter.Stream = stream
+	default:
+		return filter, fmt.Errorf("unknown stream %q, expected stdout or stderr", stream)
+	}
+	if value := params.Get("level"); value != "" {
+		filter.Level = logger.NormalizeLevel(value)
+	}
+	for _, field := range params["field"] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || key == "" {
+			return filter, fmt.Errorf("invalid field %q, expected key=value", field)
+		}
+		if filter.Fields == nil {
+			filter.Fields = make(map[string]string)
+		}
+		filter.Fields[key] = value
+	}
+	for _, pattern := range params["grep"] {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return filter, fmt.Errorf("invalid grep pattern: %v", err)
+		}
+		filter.Include = append(filter.Include, re)
+	}
+	for _, pattern := range params["exclude"] {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return filter, fmt.Errorf("invalid exclude pattern: %v", err)
+		}
+		filter.Exclude = append(filter.Exclude, re)
+	}
+	return filter, nil
+}
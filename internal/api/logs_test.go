@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"gproc/internal/logger"
+	"gproc/internal/security"
+	"gproc/pkg/types"
+)
+
+// getLogPages pages through the log of process hello with handleGetLogs,
+// tail entries at a time, and returns the entries oldest first and the
+// number of pages.
+func getLogPages(t *testing.T, rs *RESTServer, tail int) ([]logger.Entry, int) {
+	t.Helper()
+	var entries []logger.Entry
+	cursor := ""
+	for pages := 1; ; pages++ {
+		if pages > 100 {
+			t.Fatal("still paging after 100 pages")
+		}
+		params := url.Values{"tail": {fmt.Sprint(tail)}}
+		if cursor != "" {
+			params.Set("cursor", cursor)
+		}
+		r := httptest.NewRequest("GET", "/api/v1/processes/hello/logs?"+params.Encode(), nil)
+		r = mux.SetURLVars(r, map[string]string{"id": "hello"})
+		r = r.WithContext(context.WithValue(r.Context(), "user", &types.User{ID: "1", Username: "tester"}))
+		w := httptest.NewRecorder()
+		rs.handleGetLogs(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("page %d: got %d %s", pages, w.Code, w.Body)
+		}
+
+		var page struct {
+			Entries    []logger.Entry `json:"entries"`
+			NextCursor string         `json:"next_cursor"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Entries) > tail {
+			t.Fatalf("page %d: got %d entries, want at most %d", pages, len(page.Entries), tail)
+		}
+		entries = append(page.Entries, entries...)
+		if page.NextCursor == "" {
+			return entries, pages
+		}
+		cursor = page.NextCursor
+	}
+}
+
+func TestGetLogsPagesEqualTimes(t *testing.T) {
+	manager := newTestManager(t)
+	rs := NewRESTServer(&types.RESTConfig{}, manager, security.NewRBACManager(nil), nil)
+
+	for _, test := range []struct {
+		name   string
+		prefix string
+	}{
+		{"same time", "2024-01-02T15:04:05.123456789Z stdout F "},
+		// Written by a process started without the daemon.
+		{"no time", ""},
+		{"no time then timed", ""},
+	} {
+		var lines []string
+		for i := 0; i < 250; i++ {
+			lines = append(lines, fmt.Sprintf("%sline %03d", test.prefix, i))
+		}
+		if test.name == "no time then timed" {
+			for i := 250; i < 260; i++ {
+				lines = append(lines, fmt.Sprintf("2024-01-02T15:04:05Z stdout F line %03d", i))
+			}
+		}
+		if err := os.WriteFile(manager.Get("hello").LogFile, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		entries, pages := getLogPages(t, rs, 100)
+		if len(entries) != len(lines) {
+			t.Errorf("%s: got %d entries in %d pages, want %d", test.name, len(entries), pages, len(lines))
+			continue
+		}
+		for i, e := range entries {
+			if want := fmt.Sprintf("line %03d", i); e.Message != want {
+				t.Errorf("%s: entry %d is %q, want %q", test.name, i, e.Message, want)
+				break
+			}
+		}
+		if want := (len(lines) + 99) / 100; pages != want {
+			t.Errorf("%s: got %d pages, want %d", test.name, pages, want)
+		}
+	}
+}
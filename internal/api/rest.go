@@ -9,6 +9,8 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"gproc/internal/logger"
+	"gproc/internal/observability"
 	"gproc/internal/process"
 	"gproc/internal/security"
 	"gproc/pkg/types"
@@ -22,6 +24,8 @@ type RESTServer struct {
 	token      *security.TokenManager
 	upgrader   websocket.Upgrader
 	wsClients  map[*websocket.Conn]bool
+	metrics    *observability.MetricsManager
+	started    time.Time
 }
 
 func NewRESTServer(config *types.RESTConfig, manager *process.Manager, rbac *security.RBACManager, token *security.TokenManager) *RESTServer {
@@ -32,9 +36,16 @@ func NewRESTServer(config *types.RESTConfig, manager *process.Manager, rbac *sec
 		token:     token,
 		upgrader:  websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }},
 		wsClients: make(map[*websocket.Conn]bool),
+		started:   time.Now(),
 	}
 }
 
+// SetMetrics makes the server report the measurements of metrics at
+// /metrics, in the Prometheus format, and in the API.
+func (rs *RESTServer) SetMetrics(metrics *observability.MetricsManager) {
+	rs.metrics = metrics
+}
+
 func (rs *RESTServer) Start(ctx context.Context) error {
 	if !rs.config.Enabled {
 		return nil
@@ -45,6 +56,16 @@ func (rs *RESTServer) Start(ctx context.Context) error {
 	// Add CORS middleware
 	router.Use(rs.corsMiddleware)
 	
+	// Prometheus scrape endpoint, authenticated unless the metrics
+	// configuration makes it public
+	if rs.metrics != nil {
+		handler := rs.metrics.Handler().ServeHTTP
+		if !rs.manager.MetricsConfig().PublicEndpoint {
+			handler = rs.authMiddleware(handler)
+		}
+		router.HandleFunc("/metrics", handler).Methods("GET")
+	}
+	
 	api := router.PathPrefix(rs.config.Prefix).Subrouter()
 	
 	// Authentication endpoints
@@ -63,6 +84,8 @@ func (rs *RESTServer) Start(ctx context.Context) error {
 	api.HandleFunc("/processes/{id}/stop", rs.authMiddleware(rs.handleStopProcess)).Methods("POST")
 	api.HandleFunc("/processes/{id}/restart", rs.authMiddleware(rs.handleRestartProcess)).Methods("POST")
 	api.HandleFunc("/processes/{id}/logs", rs.authMiddleware(rs.handleGetLogs)).Methods("GET")
+	api.HandleFunc("/logs/query", rs.authMiddleware(rs.handleQueryLogs)).Methods("GET")
+	api.HandleFunc("/logs/search", rs.authMiddleware(rs.handleSearchLogs)).Methods("GET")
 	
 	// Cluster endpoints
 	api.HandleFunc("/cluster/nodes", rs.authMiddleware(rs.handleListNodes)).Methods("GET")
@@ -73,6 +96,7 @@ func (rs *RESTServer) Start(ctx context.Context) error {
 	
 	// Metrics endpoints
 	api.HandleFunc("/metrics", rs.authMiddleware(rs.handleMetrics)).Methods("GET")
+	api.HandleFunc("/processes/{id}/metrics", rs.authMiddleware(rs.handleProcessMetrics)).Methods("GET")
 	
 	// WebSocket endpoint
 	api.HandleFunc("/ws", rs.handleWebSocket)
@@ -225,7 +249,13 @@ func (rs *RESTServer) handleListProcesses(w http.ResponseWriter, r *http.Request
 		return
 	}
 	
-	processes := rs.manager.List()
+	// ?selector=app=api,tier!=batch filters by labels
+	selector, err := process.ParseSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	processes := rs.manager.Select(selector)
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(processes)
@@ -367,23 +397,6 @@ func (rs *RESTServer) handleRestartProcess(w http.ResponseWriter, r *http.Reques
 	json.NewEncoder(w).Encode(map[string]string{"status": "restarted"})
 }
 
-func (rs *RESTServer) handleGetLogs(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	processID := vars["id"]
-	
-	user := r.Context().Value("user").(*types.User)
-	if !rs.rbac.Authorize(user, "process", "read", fmt.Sprintf("process:%s", processID)) {
-		http.Error(w, "Forbidden", http.StatusForbidden)
-		return
-	}
-	
-	// Get logs logic
-	logs := []string{"Log line 1", "Log line 2", "Log line 3"}
-	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"logs": logs})
-}
-
 func (rs *RESTServer) handleListNodes(w http.ResponseWriter, r *http.Request) {
 	user := r.Context().Value("user").(*types.User)
 	if !rs.rbac.Authorize(user, "cluster", "read", "*") {
@@ -447,18 +460,108 @@ func (rs *RESTServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	if rs.metrics == nil {
+		http.Error(w, "Metrics are not collected", http.StatusServiceUnavailable)
+		return
+	}
+	
+	samples, host, collected := rs.metrics.Latest()
+	running := 0
+	for _, sample := range samples {
+		if sample.Status == types.StatusRunning {
+			running++
+		}
+	}
 	metrics := map[string]interface{}{
-		"processes_running": 5,
-		"processes_total":   8,
-		"cpu_usage":        34.5,
-		"memory_usage":     67.2,
-		"uptime":          "2d 14h 32m",
+		"processes_running": running,
+		"processes_total":   len(samples),
+		"uptime":            formatUptime(time.Since(rs.started)),
+		"collected_at":      collected,
+		"processes":         samples,
+	}
+	if host != nil {
+		metrics["cpu_usage"] = host.CPUPercent
+		metrics["memory_usage"] = host.MemoryPercent
+		metrics["host"] = host
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(metrics)
 }
 
+// handleProcessMetrics answers GET /processes/{id}/metrics with the
+// metrics history of a process:
+//
+//	/processes/api/metrics?since=720h
+//	/processes/api/metrics?since=2024-05-01&until=2024-05-02
+//
+// since defaults to an hour before until, which defaults to now. The
+// history picks the resolution from the range: raw samples for the last
+// hours, then 1-minute, 1-hour and 1-day rollups.
+func (rs *RESTServer) handleProcessMetrics(w http.ResponseWriter, r *http.Request) {
+	processID := mux.Vars(r)["id"]
+	user := r.Context().Value("user").(*types.User)
+	if !rs.rbac.Authorize(user, "metrics", "read", fmt.Sprintf("process:%s", processID)) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if rs.manager.Get(processID) == nil {
+		http.Error(w, fmt.Sprintf("Process %s not found", processID), http.StatusNotFound)
+		return
+	}
+	
+	params := r.URL.Query()
+	now := time.Now()
+	until := now
+	var err error
+	if value := params.Get("until"); value != "" {
+		if until, err = logger.ParseTime(value, now); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	since := until.Add(-time.Hour)
+	if value := params.Get("since"); value != "" {
+		if since, err = logger.ParseTime(value, now); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if !since.Before(until) {
+		http.Error(w, "since must be before until", http.StatusBadRequest)
+		return
+	}
+	
+	points, resolution, err := rs.manager.MetricsHistory(processID, since, until)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if points == nil {
+		points = []types.MetricPoint{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"process":    processID,
+		"since":      since,
+		"until":      until,
+		"resolution": resolution.String(),
+		"points":     points,
+	})
+}
+
+// formatUptime renders an uptime the way the dashboard shows it, such as
+// 2d 14h 32m.
+func formatUptime(d time.Duration) string {
+	days := int(d.Hours()) / 24
+	hours := int(d.Hours()) % 24
+	minutes := int(d.Minutes()) % 60
+	if days > 0 {
+		return fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
+	}
+	return fmt.Sprintf("%dh %dm", hours, minutes)
+}
+
 func (rs *RESTServer) handleListUsers(w http.ResponseWriter, r *http.Request) {
 	user := r.Context().Value("user").(*types.User)
 	if !rs.rbac.Authorize(user, "user", "read", "*") {
@@ -0,0 +1,109 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ErrDaemonNotRunning is returned when nothing listens on the control socket.
+var ErrDaemonNotRunning = errors.New("gproc daemon is not running (start it with 'gproc daemon')")
+
+// Client talks to the daemon over its control socket. Every call uses a
+// fresh connection.
+type Client struct {
+	path string
+}
+
+func NewClient(path string) *Client {
+	return &Client{path: path}
+}
+
+// Available reports whether a daemon answers on the socket.
+func (c *Client) Available() bool {
+	conn, err := net.DialTimeout("unix", c.path, time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// Call performs a request/response action and decodes the result into
+// result when it is non-nil.
+func (c *Client) Call(action string, params, result interface{}) error {
+	conn, resp, err := c.open(action, params)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if result != nil && len(resp.Result) > 0 {
+		return json.Unmarshal(resp.Result, result)
+	}
+	return nil
+}
+
+// Stream performs a streaming action. The returned connection carries the
+// frames that follow the response; result receives the response payload.
+func (c *Client) Stream(action string, params, result interface{}) (*Conn, error) {
+	conn, resp, err := c.open(action, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if result != nil && len(resp.Result) > 0 {
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (c *Client) open(action string, params interface{}) (*Conn, *Response, error) {
+	nc, err := net.Dial("unix", c.path)
+	if err != nil {
+		return nil, nil, ErrDaemonNotRunning
+	}
+	conn := newConn(nc)
+
+	req := Request{Action: action}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		req.Params = data
+	}
+
+	data, err := json.Marshal(&req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if _, err := nc.Write(append(data, '\n')); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	line, err := conn.reader.ReadBytes('\n')
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("reading daemon response: %v", err)
+	}
+
+	var resp Response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("invalid daemon response: %v", err)
+	}
+	if !resp.OK {
+		conn.Close()
+		return nil, nil, errors.New(resp.Error)
+	}
+	return conn, &resp, nil
+}
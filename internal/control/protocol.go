@@ -0,0 +1,87 @@
+package control
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// DefaultSocket is the daemon control socket used when GPROC_SOCKET is unset.
+const DefaultSocket = "gproc.sock"
+
+// SocketPath returns the control socket path shared by the daemon and the CLI.
+func SocketPath() string {
+	if path := os.Getenv("GPROC_SOCKET"); path != "" {
+		return path
+	}
+	return DefaultSocket
+}
+
+// Request is the first line a client sends on a new connection.
+type Request struct {
+	Action string          `json:"action"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Response is the daemon's answer to a Request. Streaming actions follow a
+// successful response with frames.
+type Response struct {
+	OK     bool            `json:"ok"`
+	Error  string          `json:"error,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// Frame types used by streaming actions.
+const (
+	FrameData   byte = 'd' // raw terminal or log bytes
+	FrameResize byte = 'r' // window size, JSON encoded WindowSize
+	FrameDetach byte = 'x' // client detaches, process keeps running
+	FrameExit   byte = 'e' // stream ended, JSON encoded ExitStatus
+)
+
+const maxFrameSize = 1 << 20
+
+// WindowSize is the payload of a FrameResize frame.
+type WindowSize struct {
+	Rows uint16 `json:"rows"`
+	Cols uint16 `json:"cols"`
+}
+
+// ExitStatus is the payload of a FrameExit frame.
+type ExitStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// WriteFrame writes a single type/length/payload frame to w.
+func WriteFrame(w io.Writer, typ byte, payload []byte) error {
+	header := make([]byte, 5)
+	header[0] = typ
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// ReadFrame reads a frame written by WriteFrame.
+func ReadFrame(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxFrameSize {
+		return 0, nil, fmt.Errorf("frame too large: %d bytes", size)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
@@ -0,0 +1,206 @@
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Handler serves a single control request. Simple actions answer with
+// Reply or Fail; streaming actions reply first and then exchange frames.
+type Handler func(conn *Conn, req *Request) error
+
+// Server accepts CLI connections on the daemon's unix socket.
+type Server struct {
+	path     string
+	listener net.Listener
+	handlers map[string]Handler
+	mutex    sync.RWMutex
+}
+
+func NewServer(path string) *Server {
+	return &Server{
+		path:     path,
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Handle registers the handler for action.
+func (s *Server) Handle(action string, handler Handler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.handlers[action] = handler
+}
+
+func (s *Server) Start() error {
+	if _, err := os.Stat(s.path); err == nil {
+		// Refuse to steal the socket from a live daemon, clean up a stale one.
+		if conn, err := net.DialTimeout("unix", s.path, time.Second); err == nil {
+			conn.Close()
+			return fmt.Errorf("another daemon is listening on %s", s.path)
+		}
+		os.Remove(s.path)
+	}
+
+	listener, err := net.Listen("unix", s.path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(s.path, 0600); err != nil {
+		listener.Close()
+		return err
+	}
+
+	s.listener = listener
+	go s.serve()
+	return nil
+}
+
+func (s *Server) Stop() error {
+	if s.listener == nil {
+		return nil
+	}
+	err := s.listener.Close()
+	os.Remove(s.path)
+	return err
+}
+
+func (s *Server) serve() {
+	for {
+		nc, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(nc)
+	}
+}
+
+func (s *Server) handle(nc net.Conn) {
+	conn := newConn(nc)
+	defer conn.Close()
+
+	line, err := conn.reader.ReadBytes('\n')
+	if err != nil {
+		return
+	}
+
+	var req Request
+	if err := json.Unmarshal(line, &req); err != nil {
+		conn.Fail(fmt.Errorf("invalid request: %v", err))
+		return
+	}
+
+	s.mutex.RLock()
+	handler, exists := s.handlers[req.Action]
+	s.mutex.RUnlock()
+
+	if !exists {
+		conn.Fail(fmt.Errorf("unknown action %q", req.Action))
+		return
+	}
+
+	if err := handler(conn, &req); err != nil && !conn.replied {
+		conn.Fail(err)
+	}
+}
+
+// Conn is one client connection as seen by either side.
+type Conn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writeMu sync.Mutex
+	replied bool
+}
+
+func newConn(nc net.Conn) *Conn {
+	return &Conn{conn: nc, reader: bufio.NewReader(nc)}
+}
+
+// Reply sends a successful response carrying result.
+func (c *Conn) Reply(result interface{}) error {
+	resp := Response{OK: true}
+	if result != nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		resp.Result = data
+	}
+	return c.writeResponse(&resp)
+}
+
+// Fail sends an error response.
+func (c *Conn) Fail(err error) error {
+	return c.writeResponse(&Response{OK: false, Error: err.Error()})
+}
+
+func (c *Conn) writeResponse(resp *Response) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.replied = true
+	_, err = c.conn.Write(append(data, '\n'))
+	return err
+}
+
+// WriteFrame sends a frame. It is safe for concurrent use.
+func (c *Conn) WriteFrame(typ byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return WriteFrame(c.conn, typ, payload)
+}
+
+// WriteJSONFrame sends a frame with a JSON encoded payload.
+func (c *Conn) WriteJSONFrame(typ byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteFrame(typ, data)
+}
+
+// FrameWriter returns a writer that sends every Write as one frame of typ.
+func (c *Conn) FrameWriter(typ byte) io.Writer {
+	return &frameWriter{conn: c, typ: typ}
+}
+
+type frameWriter struct {
+	conn *Conn
+	typ  byte
+}
+
+func (w *frameWriter) Write(p []byte) (int, error) {
+	if err := w.conn.WriteFrame(w.typ, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// ReadFrame receives the next frame.
+func (c *Conn) ReadFrame() (byte, []byte, error) {
+	return ReadFrame(c.reader)
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// Decode unmarshals the request parameters into v.
+func (r *Request) Decode(v interface{}) error {
+	if len(r.Params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(r.Params, v); err != nil {
+		return fmt.Errorf("invalid params for %s: %v", r.Action, err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package logger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Output streams of a process.
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// Entry is one line of output of a process.
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Process string    `json:"process,omitempty"`
+	// Stream is stdout or stderr, or empty for lines of logs written
+	// without the daemon, which have no time and stream either.
+	Stream string `json:"stream,omitempty"`
+	// Level and Fields are set for processes with a log parser.
+	Level   string            `json:"level,omitempty"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// Log files hold one entry per line in the CRI logging format:
+//
+//	2024-01-02T15:04:05.999999999Z stdout F message
+//
+// where F marks a full line and P the leading part of a line too long to
+// keep in one entry. Multi-line events, which CRI does not have, are
+// written with L on every line but the last, F; a reader joins them with
+// newlines.
+const (
+	tagFull    = "F"
+	tagPartial = "P"
+	tagLine    = "L"
+)
+
+func formatLine(t time.Time, stream, tag string, message []byte) []byte {
+	line := make([]byte, 0, len(message)+48)
+	line = t.UTC().AppendFormat(line, time.RFC3339Nano)
+	line = append(line, ' ')
+	line = append(line, stream...)
+	line = append(line, ' ')
+	line = append(line, tag...)
+	line = append(line, ' ')
+	line = append(line, message...)
+	return append(line, '\n')
+}
+
+// parseLine parses a line of a log file and returns its tag. Lines in
+// another format are returned whole as the message of a full entry
+// without time or stream.
+func parseLine(line string) (entry Entry, tag string) {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) == 4 && (fields[1] == StreamStdout || fields[1] == StreamStderr) &&
+		(fields[2] == tagFull || fields[2] == tagPartial || fields[2] == tagLine) {
+		if t, err := time.Parse(time.RFC3339Nano, fields[0]); err == nil {
+			return Entry{Time: t, Stream: fields[1], Message: fields[3]}, fields[2]
+		}
+	}
+	return Entry{Message: line}, tagFull
+}
+
+// ParseTime parses the --since and --until forms: a duration ago ("15m"),
+// an RFC 3339 time, a date and time, a date, or a time of today, all in
+// local time unless a zone is given.
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+			y, m, d := now.Date()
+			return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, now.Location()), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected a duration like 15m, a date, a time or RFC 3339", value)
+}
+
+// ParseSize parses a size like "100MB", "512K" or "1048576" (bytes). Units
+// are powers of 1024.
+func ParseSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(s, "B")
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return n * multiplier, nil
+}
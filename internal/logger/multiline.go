@@ -0,0 +1,63 @@
+package logger
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"gproc/pkg/types"
+)
+
+// Defaults of multi-line rules.
+const (
+	defaultMultilineTimeout  = time.Second
+	defaultMultilineMaxLines = 500
+)
+
+// Multiline decides which lines of a log belong to one event.
+type Multiline struct {
+	start        *regexp.Regexp
+	continuation *regexp.Regexp
+	timeout      time.Duration
+	maxLines     int
+}
+
+// NewMultiline returns the multi-line rule configured for a process, or
+// nil when it has none.
+func NewMultiline(cfg *types.LogMultiline) (*Multiline, error) {
+	if cfg == nil || cfg.Start == "" && cfg.Continuation == "" {
+		return nil, nil
+	}
+	m := &Multiline{timeout: cfg.Timeout, maxLines: cfg.MaxLines}
+	var err error
+	if cfg.Start != "" {
+		if m.start, err = regexp.Compile(cfg.Start); err != nil {
+			return nil, fmt.Errorf("invalid multi-line start pattern: %v", err)
+		}
+	}
+	if cfg.Continuation != "" {
+		if m.continuation, err = regexp.Compile(cfg.Continuation); err != nil {
+			return nil, fmt.Errorf("invalid multi-line continuation pattern: %v", err)
+		}
+	}
+	if m.timeout <= 0 {
+		m.timeout = defaultMultilineTimeout
+	}
+	if m.maxLines <= 0 {
+		m.maxLines = defaultMultilineMaxLines
+	}
+	return m, nil
+}
+
+// starts reports whether line begins an event.
+func (m *Multiline) starts(line []byte) bool {
+	return m.start == nil || m.start.Match(line)
+}
+
+// continues reports whether line is part of the event before it.
+func (m *Multiline) continues(line []byte) bool {
+	if m.continuation != nil {
+		return m.continuation.Match(line)
+	}
+	return !m.start.Match(line)
+}
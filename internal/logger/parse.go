@@ -0,0 +1,378 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gproc/pkg/types"
+)
+
+// Parser formats.
+const (
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+	FormatRegex  = "regex"
+)
+
+// Levels are the normalized log levels, least severe first.
+var Levels = []string{"trace", "debug", "info", "warn", "error", "fatal"}
+
+// Field names tried, in order, when a parser does not name them.
+var (
+	defaultTimeFields    = []string{"time", "timestamp", "ts", "@timestamp", "t"}
+	defaultLevelFields   = []string{"level", "lvl", "severity", "loglevel"}
+	defaultMessageFields = []string{"msg", "message", "@message"}
+)
+
+// Parser extracts structured data from log lines.
+type Parser struct {
+	format        string
+	pattern       *regexp.Regexp
+	timeFormat    string
+	timeFields    []string
+	levelFields   []string
+	messageFields []string
+}
+
+// NewParser returns the parser configured for a process, or nil when it
+// has none.
+func NewParser(cfg *types.LogParser) (*Parser, error) {
+	if cfg == nil || cfg.Format == "" {
+		return nil, nil
+	}
+
+	p := &Parser{
+		format:        cfg.Format,
+		timeFormat:    cfg.TimeFormat,
+		timeFields:    defaultTimeFields,
+		levelFields:   defaultLevelFields,
+		messageFields: defaultMessageFields,
+	}
+	switch cfg.Format {
+	case FormatJSON, FormatLogfmt:
+	case FormatRegex:
+		if cfg.Pattern == "" {
+			return nil, fmt.Errorf("the regex log format needs a pattern")
+		}
+		re, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log pattern: %v", err)
+		}
+		if len(re.SubexpNames()) < 2 {
+			return nil, fmt.Errorf("log pattern %q has no named groups", cfg.Pattern)
+		}
+		p.pattern = re
+	default:
+		return nil, fmt.Errorf("unknown log format %q, expected json, logfmt or regex", cfg.Format)
+	}
+	if cfg.TimeField != "" {
+		p.timeFields = []string{cfg.TimeField}
+	}
+	if cfg.LevelField != "" {
+		p.levelFields = []string{cfg.LevelField}
+	}
+	if cfg.MessageField != "" {
+		p.messageFields = []string{cfg.MessageField}
+	}
+	return p, nil
+}
+
+// Parse sets the level, message and fields of e, and its time when the
+// line has one, from its message. Lines the parser does not understand
+// are left as they are.
+func (p *Parser) Parse(e *Entry) bool {
+	var fields map[string]string
+	switch p.format {
+	case FormatJSON:
+		fields = parseJSON(e.Message)
+	case FormatLogfmt:
+		fields = parseLogfmt(e.Message)
+	case FormatRegex:
+		fields = p.parseRegex(e.Message)
+	}
+	if len(fields) == 0 {
+		return false
+	}
+
+	if key, value := take(fields, p.timeFields); key != "" {
+		if t, ok := parseTimestamp(value, p.timeFormat); ok {
+			e.Time = t
+		} else {
+			fields[key] = value
+		}
+	}
+	if _, value := take(fields, p.levelFields); value != "" {
+		e.Level = NormalizeLevel(value)
+	}
+	// Without a message field everything is in the fields, except for
+	// regex lines whose pattern did not capture one.
+	if key, value := take(fields, p.messageFields); key != "" || p.format != FormatRegex {
+		e.Message = value
+	}
+	if len(fields) > 0 {
+		e.Fields = fields
+	}
+	return true
+}
+
+// take removes the first of keys present in fields and returns it.
+func take(fields map[string]string, keys []string) (string, string) {
+	for _, key := range keys {
+		if value, ok := fields[key]; ok {
+			delete(fields, key)
+			return key, value
+		}
+	}
+	return "", ""
+}
+
+// parseJSON flattens a JSON object into fields, joining the keys of
+// nested objects with dots.
+func parseJSON(line string) map[string]string {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") {
+		return nil
+	}
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+	var object map[string]interface{}
+	if err := dec.Decode(&object); err != nil {
+		return nil
+	}
+	fields := make(map[string]string)
+	flatten("", object, fields)
+	return fields
+}
+
+func flatten(prefix string, object map[string]interface{}, fields map[string]string) {
+	for key, value := range object {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch value := value.(type) {
+		case map[string]interface{}:
+			flatten(key, value, fields)
+		case string:
+			fields[key] = value
+		case nil:
+			fields[key] = ""
+		case json.Number, bool:
+			fields[key] = fmt.Sprint(value)
+		default:
+			out, _ := json.Marshal(value)
+			fields[key] = string(out)
+		}
+	}
+}
+
+// parseLogfmt parses key=value pairs; values may be double quoted with Go
+// escapes, and a key without a value is true. A line without any pair is
+// not logfmt.
+func parseLogfmt(line string) map[string]string {
+	fields := make(map[string]string)
+	pairs := 0
+	for i := 0; i < len(line); {
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' {
+			i++
+		}
+		key := line[start:i]
+		if key == "" {
+			if i < len(line) && line[i] == '=' {
+				// "=value" is not logfmt.
+				return nil
+			}
+			break
+		}
+		if i >= len(line) || line[i] == ' ' {
+			fields[key] = "true"
+			continue
+		}
+		i++ // '='
+		pairs++
+
+		if i < len(line) && line[i] == '"' {
+			end := i + 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				return nil
+			}
+			value, err := strconv.Unquote(line[i : end+1])
+			if err != nil {
+				return nil
+			}
+			fields[key] = value
+			i = end + 1
+			continue
+		}
+		start = i
+		for i < len(line) && line[i] != ' ' {
+			i++
+		}
+		fields[key] = line[start:i]
+	}
+	if pairs == 0 {
+		return nil
+	}
+	return fields
+}
+
+func (p *Parser) parseRegex(line string) map[string]string {
+	match := p.pattern.FindStringSubmatch(line)
+	if match == nil {
+		return nil
+	}
+	fields := make(map[string]string)
+	for i, name := range p.pattern.SubexpNames() {
+		if name != "" && i < len(match) {
+			fields[name] = match[i]
+		}
+	}
+	return fields
+}
+
+// timeLayouts are the layouts tried for times without a configured one,
+// after RFC 3339. Those without a zone are in local time.
+var timeLayouts = []string{
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"02/Jan/2006:15:04:05 -0700",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// parseTimestamp parses a time in layout, or by default RFC 3339, a few
+// other common layouts or a Unix timestamp in seconds, milliseconds,
+// microseconds or nanoseconds.
+func parseTimestamp(value, layout string) (time.Time, bool) {
+	if layout != "" {
+		t, err := time.ParseInLocation(layout, value, time.Local)
+		return t, err == nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, true
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, true
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n <= 0 {
+		return time.Time{}, false
+	}
+	switch {
+	case n < 1e11:
+		sec, frac := math.Modf(n)
+		return time.Unix(int64(sec), int64(frac*1e9)), true
+	case n < 1e14:
+		return time.UnixMilli(int64(n)), true
+	case n < 1e17:
+		return time.UnixMicro(int64(n)), true
+	default:
+		return time.Unix(0, int64(n)), true
+	}
+}
+
+// NormalizeLevel maps the spellings of log levels to Levels. Unknown
+// levels are kept in lower case.
+func NormalizeLevel(level string) string {
+	if n, err := strconv.Atoi(level); err == nil && n >= 10 {
+		// Numeric levels of pino and bunyan.
+		switch {
+		case n < 20:
+			return "trace"
+		case n < 30:
+			return "debug"
+		case n < 40:
+			return "info"
+		case n < 50:
+			return "warn"
+		case n < 60:
+			return "error"
+		default:
+			return "fatal"
+		}
+	}
+	switch level = strings.ToLower(level); level {
+	case "t", "trc", "trace":
+		return "trace"
+	case "d", "dbg", "debug":
+		return "debug"
+	case "i", "inf", "info", "information", "informational", "notice":
+		return "info"
+	case "w", "wrn", "warn", "warning":
+		return "warn"
+	case "e", "err", "eror", "error":
+		return "error"
+	case "f", "crit", "critical", "fatal", "panic", "emerg", "emergency", "alert":
+		return "fatal"
+	}
+	return level
+}
+
+// levelRank returns the position of a level in Levels, or -1.
+func levelRank(level string) int {
+	for i, l := range Levels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// levelAtLeast reports whether level is at least as severe as min. An
+// unknown min only matches itself.
+func levelAtLeast(level, min string) bool {
+	min = NormalizeLevel(min)
+	rank := levelRank(min)
+	if rank < 0 {
+		return level == min
+	}
+	return levelRank(level) >= rank
+}
+
+// levelsFrom returns the levels at least as severe as min.
+func levelsFrom(min string) []string {
+	if i := levelRank(NormalizeLevel(min)); i >= 0 {
+		return Levels[i:]
+	}
+	return []string{NormalizeLevel(min)}
+}
+
+// FormatFields renders fields as sorted logfmt pairs.
+func FormatFields(fields map[string]string) string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b bytes.Buffer
+	for i, key := range keys {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		value := fields[key]
+		if value == "" || strings.ContainsAny(value, " =\"") {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(key + "=" + value)
+	}
+	return b.String()
+}
@@ -0,0 +1,316 @@
+package logger
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// followInterval is how often a followed log is checked for new lines and
+// rotation.
+const followInterval = 250 * time.Millisecond
+
+// Source is the log of one process.
+type Source struct {
+	Process string
+	Path    string
+	// Parser, when set, parses the entries read from the files.
+	Parser *Parser
+}
+
+// Filter selects log entries. The zero Filter matches every entry.
+type Filter struct {
+	Since   time.Time
+	Until   time.Time
+	Stream  string
+	Level   string            // at least this severe
+	Fields  map[string]string // every field must have the value
+	Include []*regexp.Regexp  // one of them must match, when given
+	Exclude []*regexp.Regexp  // none of them may match
+}
+
+// Match reports whether e passes the filter.
+func (f *Filter) Match(e *Entry) bool {
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && e.Time.After(f.Until) {
+		return false
+	}
+	if f.Stream != "" && e.Stream != f.Stream {
+		return false
+	}
+	if f.Level != "" && !levelAtLeast(e.Level, f.Level) {
+		return false
+	}
+	for key, value := range f.Fields {
+		if v, ok := e.Fields[key]; !ok || v != value {
+			return false
+		}
+	}
+	if len(f.Include) > 0 {
+		matched := false
+		for _, re := range f.Include {
+			if re.MatchString(e.Message) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for _, re := range f.Exclude {
+		if re.MatchString(e.Message) {
+			return false
+		}
+	}
+	return true
+}
+
+// Query reads the logs of several processes as one stream of entries in
+// time order.
+type Query struct {
+	Sources []Source
+	Filter  Filter
+	// Lines limits the history to the last Lines matching entries of each
+	// source; negative means all of them.
+	Lines int
+	// Follow keeps sending new entries, across rotations, until Stop is
+	// closed.
+	Follow bool
+	Stop   <-chan struct{}
+}
+
+// Run calls fn for every entry of the query and stops at the first error
+// fn returns.
+func (q *Query) Run(fn func(Entry) error) error {
+	readers := make([]*sourceReader, len(q.Sources))
+	var history []Entry
+	for i, src := range q.Sources {
+		r := &sourceReader{src: src, partial: make(map[string]string)}
+		readers[i] = r
+		// Open the active file first, so that a rotation while the older
+		// files are read does not lose what it moved.
+		r.open()
+
+		var entries []Entry
+		keep := func(e Entry) {
+			if !q.Filter.Match(&e) {
+				return
+			}
+			entries = append(entries, e)
+			if q.Lines >= 0 && len(entries) > q.Lines {
+				entries = entries[1:]
+			}
+		}
+		files := Files(src.Path)
+		for _, name := range files {
+			if name == src.Path {
+				continue
+			}
+			if !q.Filter.Since.IsZero() {
+				// Nothing in a rotated file is newer than its last write.
+				if info, err := os.Stat(name); err == nil && info.ModTime().Before(q.Filter.Since) {
+					continue
+				}
+			}
+			r.readFile(name, keep)
+		}
+		r.drain(keep)
+		history = append(history, entries...)
+	}
+
+	sort.SliceStable(history, func(i, j int) bool { return history[i].Time.Before(history[j].Time) })
+	for _, e := range history {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	if !q.Follow {
+		for _, r := range readers {
+			r.close()
+		}
+		return nil
+	}
+	defer func() {
+		for _, r := range readers {
+			r.close()
+		}
+	}()
+
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.Stop:
+			return nil
+		case <-ticker.C:
+		}
+
+		var batch []Entry
+		keep := func(e Entry) {
+			if e.Time.IsZero() {
+				e.Time = time.Now()
+			}
+			if q.Filter.Match(&e) {
+				batch = append(batch, e)
+			}
+		}
+		for _, r := range readers {
+			r.follow(keep)
+		}
+		sort.SliceStable(batch, func(i, j int) bool { return batch[i].Time.Before(batch[j].Time) })
+		for _, e := range batch {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sourceReader reads the files of one log and keeps the active one open
+// to follow it.
+type sourceReader struct {
+	src     Source
+	file    *os.File
+	reader  *bufio.Reader
+	pending string            // unterminated last line of the active file
+	partial map[string]string // leading parts of a split line or event, per stream
+	last    time.Time         // time of the last entry, for lines without
+}
+
+func (r *sourceReader) open() {
+	file, err := os.Open(r.src.Path)
+	if err != nil {
+		return
+	}
+	r.file = file
+	r.reader = bufio.NewReader(file)
+	r.pending = ""
+}
+
+func (r *sourceReader) close() {
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+}
+
+// readFile reads a whole rotated file, compressed or not.
+func (r *sourceReader) readFile(name string, emit func(Entry)) {
+	file, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	var in io.Reader = file
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return
+		}
+		defer gz.Close()
+		in = gz
+	}
+	reader := bufio.NewReader(in)
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			r.line(strings.TrimSuffix(line, "\n"), emit)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// drain reads the complete lines added to the active file.
+func (r *sourceReader) drain(emit func(Entry)) {
+	if r.file == nil {
+		return
+	}
+	for {
+		line, err := r.reader.ReadString('\n')
+		if err != nil {
+			r.pending += line
+			return
+		}
+		line = r.pending + strings.TrimSuffix(line, "\n")
+		r.pending = ""
+		r.line(line, emit)
+	}
+}
+
+// follow reads what was added to the log since the last call, moving to
+// the new active file after a rotation.
+func (r *sourceReader) follow(emit func(Entry)) {
+	if r.file == nil {
+		r.open()
+		r.drain(emit)
+		return
+	}
+	r.drain(emit)
+
+	current, err := os.Stat(r.src.Path)
+	if err != nil {
+		// Rotated and not created again yet.
+		return
+	}
+	opened, err := r.file.Stat()
+	if err != nil {
+		return
+	}
+	if !os.SameFile(current, opened) {
+		// Everything before the rotation has been read from the old file.
+		if r.pending != "" {
+			r.line(r.pending, emit)
+		}
+		r.close()
+		r.open()
+		r.drain(emit)
+		return
+	}
+	if offset, err := r.file.Seek(0, io.SeekCurrent); err == nil &&
+		current.Size() < offset-int64(r.reader.Buffered()) {
+		// Truncated in place.
+		r.file.Seek(0, io.SeekStart)
+		r.reader.Reset(r.file)
+		r.pending = ""
+		r.drain(emit)
+	}
+}
+
+// line turns a line of a log file into an entry, joining split lines and
+// the lines of multi-line events.
+func (r *sourceReader) line(line string, emit func(Entry)) {
+	entry, tag := parseLine(line)
+	entry.Process = r.src.Process
+	switch tag {
+	case tagPartial:
+		r.partial[entry.Stream] += entry.Message
+		return
+	case tagLine:
+		r.partial[entry.Stream] += entry.Message + "\n"
+		return
+	}
+	if head, ok := r.partial[entry.Stream]; ok {
+		entry.Message = head + entry.Message
+		delete(r.partial, entry.Stream)
+	}
+	if entry.Time.IsZero() {
+		entry.Time = r.last
+	} else {
+		r.last = entry.Time
+	}
+	if r.src.Parser != nil {
+		r.src.Parser.Parse(&entry)
+	}
+	emit(entry)
+}
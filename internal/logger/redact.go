@@ -0,0 +1,191 @@
+package logger
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"gproc/pkg/types"
+)
+
+// Built-in redaction detectors.
+const (
+	DetectorJWT        = "jwt"
+	DetectorBearer     = "bearer"
+	DetectorEmail      = "email"
+	DetectorCreditCard = "credit_card"
+	DetectorAll        = "all"
+)
+
+// Redacted replaces secrets unless a rule says otherwise.
+const Redacted = "<redacted>"
+
+// detectors are the built-in rules, in the order they apply.
+var detectors = []redactRule{
+	// Bearer first, so that a JWT after it counts once.
+	{name: DetectorBearer, re: regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9\-._~+/]+=*`), replace: "${1}" + Redacted},
+	{name: DetectorJWT, re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), replace: Redacted},
+	{name: DetectorEmail, re: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`), replace: Redacted},
+	{name: DetectorCreditCard, re: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), replace: Redacted, valid: cardNumber},
+}
+
+type redactRule struct {
+	name    string
+	re      *regexp.Regexp
+	replace string
+	// valid tells real secrets from lookalikes among the matches.
+	valid func(match []byte) bool
+}
+
+// Redactor masks secrets in log lines.
+type Redactor struct {
+	rules []redactRule
+}
+
+// NewRedactor returns the redactor applying the rules of each
+// configuration in turn, or nil when there are none.
+func NewRedactor(configs ...*types.LogRedaction) (*Redactor, error) {
+	r := &Redactor{}
+	seen := make(map[string]bool)
+	for _, cfg := range configs {
+		if cfg == nil {
+			continue
+		}
+		for _, name := range cfg.Detectors {
+			found := false
+			for _, d := range detectors {
+				if name == d.name || name == DetectorAll {
+					found = true
+					if !seen[d.name] {
+						seen[d.name] = true
+						r.rules = append(r.rules, d)
+					}
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unknown redaction detector %q, expected jwt, bearer, email, credit_card or all", name)
+			}
+		}
+		for i, rule := range cfg.Rules {
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid redaction rule %s: %v", rule.Name, err)
+			}
+			name := rule.Name
+			if name == "" {
+				name = fmt.Sprintf("rule%d", i+1)
+			}
+			replace := rule.Replacement
+			if replace == "" {
+				replace = Redacted
+			}
+			r.rules = append(r.rules, redactRule{name: name, re: re, replace: replace})
+		}
+	}
+	if len(r.rules) == 0 {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// Redact returns line with its secrets replaced, adding the number of
+// replacements of each rule to counts.
+func (r *Redactor) Redact(line []byte, counts map[string]int64) []byte {
+	if r == nil {
+		return line
+	}
+	for _, rule := range r.rules {
+		matches := rule.re.FindAllSubmatchIndex(line, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		var out []byte
+		last, replaced := 0, 0
+		for _, m := range matches {
+			if rule.valid != nil && !rule.valid(line[m[0]:m[1]]) {
+				continue
+			}
+			out = append(out, line[last:m[0]]...)
+			out = rule.re.Expand(out, []byte(rule.replace), line, m)
+			last = m[1]
+			replaced++
+		}
+		if replaced > 0 {
+			line = append(out, line[last:]...)
+			counts[rule.name] += int64(replaced)
+		}
+	}
+	return line
+}
+
+// cardIINs are the issuer prefixes of the major payment card networks
+// with the lengths of their numbers. lo and hi bound the leading digits,
+// as many as lo has.
+var cardIINs = []struct {
+	lo, hi  int
+	lengths []int
+}{
+	{4, 4, []int{13, 16, 19}},                       // Visa
+	{51, 55, []int{16}},                             // Mastercard
+	{2221, 2720, []int{16}},                         // Mastercard
+	{34, 34, []int{15}},                             // American Express
+	{37, 37, []int{15}},                             // American Express
+	{6011, 6011, []int{16, 17, 18, 19}},             // Discover
+	{644, 649, []int{16, 17, 18, 19}},               // Discover
+	{65, 65, []int{16, 17, 18, 19}},                 // Discover
+	{300, 305, []int{14}},                           // Diners Club
+	{36, 36, []int{14}},                             // Diners Club
+	{38, 38, []int{14}},                             // Diners Club
+	{3528, 3589, []int{16, 17, 18, 19}},             // JCB
+	{62, 62, []int{16, 17, 18, 19}},                 // UnionPay
+	{5018, 5018, []int{13, 14, 15, 16, 17, 18, 19}}, // Maestro
+	{5020, 5020, []int{13, 14, 15, 16, 17, 18, 19}}, // Maestro
+	{5038, 5038, []int{13, 14, 15, 16, 17, 18, 19}}, // Maestro
+	{5893, 5893, []int{13, 14, 15, 16, 17, 18, 19}}, // Maestro
+	{6304, 6304, []int{13, 14, 15, 16, 17, 18, 19}}, // Maestro
+	{6759, 6759, []int{13, 14, 15, 16, 17, 18, 19}}, // Maestro
+	{6761, 6763, []int{13, 14, 15, 16, 17, 18, 19}}, // Maestro
+}
+
+// cardNumber reports whether a match is a payment card number: one of a
+// known network, of a length it issues, that passes the Luhn checksum.
+// Other long numbers, such as IDs and timestamps, are left alone.
+func cardNumber(match []byte) bool {
+	digits := make([]byte, 0, len(match))
+	for _, c := range match {
+		if c >= '0' && c <= '9' {
+			digits = append(digits, c)
+		}
+	}
+	for _, iin := range cardIINs {
+		width := len(strconv.Itoa(iin.lo))
+		prefix, _ := strconv.Atoi(string(digits[:width]))
+		if prefix < iin.lo || prefix > iin.hi || !slices.Contains(iin.lengths, len(digits)) {
+			continue
+		}
+		return luhn(digits)
+	}
+	return false
+}
+
+// luhn reports whether the digits of a number pass the Luhn checksum of
+// payment card numbers.
+func luhn(number []byte) bool {
+	sum, digits := 0, 0
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if digits%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits >= 13 && digits <= 19 && sum%10 == 0
+}
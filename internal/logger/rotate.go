@@ -0,0 +1,126 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// rotate moves the active log to <path>.1, shifting older files up to
+// <path>.<maxFiles-1>, and starts a new one. Rotated files are compressed
+// in the background to <path>.<n>.gz. The caller holds w.mutex.
+func (w *Writer) rotate() {
+	// The previous rotated file must be done before it moves.
+	w.compressing.Wait()
+
+	keep := w.maxFiles - 1
+	if keep < 1 {
+		keep = 1
+	}
+	os.Remove(rotatedName(w.path, keep) + ".gz")
+	os.Remove(rotatedName(w.path, keep))
+	for i := keep - 1; i >= 1; i-- {
+		os.Rename(rotatedName(w.path, i)+".gz", rotatedName(w.path, i+1)+".gz")
+		os.Rename(rotatedName(w.path, i), rotatedName(w.path, i+1))
+	}
+
+	first := rotatedName(w.path, 1)
+	w.file.Close()
+	if err := os.Rename(w.path, first); err != nil {
+		log.Printf("Rotating %s: %v", w.path, err)
+	}
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		// Keep logging to wherever the old file went rather than nowhere.
+		log.Printf("Rotating %s: %v", w.path, err)
+		if file, err = os.OpenFile(first, os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+			return
+		}
+	}
+	w.file = file
+	w.size = 0
+
+	w.compressing.Add(1)
+	go func() {
+		defer w.compressing.Done()
+		if err := compressFile(first); err != nil {
+			log.Printf("Compressing %s: %v", first, err)
+		}
+	}()
+}
+
+func rotatedName(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// compressFile replaces path with path.gz. Readers never see a partial
+// .gz file: it is written under a temporary name first.
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := path + ".gz.tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	_, err = io.Copy(gz, in)
+	if cerr := gz.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Files returns the files of a log, oldest first: the rotated files,
+// compressed or not, then the active one.
+func Files(path string) []string {
+	matches, _ := filepath.Glob(path + ".*")
+	rotated := make(map[int]string)
+	for _, match := range matches {
+		suffix := strings.TrimPrefix(match, path+".")
+		n, err := strconv.Atoi(strings.TrimSuffix(suffix, ".gz"))
+		if err != nil || n < 1 {
+			continue
+		}
+		// While a file is being compressed both forms can exist for a
+		// moment; the .gz is complete once it has its name.
+		if _, seen := rotated[n]; !seen || strings.HasSuffix(match, ".gz") {
+			rotated[n] = match
+		}
+	}
+
+	numbers := make([]int, 0, len(rotated))
+	for n := range rotated {
+		numbers = append(numbers, n)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(numbers)))
+
+	files := make([]string, 0, len(numbers)+1)
+	for _, n := range numbers {
+		files = append(files, rotated[n])
+	}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	return files
+}
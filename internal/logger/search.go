@@ -0,0 +1,191 @@
+package logger
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Full-text search uses FTS5 when SQLite has it, which go-sqlite3 only
+// builds with the sqlite_fts5 tag, and otherwise FTS4 with a simpler
+// ranking.
+const (
+	moduleFTS5 = "fts5"
+	moduleFTS4 = "fts4"
+)
+
+// Hit is an entry matching a search, with the entries of its process
+// around it.
+type Hit struct {
+	Entry
+	// Rank orders the hits, best first; it only compares hits of one
+	// search.
+	Rank   float64 `json:"rank"`
+	Before []Entry `json:"before,omitempty"`
+	After  []Entry `json:"after,omitempty"`
+
+	id int64
+}
+
+// initSearch finds or creates the full-text index of the store. Without
+// a usable module the store works without search.
+func (s *Store) initSearch() {
+	var schema string
+	if err := s.db.QueryRow(`SELECT sql FROM sqlite_master WHERE name = 'entries_fts'`).Scan(&schema); err == nil {
+		module := moduleFTS4
+		if strings.Contains(strings.ToLower(schema), moduleFTS5) {
+			module = moduleFTS5
+		}
+		if _, err := s.db.Exec(`SELECT rowid FROM entries_fts LIMIT 0`); err != nil {
+			log.Printf("Log search unavailable: the index uses %s: %v", module, err)
+			return
+		}
+		s.fts = module
+		return
+	}
+
+	for _, create := range []struct{ module, sql string }{
+		{moduleFTS5, `CREATE VIRTUAL TABLE entries_fts USING fts5(message)`},
+		{moduleFTS4, `CREATE VIRTUAL TABLE entries_fts USING fts4(message, tokenize=unicode61)`},
+	} {
+		if _, err := s.db.Exec(create.sql); err == nil {
+			s.fts = create.module
+			return
+		}
+	}
+	log.Printf("Log search unavailable: SQLite has neither FTS5 nor FTS4")
+}
+
+// Search returns the best limit entries of processes, or of every
+// process, that match text and pass the filter, with up to context
+// entries before and after each. Only the entries of processes set to be
+// searchable are in the index. text is in the query syntax of SQLite
+// full-text search: words must all appear, "quoted words" as a phrase,
+// and OR, NOT and prefix* work as well.
+func (s *Store) Search(processes []string, text string, f *Filter, limit, context int) ([]Hit, error) {
+	if s.fts == "" {
+		return nil, fmt.Errorf("full-text search is not available in this build")
+	}
+	where, args := filterSQL(processes, f)
+	where = append([]string{"entries_fts MATCH ?"}, where...)
+	args = append([]interface{}{text}, args...)
+
+	rank := "-bm25(entries_fts)"
+	if s.fts == moduleFTS4 {
+		rank = "matchinfo(entries_fts, 'nx')"
+	}
+	query := "SELECT e.process, e.time, e.stream, e.level, e.message, e.fields, e.id, " + rank +
+		" FROM entries_fts JOIN entries e ON e.id = entries_fts.rowid WHERE " + strings.Join(where, " AND ")
+	if s.fts == moduleFTS5 {
+		// Best first, so that only as many rows as the limit needs are
+		// read. FTS4 has no ranking of its own: all hits are ranked here.
+		query += " ORDER BY bm25(entries_fts), e.time DESC"
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("search %q: %v", text, err)
+	}
+	var hits []Hit
+	for rows.Next() {
+		if s.fts == moduleFTS5 && limit >= 0 && len(hits) >= limit {
+			break
+		}
+		var hit Hit
+		var score interface{}
+		if err := scanEntry(rows, &hit.Entry, &hit.id, &score); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if !f.Match(&hit.Entry) {
+			continue
+		}
+		switch score := score.(type) {
+		case float64:
+			hit.Rank = score
+		case []byte:
+			hit.Rank = tfidf(score)
+		}
+		hits = append(hits, hit)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("search %q: %v", text, err)
+	}
+
+	if s.fts == moduleFTS4 {
+		sort.SliceStable(hits, func(i, j int) bool {
+			if hits[i].Rank != hits[j].Rank {
+				return hits[i].Rank > hits[j].Rank
+			}
+			return hits[i].Time.After(hits[j].Time)
+		})
+		if limit >= 0 && len(hits) > limit {
+			hits = hits[:limit]
+		}
+	}
+	if context > 0 {
+		for i := range hits {
+			if hits[i].Before, hits[i].After, err = s.around(hits[i].Process, hits[i].id, context); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return hits, nil
+}
+
+// around returns up to n entries of process before and after the entry
+// with id, in order.
+func (s *Store) around(process string, id int64, n int) (before, after []Entry, err error) {
+	if before, err = s.entries(`SELECT `+entryColumns+` FROM entries WHERE process = ? AND id < ? ORDER BY id DESC LIMIT ?`, process, id, n); err != nil {
+		return nil, nil, err
+	}
+	for i, j := 0, len(before)-1; i < j; i, j = i+1, j-1 {
+		before[i], before[j] = before[j], before[i]
+	}
+	after, err = s.entries(`SELECT `+entryColumns+` FROM entries WHERE process = ? AND id > ? ORDER BY id LIMIT ?`, process, id, n)
+	return before, after, err
+}
+
+func (s *Store) entries(query string, args ...interface{}) ([]Entry, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		if err := scanEntry(rows, &e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// tfidf scores an FTS4 hit from its matchinfo 'nx': the number of rows,
+// then for each phrase the hits in this row, the hits in all rows and the
+// rows with hits.
+func tfidf(info []byte) float64 {
+	values := make([]uint32, len(info)/4)
+	for i := range values {
+		values[i] = binary.NativeEndian.Uint32(info[i*4:])
+	}
+	if len(values) < 1 {
+		return 0
+	}
+	rows := float64(values[0])
+	score := 0.0
+	for i := 1; i+2 < len(values); i += 3 {
+		hits, withHits := float64(values[i]), float64(values[i+2])
+		if hits > 0 && withHits > 0 {
+			score += hits * math.Log(1+rows/withHits)
+		}
+	}
+	return score
+}
@@ -0,0 +1,391 @@
+package logger
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Entries are written to the store in batches, after at most
+// storeFlushInterval or once storeBatchSize are waiting.
+const (
+	storeFlushInterval = 500 * time.Millisecond
+	storeBatchSize     = 1000
+	storeQueueSize     = 10000
+)
+
+// DefaultRetention is how long the store keeps the entries of processes
+// without a retention of their own.
+const DefaultRetention = 7 * 24 * time.Hour
+
+// expireInterval is how often entries past their retention are deleted.
+const expireInterval = 10 * time.Minute
+
+// Store is an indexed database of the entries of captured logs, to query
+// them by level and fields without reading every file, and to search the
+// processes that want it by full text.
+type Store struct {
+	db      *sql.DB
+	fts     string // full-text search module, fts5 or fts4, or none
+	queue   chan Entry
+	dropped atomic.Int64
+	done    chan struct{}
+	mutex   sync.RWMutex // guards closed, so that Add never sends on a closed queue
+	closed  bool
+
+	optionsMutex sync.Mutex
+	options      map[string]storeOptions
+}
+
+// storeOptions are the settings of one process in the store.
+type storeOptions struct {
+	search    bool
+	retention time.Duration
+}
+
+// OpenStore opens the store at path, creating it if needed.
+func OpenStore(path string) (*Store, error) {
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	// One connection: writes are serialized anyway, and the WAL lets
+	// queries in between.
+	db.SetMaxOpenConns(1)
+
+	schema := `
+	CREATE TABLE IF NOT EXISTS entries (
+		id INTEGER PRIMARY KEY,
+		process TEXT NOT NULL,
+		time INTEGER NOT NULL,
+		stream TEXT NOT NULL,
+		level TEXT NOT NULL,
+		message TEXT NOT NULL,
+		fields TEXT
+	);
+	CREATE INDEX IF NOT EXISTS idx_entries_process_time ON entries(process, time);
+	CREATE INDEX IF NOT EXISTS idx_entries_process_level_time ON entries(process, level, time);
+
+	CREATE TABLE IF NOT EXISTS entry_fields (
+		entry_id INTEGER NOT NULL,
+		key TEXT NOT NULL,
+		value TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_entry_fields_key_value ON entry_fields(key, value, entry_id);
+	`
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &Store{
+		db:      db,
+		queue:   make(chan Entry, storeQueueSize),
+		done:    make(chan struct{}),
+		options: make(map[string]storeOptions),
+	}
+	s.initSearch()
+	go s.run()
+	return s, nil
+}
+
+// SetProcess sets whether the entries of process go to the full-text
+// search index and how long they are kept; zero keeps them for
+// DefaultRetention.
+func (s *Store) SetProcess(process string, search bool, retention time.Duration) {
+	s.optionsMutex.Lock()
+	s.options[process] = storeOptions{search: search, retention: retention}
+	s.optionsMutex.Unlock()
+}
+
+func (s *Store) searchable(process string) bool {
+	s.optionsMutex.Lock()
+	defer s.optionsMutex.Unlock()
+	return s.options[process].search
+}
+
+// Add queues an entry to be stored. It never blocks the process writing
+// the log: when the store falls behind, entries are dropped from it, but
+// not from the log files.
+func (s *Store) Add(e Entry) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- e:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Dropped returns how many entries were left out of the store because it
+// fell behind.
+func (s *Store) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Close stores the queued entries and closes the database.
+func (s *Store) Close() error {
+	s.mutex.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mutex.Unlock()
+	<-s.done
+	return s.db.Close()
+}
+
+func (s *Store) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(storeFlushInterval)
+	defer ticker.Stop()
+
+	var batch []Entry
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.insert(batch); err != nil {
+			log.Printf("Storing %d log entries: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case e, ok := <-s.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= storeBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (s *Store) insert(batch []Entry) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	insertEntry, err := tx.Prepare(`INSERT INTO entries (process, time, stream, level, message, fields) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insertEntry.Close()
+	insertField, err := tx.Prepare(`INSERT INTO entry_fields (entry_id, key, value) VALUES (?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insertField.Close()
+	var insertText *sql.Stmt
+	if s.fts != "" {
+		if insertText, err = tx.Prepare(`INSERT INTO entries_fts (rowid, message) VALUES (?, ?)`); err != nil {
+			return err
+		}
+		defer insertText.Close()
+	}
+
+	for _, e := range batch {
+		var fields interface{}
+		if len(e.Fields) > 0 {
+			out, _ := json.Marshal(e.Fields)
+			fields = string(out)
+		}
+		result, err := insertEntry.Exec(e.Process, e.Time.UnixNano(), e.Stream, e.Level, e.Message, fields)
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		for key, value := range e.Fields {
+			if _, err := insertField.Exec(id, key, value); err != nil {
+				return err
+			}
+		}
+		if insertText != nil && s.searchable(e.Process) {
+			if _, err := insertText.Exec(id, e.Message); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// EnforceRetention deletes the entries past the retention of their
+// process now and every expireInterval until the store is closed. Only
+// the store of the daemon does, as it knows the retention of every
+// process.
+func (s *Store) EnforceRetention() {
+	go func() {
+		ticker := time.NewTicker(expireInterval)
+		defer ticker.Stop()
+		for {
+			if err := s.expire(time.Now()); err != nil {
+				log.Printf("Deleting expired log entries: %v", err)
+			}
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// expire deletes the entries older than the retention of their process.
+func (s *Store) expire(now time.Time) error {
+	// Processes with a retention of their own, then all the others.
+	var conditions []string
+	var args [][]interface{}
+	var own []interface{}
+	s.optionsMutex.Lock()
+	for process, opts := range s.options {
+		if opts.retention > 0 {
+			conditions = append(conditions, "process = ? AND time < ?")
+			args = append(args, []interface{}{process, now.Add(-opts.retention).UnixNano()})
+			own = append(own, process)
+		}
+	}
+	s.optionsMutex.Unlock()
+	if len(own) > 0 {
+		conditions = append(conditions, "process NOT IN ("+placeholders(len(own))+") AND time < ?")
+	} else {
+		conditions = append(conditions, "time < ?")
+	}
+	args = append(args, append(own, now.Add(-DefaultRetention).UnixNano()))
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for i, condition := range conditions {
+		expired := "SELECT id FROM entries WHERE " + condition
+		statements := []string{"DELETE FROM entry_fields WHERE entry_id IN (" + expired + ")"}
+		if s.fts != "" {
+			statements = append(statements, "DELETE FROM entries_fts WHERE rowid IN ("+expired+")")
+		}
+		statements = append(statements, "DELETE FROM entries WHERE "+condition)
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement, args[i]...); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// Query returns the last limit entries of processes that pass the filter,
+// oldest first; a negative limit returns all of them. No processes means
+// every process.
+func (s *Store) Query(processes []string, f *Filter, limit int) ([]Entry, error) {
+	where, args := filterSQL(processes, f)
+	query := "SELECT " + entryColumns + " FROM entries"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	// Newest first, so that the regular expressions, which SQLite cannot
+	// apply, only look at as many rows as the limit needs.
+	query += " ORDER BY time DESC, id DESC"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() && (limit < 0 || len(entries) < limit) {
+		var e Entry
+		if err := scanEntry(rows, &e); err != nil {
+			return nil, err
+		}
+		if f.Match(&e) {
+			entries = append(entries, e)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// filterSQL returns the conditions on the entries table that select the
+// entries of processes passing f, except for its regular expressions.
+func filterSQL(processes []string, f *Filter) ([]string, []interface{}) {
+	var where []string
+	var args []interface{}
+	if len(processes) > 0 {
+		where = append(where, "process IN ("+placeholders(len(processes))+")")
+		for _, p := range processes {
+			args = append(args, p)
+		}
+	}
+	if !f.Since.IsZero() {
+		where = append(where, "time >= ?")
+		args = append(args, f.Since.UnixNano())
+	}
+	if !f.Until.IsZero() {
+		where = append(where, "time <= ?")
+		args = append(args, f.Until.UnixNano())
+	}
+	if f.Stream != "" {
+		where = append(where, "stream = ?")
+		args = append(args, f.Stream)
+	}
+	if f.Level != "" {
+		levels := levelsFrom(f.Level)
+		where = append(where, "level IN ("+placeholders(len(levels))+")")
+		for _, l := range levels {
+			args = append(args, l)
+		}
+	}
+	for key, value := range f.Fields {
+		where = append(where, "id IN (SELECT entry_id FROM entry_fields WHERE key = ? AND value = ?)")
+		args = append(args, key, value)
+	}
+	return where, args
+}
+
+// entryColumns are the columns scanEntry reads, in order.
+const entryColumns = "process, time, stream, level, message, fields"
+
+// scanEntry reads the entryColumns of a row, followed by dest.
+func scanEntry(rows *sql.Rows, e *Entry, dest ...interface{}) error {
+	var nanos int64
+	var fields sql.NullString
+	columns := append([]interface{}{&e.Process, &nanos, &e.Stream, &e.Level, &e.Message, &fields}, dest...)
+	if err := rows.Scan(columns...); err != nil {
+		return err
+	}
+	e.Time = time.Unix(0, nanos)
+	if fields.Valid {
+		json.Unmarshal([]byte(fields.String), &e.Fields)
+	}
+	return nil
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
@@ -0,0 +1,363 @@
+package logger
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"gproc/pkg/types"
+)
+
+// maxLineSize is the longest line kept in one entry; longer lines are
+// split into partial entries.
+const maxLineSize = 16 * 1024
+
+// maxEntrySize is the longest line handed to the sink whole; the rest of
+// a longer line is left out of the entry but not out of the file.
+const maxEntrySize = 256 * 1024
+
+// defaultMaxFiles is how many files a rotated log keeps when its rotation
+// does not say.
+const defaultMaxFiles = 5
+
+// Sink receives the entries of logs as they are written.
+type Sink interface {
+	Add(e Entry)
+}
+
+// Sinks hands every entry to each of its sinks in turn.
+type Sinks []Sink
+
+func (s Sinks) Add(e Entry) {
+	for _, sink := range s {
+		sink.Add(e)
+	}
+}
+
+// Writer writes the output of a process to its log file, one timestamped
+// entry per line, rotating the file when it grows too big. One Writer
+// serves every run of a process.
+type Writer struct {
+	mutex     sync.Mutex
+	process   string
+	path      string
+	file      *os.File
+	size      int64
+	maxSize   int64 // 0 disables rotation
+	maxFiles  int
+	parser    *Parser
+	multiline *Multiline
+	redactor  *Redactor
+	sink      Sink
+	// redactions counts the secrets redacted by rule, over every run.
+	redactions map[string]int64
+
+	compressing sync.WaitGroup
+}
+
+// NewWriter opens the log file of process at path for appending.
+func NewWriter(process, path string, rotation *types.LogRotation) (*Writer, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	w := &Writer{process: process, path: path, file: file, size: info.Size()}
+	if err := w.SetRotation(rotation); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Path returns the path of the active log file.
+func (w *Writer) Path() string {
+	return w.path
+}
+
+// SetRotation changes when the log is rotated; nil disables rotation.
+func (w *Writer) SetRotation(rotation *types.LogRotation) error {
+	var maxSize int64
+	maxFiles := defaultMaxFiles
+	if rotation != nil && rotation.MaxSize != "" {
+		size, err := ParseSize(rotation.MaxSize)
+		if err != nil {
+			return err
+		}
+		maxSize = size
+		if rotation.MaxFiles > 0 {
+			maxFiles = rotation.MaxFiles
+		}
+	}
+
+	w.mutex.Lock()
+	w.maxSize = maxSize
+	w.maxFiles = maxFiles
+	w.mutex.Unlock()
+	return nil
+}
+
+// SetParser sets the parser of the entries handed to the sink; nil
+// hands them on as plain lines.
+func (w *Writer) SetParser(p *Parser) {
+	w.mutex.Lock()
+	w.parser = p
+	w.mutex.Unlock()
+}
+
+// SetMultiline sets the rule joining the lines of one event into an
+// entry; nil makes every line an entry.
+func (w *Writer) SetMultiline(m *Multiline) {
+	w.mutex.Lock()
+	w.multiline = m
+	w.mutex.Unlock()
+}
+
+// SetRedactor sets the rules masking secrets in the output before it is
+// written anywhere; nil writes it as it is.
+func (w *Writer) SetRedactor(r *Redactor) {
+	w.mutex.Lock()
+	w.redactor = r
+	w.mutex.Unlock()
+}
+
+// Redactions returns the number of secrets redacted by each rule.
+func (w *Writer) Redactions() map[string]int64 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	counts := make(map[string]int64, len(w.redactions))
+	for rule, n := range w.redactions {
+		counts[rule] = n
+	}
+	return counts
+}
+
+// SetSink sets where whole lines, or events, go as entries after they are
+// written to the file.
+func (w *Writer) SetSink(sink Sink) {
+	w.mutex.Lock()
+	w.sink = sink
+	w.mutex.Unlock()
+}
+
+// Close closes the log file, waiting for a rotated file being compressed.
+func (w *Writer) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.compressing.Wait()
+	return w.file.Close()
+}
+
+// Stream returns a writer for one output stream. It turns what is written
+// into entries line by line; Close writes a last unterminated line.
+func (w *Writer) Stream(stream string) io.WriteCloser {
+	return &lineWriter{w: w, stream: stream}
+}
+
+// Pipe returns the write end of a pipe whose output goes to stream, to
+// hand to a child process. The caller closes it once the child has it;
+// the log sees the end of the stream once every holder closed it.
+func (w *Writer) Pipe(stream string) (*os.File, error) {
+	r, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		out := w.Stream(stream)
+		io.Copy(out, r)
+		out.Close()
+		r.Close()
+	}()
+	return pw, nil
+}
+
+// writePartial writes the leading piece of a line too long for one entry,
+// and returns it as written.
+func (w *Writer) writePartial(stream string, piece []byte) []byte {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	piece = w.redact(piece)
+	w.writeLine(formatLine(time.Now(), stream, tagPartial, piece))
+	return piece
+}
+
+// redact masks the secrets in a line. The caller holds w.mutex.
+func (w *Writer) redact(line []byte) []byte {
+	if w.redactor == nil {
+		return line
+	}
+	if w.redactions == nil {
+		w.redactions = make(map[string]int64)
+	}
+	return w.redactor.Redact(line, w.redactions)
+}
+
+// writeEvent writes the lines of one event to the file, and hands the
+// event to the sink, after head, the pieces of its first line written
+// before.
+func (w *Writer) writeEvent(stream string, lines [][]byte, head []byte) {
+	w.mutex.Lock()
+	// The time is taken under the lock so that entries are in time order
+	// in the file.
+	now := time.Now()
+	if w.redactor != nil {
+		redacted := make([][]byte, len(lines))
+		for i, line := range lines {
+			redacted[i] = w.redact(line)
+		}
+		lines = redacted
+	}
+	for i, line := range lines {
+		for len(line) > maxLineSize {
+			w.writeLine(formatLine(now, stream, tagPartial, line[:maxLineSize]))
+			line = line[maxLineSize:]
+		}
+		tag := tagFull
+		if i < len(lines)-1 {
+			tag = tagLine
+		}
+		w.writeLine(formatLine(now, stream, tag, line))
+	}
+	parser, sink := w.parser, w.sink
+	w.mutex.Unlock()
+
+	if sink == nil {
+		return
+	}
+	message := append(head, bytes.Join(lines, []byte("\n"))...)
+	if len(message) > maxEntrySize {
+		message = message[:maxEntrySize]
+	}
+	e := Entry{Time: now, Process: w.process, Stream: stream, Message: string(message)}
+	if parser != nil {
+		parser.Parse(&e)
+	}
+	sink.Add(e)
+}
+
+// writeLine writes a formatted line, rotating the file first when it
+// would grow too big. The caller holds w.mutex.
+func (w *Writer) writeLine(line []byte) {
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(line)) > w.maxSize {
+		w.rotate()
+	}
+	n, _ := w.file.Write(line)
+	w.size += int64(n)
+}
+
+// lineWriter splits the output of one stream into lines, joining those of
+// one event when the log has a multi-line rule.
+type lineWriter struct {
+	mutex  sync.Mutex // the flush timer writes too
+	w      *Writer
+	stream string
+	buf    []byte
+	head   []byte // the partial pieces written of the current line
+
+	event     [][]byte // lines of the pending multi-line event
+	eventSize int
+	timer     *time.Timer
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.mutex.Lock()
+	defer lw.mutex.Unlock()
+
+	lw.buf = append(lw.buf, p...)
+	for {
+		i := bytes.IndexByte(lw.buf, '\n')
+		if i < 0 {
+			break
+		}
+		lw.line(bytes.TrimSuffix(lw.buf[:i], []byte("\r")))
+		lw.buf = lw.buf[i+1:]
+	}
+	for len(lw.buf) >= maxLineSize {
+		// A line this long ends the pending event, which must be in the
+		// file before its first piece.
+		lw.flush()
+		piece := lw.w.writePartial(lw.stream, lw.buf[:maxLineSize])
+		if len(lw.head) < maxEntrySize {
+			lw.head = append(lw.head, piece...)
+		}
+		lw.buf = lw.buf[maxLineSize:]
+	}
+	// Keep the buffer from growing with the unused head of old lines.
+	lw.buf = append([]byte(nil), lw.buf...)
+	return len(p), nil
+}
+
+// line handles a complete line. The caller holds lw.mutex.
+func (lw *lineWriter) line(line []byte) {
+	if lw.head != nil {
+		head := lw.head
+		lw.head = nil
+		lw.w.writeEvent(lw.stream, [][]byte{line}, head)
+		return
+	}
+	lw.w.mutex.Lock()
+	rule := lw.w.multiline
+	lw.w.mutex.Unlock()
+	if rule == nil {
+		lw.flush()
+		lw.w.writeEvent(lw.stream, [][]byte{line}, nil)
+		return
+	}
+
+	if lw.event != nil && rule.continues(line) &&
+		len(lw.event) < rule.maxLines && lw.eventSize+len(line) < maxEntrySize {
+		lw.event = append(lw.event, append([]byte(nil), line...))
+		lw.eventSize += len(line) + 1
+		lw.timer.Reset(rule.timeout)
+		return
+	}
+	lw.flush()
+	if !rule.starts(line) {
+		lw.w.writeEvent(lw.stream, [][]byte{line}, nil)
+		return
+	}
+	lw.event = [][]byte{append([]byte(nil), line...)}
+	lw.eventSize = len(line)
+	if lw.timer == nil {
+		lw.timer = time.AfterFunc(rule.timeout, lw.expire)
+	} else {
+		lw.timer.Reset(rule.timeout)
+	}
+}
+
+// flush writes the pending event. The caller holds lw.mutex.
+func (lw *lineWriter) flush() {
+	if lw.event == nil {
+		return
+	}
+	lw.w.writeEvent(lw.stream, lw.event, nil)
+	lw.event = nil
+	lw.eventSize = 0
+	if lw.timer != nil {
+		lw.timer.Stop()
+	}
+}
+
+// expire ends the pending event once no line followed it in time.
+func (lw *lineWriter) expire() {
+	lw.mutex.Lock()
+	lw.flush()
+	lw.mutex.Unlock()
+}
+
+func (lw *lineWriter) Close() error {
+	lw.mutex.Lock()
+	defer lw.mutex.Unlock()
+	if len(lw.buf) > 0 || lw.head != nil {
+		lw.line(bytes.TrimSuffix(lw.buf, []byte("\r")))
+		lw.buf = nil
+	}
+	lw.flush()
+	return nil
+}
@@ -3,16 +3,28 @@ package logging
 import (
 	"context"
 	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
 	"time"
 
+	"gproc/internal/logger"
 	"gproc/pkg/types"
 )
 
+// AggregationManager ships the logs of the processes to external log
+// stores, each through its own pipeline that batches, compresses and
+// retries, buffering on disk while the store is down.
 type AggregationManager struct {
 	config    *types.LogAggregationConfig
 	providers map[string]LogProvider
+	pipelines map[string]*Pipeline
+	nodeID    string
+	mutex     sync.RWMutex
 }
 
+// LogProvider is an external log store.
 type LogProvider interface {
 	SendLogs(ctx context.Context, logs []LogEntry) error
 	Query(ctx context.Context, query LogQuery) ([]LogEntry, error)
@@ -25,6 +37,8 @@ type LogEntry struct {
 	ProcessID   string            `json:"process_id"`
 	ProcessName string            `json:"process_name"`
 	NodeID      string            `json:"node_id"`
+	Stream      string            `json:"stream,omitempty"`
+	Fields      map[string]string `json:"fields,omitempty"`
 }
 
 type LogQuery struct {
@@ -35,29 +49,132 @@ type LogQuery struct {
 	Limit       int       `json:"limit,omitempty"`
 }
 
-type ElasticSearchProvider struct {
-	endpoint string
-}
-
 func NewAggregationManager(config *types.LogAggregationConfig) *AggregationManager {
+	nodeID, _ := os.Hostname()
 	return &AggregationManager{
 		config:    config,
 		providers: make(map[string]LogProvider),
+		pipelines: make(map[string]*Pipeline),
+		nodeID:    nodeID,
 	}
 }
 
-func (a *AggregationManager) SendLog(ctx context.Context, entry LogEntry) error {
-	for _, provider := range a.providers {
-		provider.SendLogs(ctx, []LogEntry{entry})
+// Start creates the provider of the configuration and starts shipping to
+// it. Outage buffers go under dataDir unless the configuration sets
+// buffer_dir.
+func (a *AggregationManager) Start(dataDir string) error {
+	if a.config == nil || a.config.Provider == "" {
+		return nil
+	}
+	provider, err := NewProvider(a.config.Provider, a.config.Config)
+	if err != nil {
+		return err
 	}
+	opts, err := ParsePipelineOptions(a.config.Config)
+	if err != nil {
+		return err
+	}
+	if opts.BufferDir == "" {
+		opts.BufferDir = filepath.Join(dataDir, "shipping", a.config.Provider)
+	}
+	return a.AddProvider(a.config.Provider, provider, opts)
+}
+
+// AddProvider starts shipping to provider under name.
+func (a *AggregationManager) AddProvider(name string, provider LogProvider, opts PipelineOptions) error {
+	pipeline, err := NewPipeline(name, provider, opts)
+	if err != nil {
+		return err
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if old := a.pipelines[name]; old != nil {
+		old.Close()
+	}
+	a.providers[name] = provider
+	a.pipelines[name] = pipeline
 	return nil
 }
 
-func (e *ElasticSearchProvider) SendLogs(ctx context.Context, logs []LogEntry) error {
-	fmt.Printf("Sending %d logs to ElasticSearch\n", len(logs))
+// SendLog queues an entry for every provider. It does not wait for the
+// entry to be shipped.
+func (a *AggregationManager) SendLog(ctx context.Context, entry LogEntry) error {
+	if entry.NodeID == "" {
+		entry.NodeID = a.nodeID
+	}
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	for _, pipeline := range a.pipelines {
+		pipeline.Add(entry)
+	}
 	return nil
 }
 
-func (e *ElasticSearchProvider) Query(ctx context.Context, query LogQuery) ([]LogEntry, error) {
-	return []LogEntry{}, nil
-}
\ No newline at end of file
+// Query asks the named provider for logs.
+func (a *AggregationManager) Query(ctx context.Context, name string, query LogQuery) ([]LogEntry, error) {
+	a.mutex.RLock()
+	provider := a.providers[name]
+	a.mutex.RUnlock()
+	if provider == nil {
+		return nil, fmt.Errorf("no log provider %s", name)
+	}
+	return provider.Query(ctx, query)
+}
+
+// Stats returns the state of the pipeline of each provider.
+func (a *AggregationManager) Stats() map[string]PipelineStats {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	stats := make(map[string]PipelineStats, len(a.pipelines))
+	for name, pipeline := range a.pipelines {
+		stats[name] = pipeline.Stats()
+	}
+	return stats
+}
+
+// Close ships or buffers what is queued and stops the pipelines.
+func (a *AggregationManager) Close() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for name, pipeline := range a.pipelines {
+		if err := pipeline.Close(); err != nil {
+			log.Printf("Closing log shipping to %s: %v", name, err)
+		}
+	}
+}
+
+// Sink returns the log sink of one process, for logger.Writer.
+func (a *AggregationManager) Sink(processID string) logger.Sink {
+	return processSink{manager: a, processID: processID}
+}
+
+type processSink struct {
+	manager   *AggregationManager
+	processID string
+}
+
+func (s processSink) Add(e logger.Entry) {
+	s.manager.SendLog(context.Background(), LogEntry{
+		Timestamp:   e.Time,
+		Level:       e.Level,
+		Message:     e.Message,
+		ProcessID:   s.processID,
+		ProcessName: e.Process,
+		Stream:      e.Stream,
+		Fields:      e.Fields,
+	})
+}
+
+// NewProvider returns the provider named by a log aggregation
+// configuration: elasticsearch, loki or splunk.
+func NewProvider(name string, config map[string]string) (LogProvider, error) {
+	switch name {
+	case "elasticsearch":
+		return NewElasticSearchProvider(config)
+	case "loki":
+		return NewLokiProvider(config)
+	case "splunk":
+		return NewSplunkProvider(config)
+	}
+	return nil, fmt.Errorf("unknown log provider %q, expected elasticsearch, loki or splunk", name)
+}
@@ -0,0 +1,194 @@
+package logging
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// segmentSuffix ends the name of every file of a disk buffer.
+const segmentSuffix = ".ndjson.gz"
+
+// diskBuffer keeps the batches a pipeline could not send, one gzipped
+// file of JSON lines per batch named <sequence>-<entries>, until they
+// are sent or it grows past its size and drops the oldest.
+type diskBuffer struct {
+	dir     string
+	maxSize int64
+	size    atomic.Int64
+
+	mutex    sync.Mutex
+	segments []string // oldest first
+	next     uint64
+}
+
+func openDiskBuffer(dir string, maxSize int64) (*diskBuffer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	b := &diskBuffer{dir: dir, maxSize: maxSize}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasSuffix(name, ".tmp") {
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		seq, _, ok := parseSegmentName(name)
+		if !ok {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			b.size.Add(info.Size())
+		}
+		b.segments = append(b.segments, name)
+		if seq >= b.next {
+			b.next = seq + 1
+		}
+	}
+	// Zero-padded sequence numbers sort in order.
+	sort.Strings(b.segments)
+	return b, nil
+}
+
+func parseSegmentName(name string) (seq uint64, count int, ok bool) {
+	base, found := strings.CutSuffix(name, segmentSuffix)
+	if !found {
+		return 0, 0, false
+	}
+	if _, err := fmt.Sscanf(base, "%d-%d", &seq, &count); err != nil {
+		return 0, 0, false
+	}
+	return seq, count, true
+}
+
+// Size returns the bytes buffered.
+func (b *diskBuffer) Size() int64 {
+	return b.size.Load()
+}
+
+// Empty reports whether nothing is buffered.
+func (b *diskBuffer) Empty() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.segments) == 0
+}
+
+// Push buffers a batch and returns how many entries were dropped to stay
+// within the size of the buffer.
+func (b *diskBuffer) Push(batch []LogEntry) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	name := fmt.Sprintf("%020d-%d%s", b.next, len(batch), segmentSuffix)
+	path := filepath.Join(b.dir, name)
+	if err := writeSegment(path, batch); err != nil {
+		return 0, err
+	}
+	b.next++
+	b.segments = append(b.segments, name)
+	if info, err := os.Stat(path); err == nil {
+		b.size.Add(info.Size())
+	}
+
+	dropped := 0
+	for b.size.Load() > b.maxSize && len(b.segments) > 1 {
+		_, count, _ := parseSegmentName(b.segments[0])
+		b.remove(b.segments[0])
+		dropped += count
+	}
+	return dropped, nil
+}
+
+func writeSegment(path string, batch []LogEntry) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(file)
+	enc := json.NewEncoder(gz)
+	for i := range batch {
+		if err = enc.Encode(&batch[i]); err != nil {
+			break
+		}
+	}
+	if cerr := gz.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// Oldest reads the oldest buffered batch.
+func (b *diskBuffer) Oldest() (string, []LogEntry, error) {
+	b.mutex.Lock()
+	if len(b.segments) == 0 {
+		b.mutex.Unlock()
+		return "", nil, nil
+	}
+	name := b.segments[0]
+	b.mutex.Unlock()
+
+	file, err := os.Open(filepath.Join(b.dir, name))
+	if err != nil {
+		return name, nil, err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return name, nil, err
+	}
+	defer gz.Close()
+
+	var batch []LogEntry
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e LogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return name, nil, err
+		}
+		batch = append(batch, e)
+	}
+	return name, batch, scanner.Err()
+}
+
+// Remove deletes a buffered batch.
+func (b *diskBuffer) Remove(name string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.remove(name)
+}
+
+func (b *diskBuffer) remove(name string) {
+	path := filepath.Join(b.dir, name)
+	if info, err := os.Stat(path); err == nil {
+		b.size.Add(-info.Size())
+	}
+	os.Remove(path)
+	for i, segment := range b.segments {
+		if segment == name {
+			b.segments = append(b.segments[:i], b.segments[i+1:]...)
+			break
+		}
+	}
+}
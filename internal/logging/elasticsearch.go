@@ -0,0 +1,174 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultIndex is the Elasticsearch index of the logs when the
+// configuration does not set index.
+const defaultIndex = "gproc-logs"
+
+// ElasticSearchProvider ships logs with the bulk API of Elasticsearch
+// (or OpenSearch). Configuration: url, index, and api_key or username
+// and password.
+type ElasticSearchProvider struct {
+	endpoint string
+	index    string
+	client   *httpClient
+}
+
+func NewElasticSearchProvider(config map[string]string) (*ElasticSearchProvider, error) {
+	endpoint := strings.TrimSuffix(config["url"], "/")
+	if endpoint == "" {
+		return nil, fmt.Errorf("elasticsearch needs a url")
+	}
+	client, err := newHTTPClient(config)
+	if err != nil {
+		return nil, err
+	}
+	if key := config["api_key"]; key != "" {
+		client.header.Set("Authorization", "ApiKey "+key)
+	} else if config["username"] != "" {
+		client.header.Set("Authorization", basicAuth(config["username"], config["password"]))
+	}
+	index := config["index"]
+	if index == "" {
+		index = defaultIndex
+	}
+	return &ElasticSearchProvider{endpoint: endpoint, index: index, client: client}, nil
+}
+
+// SendLogs indexes a batch. Every entry gets an ID derived from its
+// content and is only created, so that sending a batch again after a
+// partial failure does not duplicate what was indexed the first time.
+func (e *ElasticSearchProvider) SendLogs(ctx context.Context, logs []LogEntry) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for i := range logs {
+		action := map[string]map[string]string{"create": {"_index": e.index, "_id": documentID(&logs[i])}}
+		if err := enc.Encode(action); err != nil {
+			return err
+		}
+		if err := enc.Encode(&logs[i]); err != nil {
+			return err
+		}
+	}
+	data, err := e.client.do(ctx, "POST", e.endpoint+"/_bulk", "application/x-ndjson", body.Bytes())
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return fmt.Errorf("invalid bulk response: %v", err)
+	}
+	if !resp.Errors {
+		return nil
+	}
+	retry, rejected, reason := 0, 0, ""
+	for _, item := range resp.Items {
+		for _, result := range item {
+			switch {
+			case result.Status < 300, result.Status == 409:
+				// Created now, or by an earlier try.
+			case result.Status == 429 || result.Status >= 500:
+				retry++
+			default:
+				rejected++
+				if reason == "" {
+					reason = result.Error.Type + ": " + result.Error.Reason
+				}
+			}
+		}
+	}
+	if rejected > 0 {
+		log.Printf("Elasticsearch rejected %d of %d log entries: %s", rejected, len(logs), reason)
+	}
+	if retry > 0 {
+		return fmt.Errorf("elasticsearch could not index %d of %d entries now", retry, len(logs))
+	}
+	return nil
+}
+
+// Query returns the last query.Limit entries (100 by default) matching
+// the query, oldest first.
+func (e *ElasticSearchProvider) Query(ctx context.Context, query LogQuery) ([]LogEntry, error) {
+	var filters []interface{}
+	if query.ProcessName != "" {
+		filters = append(filters, map[string]interface{}{"match_phrase": map[string]string{"process_name": query.ProcessName}})
+	}
+	if query.Level != "" {
+		filters = append(filters, map[string]interface{}{"match_phrase": map[string]string{"level": query.Level}})
+	}
+	if !query.StartTime.IsZero() || !query.EndTime.IsZero() {
+		bounds := make(map[string]string)
+		if !query.StartTime.IsZero() {
+			bounds["gte"] = query.StartTime.Format(time.RFC3339Nano)
+		}
+		if !query.EndTime.IsZero() {
+			bounds["lte"] = query.EndTime.Format(time.RFC3339Nano)
+		}
+		filters = append(filters, map[string]interface{}{"range": map[string]interface{}{"@timestamp": bounds}})
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	search := map[string]interface{}{
+		"size":  limit,
+		"sort":  []interface{}{map[string]string{"@timestamp": "desc"}},
+		"query": map[string]interface{}{"bool": map[string]interface{}{"filter": filters}},
+	}
+	body, err := json.Marshal(search)
+	if err != nil {
+		return nil, err
+	}
+	data, err := e.client.do(ctx, "POST", e.endpoint+"/"+e.index+"/_search", "application/json", body)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Hits struct {
+			Hits []struct {
+				Source LogEntry `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("invalid search response: %v", err)
+	}
+	logs := make([]LogEntry, len(resp.Hits.Hits))
+	for i, hit := range resp.Hits.Hits {
+		logs[len(logs)-1-i] = hit.Source
+	}
+	return logs, nil
+}
+
+// documentID identifies an entry by its content.
+func documentID(e *LogEntry) string {
+	h := sha1.New()
+	for _, part := range []string{e.NodeID, e.ProcessID, e.ProcessName, e.Stream, strconv.FormatInt(e.Timestamp.UnixNano(), 10), e.Message} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,146 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestElasticsearchBulk(t *testing.T) {
+	var requests []*http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		body = readBody(t, r)
+		fmt.Fprint(w, `{"errors":false,"items":[]}`)
+	}))
+	defer server.Close()
+
+	es, err := NewElasticSearchProvider(map[string]string{"url": server.URL + "/", "index": "logs", "api_key": "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := testEntries()
+	if err := es.SendLogs(context.Background(), entries); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(requests))
+	}
+	r := requests[0]
+	if r.Method != "POST" || r.URL.Path != "/_bulk" {
+		t.Errorf("got %s %s, want POST /_bulk", r.Method, r.URL.Path)
+	}
+	if got := r.Header.Get("Authorization"); got != "ApiKey secret" {
+		t.Errorf("got Authorization %q", got)
+	}
+	if got := r.Header.Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("got Content-Type %q", got)
+	}
+	if got := r.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("got Content-Encoding %q, want gzip by default", got)
+	}
+
+	// An action line, then the document, for every entry in turn.
+	lines := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+	if len(lines) != 2*len(entries) {
+		t.Fatalf("got %d lines, want %d", len(lines), 2*len(entries))
+	}
+	for i := range entries {
+		var action map[string]map[string]string
+		if err := json.Unmarshal([]byte(lines[2*i]), &action); err != nil {
+			t.Fatal(err)
+		}
+		create := action["create"]
+		if create["_index"] != "logs" || create["_id"] != documentID(&entries[i]) {
+			t.Errorf("entry %d: got action %s", i, lines[2*i])
+		}
+		var doc LogEntry
+		if err := json.Unmarshal([]byte(lines[2*i+1]), &doc); err != nil {
+			t.Fatal(err)
+		}
+		if doc.Message != entries[i].Message || !doc.Timestamp.Equal(entries[i].Timestamp) || doc.ProcessName != entries[i].ProcessName {
+			t.Errorf("entry %d: got document %s", i, lines[2*i+1])
+		}
+	}
+
+	// The same entries keep their IDs, so a retry cannot duplicate them.
+	if id := documentID(&testEntries()[0]); id != documentID(&entries[0]) || id == documentID(&entries[1]) {
+		t.Error("document IDs do not follow the content of the entries")
+	}
+}
+
+func TestElasticsearchItemErrors(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		statuses []int
+		retry    bool
+	}{
+		{"created", []int{201, 201, 201}, false},
+		// Indexed by an earlier try of the same batch.
+		{"conflict", []int{201, 409, 201}, false},
+		// Sending a malformed document again cannot help.
+		{"rejected", []int{201, 400, 201}, false},
+		{"throttled", []int{201, 429, 201}, true},
+		{"unavailable", []int{409, 201, 503}, true},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var items bytes.Buffer
+			failed := false
+			for i, status := range test.statuses {
+				if i > 0 {
+					items.WriteByte(',')
+				}
+				item := fmt.Sprintf(`{"create":{"status":%d}}`, status)
+				if status >= 300 {
+					failed = true
+					item = fmt.Sprintf(`{"create":{"status":%d,"error":{"type":"mapper_parsing_exception","reason":"bad field"}}}`, status)
+				}
+				items.WriteString(item)
+			}
+			fmt.Fprintf(w, `{"errors":%v,"items":[%s]}`, failed, items.String())
+		}))
+
+		es, err := NewElasticSearchProvider(map[string]string{"url": server.URL, "compression": "none"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = es.SendLogs(context.Background(), testEntries())
+		server.Close()
+		if (err != nil) != test.retry {
+			t.Errorf("%s: got error %v, want one: %v", test.name, err, test.retry)
+		}
+		if err != nil && Permanent(err) {
+			t.Errorf("%s: items to retry make a permanent error", test.name)
+		}
+	}
+}
+
+func TestElasticsearchRequestErrors(t *testing.T) {
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		fmt.Fprint(w, `not json`)
+	}))
+	defer server.Close()
+
+	es, err := NewElasticSearchProvider(map[string]string{"url": server.URL, "username": "elastic", "password": "pw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := es.SendLogs(context.Background(), testEntries()); err == nil || !strings.Contains(err.Error(), "invalid bulk response") {
+		t.Errorf("got %v, want an invalid bulk response", err)
+	}
+	if auth != basicAuth("elastic", "pw") {
+		t.Errorf("got Authorization %q, want basic credentials", auth)
+	}
+	if _, err := NewElasticSearchProvider(map[string]string{}); err == nil {
+		t.Error("a provider without a url was created")
+	}
+}
@@ -0,0 +1,120 @@
+package logging
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// StatusError is an error response of a log store.
+type StatusError struct {
+	Status int
+	Body   string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("HTTP %d", e.Status)
+	}
+	return fmt.Sprintf("HTTP %d: %s", e.Status, e.Body)
+}
+
+// Permanent reports whether sending the same batch again cannot succeed:
+// the store rejected it as malformed or too large. Anything else, like
+// an outage, throttling or bad credentials, may pass later.
+func Permanent(err error) bool {
+	var status *StatusError
+	if !errors.As(err, &status) {
+		return false
+	}
+	switch status.Status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// httpClient talks to the HTTP API of a log store.
+type httpClient struct {
+	client   *http.Client
+	compress bool
+	header   http.Header
+}
+
+// newHTTPClient reads the settings every HTTP provider has: compression
+// (gzip, the default, or none) and insecure_skip_verify.
+func newHTTPClient(config map[string]string) (*httpClient, error) {
+	c := &httpClient{client: &http.Client{}, compress: true, header: make(http.Header)}
+	switch config["compression"] {
+	case "", "gzip":
+	case "none":
+		c.compress = false
+	default:
+		return nil, fmt.Errorf("unknown compression %q, expected gzip or none", config["compression"])
+	}
+	if config["insecure_skip_verify"] == "true" {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		c.client.Transport = transport
+	}
+	return c, nil
+}
+
+// do sends a request and returns the body of a successful response.
+func (c *httpClient) do(ctx context.Context, method, url, contentType string, body []byte) ([]byte, error) {
+	var reader io.Reader
+	encoding := ""
+	if body != nil {
+		if c.compress {
+			var compressed bytes.Buffer
+			gz := gzip.NewWriter(&compressed)
+			gz.Write(body)
+			gz.Close()
+			body = compressed.Bytes()
+			encoding = "gzip"
+		}
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range c.header {
+		req.Header[key] = values
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16*1024*1024))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		text := strings.TrimSpace(string(data))
+		if len(text) > 512 {
+			text = text[:512] + "..."
+		}
+		return nil, &StatusError{Status: resp.StatusCode, Body: text}
+	}
+	return data, nil
+}
+
+func basicAuth(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
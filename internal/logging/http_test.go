@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testEntries are two processes' entries, not in time order.
+func testEntries() []LogEntry {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return []LogEntry{
+		{Timestamp: base.Add(2 * time.Second), Level: "info", Message: "second", ProcessID: "web", ProcessName: "web", NodeID: "n1", Stream: "stdout"},
+		{Timestamp: base, Level: "info", Message: "first", ProcessID: "web", ProcessName: "web", NodeID: "n1", Stream: "stdout",
+			Fields: map[string]string{"user": "ann", "path": "/a b"}},
+		{Timestamp: base.Add(time.Second), Level: "error", Message: "failed", ProcessID: "worker", ProcessName: "worker", NodeID: "n1", Stream: "stderr"},
+	}
+}
+
+// readBody returns the body of a request the providers sent, gunzipped.
+func readBody(t *testing.T, r *http.Request) []byte {
+	t.Helper()
+	var reader io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("invalid gzip body: %v", err)
+			return nil
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Errorf("read body: %v", err)
+	}
+	return data
+}
+
+func TestPermanent(t *testing.T) {
+	for _, test := range []struct {
+		status    int
+		permanent bool
+	}{
+		{http.StatusBadRequest, true},
+		{http.StatusRequestEntityTooLarge, true},
+		{http.StatusUnprocessableEntity, true},
+		{http.StatusUnauthorized, false},
+		{http.StatusTooManyRequests, false},
+		{http.StatusServiceUnavailable, false},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "nope", test.status)
+		}))
+		client, err := newHTTPClient(map[string]string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = client.do(context.Background(), "POST", server.URL, "application/json", []byte("{}"))
+		server.Close()
+
+		status, ok := err.(*StatusError)
+		if !ok || status.Status != test.status || status.Body != "nope" {
+			t.Errorf("HTTP %d: got error %v", test.status, err)
+		}
+		if Permanent(err) != test.permanent {
+			t.Errorf("HTTP %d: Permanent is %v, want %v", test.status, !test.permanent, test.permanent)
+		}
+	}
+}
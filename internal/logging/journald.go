@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+
+	"gproc/internal/logger"
+)
+
+// journalSocket is where journald reads entries in its native protocol.
+const journalSocket = "/run/systemd/journal/socket"
+
+// journalSink sends the entries of one process to the systemd journal,
+// with the fields GPROC_PROCESS (the name of the process), GPROC_INSTANCE
+// (its ID) and STREAM besides the usual ones.
+type journalSink struct {
+	sender     *sender
+	identifier string
+	facility   int // -1 for none
+	process    string
+	instance   string
+}
+
+func (s *journalSink) Add(e logger.Entry) {
+	var b bytes.Buffer
+	message := e.Message
+	if len(e.Fields) > 0 {
+		message += " " + logger.FormatFields(e.Fields)
+	}
+	journalField(&b, "MESSAGE", message)
+	journalField(&b, "PRIORITY", strconv.Itoa(severity(&e)))
+	journalField(&b, "SYSLOG_IDENTIFIER", s.identifier)
+	if s.facility >= 0 {
+		journalField(&b, "SYSLOG_FACILITY", strconv.Itoa(s.facility))
+	}
+	journalField(&b, "GPROC_PROCESS", s.process)
+	journalField(&b, "GPROC_INSTANCE", s.instance)
+	if e.Stream != "" {
+		journalField(&b, "STREAM", e.Stream)
+	}
+	s.sender.Send(b.Bytes())
+}
+
+// journalField writes a field in the native protocol: NAME=value, or for
+// values with newlines the name, the length of the value as a 64-bit
+// little-endian integer and the value.
+func journalField(b *bytes.Buffer, name, value string) {
+	b.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
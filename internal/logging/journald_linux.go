@@ -0,0 +1,61 @@
+//go:build linux
+
+package logging
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// journalConn is a socket sending to journald. It is not connected, as
+// a connected socket cannot pass file descriptors.
+type journalConn struct {
+	conn *net.UnixConn
+	addr *net.UnixAddr
+}
+
+func dialJournal() (transport, error) {
+	addr := &net.UnixAddr{Name: journalSocket, Net: "unixgram"}
+	if _, err := os.Stat(journalSocket); err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journalConn{conn: conn, addr: addr}, nil
+}
+
+// Send sends an entry in one datagram, or when it is too big for one, in
+// a sealed memory file passed to journald.
+func (c *journalConn) Send(msg []byte) error {
+	c.conn.SetWriteDeadline(time.Now().Add(systemSendTimeout))
+	_, _, err := c.conn.WriteMsgUnix(msg, nil, c.addr)
+	if !errors.Is(err, syscall.EMSGSIZE) && !errors.Is(err, syscall.ENOBUFS) {
+		return err
+	}
+
+	fd, err := unix.MemfdCreate("journal-entry", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return err
+	}
+	file := os.NewFile(uintptr(fd), "journal-entry")
+	defer file.Close()
+	if _, err := file.Write(msg); err != nil {
+		return err
+	}
+	if _, err := unix.FcntlInt(uintptr(fd), unix.F_ADD_SEALS, unix.F_SEAL_SHRINK|unix.F_SEAL_GROW|unix.F_SEAL_WRITE|unix.F_SEAL_SEAL); err != nil {
+		return err
+	}
+	_, _, err = c.conn.WriteMsgUnix(nil, unix.UnixRights(fd), c.addr)
+	return err
+}
+
+func (c *journalConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package logging
+
+import "errors"
+
+func dialJournal() (transport, error) {
+	return nil, errors.New("the systemd journal is only available on linux")
+}
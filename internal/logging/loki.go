@@ -0,0 +1,181 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gproc/internal/logger"
+)
+
+// LokiProvider ships logs with the push API of Grafana Loki, one stream
+// per process, node and level. Configuration: url, tenant (the
+// X-Scope-OrgID header), username and password, and labels added to
+// every stream as key=value,key=value.
+type LokiProvider struct {
+	endpoint string
+	labels   map[string]string
+	client   *httpClient
+}
+
+func NewLokiProvider(config map[string]string) (*LokiProvider, error) {
+	endpoint := strings.TrimSuffix(config["url"], "/")
+	if endpoint == "" {
+		return nil, fmt.Errorf("loki needs a url")
+	}
+	client, err := newHTTPClient(config)
+	if err != nil {
+		return nil, err
+	}
+	if tenant := config["tenant"]; tenant != "" {
+		client.header.Set("X-Scope-OrgID", tenant)
+	}
+	if config["username"] != "" {
+		client.header.Set("Authorization", basicAuth(config["username"], config["password"]))
+	}
+	labels := map[string]string{"job": "gproc"}
+	if value := config["labels"]; value != "" {
+		for _, pair := range strings.Split(value, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || key == "" {
+				return nil, fmt.Errorf("invalid loki label %q, expected key=value", pair)
+			}
+			labels[key] = value
+		}
+	}
+	return &LokiProvider{endpoint: endpoint, labels: labels, client: client}, nil
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// SendLogs pushes a batch. The fields of an entry follow its message as
+// logfmt.
+func (l *LokiProvider) SendLogs(ctx context.Context, logs []LogEntry) error {
+	// The values of a stream go in time order.
+	logs = append([]LogEntry(nil), logs...)
+	sort.SliceStable(logs, func(i, j int) bool { return logs[i].Timestamp.Before(logs[j].Timestamp) })
+
+	streams := make(map[string]*lokiStream)
+	var keys []string
+	for _, e := range logs {
+		labels := make(map[string]string, len(l.labels)+3)
+		for key, value := range l.labels {
+			labels[key] = value
+		}
+		labels["process"] = e.ProcessName
+		labels["node"] = e.NodeID
+		if e.Level != "" {
+			labels["level"] = e.Level
+		}
+		key := lokiSelector(labels)
+		stream := streams[key]
+		if stream == nil {
+			stream = &lokiStream{Stream: labels}
+			streams[key] = stream
+			keys = append(keys, key)
+		}
+		line := e.Message
+		if len(e.Fields) > 0 {
+			line += " " + logger.FormatFields(e.Fields)
+		}
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(e.Timestamp.UnixNano(), 10), line})
+	}
+
+	push := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, key := range keys {
+		push.Streams = append(push.Streams, streams[key])
+	}
+	body, err := json.Marshal(push)
+	if err != nil {
+		return err
+	}
+	_, err = l.client.do(ctx, "POST", l.endpoint+"/loki/api/v1/push", "application/json", body)
+	return err
+}
+
+// Query returns the last query.Limit entries (100 by default) matching
+// the query, oldest first. Loki needs a time range: it defaults to the
+// last hour.
+func (l *LokiProvider) Query(ctx context.Context, query LogQuery) ([]LogEntry, error) {
+	labels := map[string]string{"job": l.labels["job"]}
+	if query.ProcessName != "" {
+		labels["process"] = query.ProcessName
+	}
+	if query.Level != "" {
+		labels["level"] = query.Level
+	}
+	end := query.EndTime
+	if end.IsZero() {
+		end = time.Now()
+	}
+	start := query.StartTime
+	if start.IsZero() {
+		start = end.Add(-time.Hour)
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	params := url.Values{
+		"query":     {lokiSelector(labels)},
+		"start":     {strconv.FormatInt(start.UnixNano(), 10)},
+		"end":       {strconv.FormatInt(end.UnixNano(), 10)},
+		"limit":     {strconv.Itoa(limit)},
+		"direction": {"backward"},
+	}
+	data, err := l.client.do(ctx, "GET", l.endpoint+"/loki/api/v1/query_range?"+params.Encode(), "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data struct {
+			Result []lokiStream `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("invalid query response: %v", err)
+	}
+	var logs []LogEntry
+	for _, stream := range resp.Data.Result {
+		for _, value := range stream.Values {
+			nanos, _ := strconv.ParseInt(value[0], 10, 64)
+			logs = append(logs, LogEntry{
+				Timestamp:   time.Unix(0, nanos),
+				Level:       stream.Stream["level"],
+				Message:     value[1],
+				ProcessName: stream.Stream["process"],
+				NodeID:      stream.Stream["node"],
+			})
+		}
+	}
+	sort.SliceStable(logs, func(i, j int) bool { return logs[i].Timestamp.Before(logs[j].Timestamp) })
+	if len(logs) > limit {
+		logs = logs[len(logs)-limit:]
+	}
+	return logs, nil
+}
+
+// lokiSelector renders labels as a LogQL stream selector, sorted.
+func lokiSelector(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + strconv.Quote(labels[key])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
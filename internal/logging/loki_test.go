@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestLokiPush(t *testing.T) {
+	var requests []*http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		body = readBody(t, r)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	loki, err := NewLokiProvider(map[string]string{"url": server.URL, "tenant": "team-a", "labels": "env=prod, region=eu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := testEntries()
+	if err := loki.SendLogs(context.Background(), entries); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(requests))
+	}
+	r := requests[0]
+	if r.Method != "POST" || r.URL.Path != "/loki/api/v1/push" {
+		t.Errorf("got %s %s, want POST /loki/api/v1/push", r.Method, r.URL.Path)
+	}
+	if got := r.Header.Get("X-Scope-OrgID"); got != "team-a" {
+		t.Errorf("got X-Scope-OrgID %q, want the tenant", got)
+	}
+	if got := r.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("got Content-Type %q", got)
+	}
+
+	var push struct {
+		Streams []lokiStream `json:"streams"`
+	}
+	if err := json.Unmarshal(body, &push); err != nil {
+		t.Fatal(err)
+	}
+	// One stream per process, node and level, in the order of their first
+	// entries, each with its values in time order.
+	want := []struct {
+		selector string
+		values   [][2]string
+	}{
+		{`{env="prod",job="gproc",level="info",node="n1",process="web",region="eu"}`, [][2]string{
+			{nanos(entries[1]), `first path="/a b" user=ann`},
+			{nanos(entries[0]), "second"},
+		}},
+		{`{env="prod",job="gproc",level="error",node="n1",process="worker",region="eu"}`, [][2]string{
+			{nanos(entries[2]), "failed"},
+		}},
+	}
+	if len(push.Streams) != len(want) {
+		t.Fatalf("got %d streams, want %d: %s", len(push.Streams), len(want), body)
+	}
+	for i, stream := range push.Streams {
+		if got := lokiSelector(stream.Stream); got != want[i].selector {
+			t.Errorf("stream %d: got labels %s, want %s", i, got, want[i].selector)
+		}
+		if len(stream.Values) != len(want[i].values) {
+			t.Errorf("stream %d: got values %q, want %q", i, stream.Values, want[i].values)
+			continue
+		}
+		for j, value := range stream.Values {
+			if value != want[i].values[j] {
+				t.Errorf("stream %d: got value %q, want %q", i, value, want[i].values[j])
+			}
+		}
+	}
+}
+
+func TestLokiConfig(t *testing.T) {
+	if _, err := NewLokiProvider(map[string]string{"url": "http://loki", "labels": "env"}); err == nil {
+		t.Error("a label without a value was accepted")
+	}
+	if _, err := NewLokiProvider(map[string]string{"url": "http://loki", "compression": "zstd"}); err == nil {
+		t.Error("an unknown compression was accepted")
+	}
+}
+
+func nanos(e LogEntry) string {
+	return strconv.FormatInt(e.Timestamp.UnixNano(), 10)
+}
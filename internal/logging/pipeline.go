@@ -0,0 +1,294 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gproc/internal/logger"
+)
+
+// Pipeline defaults, and the keys of a log aggregation configuration
+// that change them.
+const (
+	defaultBatchSize     = 500             // batch_size
+	defaultFlushInterval = 5 * time.Second // flush_interval
+	defaultSendTimeout   = 10 * time.Second
+	defaultMinBackoff    = time.Second
+	defaultMaxBackoff    = 5 * time.Minute   // max_backoff
+	defaultBufferMaxSize = 100 * 1024 * 1024 // buffer_max_size
+	defaultQueueSize     = 10000
+
+	// drainSegments is how many buffered batches one flush sends at most,
+	// so that draining a long outage does not hold up new entries.
+	drainSegments = 20
+)
+
+// PipelineOptions tune a pipeline.
+type PipelineOptions struct {
+	BatchSize     int
+	FlushInterval time.Duration
+	SendTimeout   time.Duration
+	MinBackoff    time.Duration
+	MaxBackoff    time.Duration
+	// BufferDir holds the batches that could not be sent, up to
+	// BufferMaxSize bytes; the oldest are dropped beyond it.
+	BufferDir     string
+	BufferMaxSize int64
+	QueueSize     int
+}
+
+// ParsePipelineOptions reads the pipeline settings of a log aggregation
+// configuration: batch_size, flush_interval, timeout, max_backoff,
+// buffer_dir and buffer_max_size.
+func ParsePipelineOptions(config map[string]string) (PipelineOptions, error) {
+	opts := PipelineOptions{BufferDir: config["buffer_dir"]}
+	var err error
+	if value := config["batch_size"]; value != "" {
+		if opts.BatchSize, err = strconv.Atoi(value); err != nil || opts.BatchSize < 1 {
+			return opts, fmt.Errorf("invalid batch_size %q", value)
+		}
+	}
+	for key, d := range map[string]*time.Duration{
+		"flush_interval": &opts.FlushInterval,
+		"timeout":        &opts.SendTimeout,
+		"max_backoff":    &opts.MaxBackoff,
+	} {
+		if value := config[key]; value != "" {
+			if *d, err = time.ParseDuration(value); err != nil || *d <= 0 {
+				return opts, fmt.Errorf("invalid %s %q", key, value)
+			}
+		}
+	}
+	if value := config["buffer_max_size"]; value != "" {
+		if opts.BufferMaxSize, err = logger.ParseSize(value); err != nil {
+			return opts, fmt.Errorf("invalid buffer_max_size: %v", err)
+		}
+	}
+	return opts, nil
+}
+
+func (o *PipelineOptions) setDefaults() {
+	if o.BatchSize <= 0 {
+		o.BatchSize = defaultBatchSize
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = defaultFlushInterval
+	}
+	if o.SendTimeout <= 0 {
+		o.SendTimeout = defaultSendTimeout
+	}
+	if o.MinBackoff <= 0 {
+		o.MinBackoff = defaultMinBackoff
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = defaultMaxBackoff
+	}
+	if o.BufferMaxSize <= 0 {
+		o.BufferMaxSize = defaultBufferMaxSize
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = defaultQueueSize
+	}
+}
+
+// PipelineStats describe the state of a pipeline.
+type PipelineStats struct {
+	Queued        int    `json:"queued"`
+	BufferedBytes int64  `json:"buffered_bytes"`
+	Sent          int64  `json:"sent"`
+	Dropped       int64  `json:"dropped"`
+	Failures      int64  `json:"failures"`
+	LastError     string `json:"last_error,omitempty"`
+}
+
+// Pipeline ships entries to one provider in batches. A batch that cannot
+// be sent goes to the disk buffer, and so do the following ones until
+// the provider is back, retried with exponential backoff, so that entries
+// arrive in order.
+type Pipeline struct {
+	name     string
+	provider LogProvider
+	opts     PipelineOptions
+	queue    chan LogEntry
+	buffer   *diskBuffer
+	done     chan struct{}
+
+	sent     atomic.Int64
+	dropped  atomic.Int64
+	failures atomic.Int64
+
+	mutex     sync.RWMutex // guards closed and lastError
+	closed    bool
+	lastError string
+
+	// Used by run only.
+	backoff time.Duration
+	retryAt time.Time
+}
+
+// NewPipeline starts shipping to provider, picking up what an earlier
+// run left in the disk buffer.
+func NewPipeline(name string, provider LogProvider, opts PipelineOptions) (*Pipeline, error) {
+	opts.setDefaults()
+	p := &Pipeline{
+		name:     name,
+		provider: provider,
+		opts:     opts,
+		queue:    make(chan LogEntry, opts.QueueSize),
+		done:     make(chan struct{}),
+	}
+	if opts.BufferDir != "" {
+		buffer, err := openDiskBuffer(opts.BufferDir, opts.BufferMaxSize)
+		if err != nil {
+			return nil, err
+		}
+		p.buffer = buffer
+	}
+	go p.run()
+	return p, nil
+}
+
+// Add queues an entry. It never blocks: entries are dropped while the
+// queue is full.
+func (p *Pipeline) Add(e LogEntry) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if p.closed {
+		return
+	}
+	select {
+	case p.queue <- e:
+	default:
+		p.dropped.Add(1)
+	}
+}
+
+// Stats returns the counters of the pipeline.
+func (p *Pipeline) Stats() PipelineStats {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	stats := PipelineStats{
+		Queued:    len(p.queue),
+		Sent:      p.sent.Load(),
+		Dropped:   p.dropped.Load(),
+		Failures:  p.failures.Load(),
+		LastError: p.lastError,
+	}
+	if p.buffer != nil {
+		stats.BufferedBytes = p.buffer.Size()
+	}
+	return stats
+}
+
+// Close sends what is queued, or buffers it, and stops the pipeline.
+func (p *Pipeline) Close() error {
+	p.mutex.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mutex.Unlock()
+	<-p.done
+	return nil
+}
+
+func (p *Pipeline) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.opts.FlushInterval)
+	defer ticker.Stop()
+
+	var batch []LogEntry
+	for {
+		select {
+		case e, ok := <-p.queue:
+			if !ok {
+				p.flush(batch)
+				return
+			}
+			if batch = append(batch, e); len(batch) < p.opts.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		p.flush(batch)
+		batch = nil
+	}
+}
+
+// flush sends what is buffered, oldest first, then batch. Once a send
+// fails, the rest waits in the buffer for the next try.
+func (p *Pipeline) flush(batch []LogEntry) {
+	if p.buffer == nil {
+		if len(batch) > 0 && !p.send(batch) {
+			p.dropped.Add(int64(len(batch)))
+		}
+		return
+	}
+
+	if time.Now().After(p.retryAt) {
+		for i := 0; i < drainSegments && !p.buffer.Empty(); i++ {
+			segment, buffered, err := p.buffer.Oldest()
+			if err != nil {
+				log.Printf("Log shipping to %s: dropping unreadable buffer %s: %v", p.name, segment, err)
+				p.buffer.Remove(segment)
+				continue
+			}
+			if !p.send(buffered) {
+				break
+			}
+			p.buffer.Remove(segment)
+		}
+		if p.buffer.Empty() && len(batch) > 0 && p.send(batch) {
+			return
+		}
+	}
+	if len(batch) > 0 {
+		dropped, err := p.buffer.Push(batch)
+		if err != nil {
+			log.Printf("Log shipping to %s: buffering %d entries: %v", p.name, len(batch), err)
+			dropped = len(batch)
+		}
+		p.dropped.Add(int64(dropped))
+	}
+}
+
+// send sends one batch. A batch the provider rejects for good counts as
+// done, as sending it again cannot help; false means try again later.
+func (p *Pipeline) send(batch []LogEntry) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), p.opts.SendTimeout)
+	defer cancel()
+	err := p.provider.SendLogs(ctx, batch)
+	if err == nil {
+		p.sent.Add(int64(len(batch)))
+		p.backoff = 0
+		p.retryAt = time.Time{}
+		return true
+	}
+
+	p.failures.Add(1)
+	p.mutex.Lock()
+	p.lastError = err.Error()
+	p.mutex.Unlock()
+	if Permanent(err) {
+		log.Printf("Log shipping to %s: dropping %d entries: %v", p.name, len(batch), err)
+		p.dropped.Add(int64(len(batch)))
+		return true
+	}
+
+	if p.backoff == 0 {
+		p.backoff = p.opts.MinBackoff
+	} else if p.backoff *= 2; p.backoff > p.opts.MaxBackoff {
+		p.backoff = p.opts.MaxBackoff
+	}
+	// Jitter, so that many daemons do not retry in step.
+	delay := p.backoff/2 + time.Duration(rand.Int63n(int64(p.backoff/2)+1))
+	p.retryAt = time.Now().Add(delay)
+	log.Printf("Log shipping to %s failed, retrying in %v: %v", p.name, delay.Round(time.Second), err)
+	return false
+}
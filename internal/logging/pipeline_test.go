@@ -0,0 +1,192 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collector is a Splunk event collector that fails while down.
+type collector struct {
+	t *testing.T
+
+	mutex    sync.Mutex
+	down     bool
+	fail     int // requests to fail before it comes back
+	attempts []time.Time
+	messages []string
+}
+
+func newCollector(t *testing.T) (*collector, *SplunkProvider) {
+	c := &collector{t: t}
+	server := httptest.NewServer(c)
+	t.Cleanup(server.Close)
+	provider, err := NewSplunkProvider(map[string]string{"url": server.URL, "token": "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, provider
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body := readBody(c.t, r)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.attempts = append(c.attempts, time.Now())
+	if c.down || c.fail > 0 {
+		c.fail--
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	for dec.More() {
+		var event splunkEvent
+		if err := dec.Decode(&event); err != nil {
+			c.t.Errorf("invalid event: %v", err)
+			break
+		}
+		c.messages = append(c.messages, event.Event.Message)
+	}
+}
+
+func (c *collector) setDown(down bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.down = down
+}
+
+func (c *collector) received() ([]string, []time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]string(nil), c.messages...), append([]time.Time(nil), c.attempts...)
+}
+
+// waitSent waits until the pipeline sent n entries.
+func waitSent(t *testing.T, p *Pipeline, n int64) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for p.Stats().Sent < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("sent %d entries, want %d: %+v", p.Stats().Sent, n, p.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func addMessages(p *Pipeline, messages ...string) {
+	for _, message := range messages {
+		p.Add(LogEntry{Timestamp: time.Now(), Message: message, ProcessName: "web"})
+	}
+}
+
+func TestPipelineRetriesWithBackoff(t *testing.T) {
+	c, provider := newCollector(t)
+	c.fail = 3
+
+	p, err := NewPipeline("splunk", provider, PipelineOptions{
+		BatchSize:     10,
+		FlushInterval: 10 * time.Millisecond,
+		MinBackoff:    100 * time.Millisecond,
+		MaxBackoff:    time.Second,
+		BufferDir:     t.TempDir(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	addMessages(p, "one", "two", "three")
+	waitSent(t, p, 3)
+	messages, attempts := c.received()
+
+	if len(attempts) != 4 {
+		t.Fatalf("got %d attempts, want 3 failures and a success", len(attempts))
+	}
+	// The backoff doubles from MinBackoff, less up to half of jitter.
+	for i, min := range []time.Duration{50 * time.Millisecond, 100 * time.Millisecond, 200 * time.Millisecond} {
+		if gap := attempts[i+1].Sub(attempts[i]); gap < min {
+			t.Errorf("retry %d came after %v, want at least %v", i+1, gap, min)
+		}
+	}
+	if stats := p.Stats(); stats.Failures != 3 || stats.Dropped != 0 || stats.LastError == "" {
+		t.Errorf("got stats %+v, want 3 failures and nothing dropped", stats)
+	}
+	if want := []string{"one", "two", "three"}; !slices.Equal(messages, want) {
+		t.Errorf("got %q, want %q in order", messages, want)
+	}
+}
+
+func TestPipelineReplaysBuffer(t *testing.T) {
+	c, provider := newCollector(t)
+	dir := t.TempDir()
+	opts := PipelineOptions{FlushInterval: 10 * time.Millisecond, MinBackoff: time.Hour, BufferDir: dir}
+
+	// An outage: what the pipeline cannot send stays on disk when it
+	// stops.
+	c.setDown(true)
+	p, err := NewPipeline("splunk", provider, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addMessages(p, "one", "two")
+	time.Sleep(50 * time.Millisecond)
+	addMessages(p, "three")
+	p.Close()
+	if stats := p.Stats(); stats.Sent != 0 || stats.Dropped != 0 || stats.BufferedBytes == 0 {
+		t.Fatalf("got stats %+v, want everything buffered", stats)
+	}
+	if segments, _ := os.ReadDir(dir); len(segments) == 0 {
+		t.Fatal("nothing was buffered on disk")
+	}
+
+	// Back up: the next run sends the buffer first, then the new entries.
+	c.setDown(false)
+	opts.MinBackoff = 0
+	p, err = NewPipeline("splunk", provider, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	addMessages(p, "four")
+	waitSent(t, p, 4)
+
+	messages, _ := c.received()
+	if want := []string{"one", "two", "three", "four"}; !slices.Equal(messages, want) {
+		t.Errorf("got %q, want %q in order", messages, want)
+	}
+	if stats := p.Stats(); stats.BufferedBytes != 0 {
+		t.Errorf("got %d bytes still buffered", stats.BufferedBytes)
+	}
+	if segments, _ := os.ReadDir(dir); len(segments) != 0 {
+		t.Errorf("got %d segments left on disk", len(segments))
+	}
+}
+
+func TestPipelineDropsRejectedBatch(t *testing.T) {
+	rejected := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rejected++
+		http.Error(w, "malformed", http.StatusBadRequest)
+	}))
+	defer server.Close()
+	provider, err := NewSplunkProvider(map[string]string{"url": server.URL, "token": "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewPipeline("splunk", provider, PipelineOptions{FlushInterval: time.Hour, BufferDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addMessages(p, "one", "two")
+	p.Close()
+	if stats := p.Stats(); rejected != 1 || stats.Dropped != 2 || stats.BufferedBytes != 0 {
+		t.Errorf("got %d requests and stats %+v, want the batch dropped at once", rejected, stats)
+	}
+}
@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SplunkProvider ships logs to the HTTP Event Collector of Splunk.
+// Configuration: url, token, and optionally index and sourcetype
+// (gproc by default).
+type SplunkProvider struct {
+	endpoint   string
+	index      string
+	sourcetype string
+	client     *httpClient
+}
+
+func NewSplunkProvider(config map[string]string) (*SplunkProvider, error) {
+	endpoint := strings.TrimSuffix(config["url"], "/")
+	if endpoint == "" {
+		return nil, fmt.Errorf("splunk needs a url")
+	}
+	if config["token"] == "" {
+		return nil, fmt.Errorf("splunk needs an HEC token")
+	}
+	client, err := newHTTPClient(config)
+	if err != nil {
+		return nil, err
+	}
+	client.header.Set("Authorization", "Splunk "+config["token"])
+	sourcetype := config["sourcetype"]
+	if sourcetype == "" {
+		sourcetype = "gproc"
+	}
+	return &SplunkProvider{endpoint: endpoint, index: config["index"], sourcetype: sourcetype, client: client}, nil
+}
+
+type splunkEvent struct {
+	Time       float64   `json:"time"`
+	Host       string    `json:"host,omitempty"`
+	Source     string    `json:"source,omitempty"`
+	Sourcetype string    `json:"sourcetype"`
+	Index      string    `json:"index,omitempty"`
+	Event      *LogEntry `json:"event"`
+}
+
+// SendLogs sends a batch as one request of concatenated events.
+func (s *SplunkProvider) SendLogs(ctx context.Context, logs []LogEntry) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for i := range logs {
+		event := splunkEvent{
+			Time:       float64(logs[i].Timestamp.UnixNano()) / 1e9,
+			Host:       logs[i].NodeID,
+			Source:     logs[i].ProcessName,
+			Sourcetype: s.sourcetype,
+			Index:      s.index,
+			Event:      &logs[i],
+		}
+		if err := enc.Encode(&event); err != nil {
+			return err
+		}
+	}
+	_, err := s.client.do(ctx, "POST", s.endpoint+"/services/collector/event", "application/json", body.Bytes())
+	return err
+}
+
+// Query is not possible: the event collector only takes events in.
+func (s *SplunkProvider) Query(ctx context.Context, query LogQuery) ([]LogEntry, error) {
+	return nil, fmt.Errorf("the Splunk HTTP Event Collector cannot be queried, search in Splunk instead")
+}
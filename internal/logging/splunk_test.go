@@ -0,0 +1,77 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSplunkEvents(t *testing.T) {
+	var requests []*http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		body = readBody(t, r)
+		w.Write([]byte(`{"text":"Success","code":0}`))
+	}))
+	defer server.Close()
+
+	splunk, err := NewSplunkProvider(map[string]string{"url": server.URL, "token": "hec-token", "index": "apps"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := testEntries()
+	if err := splunk.SendLogs(context.Background(), entries); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, want the batch in 1", len(requests))
+	}
+	r := requests[0]
+	if r.Method != "POST" || r.URL.Path != "/services/collector/event" {
+		t.Errorf("got %s %s, want POST /services/collector/event", r.Method, r.URL.Path)
+	}
+	if got := r.Header.Get("Authorization"); got != "Splunk hec-token" {
+		t.Errorf("got Authorization %q, want the HEC token", got)
+	}
+
+	// The events of the batch are concatenated.
+	dec := json.NewDecoder(bytes.NewReader(body))
+	for i := range entries {
+		var event struct {
+			Time       float64  `json:"time"`
+			Host       string   `json:"host"`
+			Source     string   `json:"source"`
+			Sourcetype string   `json:"sourcetype"`
+			Index      string   `json:"index"`
+			Event      LogEntry `json:"event"`
+		}
+		if err := dec.Decode(&event); err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+		e := entries[i]
+		if event.Time != float64(e.Timestamp.UnixNano())/1e9 || event.Host != e.NodeID || event.Source != e.ProcessName {
+			t.Errorf("event %d: got time %v, host %q, source %q", i, event.Time, event.Host, event.Source)
+		}
+		if event.Sourcetype != "gproc" || event.Index != "apps" {
+			t.Errorf("event %d: got sourcetype %q, index %q", i, event.Sourcetype, event.Index)
+		}
+		if event.Event.Message != e.Message || event.Event.Level != e.Level {
+			t.Errorf("event %d: got %+v", i, event.Event)
+		}
+	}
+	if err := dec.Decode(new(json.RawMessage)); err != io.EOF {
+		t.Errorf("got more events than entries: %v", err)
+	}
+}
+
+func TestSplunkConfig(t *testing.T) {
+	if _, err := NewSplunkProvider(map[string]string{"url": "https://splunk:8088"}); err == nil {
+		t.Error("a provider without an HEC token was created")
+	}
+}
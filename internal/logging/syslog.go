@@ -0,0 +1,165 @@
+package logging
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gproc/internal/logger"
+	"gproc/pkg/types"
+)
+
+// maxDatagram is the longest syslog message sent over a datagram socket,
+// within the limit of UDP; longer ones are cut.
+const maxDatagram = 60 * 1024
+
+// facilities are the syslog facilities by name.
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"ntp": 12, "security": 13, "console": 14, "solaris-cron": 15,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// ParseFacility returns the code of a syslog facility name.
+func ParseFacility(name string) (int, error) {
+	if code, ok := facilities[strings.ToLower(name)]; ok {
+		return code, nil
+	}
+	return 0, fmt.Errorf("unknown syslog facility %q, expected one such as daemon, user or local0-local7", name)
+}
+
+// syslogSettings returns where the messages of a syslog output go and
+// their facility, filling in the defaults.
+func syslogSettings(out *types.LogOutput) (network, address string, facility int, err error) {
+	network, address = out.Network, out.Address
+	switch network {
+	case "":
+		network = "unix"
+	case "unix", "unixgram", "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6":
+	default:
+		return "", "", 0, fmt.Errorf("unknown syslog network %q, expected unix, udp or tcp", network)
+	}
+	if address == "" {
+		if strings.HasPrefix(network, "unix") {
+			address = localSyslog()
+		} else {
+			address = "localhost:514"
+		}
+	}
+	facility = facilities["daemon"]
+	if out.Facility != "" {
+		if facility, err = ParseFacility(out.Facility); err != nil {
+			return "", "", 0, err
+		}
+	}
+	return network, address, facility, nil
+}
+
+// localSyslog returns the socket of the local syslog daemon.
+func localSyslog() string {
+	for _, path := range []string{"/dev/log", "/var/run/syslog", "/var/run/log"} {
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			return path
+		}
+	}
+	return "/dev/log"
+}
+
+func isStream(network string) bool {
+	return strings.HasPrefix(network, "tcp")
+}
+
+// syslogConn is a connection to a syslog daemon. Messages on stream
+// connections are framed by octet counting (RFC 6587).
+type syslogConn struct {
+	conn   net.Conn
+	stream bool
+}
+
+// dialSyslog connects to a syslog daemon. unix tries a datagram socket,
+// then a stream one.
+func dialSyslog(network, address string) (transport, error) {
+	if network == "unix" {
+		if conn, err := net.DialTimeout("unixgram", address, systemSendTimeout); err == nil {
+			return &syslogConn{conn: conn}, nil
+		}
+		conn, err := net.DialTimeout("unix", address, systemSendTimeout)
+		if err != nil {
+			return nil, err
+		}
+		return &syslogConn{conn: conn, stream: true}, nil
+	}
+	conn, err := net.DialTimeout(network, address, systemSendTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogConn{conn: conn, stream: isStream(network)}, nil
+}
+
+func (c *syslogConn) Send(msg []byte) error {
+	c.conn.SetWriteDeadline(time.Now().Add(systemSendTimeout))
+	if c.stream {
+		msg = append(strconv.AppendInt(nil, int64(len(msg)), 10), append([]byte{' '}, msg...)...)
+	} else if len(msg) > maxDatagram {
+		msg = msg[:maxDatagram]
+	}
+	_, err := c.conn.Write(msg)
+	return err
+}
+
+func (c *syslogConn) Close() error {
+	return c.conn.Close()
+}
+
+// syslogSink formats the entries of one process as RFC 5424 messages:
+//
+//	<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID - MSG
+//
+// where PROCID is the ID of the process and MSGID its stream.
+type syslogSink struct {
+	sender   *sender
+	facility int
+	hostname string
+	appName  string
+	procID   string
+}
+
+func (s *syslogSink) Add(e logger.Entry) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s %s - ",
+		s.facility*8+severity(&e),
+		e.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogField(s.hostname, 255),
+		syslogField(s.appName, 48),
+		syslogField(s.procID, 128),
+		syslogField(e.Stream, 32))
+	b.WriteString(e.Message)
+	if len(e.Fields) > 0 {
+		b.WriteString(" ")
+		b.WriteString(logger.FormatFields(e.Fields))
+	}
+	s.sender.Send([]byte(b.String()))
+}
+
+// syslogField makes value a valid header field of at most max printable
+// ASCII characters, or the nil value "-".
+func syslogField(value string, max int) string {
+	if value == "" {
+		return "-"
+	}
+	b := []byte(value)
+	if len(b) > max {
+		b = b[:max]
+	}
+	for i, c := range b {
+		if c < 33 || c > 126 {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
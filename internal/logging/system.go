@@ -0,0 +1,276 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gproc/internal/logger"
+	"gproc/pkg/types"
+)
+
+// Types of the system log outputs of processes.
+const (
+	OutputSyslog   = "syslog"
+	OutputJournald = "journald"
+	OutputNone     = "none"
+)
+
+const (
+	// systemQueueSize is how many messages wait for each destination;
+	// more are dropped.
+	systemQueueSize = 10000
+	// systemSendTimeout bounds the write of one message.
+	systemSendTimeout = 5 * time.Second
+	// systemRedial is how long a destination that cannot be reached is
+	// left alone, its messages dropped, before connecting again.
+	systemRedial = 5 * time.Second
+)
+
+// SystemLog forwards the output of processes to the syslog daemon and the
+// systemd journal. Processes sending to the same place share one
+// connection, which is opened again when it fails.
+type SystemLog struct {
+	mutex    sync.Mutex
+	senders  map[string]*sender
+	closed   bool
+	hostname string
+}
+
+func NewSystemLog() *SystemLog {
+	hostname, _ := os.Hostname()
+	return &SystemLog{senders: make(map[string]*sender), hostname: hostname}
+}
+
+// Output returns the system log output of proc: its own, or else the one
+// of the logging configuration; nil for none.
+func Output(proc *types.Process, config *types.LoggingConfig) *types.LogOutput {
+	out := proc.LogOutput
+	if out == nil && config != nil {
+		switch config.Output {
+		case OutputSyslog:
+			out = &types.LogOutput{}
+			if config.Syslog != nil {
+				*out = *config.Syslog
+			}
+			out.Type = OutputSyslog
+		case OutputJournald:
+			out = &types.LogOutput{Type: OutputJournald}
+		}
+	}
+	if out == nil || out.Type == "" || out.Type == OutputNone {
+		return nil
+	}
+	return out
+}
+
+// CheckOutput returns why a system log output is invalid, if it is.
+func CheckOutput(out *types.LogOutput) error {
+	if out == nil {
+		return nil
+	}
+	switch out.Type {
+	case "", OutputNone:
+		return nil
+	case OutputSyslog:
+		_, _, _, err := syslogSettings(out)
+		return err
+	case OutputJournald:
+		if runtime.GOOS != "linux" {
+			return fmt.Errorf("the systemd journal is only available on linux")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown log output %q, expected syslog, journald or none", out.Type)
+}
+
+// Sink returns the sink forwarding the entries of proc to out.
+func (s *SystemLog) Sink(out *types.LogOutput, proc *types.Process) (logger.Sink, error) {
+	if err := CheckOutput(out); err != nil {
+		return nil, err
+	}
+	switch out.Type {
+	case OutputSyslog:
+		network, address, facility, _ := syslogSettings(out)
+		appName := out.AppName
+		if appName == "" {
+			appName = proc.Name
+		}
+		dest := fmt.Sprintf("syslog %s://%s", network, address)
+		return &syslogSink{
+			sender:   s.sender(dest, func() (transport, error) { return dialSyslog(network, address) }),
+			facility: facility,
+			hostname: s.hostname,
+			appName:  appName,
+			procID:   proc.ID,
+		}, nil
+	case OutputJournald:
+		identifier := out.AppName
+		if identifier == "" {
+			identifier = proc.Name
+		}
+		facility := -1
+		if out.Facility != "" {
+			facility, _ = ParseFacility(out.Facility)
+		}
+		return &journalSink{
+			sender:     s.sender("journald", dialJournal),
+			identifier: identifier,
+			facility:   facility,
+			process:    proc.Name,
+			instance:   proc.ID,
+		}, nil
+	}
+	return nil, fmt.Errorf("no log output")
+}
+
+// Close sends what is queued and closes the connections.
+func (s *SystemLog) Close() {
+	s.mutex.Lock()
+	s.closed = true
+	senders := s.senders
+	s.senders = make(map[string]*sender)
+	s.mutex.Unlock()
+	for _, snd := range senders {
+		snd.Close()
+	}
+}
+
+func (s *SystemLog) sender(dest string, dial func() (transport, error)) *sender {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if snd := s.senders[dest]; snd != nil {
+		return snd
+	}
+	snd := newSender(dest, dial)
+	if s.closed {
+		snd.Close()
+	} else {
+		s.senders[dest] = snd
+	}
+	return snd
+}
+
+// severity returns the syslog severity of an entry: that of its level
+// when it has one, else error for stderr and informational for stdout.
+func severity(e *logger.Entry) int {
+	switch e.Level {
+	case "trace", "debug":
+		return 7
+	case "info":
+		return 6
+	case "warn":
+		return 4
+	case "error":
+		return 3
+	case "fatal":
+		return 2
+	}
+	if e.Stream == logger.StreamStderr {
+		return 3
+	}
+	return 6
+}
+
+// transport is a connection to a system log.
+type transport interface {
+	Send(msg []byte) error
+	Close() error
+}
+
+// sender writes messages to one system log in the background, so that a
+// slow or missing log never holds up the output of the processes.
+type sender struct {
+	dest    string
+	dial    func() (transport, error)
+	queue   chan []byte
+	done    chan struct{}
+	dropped atomic.Int64
+
+	mutex  sync.RWMutex // guards closed
+	closed bool
+}
+
+func newSender(dest string, dial func() (transport, error)) *sender {
+	s := &sender{
+		dest:  dest,
+		dial:  dial,
+		queue: make(chan []byte, systemQueueSize),
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Send queues a message, or drops it when the queue is full.
+func (s *sender) Send(msg []byte) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- msg:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Close sends what is queued and stops the sender.
+func (s *sender) Close() {
+	s.mutex.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mutex.Unlock()
+	<-s.done
+}
+
+func (s *sender) run() {
+	defer close(s.done)
+	var conn transport
+	var redialAt time.Time
+	failing := false
+	for msg := range s.queue {
+		var err error
+		// A connection that failed is opened again once at once, as the
+		// log may just have restarted.
+		for attempt := 0; attempt < 2; attempt++ {
+			if conn == nil {
+				if time.Now().Before(redialAt) {
+					break
+				}
+				if conn, err = s.dial(); err != nil {
+					conn = nil
+					redialAt = time.Now().Add(systemRedial)
+					break
+				}
+			}
+			if err = conn.Send(msg); err == nil {
+				break
+			}
+			conn.Close()
+			conn = nil
+		}
+		if conn != nil && err == nil {
+			if failing {
+				log.Printf("Log output to %s resumed, %d messages dropped", s.dest, s.dropped.Load())
+				failing = false
+			}
+			continue
+		}
+		s.dropped.Add(1)
+		if !failing && err != nil {
+			log.Printf("Log output to %s failing, dropping messages: %v", s.dest, err)
+			failing = true
+		}
+	}
+	if conn != nil {
+		conn.Close()
+	}
+}
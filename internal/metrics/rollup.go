@@ -0,0 +1,461 @@
+package metrics
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"gproc/pkg/types"
+)
+
+// Resolution is the step of the metrics history: Raw for the samples as
+// recorded, or the length of the buckets of a rollup.
+type Resolution time.Duration
+
+const (
+	Raw    Resolution = 0
+	Minute            = Resolution(time.Minute)
+	Hour              = Resolution(time.Hour)
+	Day               = Resolution(24 * time.Hour)
+)
+
+// rollups are the resolutions of the rollups, finest first. Each is
+// computed from the one before it, the first from the raw samples.
+var rollups = []Resolution{Minute, Hour, Day}
+
+func (r Resolution) String() string {
+	switch r {
+	case Raw:
+		return "raw"
+	case Minute:
+		return "1m"
+	case Hour:
+		return "1h"
+	case Day:
+		return "1d"
+	}
+	return time.Duration(r).String()
+}
+
+// finer returns the resolution a rollup is computed from.
+func (r Resolution) finer() Resolution {
+	for i, res := range rollups {
+		if res == r && i > 0 {
+			return rollups[i-1]
+		}
+	}
+	return Raw
+}
+
+const (
+	// rawStep is about how often the daemon records a sample of a process.
+	rawStep = 15 * time.Second
+	// maxHistoryPoints is the most points a query of a time range should
+	// return; it gets the finest resolution that stays within.
+	maxHistoryPoints = 1500
+	// compactInterval is how often the rollups are brought up to date
+	// and the history past its retention is removed.
+	compactInterval = time.Minute
+	// compactChunk bounds the buckets computed at once, so that a long
+	// backlog is compacted piece by piece.
+	compactChunk = 1000
+)
+
+var defaultRetention = types.MetricsRetention{
+	Raw:    24 * time.Hour,
+	Minute: 7 * 24 * time.Hour,
+	Hour:   90 * 24 * time.Hour,
+	Day:    2 * 365 * 24 * time.Hour,
+}
+
+// SetRetention sets how long each resolution is kept; zero durations keep
+// their default. A resolution is kept for at least two buckets of the next
+// one, which is computed from it.
+func (m *MetricsStorage) SetRetention(retention *types.MetricsRetention) {
+	r := defaultRetention
+	if retention != nil {
+		for _, d := range []struct {
+			dst *time.Duration
+			src time.Duration
+			min time.Duration
+		}{
+			{&r.Raw, retention.Raw, 2 * time.Duration(Minute)},
+			{&r.Minute, retention.Minute, 2 * time.Duration(Hour)},
+			{&r.Hour, retention.Hour, 2 * time.Duration(Day)},
+			{&r.Day, retention.Day, 0},
+		} {
+			if d.src > 0 {
+				*d.dst = d.src
+			}
+			if *d.dst < d.min {
+				*d.dst = d.min
+			}
+		}
+	}
+	m.mutex.Lock()
+	m.retention = r
+	m.mutex.Unlock()
+}
+
+func (m *MetricsStorage) retentionOf(res Resolution) time.Duration {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	switch res {
+	case Raw:
+		return m.retention.Raw
+	case Minute:
+		return m.retention.Minute
+	case Hour:
+		return m.retention.Hour
+	}
+	return m.retention.Day
+}
+
+// QueryMetrics returns the history of a process from from until to, at
+// the finest resolution that still reaches back to from and gives at most
+// maxHistoryPoints points. Rollups cover the recent history that is not
+// compacted yet as well.
+func (m *MetricsStorage) QueryMetrics(processID string, from, to time.Time) ([]types.MetricPoint, Resolution, error) {
+	res := m.resolutionFor(from, to)
+	points, err := m.query(processID, res, from, to)
+	return points, res, err
+}
+
+func (m *MetricsStorage) resolutionFor(from, to time.Time) Resolution {
+	span, age := to.Sub(from), time.Since(from)
+	for _, res := range append([]Resolution{Raw}, rollups...) {
+		step := time.Duration(res)
+		if res == Raw {
+			step = rawStep
+		}
+		if age <= m.retentionOf(res) && span/step <= maxHistoryPoints {
+			return res
+		}
+	}
+	return Day
+}
+
+// query returns the points of a process at res: the rollups computed so
+// far and, after them, the finer history rolled up on the fly.
+func (m *MetricsStorage) query(processID string, res Resolution, from, to time.Time) ([]types.MetricPoint, error) {
+	stored, err := m.load(res, processID, from, to)
+	if err != nil || res == Raw {
+		return stored[processID], err
+	}
+	points := stored[processID]
+
+	compacted, _, err := m.compactedUntil(res)
+	if err != nil {
+		return nil, err
+	}
+	if compacted.Before(from) {
+		compacted = from
+	}
+	if compacted.Before(to) {
+		finer, err := m.query(processID, res.finer(), compacted, to)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, rollup(finer, res)...)
+	}
+	return points, nil
+}
+
+// load reads the points at res of a process, or of every process when
+// processID is empty, from from until to, by process and oldest first.
+// Rollups are those whose bucket overlaps the range.
+func (m *MetricsStorage) load(res Resolution, processID string, from, to time.Time) (map[string][]types.MetricPoint, error) {
+	var rows *sql.Rows
+	var err error
+	filter := ""
+	if processID != "" {
+		filter = "AND process_id = ?"
+	}
+	if res == Raw {
+		query := `
+		SELECT process_id, timestamp, cpu_usage, memory_usage
+		FROM process_metrics
+		WHERE timestamp >= ? AND timestamp < ? ` + filter + `
+		ORDER BY timestamp ASC
+		`
+		args := []interface{}{from.UTC(), to.UTC()}
+		if processID != "" {
+			args = append(args, processID)
+		}
+		rows, err = m.db.Query(query, args...)
+	} else {
+		query := `
+		SELECT process_id, bucket, samples, cpu_avg, cpu_min, cpu_max, cpu_p95,
+			memory_avg, memory_min, memory_max, memory_p95
+		FROM process_metrics_rollup
+		WHERE resolution = ? AND bucket > ? AND bucket < ? ` + filter + `
+		ORDER BY bucket ASC
+		`
+		step := int64(time.Duration(res) / time.Second)
+		args := []interface{}{step, from.Unix() - step, to.Unix()}
+		if processID != "" {
+			args = append(args, processID)
+		}
+		rows, err = m.db.Query(query, args...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := make(map[string][]types.MetricPoint)
+	for rows.Next() {
+		var id string
+		var p types.MetricPoint
+		if res == Raw {
+			err = rows.Scan(&id, &p.Timestamp, &p.CPU, &p.Memory)
+		} else {
+			var bucket int64
+			err = rows.Scan(&id, &bucket, &p.Samples, &p.CPU, &p.CPUMin, &p.CPUMax, &p.CPUP95,
+				&p.Memory, &p.MemoryMin, &p.MemoryMax, &p.MemoryP95)
+			p.Timestamp = time.Unix(bucket, 0).UTC()
+		}
+		if err != nil {
+			return nil, err
+		}
+		points[id] = append(points[id], p)
+	}
+	return points, rows.Err()
+}
+
+// compactedUntil returns the end of the history rolled up at res, and
+// false if nothing was yet.
+func (m *MetricsStorage) compactedUntil(res Resolution) (time.Time, bool, error) {
+	var until int64
+	err := m.db.QueryRow(`SELECT until FROM metrics_compaction WHERE resolution = ?`,
+		int64(time.Duration(res)/time.Second)).Scan(&until)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return time.Unix(until, 0).UTC(), true, nil
+}
+
+// earliest returns the time of the oldest point at res, and false if there
+// is none.
+func (m *MetricsStorage) earliest(res Resolution) (time.Time, bool, error) {
+	if res == Raw {
+		var t time.Time
+		err := m.db.QueryRow(`SELECT timestamp FROM process_metrics ORDER BY timestamp ASC LIMIT 1`).Scan(&t)
+		if err == sql.ErrNoRows {
+			return t, false, nil
+		}
+		return t, err == nil, err
+	}
+	var bucket sql.NullInt64
+	err := m.db.QueryRow(`SELECT MIN(bucket) FROM process_metrics_rollup WHERE resolution = ?`,
+		int64(time.Duration(res)/time.Second)).Scan(&bucket)
+	return time.Unix(bucket.Int64, 0).UTC(), bucket.Valid, err
+}
+
+// rollup aggregates points of one process, oldest first, into buckets of
+// res. The p95 of points that are rollups themselves is estimated from
+// theirs, weighted by their samples.
+func rollup(points []types.MetricPoint, res Resolution) []types.MetricPoint {
+	step := time.Duration(res)
+	var out []types.MetricPoint
+	for i := 0; i < len(points); {
+		bucket := points[i].Timestamp.Truncate(step)
+		j := i + 1
+		for j < len(points) && points[j].Timestamp.Truncate(step).Equal(bucket) {
+			j++
+		}
+		out = append(out, merge(bucket, points[i:j]))
+		i = j
+	}
+	return out
+}
+
+type weighted struct {
+	value  float64
+	weight int
+}
+
+func merge(bucket time.Time, points []types.MetricPoint) types.MetricPoint {
+	out := types.MetricPoint{Timestamp: bucket.UTC()}
+	cpu := make([]weighted, 0, len(points))
+	memory := make([]weighted, 0, len(points))
+	var cpuSum, memorySum float64
+	for i, p := range points {
+		if p.Samples == 0 {
+			// A raw sample.
+			p.Samples = 1
+			p.CPUMin, p.CPUMax, p.CPUP95 = p.CPU, p.CPU, p.CPU
+			p.MemoryMin, p.MemoryMax, p.MemoryP95 = p.Memory, p.Memory, p.Memory
+		}
+		if i == 0 || p.CPUMin < out.CPUMin {
+			out.CPUMin = p.CPUMin
+		}
+		if i == 0 || p.CPUMax > out.CPUMax {
+			out.CPUMax = p.CPUMax
+		}
+		if i == 0 || p.MemoryMin < out.MemoryMin {
+			out.MemoryMin = p.MemoryMin
+		}
+		if i == 0 || p.MemoryMax > out.MemoryMax {
+			out.MemoryMax = p.MemoryMax
+		}
+		out.Samples += p.Samples
+		cpuSum += p.CPU * float64(p.Samples)
+		memorySum += p.Memory * float64(p.Samples)
+		cpu = append(cpu, weighted{p.CPUP95, p.Samples})
+		memory = append(memory, weighted{p.MemoryP95, p.Samples})
+	}
+	out.CPU = cpuSum / float64(out.Samples)
+	out.Memory = memorySum / float64(out.Samples)
+	out.CPUP95 = percentile(cpu, 0.95)
+	out.MemoryP95 = percentile(memory, 0.95)
+	return out
+}
+
+// percentile returns the q-percentile of weighted values by nearest rank.
+func percentile(values []weighted, q float64) float64 {
+	sort.Slice(values, func(i, j int) bool { return values[i].value < values[j].value })
+	total := 0
+	for _, v := range values {
+		total += v.weight
+	}
+	target := q * float64(total)
+	cumulative := 0
+	for _, v := range values {
+		cumulative += v.weight
+		if float64(cumulative) >= target {
+			return v.value
+		}
+	}
+	return values[len(values)-1].value
+}
+
+// Compact brings the rollups up to date with the history recorded since
+// the last compaction and removes the history past its retention.
+func (m *MetricsStorage) Compact() error {
+	now := time.Now()
+	for _, res := range rollups {
+		if err := m.compact(res, now); err != nil {
+			return fmt.Errorf("rollup %s: %v", res, err)
+		}
+	}
+	return m.expire(now)
+}
+
+// compact computes the rollups at res of the buckets completed since the
+// last compaction.
+func (m *MetricsStorage) compact(res Resolution, now time.Time) error {
+	step := time.Duration(res)
+	cutoff := now.Truncate(step)
+	start, ok, err := m.compactedUntil(res)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		first, found, err := m.earliest(res.finer())
+		if err != nil {
+			return err
+		}
+		start = cutoff
+		if found {
+			start = first.Truncate(step)
+		}
+	}
+
+	for {
+		end := start.Add(compactChunk * step)
+		if end.After(cutoff) {
+			end = cutoff
+		}
+		points, err := m.load(res.finer(), "", start, end)
+		if err != nil {
+			return err
+		}
+		if err := m.storeRollups(res, points, end); err != nil {
+			return err
+		}
+		if !end.Before(cutoff) {
+			return nil
+		}
+		start = end
+	}
+}
+
+// storeRollups records the rollups at res of points by process, and that
+// the history is compacted until until, at once.
+func (m *MetricsStorage) storeRollups(res Resolution, points map[string][]types.MetricPoint, until time.Time) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+	INSERT OR REPLACE INTO process_metrics_rollup (process_id, resolution, bucket, samples,
+		cpu_avg, cpu_min, cpu_max, cpu_p95, memory_avg, memory_min, memory_max, memory_p95)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	step := int64(time.Duration(res) / time.Second)
+	for id, series := range points {
+		for _, p := range rollup(series, res) {
+			_, err := stmt.Exec(id, step, p.Timestamp.Unix(), p.Samples,
+				p.CPU, p.CPUMin, p.CPUMax, p.CPUP95, p.Memory, p.MemoryMin, p.MemoryMax, p.MemoryP95)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	_, err = tx.Exec(`INSERT OR REPLACE INTO metrics_compaction (resolution, until) VALUES (?, ?)`, step, until.Unix())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// expire removes the history past the retention of its resolution.
+func (m *MetricsStorage) expire(now time.Time) error {
+	raw := now.Add(-m.retentionOf(Raw)).UTC()
+	if _, err := m.db.Exec(`DELETE FROM process_metrics WHERE timestamp < ?`, raw); err != nil {
+		return err
+	}
+	if _, err := m.db.Exec(`DELETE FROM app_metrics WHERE timestamp < ?`, raw); err != nil {
+		return err
+	}
+	for _, res := range rollups {
+		_, err := m.db.Exec(`DELETE FROM process_metrics_rollup WHERE resolution = ? AND bucket < ?`,
+			int64(time.Duration(res)/time.Second), now.Add(-m.retentionOf(res)).Unix())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartCompaction compacts the history now and then every compactInterval
+// until the storage is closed.
+func (m *MetricsStorage) StartCompaction() {
+	go func() {
+		ticker := time.NewTicker(compactInterval)
+		defer ticker.Stop()
+		for {
+			if err := m.Compact(); err != nil {
+				log.Printf("Compacting metrics history: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
@@ -2,14 +2,23 @@ package metrics
 
 import (
 	"database/sql"
+	"encoding/json"
+	"sync"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"gproc/pkg/types"
 )
 
+// MetricsStorage is the metrics history of the processes: their raw
+// samples and, once compacted, rollups of them at coarser resolutions,
+// each kept for its own retention.
 type MetricsStorage struct {
-	db *sql.DB
+	db        *sql.DB
+	mutex     sync.Mutex
+	retention types.MetricsRetention
+	stop      chan struct{}
+	stopOnce  sync.Once
 }
 
 func NewMetricsStorage(dbPath string) (*MetricsStorage, error) {
@@ -18,7 +27,7 @@ func NewMetricsStorage(dbPath string) (*MetricsStorage, error) {
 		return nil, err
 	}
 	
-	storage := &MetricsStorage{db: db}
+	storage := &MetricsStorage{db: db, retention: defaultRetention, stop: make(chan struct{})}
 	if err := storage.initTables(); err != nil {
 		return nil, err
 	}
@@ -38,6 +47,49 @@ func (m *MetricsStorage) initTables() error {
 	);
 	
 	CREATE INDEX IF NOT EXISTS idx_process_timestamp ON process_metrics(process_id, timestamp);
+	CREATE INDEX IF NOT EXISTS idx_metrics_timestamp ON process_metrics(timestamp);
+	
+	CREATE TABLE IF NOT EXISTS process_metrics_rollup (
+		process_id TEXT NOT NULL,
+		resolution INTEGER NOT NULL,
+		bucket INTEGER NOT NULL,
+		samples INTEGER NOT NULL,
+		cpu_avg REAL NOT NULL,
+		cpu_min REAL NOT NULL,
+		cpu_max REAL NOT NULL,
+		cpu_p95 REAL NOT NULL,
+		memory_avg REAL NOT NULL,
+		memory_min REAL NOT NULL,
+		memory_max REAL NOT NULL,
+		memory_p95 REAL NOT NULL,
+		PRIMARY KEY (process_id, resolution, bucket)
+	);
+	
+	CREATE INDEX IF NOT EXISTS idx_rollup_bucket ON process_metrics_rollup(resolution, bucket);
+	
+	CREATE TABLE IF NOT EXISTS metrics_compaction (
+		resolution INTEGER PRIMARY KEY,
+		until INTEGER NOT NULL
+	);
+	
+	CREATE TABLE IF NOT EXISTS app_metrics (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		process_id TEXT NOT NULL,
+		timestamp DATETIME NOT NULL,
+		name TEXT NOT NULL,
+		type TEXT NOT NULL,
+		tags TEXT NOT NULL,
+		value REAL NOT NULL,
+		count INTEGER NOT NULL,
+		sum REAL NOT NULL,
+		min REAL NOT NULL,
+		max REAL NOT NULL,
+		p50 REAL NOT NULL,
+		p95 REAL NOT NULL,
+		p99 REAL NOT NULL
+	);
+	
+	CREATE INDEX IF NOT EXISTS idx_app_metrics ON app_metrics(process_id, name, timestamp);
 	`
 	
 	_, err := m.db.Exec(query)
@@ -50,40 +102,52 @@ func (m *MetricsStorage) StoreMetrics(processID string, metrics *types.ProcessMe
 	VALUES (?, ?, ?, ?, ?)
 	`
 	
-	_, err := m.db.Exec(query, processID, time.Now(), 
+	_, err := m.db.Exec(query, processID, time.Now().UTC(), 
 		metrics.CPUUsage, metrics.MemoryUsage, int64(metrics.Uptime))
 	return err
 }
 
-func (m *MetricsStorage) GetMetricsHistory(processID string, hours int) ([]types.MetricPoint, error) {
-	query := `
-	SELECT timestamp, cpu_usage, memory_usage 
-	FROM process_metrics 
-	WHERE process_id = ? AND timestamp > datetime('now', '-' || ? || ' hours')
-	ORDER BY timestamp ASC
-	`
+// StoreAppMetrics records the StatsD metrics of a process, with their
+// tags as a JSON object.
+func (m *MetricsStorage) StoreAppMetrics(processID string, metrics []types.AppMetric) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 	
-	rows, err := m.db.Query(query, processID, hours)
+	stmt, err := tx.Prepare(`
+	INSERT INTO app_metrics (process_id, timestamp, name, type, tags, value, count, sum, min, max, p50, p95, p99)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	defer stmt.Close()
 	
-	var points []types.MetricPoint
-	for rows.Next() {
-		var point types.MetricPoint
-		var timestamp string
-		
-		err := rows.Scan(&timestamp, &point.CPU, &point.Memory)
+	now := time.Now().UTC()
+	for _, metric := range metrics {
+		tags := []byte("{}")
+		if len(metric.Tags) > 0 {
+			if tags, err = json.Marshal(metric.Tags); err != nil {
+				return err
+			}
+		}
+		_, err = stmt.Exec(processID, now, metric.Name, metric.Type, string(tags), metric.Value,
+			int64(metric.Count), metric.Sum, metric.Min, metric.Max, metric.P50, metric.P95, metric.P99)
 		if err != nil {
-			continue
+			return err
 		}
-		
-		point.Timestamp, _ = time.Parse("2006-01-02 15:04:05", timestamp)
-		points = append(points, point)
 	}
-	
-	return points, nil
+	return tx.Commit()
+}
+
+// GetMetricsHistory returns the history of a process over the last hours,
+// at the resolution QueryMetrics picks for them.
+func (m *MetricsStorage) GetMetricsHistory(processID string, hours int) ([]types.MetricPoint, error) {
+	now := time.Now()
+	points, _, err := m.QueryMetrics(processID, now.Add(-time.Duration(hours)*time.Hour), now)
+	return points, err
 }
 
 func (m *MetricsStorage) GetAggregatedMetrics(processID string) (*AggregatedMetrics, error) {
@@ -114,6 +178,7 @@ func (m *MetricsStorage) CleanupOldMetrics(days int) error {
 }
 
 func (m *MetricsStorage) Close() error {
+	m.stopOnce.Do(func() { close(m.stop) })
 	return m.db.Close()
 }
 
@@ -1,8 +1,7 @@
 package monitor
 
 import (
-	"fmt"
-	"runtime"
+	"time"
 )
 
 type ResourceUsage struct {
@@ -11,13 +10,57 @@ type ResourceUsage struct {
 	MemoryPercent float64 `json:"memory_percent"`
 }
 
-func GetProcessResources(pid int) (*ResourceUsage, error) {
-	if runtime.GOOS == "windows" {
-		return &ResourceUsage{
-			CPUPercent:    0,
-			MemoryMB:      0,
-			MemoryPercent: 0,
-		}, nil
+// HostUsage is the CPU, memory and load of the whole machine.
+type HostUsage struct {
+	CPUPercent    float64 `json:"cpu_percent"` // of all CPUs
+	MemoryPercent float64 `json:"memory_percent"`
+	MemoryBytes   uint64  `json:"memory_bytes"` // in use
+	MemoryTotal   uint64  `json:"memory_total"` // physical
+	Load1         float64 `json:"load1"`
+	Load5         float64 `json:"load5"`
+	Load15        float64 `json:"load15"`
+}
+
+// ProcessInfo describes one OS process and, in a tree, its descendants.
+type ProcessInfo struct {
+	PID           int            `json:"pid"`
+	PPID          int            `json:"ppid"`
+	PGID          int            `json:"pgid"`
+	SID           int            `json:"sid"`
+	Command       string         `json:"command"`
+	State         string         `json:"state"`
+	StartTime     time.Time      `json:"start_time"`
+	CPUTime       time.Duration  `json:"cpu_time"`
+	CPUPercent    float64        `json:"cpu_percent"`
+	RSSBytes      uint64         `json:"rss_bytes"`
+	MemoryPercent float64        `json:"memory_percent"`
+	Threads       int            `json:"threads"`
+	FDs           int            `json:"fds"`
+	Children      []*ProcessInfo `json:"children,omitempty"`
+}
+
+// cpuSample is how long CPU usage is measured for a percentage.
+const cpuSample = 200 * time.Millisecond
+
+// Walk calls fn for the process and all its descendants, depth first.
+func (p *ProcessInfo) Walk(fn func(p *ProcessInfo, depth int)) {
+	p.walk(fn, 0)
+}
+
+func (p *ProcessInfo) walk(fn func(p *ProcessInfo, depth int), depth int) {
+	fn(p, depth)
+	for _, child := range p.Children {
+		child.walk(fn, depth+1)
 	}
-	return &ResourceUsage{}, fmt.Errorf("resource monitoring not implemented for %s", runtime.GOOS)
-}
\ No newline at end of file
+}
+
+// Total sums CPU and memory over the process and its descendants.
+func (p *ProcessInfo) Total() ResourceUsage {
+	var usage ResourceUsage
+	p.Walk(func(p *ProcessInfo, depth int) {
+		usage.CPUPercent += p.CPUPercent
+		usage.MemoryMB += float64(p.RSSBytes) / (1024 * 1024)
+		usage.MemoryPercent += p.MemoryPercent
+	})
+	return usage
+}
@@ -0,0 +1,349 @@
+//go:build linux
+
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is USER_HZ, the unit of CPU times in /proc. It is 100 on
+// every Linux architecture Go supports.
+const clockTicks = 100
+
+const pageSize = 4096
+
+// GetProcessResources measures the CPU and memory usage of a process.
+func GetProcessResources(pid int) (*ResourceUsage, error) {
+	info, err := readProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+	sampleCPU([]*ProcessInfo{info})
+	return &ResourceUsage{
+		CPUPercent:    info.CPUPercent,
+		MemoryMB:      float64(info.RSSBytes) / (1024 * 1024),
+		MemoryPercent: info.MemoryPercent,
+	}, nil
+}
+
+// GetProcessTree returns a process with all its descendants, each with
+// its CPU usage measured over the same short interval.
+func GetProcessTree(pid int) (*ProcessInfo, error) {
+	trees, err := GetProcessTrees([]int{pid})
+	if err != nil {
+		return nil, err
+	}
+	if len(trees) == 0 {
+		return nil, fmt.Errorf("process %d not found", pid)
+	}
+	return trees[0], nil
+}
+
+// GetProcessTrees returns the trees of several processes, skipping those
+// that no longer exist, with all CPU usage measured over one interval.
+func GetProcessTrees(pids []int) ([]*ProcessInfo, error) {
+	var roots []*ProcessInfo
+	for _, pid := range pids {
+		if root, err := readProcess(pid); err == nil {
+			roots = append(roots, root)
+		}
+	}
+	if len(roots) == 0 {
+		return nil, nil
+	}
+
+	children := make(map[int][]int)
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		child, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		fields, _, err := readStat(child)
+		if err != nil {
+			// Exited meanwhile.
+			continue
+		}
+		ppid, _ := strconv.Atoi(fields[1])
+		children[ppid] = append(children[ppid], child)
+	}
+
+	all := append([]*ProcessInfo{}, roots...)
+	queue := append([]*ProcessInfo{}, roots...)
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+		for _, child := range children[parent.PID] {
+			if info, err := readProcess(child); err == nil {
+				parent.Children = append(parent.Children, info)
+			}
+		}
+		all = append(all, parent.Children...)
+		queue = append(queue, parent.Children...)
+	}
+	sampleCPU(all)
+	return roots, nil
+}
+
+// ListProcesses returns every process on the system with only what
+// /proc/<pid>/stat tells cheaply: parent, process group, session, state
+// and command name.
+func ListProcesses() ([]*ProcessInfo, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	var processes []*ProcessInfo
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		fields, name, err := readStat(pid)
+		if err != nil {
+			continue
+		}
+		info := &ProcessInfo{PID: pid, State: fields[0], Command: name}
+		info.PPID, _ = strconv.Atoi(fields[1])
+		info.PGID, _ = strconv.Atoi(fields[2])
+		info.SID, _ = strconv.Atoi(fields[3])
+		processes = append(processes, info)
+	}
+	return processes, nil
+}
+
+// sampleCPU sets the CPU percentage of each process from the CPU time it
+// used over cpuSample.
+func sampleCPU(processes []*ProcessInfo) {
+	start := time.Now()
+	before := make([]time.Duration, len(processes))
+	for i, p := range processes {
+		before[i] = p.CPUTime
+	}
+	time.Sleep(cpuSample)
+	elapsed := time.Since(start)
+
+	for i, p := range processes {
+		fields, _, err := readStat(p.PID)
+		if err != nil {
+			continue
+		}
+		p.CPUTime = cpuTime(fields)
+		p.CPUPercent = float64(p.CPUTime-before[i]) / float64(elapsed) * 100
+	}
+}
+
+// GetHostUsage measures the CPU usage of the machine over a short
+// interval, its memory in use and its load averages.
+func GetHostUsage() (*HostUsage, error) {
+	busyBefore, totalBefore, err := hostCPU()
+	if err != nil {
+		return nil, err
+	}
+	time.Sleep(cpuSample)
+	busy, total, err := hostCPU()
+	if err != nil {
+		return nil, err
+	}
+	usage := &HostUsage{}
+	if total > totalBefore {
+		usage.CPUPercent = float64(busy-busyBefore) / float64(total-totalBefore) * 100
+	}
+
+	meminfo, err := readMeminfo()
+	if err != nil {
+		return nil, err
+	}
+	usage.MemoryTotal = meminfo["MemTotal:"]
+	available, ok := meminfo["MemAvailable:"]
+	if !ok {
+		// Kernels before 3.14.
+		available = meminfo["MemFree:"] + meminfo["Buffers:"] + meminfo["Cached:"]
+	}
+	if usage.MemoryTotal > available {
+		usage.MemoryBytes = usage.MemoryTotal - available
+	}
+	if usage.MemoryTotal > 0 {
+		usage.MemoryPercent = float64(usage.MemoryBytes) / float64(usage.MemoryTotal) * 100
+	}
+
+	loadavg, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return nil, err
+	}
+	if fields := strings.Fields(string(loadavg)); len(fields) >= 3 {
+		usage.Load1, _ = strconv.ParseFloat(fields[0], 64)
+		usage.Load5, _ = strconv.ParseFloat(fields[1], 64)
+		usage.Load15, _ = strconv.ParseFloat(fields[2], 64)
+	}
+	return usage, nil
+}
+
+// hostCPU returns the CPU time of the machine spent busy and in total
+// since boot, in clock ticks, from the cpu line of /proc/stat.
+func hostCPU() (busy, total uint64, err error) {
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+		// user nice system idle iowait irq softirq steal; guest time is
+		// already counted in user and nice.
+		for i, field := range fields[1:] {
+			if i >= 8 {
+				break
+			}
+			ticks, _ := strconv.ParseUint(field, 10, 64)
+			total += ticks
+			if i != 3 && i != 4 {
+				busy += ticks
+			}
+		}
+		return busy, total, nil
+	}
+	return 0, 0, fmt.Errorf("no cpu line in /proc/stat")
+}
+
+// readStat returns the fields of /proc/<pid>/stat after the command name,
+// starting with the state, and the command name.
+func readStat(pid int) ([]string, string, error) {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return nil, "", fmt.Errorf("process %d: %v", pid, err)
+	}
+
+	// The command name is in parentheses and may itself contain spaces
+	// and parentheses.
+	s := string(stat)
+	open, end := strings.IndexByte(s, '('), strings.LastIndexByte(s, ')')
+	if open < 0 || end < open {
+		return nil, "", fmt.Errorf("process %d: malformed stat", pid)
+	}
+	fields := strings.Fields(s[end+1:])
+	if len(fields) < 22 {
+		return nil, "", fmt.Errorf("process %d: malformed stat", pid)
+	}
+	return fields, s[open+1 : end], nil
+}
+
+// ParentPID returns the PID of the parent of a process.
+func ParentPID(pid int) (int, error) {
+	fields, _, err := readStat(pid)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(fields[1])
+}
+
+// readProcess reads what /proc knows about a process.
+func readProcess(pid int) (*ProcessInfo, error) {
+	fields, name, err := readStat(pid)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join("/proc", strconv.Itoa(pid))
+
+	info := &ProcessInfo{PID: pid, State: fields[0], Command: name}
+	info.PPID, _ = strconv.Atoi(fields[1])
+	info.PGID, _ = strconv.Atoi(fields[2])
+	info.SID, _ = strconv.Atoi(fields[3])
+	info.CPUTime = cpuTime(fields)
+	info.Threads, _ = strconv.Atoi(fields[17])
+	if started, err := strconv.ParseUint(fields[19], 10, 64); err == nil {
+		if boot, err := bootTime(); err == nil {
+			info.StartTime = boot.Add(time.Duration(started) * time.Second / clockTicks)
+		}
+	}
+	if rss, err := strconv.ParseUint(fields[21], 10, 64); err == nil {
+		info.RSSBytes = rss * pageSize
+		if total, err := memTotal(); err == nil && total > 0 {
+			info.MemoryPercent = float64(info.RSSBytes) / float64(total) * 100
+		}
+	}
+
+	if cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil && len(cmdline) > 0 {
+		info.Command = strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " "))
+	}
+	if fds, err := os.ReadDir(filepath.Join(dir, "fd")); err == nil {
+		info.FDs = len(fds)
+	}
+	return info, nil
+}
+
+// cpuTime is the user and system time in stat fields from readStat.
+func cpuTime(fields []string) time.Duration {
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	return time.Duration(utime+stime) * time.Second / clockTicks
+}
+
+func bootTime() (time.Time, error) {
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "btime "); ok {
+			secs, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(secs, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("no btime in /proc/stat")
+}
+
+// memTotal returns the physical memory in bytes.
+func memTotal() (uint64, error) {
+	meminfo, err := readMeminfo()
+	if err != nil {
+		return 0, err
+	}
+	total, ok := meminfo["MemTotal:"]
+	if !ok {
+		return 0, fmt.Errorf("no MemTotal in /proc/meminfo")
+	}
+	return total, nil
+}
+
+// readMeminfo returns the sizes in /proc/meminfo in bytes, by name with
+// the colon.
+func readMeminfo() (map[string]uint64, error) {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	sizes := make(map[string]uint64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 {
+			if kb, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+				sizes[fields[0]] = kb * 1024
+			}
+		}
+	}
+	return sizes, scanner.Err()
+}
@@ -0,0 +1,44 @@
+//go:build !linux
+
+package monitor
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func GetProcessResources(pid int) (*ResourceUsage, error) {
+	if runtime.GOOS == "windows" {
+		return &ResourceUsage{
+			CPUPercent:    0,
+			MemoryMB:      0,
+			MemoryPercent: 0,
+		}, nil
+	}
+	return &ResourceUsage{}, fmt.Errorf("resource monitoring not implemented for %s", runtime.GOOS)
+}
+
+// GetProcessTree is only implemented on Linux.
+func GetProcessTree(pid int) (*ProcessInfo, error) {
+	return nil, fmt.Errorf("process inspection not implemented for %s", runtime.GOOS)
+}
+
+// GetProcessTrees is only implemented on Linux.
+func GetProcessTrees(pids []int) ([]*ProcessInfo, error) {
+	return nil, fmt.Errorf("process inspection not implemented for %s", runtime.GOOS)
+}
+
+// ListProcesses is only implemented on Linux.
+func ListProcesses() ([]*ProcessInfo, error) {
+	return nil, fmt.Errorf("process inspection not implemented for %s", runtime.GOOS)
+}
+
+// ParentPID is only implemented on Linux.
+func ParentPID(pid int) (int, error) {
+	return 0, fmt.Errorf("process inspection not implemented for %s", runtime.GOOS)
+}
+
+// GetHostUsage is only implemented on Linux.
+func GetHostUsage() (*HostUsage, error) {
+	return nil, fmt.Errorf("host monitoring not implemented for %s", runtime.GOOS)
+}
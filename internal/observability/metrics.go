@@ -3,88 +3,106 @@ package observability
 import (
 	"context"
 	"fmt"
+	"log"
 	"net/http"
 	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gproc/internal/monitor"
+	"gproc/internal/process"
 	"gproc/pkg/types"
 )
 
+// collectInterval is how often the supervised processes and the host are
+// measured.
+const collectInterval = 15 * time.Second
+
+// ProcessSource is the supervisor whose processes the exporter reports.
+type ProcessSource interface {
+	CollectMetrics() []process.ProcessSample
+}
+
+// MetricsManager exports the measurements of the supervised processes and
+// of the host to Prometheus. Per-process metrics are labelled with
+// process_name, group and instance (the ID of the process). The metrics
+// processes serve at their metrics endpoint or send over StatsD are
+// exported along, labelled with gproc_process (the name) and instance.
 type MetricsManager struct {
 	config    *types.MetricsConfig
+	source    ProcessSource
 	registry  *prometheus.Registry
 	server    *http.Server
 	
 	// Process metrics
-	processCount    *prometheus.GaugeVec
-	processRestarts *prometheus.CounterVec
-	processUptime   *prometheus.GaugeVec
-	processCPU      *prometheus.GaugeVec
-	processMemory   *prometheus.GaugeVec
+	processCount    *prometheus.Desc
+	processRestarts *prometheus.Desc
+	processUptime   *prometheus.Desc
+	processCPU      *prometheus.Desc
+	processMemory   *prometheus.Desc
+	processThreads  *prometheus.Desc
+	processFDs      *prometheus.Desc
+	processStatus   *prometheus.Desc
+	processHealth   *prometheus.Desc
+	logRedactions   *prometheus.Desc
+	scrapeUp        *prometheus.Desc
+	
+	// Metrics of the processes' own endpoints
+	scraper *scraper
 	
 	// System metrics
 	systemCPU    prometheus.Gauge
 	systemMemory prometheus.Gauge
 	systemLoad   prometheus.Gauge
 	
-	mu sync.RWMutex
+	mu        sync.RWMutex
+	samples   []process.ProcessSample
+	host      *monitor.HostUsage
+	collected time.Time
 }
 
-func NewMetricsManager(config *types.MetricsConfig) *MetricsManager {
+func NewMetricsManager(config *types.MetricsConfig, source ProcessSource) *MetricsManager {
 	registry := prometheus.NewRegistry()
 	
 	mm := &MetricsManager{
 		config:   config,
+		source:   source,
 		registry: registry,
+		scraper:  newScraper(),
 	}
 	
 	mm.initMetrics()
 	return mm
 }
 
+// processLabels label every per-process metric.
+var processLabels = []string{"process_name", "group", "instance"}
+
 func (mm *MetricsManager) initMetrics() {
 	// Process metrics
-	mm.processCount = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "gproc_processes_total",
-			Help: "Total number of processes by status",
-		},
-		[]string{"status"},
-	)
-	
-	mm.processRestarts = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "gproc_process_restarts_total",
-			Help: "Total number of process restarts",
-		},
-		[]string{"process_name"},
-	)
-	
-	mm.processUptime = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "gproc_process_uptime_seconds",
-			Help: "Process uptime in seconds",
-		},
-		[]string{"process_name"},
-	)
-	
-	mm.processCPU = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "gproc_process_cpu_percent",
-			Help: "Process CPU usage percentage",
-		},
-		[]string{"process_name"},
-	)
-	
-	mm.processMemory = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "gproc_process_memory_bytes",
-			Help: "Process memory usage in bytes",
-		},
-		[]string{"process_name"},
-	)
+	mm.processCount = prometheus.NewDesc("gproc_processes_total",
+		"Total number of processes by status", []string{"status"}, nil)
+	mm.processRestarts = prometheus.NewDesc("gproc_process_restarts_total",
+		"Total number of process restarts", processLabels, nil)
+	mm.processUptime = prometheus.NewDesc("gproc_process_uptime_seconds",
+		"Process uptime in seconds, 0 when not running", processLabels, nil)
+	mm.processCPU = prometheus.NewDesc("gproc_process_cpu_percent",
+		"Process CPU usage percentage, with its descendants", processLabels, nil)
+	mm.processMemory = prometheus.NewDesc("gproc_process_memory_bytes",
+		"Process resident memory in bytes, with its descendants", processLabels, nil)
+	mm.processThreads = prometheus.NewDesc("gproc_process_threads",
+		"Process threads, with its descendants", processLabels, nil)
+	mm.processFDs = prometheus.NewDesc("gproc_process_open_fds",
+		"Process open file descriptors, with its descendants", processLabels, nil)
+	mm.processStatus = prometheus.NewDesc("gproc_process_status",
+		"1 for the current status of the process, 0 for the others", append(processLabels, "status"), nil)
+	mm.processHealth = prometheus.NewDesc("gproc_process_health",
+		"1 for the current health of the process, 0 for the others", append(processLabels, "health"), nil)
+	mm.logRedactions = prometheus.NewDesc("gproc_log_redactions_total",
+		"Secrets redacted from the process output by rule", append(processLabels, "rule"), nil)
+	mm.scrapeUp = prometheus.NewDesc("gproc_process_metrics_up",
+		"1 if the last scrape of the metrics endpoint of the process succeeded", processLabels, nil)
 	
 	// System metrics
 	mm.systemCPU = prometheus.NewGauge(
@@ -104,17 +122,13 @@ func (mm *MetricsManager) initMetrics() {
 	mm.systemLoad = prometheus.NewGauge(
 		prometheus.GaugeOpts{
 			Name: "gproc_system_load_average",
-			Help: "System load average",
+			Help: "System load average over 1 minute",
 		},
 	)
 	
 	// Register metrics
 	mm.registry.MustRegister(
-		mm.processCount,
-		mm.processRestarts,
-		mm.processUptime,
-		mm.processCPU,
-		mm.processMemory,
+		mm,
 		mm.systemCPU,
 		mm.systemMemory,
 		mm.systemLoad,
@@ -128,8 +142,12 @@ func (mm *MetricsManager) Start(ctx context.Context) error {
 	
 	// Start Prometheus HTTP server
 	if mm.config.Prometheus != nil {
+		path := mm.config.Prometheus.Path
+		if path == "" {
+			path = "/metrics"
+		}
 		mux := http.NewServeMux()
-		mux.Handle(mm.config.Prometheus.Path, promhttp.HandlerFor(mm.registry, promhttp.HandlerOpts{}))
+		mux.Handle(path, mm.Handler())
 		
 		mm.server = &http.Server{
 			Addr:    fmt.Sprintf(":%d", mm.config.Prometheus.Port),
@@ -143,7 +161,7 @@ func (mm *MetricsManager) Start(ctx context.Context) error {
 		}()
 		
 		fmt.Printf("Metrics server started on :%d%s\n", 
-			mm.config.Prometheus.Port, mm.config.Prometheus.Path)
+			mm.config.Prometheus.Port, path)
 	}
 	
 	// Start metrics collection
@@ -161,46 +179,111 @@ func (mm *MetricsManager) Stop() error {
 	return nil
 }
 
+// Handler serves the metrics in the Prometheus exposition format. Metrics
+// of a process that clash with others are left out, with an error in the
+// log, rather than failing the whole scrape.
+func (mm *MetricsManager) Handler() http.Handler {
+	gatherers := prometheus.Gatherers{mm.registry, mm.scraper, prometheus.GathererFunc(mm.gatherAppMetrics)}
+	return promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{
+		ErrorLog:      log.Default(),
+		ErrorHandling: promhttp.ContinueOnError,
+	})
+}
+
+// Latest returns the last measurements of the processes and of the host,
+// which is nil where it cannot be measured, and when they were taken.
+func (mm *MetricsManager) Latest() ([]process.ProcessSample, *monitor.HostUsage, time.Time) {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+	return mm.samples, mm.host, mm.collected
+}
+
 func (mm *MetricsManager) collectMetrics(ctx context.Context) {
-	ticker := time.NewTicker(15 * time.Second)
+	ticker := time.NewTicker(collectInterval)
 	defer ticker.Stop()
 	
 	for {
+		mm.collect()
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			mm.updateSystemMetrics()
 		}
 	}
 }
 
-func (mm *MetricsManager) updateSystemMetrics() {
-	// Simulate system metrics (in production, use actual system calls)
-	mm.systemCPU.Set(float64(35 + (time.Now().Unix() % 30)))
-	mm.systemMemory.Set(float64(60 + (time.Now().Unix() % 20)))
-	mm.systemLoad.Set(float64(1.2 + float64(time.Now().Unix()%10)/10))
+// collect measures the processes and the host and scrapes the processes.
+func (mm *MetricsManager) collect() {
+	samples := mm.source.CollectMetrics()
+	mm.scraper.scrape(samples)
+	host, err := monitor.GetHostUsage()
+	if err == nil {
+		mm.systemCPU.Set(host.CPUPercent)
+		mm.systemMemory.Set(host.MemoryPercent)
+		mm.systemLoad.Set(host.Load1)
+	}
+	
+	mm.mu.Lock()
+	mm.samples, mm.host, mm.collected = samples, host, time.Now()
+	mm.mu.Unlock()
 }
 
-func (mm *MetricsManager) RecordProcessStart(processName string) {
-	mm.processCount.WithLabelValues("running").Inc()
-	mm.processUptime.WithLabelValues(processName).Set(0)
+// Describe and Collect make the manager the collector of the per-process
+// metrics, which it reports from the last measurements.
+func (mm *MetricsManager) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{mm.processCount, mm.processRestarts, mm.processUptime,
+		mm.processCPU, mm.processMemory, mm.processThreads, mm.processFDs, mm.processStatus,
+		mm.processHealth, mm.logRedactions, mm.scrapeUp} {
+		ch <- desc
+	}
 }
 
-func (mm *MetricsManager) RecordProcessStop(processName string) {
-	mm.processCount.WithLabelValues("running").Dec()
-	mm.processCount.WithLabelValues("stopped").Inc()
-	mm.processUptime.WithLabelValues(processName).Set(0)
+func (mm *MetricsManager) Collect(ch chan<- prometheus.Metric) {
+	samples, _, _ := mm.Latest()
+	up := mm.scraper.up()
+	
+	counts := map[types.ProcessStatus]int{}
+	for _, status := range processStatuses {
+		counts[status] = 0
+	}
+	for _, s := range samples {
+		counts[s.Status]++
+		labels := []string{s.Name, s.Group, s.ID}
+		gauge := func(desc *prometheus.Desc, value float64, extra ...string) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, append(labels, extra...)...)
+		}
+		
+		ch <- prometheus.MustNewConstMetric(mm.processRestarts, prometheus.CounterValue, float64(s.Restarts), labels...)
+		gauge(mm.processUptime, s.Uptime.Seconds())
+		gauge(mm.processCPU, s.CPUPercent)
+		gauge(mm.processMemory, float64(s.RSSBytes))
+		gauge(mm.processThreads, float64(s.Threads))
+		gauge(mm.processFDs, float64(s.FDs))
+		for _, status := range processStatuses {
+			gauge(mm.processStatus, boolValue(s.Status == status), string(status))
+		}
+		for _, health := range []string{"healthy", "unhealthy", "unknown"} {
+			gauge(mm.processHealth, boolValue(s.Health == health), health)
+		}
+		if ok, scraped := up[s.ID]; scraped {
+			gauge(mm.scrapeUp, boolValue(ok))
+		}
+		for rule, n := range s.LogRedactions {
+			ch <- prometheus.MustNewConstMetric(mm.logRedactions, prometheus.CounterValue, float64(n), append(labels, rule)...)
+		}
+	}
+	for status, n := range counts {
+		ch <- prometheus.MustNewConstMetric(mm.processCount, prometheus.GaugeValue, float64(n), string(status))
+	}
 }
 
-func (mm *MetricsManager) RecordProcessRestart(processName string) {
-	mm.processRestarts.WithLabelValues(processName).Inc()
-}
+var processStatuses = []types.ProcessStatus{types.StatusRunning, types.StatusStopped, types.StatusFailed, types.StatusIdle}
 
-func (mm *MetricsManager) UpdateProcessMetrics(processName string, cpu float64, memory float64, uptime time.Duration) {
-	mm.processCPU.WithLabelValues(processName).Set(cpu)
-	mm.processMemory.WithLabelValues(processName).Set(memory)
-	mm.processUptime.WithLabelValues(processName).Set(uptime.Seconds())
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
 }
 
 // Alerting Manager
@@ -0,0 +1,166 @@
+package observability
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/proto"
+	"gproc/internal/process"
+)
+
+// scrapeTimeout bounds a scrape of the metrics endpoint of a process.
+const scrapeTimeout = 10 * time.Second
+
+// Labels added to the metrics scraped from processes.
+const (
+	labelProcess  = "gproc_process"
+	labelInstance = "instance"
+)
+
+// scraper collects the metrics the processes serve themselves and hands
+// them to the exporter, each labelled with the name and ID of its process.
+type scraper struct {
+	client *http.Client
+
+	mu       sync.RWMutex
+	families []*dto.MetricFamily
+	results  map[string]error // by process ID, for those with an endpoint
+}
+
+func newScraper() *scraper {
+	return &scraper{
+		client:  &http.Client{Timeout: scrapeTimeout},
+		results: make(map[string]error),
+	}
+}
+
+// scrape reads the endpoints of the running processes side by side and
+// replaces the metrics of the last scrape.
+func (s *scraper) scrape(samples []process.ProcessSample) {
+	type scraped struct {
+		sample   *process.ProcessSample
+		families []*dto.MetricFamily
+		err      error
+	}
+	var results []*scraped
+	var wg sync.WaitGroup
+	for i := range samples {
+		if samples[i].MetricsURL == "" {
+			continue
+		}
+		r := &scraped{sample: &samples[i]}
+		results = append(results, r)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.families, r.err = s.fetch(r.sample.MetricsURL)
+		}()
+	}
+	wg.Wait()
+
+	// Merge the families of the same name across processes; a family
+	// whose type differs from the first one seen is left out.
+	merged := make(map[string]*dto.MetricFamily)
+	errs := make(map[string]error)
+	for _, r := range results {
+		errs[r.sample.ID] = r.err
+		for _, family := range r.families {
+			relabel(family, r.sample.Name, r.sample.ID)
+			existing, ok := merged[family.GetName()]
+			if !ok {
+				merged[family.GetName()] = family
+				continue
+			}
+			if existing.GetType() != family.GetType() {
+				log.Printf("Dropping metric %s of %s: it is a %s elsewhere, not a %s",
+					family.GetName(), r.sample.Name, existing.GetType(), family.GetType())
+				continue
+			}
+			existing.Metric = append(existing.Metric, family.Metric...)
+		}
+	}
+	families := make([]*dto.MetricFamily, 0, len(merged))
+	for _, family := range merged {
+		families = append(families, family)
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].GetName() < families[j].GetName() })
+
+	s.mu.Lock()
+	s.families, s.results = families, errs
+	s.mu.Unlock()
+}
+
+// fetch scrapes one endpoint, in the text or the protobuf format.
+func (s *scraper) fetch(url string) ([]*dto.MetricFamily, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", string(expfmt.NewFormat(expfmt.TypeProtoDelim))+";q=0.7,"+
+		string(expfmt.NewFormat(expfmt.TypeTextPlain))+";q=0.3")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	var families []*dto.MetricFamily
+	decoder := expfmt.NewDecoder(resp.Body, expfmt.ResponseFormat(resp.Header))
+	for {
+		family := &dto.MetricFamily{}
+		if err := decoder.Decode(family); err == io.EOF {
+			return families, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %v", url, err)
+		}
+		families = append(families, family)
+	}
+}
+
+// relabel sets the process labels on every metric of a family, replacing
+// labels of the same names, and keeps the labels sorted as the exporter
+// expects.
+func relabel(family *dto.MetricFamily, name, id string) {
+	for _, metric := range family.Metric {
+		labels := metric.Label[:0]
+		for _, label := range metric.Label {
+			if label.GetName() != labelProcess && label.GetName() != labelInstance {
+				labels = append(labels, label)
+			}
+		}
+		labels = append(labels,
+			&dto.LabelPair{Name: proto.String(labelProcess), Value: proto.String(name)},
+			&dto.LabelPair{Name: proto.String(labelInstance), Value: proto.String(id)})
+		sort.Slice(labels, func(i, j int) bool { return labels[i].GetName() < labels[j].GetName() })
+		metric.Label = labels
+	}
+}
+
+// Gather returns the metrics of the last scrape.
+func (s *scraper) Gather() ([]*dto.MetricFamily, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.families, nil
+}
+
+// up returns the processes with an endpoint and whether their last scrape
+// succeeded.
+func (s *scraper) up() map[string]bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	up := make(map[string]bool, len(s.results))
+	for id, err := range s.results {
+		up[id] = err == nil
+	}
+	return up
+}
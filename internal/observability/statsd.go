@@ -0,0 +1,100 @@
+package observability
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// gatherAppMetrics returns the metrics the processes sent over StatsD as
+// of the last collection, labelled like the scraped ones. Dots and other
+// characters Prometheus does not allow in names become underscores.
+// Timers, histograms and distributions are summaries with the quantiles
+// of the last flush interval.
+func (mm *MetricsManager) gatherAppMetrics() ([]*dto.MetricFamily, error) {
+	samples, _, _ := mm.Latest()
+	families := make(map[string]*dto.MetricFamily)
+	for _, s := range samples {
+		for _, app := range s.AppMetrics {
+			metric := &dto.Metric{}
+			var kind dto.MetricType
+			switch app.Type {
+			case "counter":
+				kind = dto.MetricType_COUNTER
+				metric.Counter = &dto.Counter{Value: proto.Float64(app.Value)}
+			case "gauge", "set":
+				kind = dto.MetricType_GAUGE
+				metric.Gauge = &dto.Gauge{Value: proto.Float64(app.Value)}
+			default:
+				kind = dto.MetricType_SUMMARY
+				summary := &dto.Summary{SampleCount: proto.Uint64(app.Count), SampleSum: proto.Float64(app.Sum)}
+				for _, q := range []struct{ quantile, value float64 }{{0.5, app.P50}, {0.95, app.P95}, {0.99, app.P99}} {
+					value := q.value
+					if app.Value == 0 {
+						// Nothing observed in the interval.
+						value = math.NaN()
+					}
+					summary.Quantile = append(summary.Quantile, &dto.Quantile{Quantile: proto.Float64(q.quantile), Value: proto.Float64(value)})
+				}
+				metric.Summary = summary
+			}
+
+			labels := make(map[string]string, len(app.Tags)+2)
+			for key, value := range app.Tags {
+				name := sanitizeName(key, false)
+				if _, ok := labels[name]; ok || strings.HasPrefix(name, "__") {
+					continue
+				}
+				labels[name] = value
+			}
+			labels[labelProcess] = s.Name
+			labels[labelInstance] = s.ID
+			for name, value := range labels {
+				metric.Label = append(metric.Label, &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)})
+			}
+			sort.Slice(metric.Label, func(i, j int) bool { return metric.Label[i].GetName() < metric.Label[j].GetName() })
+
+			name := sanitizeName(app.Name, true)
+			family, ok := families[name]
+			if !ok {
+				family = &dto.MetricFamily{
+					Name: proto.String(name),
+					Help: proto.String("StatsD " + app.Type + " " + app.Name),
+					Type: kind.Enum(),
+				}
+				families[name] = family
+			} else if family.GetType() != kind {
+				// Sent as different types; keep the first.
+				continue
+			}
+			family.Metric = append(family.Metric, metric)
+		}
+	}
+
+	result := make([]*dto.MetricFamily, 0, len(families))
+	for _, family := range families {
+		result = append(result, family)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].GetName() < result[j].GetName() })
+	return result, nil
+}
+
+// sanitizeName turns s into a valid Prometheus metric name or, without
+// colons, label name.
+func sanitizeName(s string, colons bool) string {
+	b := []byte(s)
+	for i, c := range b {
+		valid := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+			(c >= '0' && c <= '9') || (colons && c == ':')
+		if !valid {
+			b[i] = '_'
+		}
+	}
+	if len(b) > 0 && b[0] >= '0' && b[0] <= '9' {
+		return "_" + string(b)
+	}
+	return string(b)
+}
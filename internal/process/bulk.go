@@ -0,0 +1,105 @@
+package process
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"gproc/pkg/types"
+)
+
+// DefaultBulkParallel is how many processes a bulk operation acts on at
+// once when the caller does not say.
+const DefaultBulkParallel = 4
+
+// BulkResult is the outcome of a bulk operation for one process.
+type BulkResult struct {
+	Process string `json:"process"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Select returns a copy of every process matching sel, sorted by name.
+func (m *Manager) Select(sel Selector) []types.Process {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	processes := []types.Process{}
+	for _, proc := range m.processes {
+		if sel.Matches(proc.Labels) {
+			processes = append(processes, *proc)
+		}
+	}
+	sort.Slice(processes, func(i, j int) bool { return processes[i].Name < processes[j].Name })
+	return processes
+}
+
+// Bulk runs action ("start", "stop", "restart" or "reload") on the given
+// processes, at most parallel at a time, and returns one result per process
+// in the order given.
+func (m *Manager) Bulk(action string, ids []string, parallel int) ([]BulkResult, error) {
+	var op func(id string) error
+	switch action {
+	case "start":
+		op = m.StartByName
+	case "stop":
+		op = m.Stop
+	case "restart":
+		op = m.Restart
+	case "reload":
+		op = m.ZeroDowntimeReload
+	default:
+		return nil, fmt.Errorf("unknown bulk action %q", action)
+	}
+	if parallel <= 0 {
+		parallel = DefaultBulkParallel
+	}
+
+	results := make([]BulkResult, len(ids))
+	slots := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, id string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i].Process = id
+			if err := op(id); err != nil {
+				results[i].Error = err.Error()
+			}
+		}(i, id)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// SetLabels adds or changes the labels in set and removes those in remove.
+func (m *Manager) SetLabels(id string, set map[string]string, remove []string) (types.Process, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	proc, exists := m.processes[id]
+	if !exists {
+		return types.Process{}, fmt.Errorf("process %s not found", id)
+	}
+	labels := make(map[string]string, len(proc.Labels)+len(set))
+	for key, value := range proc.Labels {
+		labels[key] = value
+	}
+	for key, value := range set {
+		labels[key] = value
+	}
+	for _, key := range remove {
+		delete(labels, key)
+	}
+	if len(labels) == 0 {
+		labels = nil
+	}
+	proc.Labels = labels
+	// Log alert rules may select the process by its labels.
+	if w := m.logWriters[id]; w != nil {
+		m.setLogSinks(w, proc)
+	}
+	m.saveConfig()
+	return *proc, nil
+}
@@ -0,0 +1,176 @@
+package process
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"gproc/internal/pty"
+)
+
+// scrollbackSize is how much recent terminal output a Console replays to
+// newly attached clients.
+const scrollbackSize = 64 * 1024
+
+// clientBuffer is the number of pending output chunks a client may lag
+// behind before it is disconnected.
+const clientBuffer = 256
+
+var errConsoleBusy = errors.New("console already has an interactive client, attach with --read-only")
+
+// Console owns the master side of a process's pseudo-terminal. It copies the
+// terminal output to the log file, keeps a scrollback buffer and fans the
+// output out to attached clients. At most one client may write input.
+type Console struct {
+	master     *os.File
+	mutex      sync.Mutex
+	scrollback []byte
+	clients    map[*ConsoleClient]struct{}
+	writer     *ConsoleClient
+	closed     bool
+}
+
+// ConsoleClient is one attached terminal.
+type ConsoleClient struct {
+	console  *Console
+	output   chan []byte
+	readOnly bool
+	once     sync.Once
+}
+
+func newConsole(master *os.File) *Console {
+	return &Console{
+		master:  master,
+		clients: make(map[*ConsoleClient]struct{}),
+	}
+}
+
+// pump copies terminal output until the pty is closed.
+func (c *Console) pump(log io.Writer) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := c.master.Read(buf)
+		if n > 0 {
+			chunk := make([]byte, n)
+			copy(chunk, buf[:n])
+			log.Write(chunk)
+			c.broadcast(chunk)
+		}
+		if err != nil {
+			break
+		}
+	}
+	c.Close()
+}
+
+func (c *Console) broadcast(chunk []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.scrollback = append(c.scrollback, chunk...)
+	if over := len(c.scrollback) - scrollbackSize; over > 0 {
+		c.scrollback = append([]byte(nil), c.scrollback[over:]...)
+	}
+
+	for client := range c.clients {
+		select {
+		case client.output <- chunk:
+		default:
+			// Slow client, drop it rather than stall the process.
+			c.removeLocked(client)
+		}
+	}
+}
+
+// Attach registers a new client and returns it together with the current
+// scrollback.
+func (c *Console) Attach(readOnly bool) (*ConsoleClient, []byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return nil, nil, errors.New("process terminal is closed")
+	}
+	if !readOnly && c.writer != nil {
+		return nil, nil, errConsoleBusy
+	}
+
+	client := &ConsoleClient{
+		console:  c,
+		output:   make(chan []byte, clientBuffer),
+		readOnly: readOnly,
+	}
+	c.clients[client] = struct{}{}
+	if !readOnly {
+		c.writer = client
+	}
+
+	return client, append([]byte(nil), c.scrollback...), nil
+}
+
+// Resize changes the terminal window size.
+func (c *Console) Resize(rows, cols uint16) error {
+	return pty.SetSize(c.master, rows, cols)
+}
+
+// Closed reports whether the process side of the terminal has gone away.
+func (c *Console) Closed() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.closed
+}
+
+// Close disconnects all clients and releases the pty.
+func (c *Console) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return
+	}
+	c.closed = true
+	for client := range c.clients {
+		c.removeLocked(client)
+	}
+	c.master.Close()
+}
+
+func (c *Console) removeLocked(client *ConsoleClient) {
+	if _, ok := c.clients[client]; !ok {
+		return
+	}
+	delete(c.clients, client)
+	if c.writer == client {
+		c.writer = nil
+	}
+	close(client.output)
+}
+
+// Output delivers terminal output; it is closed when the client is detached
+// or the process exits.
+func (cc *ConsoleClient) Output() <-chan []byte {
+	return cc.output
+}
+
+// ReadOnly reports whether the client is a watcher.
+func (cc *ConsoleClient) ReadOnly() bool {
+	return cc.readOnly
+}
+
+// Write forwards input to the process. Watchers cannot write.
+func (cc *ConsoleClient) Write(p []byte) (int, error) {
+	if cc.readOnly {
+		return 0, errors.New("read-only client cannot send input")
+	}
+	return cc.console.master.Write(p)
+}
+
+// Detach removes the client from the console.
+func (cc *ConsoleClient) Detach() {
+	cc.once.Do(func() {
+		cc.console.mutex.Lock()
+		defer cc.console.mutex.Unlock()
+		cc.console.removeLocked(cc)
+	})
+}
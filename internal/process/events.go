@@ -0,0 +1,233 @@
+package process
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"gproc/internal/monitor"
+	"gproc/pkg/types"
+)
+
+// eventsPerProcess is how many events the daemon keeps for a process.
+const eventsPerProcess = 100
+
+// Description is everything 'gproc describe' shows about a process.
+type Description struct {
+	Process        types.Process          `json:"process"`
+	Tree           *monitor.ProcessInfo   `json:"tree,omitempty"`
+	Orphans        []*monitor.ProcessInfo `json:"orphans,omitempty"`
+	Resources      *monitor.ResourceUsage `json:"resources,omitempty"`
+	Health         HealthStatus           `json:"health"`
+	Events         []types.ProcessEvent   `json:"events"`
+	RestartHistory []types.ProcessEvent   `json:"restart_history"`
+	// LogRedactions counts the secrets redacted from the output by rule.
+	LogRedactions map[string]int64 `json:"log_redactions,omitempty"`
+}
+
+// HealthStatus is the health of a process as far as GProc can tell.
+type HealthStatus struct {
+	Status string `json:"status"` // healthy, unhealthy or unknown
+	Source string `json:"source,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// recordEvent appends an event to the history of a process. The caller
+// must hold m.mutex.
+func (m *Manager) recordEvent(id, kind string, pid int, exitCode *int, format string, args ...interface{}) {
+	event := types.ProcessEvent{
+		Time:     time.Now(),
+		Type:     kind,
+		Message:  fmt.Sprintf(format, args...),
+		PID:      pid,
+		ExitCode: exitCode,
+		Process:  id,
+	}
+	events := append(m.events[id], event)
+	if len(events) > eventsPerProcess {
+		events = events[len(events)-eventsPerProcess:]
+	}
+	m.events[id] = events
+
+	for ch, watched := range m.eventWatchers {
+		if watched != "" && watched != id {
+			continue
+		}
+		select {
+		case ch <- event:
+		default:
+			// Subscriber is too slow, cut it off instead of blocking.
+			delete(m.eventWatchers, ch)
+			close(ch)
+		}
+	}
+}
+
+// SubscribeEvents returns the recorded events of the process with id, or
+// of every process when id is empty, oldest first, and a channel with
+// those recorded after them. The channel is closed when the subscriber
+// falls too far behind. Call stop when done reading.
+func (m *Manager) SubscribeEvents(id string) (history []types.ProcessEvent, live <-chan types.ProcessEvent, stop func()) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if id != "" {
+		history = append(history, m.events[id]...)
+	} else {
+		for _, events := range m.events {
+			history = append(history, events...)
+		}
+		sort.SliceStable(history, func(i, j int) bool { return history[i].Time.Before(history[j].Time) })
+	}
+
+	ch := make(chan types.ProcessEvent, clientBuffer)
+	m.eventWatchers[ch] = id
+	return history, ch, func() {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		if _, ok := m.eventWatchers[ch]; ok {
+			delete(m.eventWatchers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Events returns the recorded events of a process, oldest first.
+func (m *Manager) Events(id string) []types.ProcessEvent {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return append([]types.ProcessEvent{}, m.events[id]...)
+}
+
+// Describe gathers the spec, process tree, resource usage, health and
+// history of a process.
+func (m *Manager) Describe(id string) (*Description, error) {
+	m.mutex.RLock()
+	proc, exists := m.processes[id]
+	if !exists {
+		m.mutex.RUnlock()
+		return nil, fmt.Errorf("process %s not found", id)
+	}
+	desc := &Description{
+		Process:        *proc,
+		Events:         append([]types.ProcessEvent{}, m.events[id]...),
+		RestartHistory: []types.ProcessEvent{},
+	}
+	if w := m.logWriters[id]; w != nil {
+		desc.LogRedactions = w.Redactions()
+	}
+	// The description is printed and sent over the control socket: the
+	// secrets of the environment stay out of it, as they do of gproc env.
+	if proc.Env != nil {
+		desc.Process.Env = make(map[string]string, len(proc.Env))
+		for key, value := range proc.Env {
+			desc.Process.Env[key] = redactValue(key, value)
+		}
+	}
+	m.mutex.RUnlock()
+
+	for _, event := range desc.Events {
+		if event.Type == types.EventRestarted {
+			desc.RestartHistory = append(desc.RestartHistory, event)
+		}
+	}
+
+	if tree, err := m.Tree(id); err == nil {
+		desc.Tree = tree.Tree
+		desc.Orphans = tree.Orphans
+		desc.Resources = tree.Resources
+	}
+	desc.Health = checkHealth(&desc.Process)
+	return desc, nil
+}
+
+// ProcessTree is the running tree of a process: the service with its
+// descendants and the orphaned descendants the daemon adopted.
+type ProcessTree struct {
+	Process   string                 `json:"process"`
+	Tree      *monitor.ProcessInfo   `json:"tree,omitempty"`
+	Orphans   []*monitor.ProcessInfo `json:"orphans,omitempty"`
+	Resources *monitor.ResourceUsage `json:"resources,omitempty"`
+}
+
+// Tree measures every process that belongs to a running process.
+func (m *Manager) Tree(id string) (*ProcessTree, error) {
+	m.mutex.RLock()
+	proc, exists := m.processes[id]
+	if !exists {
+		m.mutex.RUnlock()
+		return nil, fmt.Errorf("process %s not found", id)
+	}
+	pid := proc.PID
+	running := proc.Status == types.StatusRunning && pid > 0
+	m.mutex.RUnlock()
+
+	tree := &ProcessTree{Process: id}
+	if !running {
+		return tree, nil
+	}
+
+	trees, err := monitor.GetProcessTrees(append([]int{pid}, m.Orphans(id)...))
+	if err != nil {
+		return nil, err
+	}
+	var total monitor.ResourceUsage
+	for _, t := range trees {
+		if t.PID == pid {
+			tree.Tree = t
+		} else {
+			tree.Orphans = append(tree.Orphans, t)
+		}
+		usage := t.Total()
+		total.CPUPercent += usage.CPUPercent
+		total.MemoryMB += usage.MemoryMB
+		total.MemoryPercent += usage.MemoryPercent
+	}
+	if len(trees) > 0 {
+		tree.Resources = &total
+	}
+	return tree, nil
+}
+
+// checkHealth probes the health check URL of a process once or, for
+// notify processes, reports what the process last said about itself.
+func checkHealth(proc *types.Process) HealthStatus {
+	if proc.Status != types.StatusRunning {
+		return HealthStatus{Status: "unknown", Detail: "process is " + string(proc.Status)}
+	}
+
+	if proc.HealthCheck != nil && proc.HealthCheck.URL != "" {
+		timeout := proc.HealthCheck.Timeout
+		if timeout <= 0 {
+			timeout = 5 * time.Second
+		}
+		client := &http.Client{Timeout: timeout}
+		start := time.Now()
+		resp, err := client.Get(proc.HealthCheck.URL)
+		if err != nil {
+			return HealthStatus{Status: "unhealthy", Source: proc.HealthCheck.URL, Detail: err.Error()}
+		}
+		resp.Body.Close()
+		detail := fmt.Sprintf("%s in %s", resp.Status, time.Since(start).Round(time.Millisecond))
+		if resp.StatusCode >= 400 {
+			return HealthStatus{Status: "unhealthy", Source: proc.HealthCheck.URL, Detail: detail}
+		}
+		return HealthStatus{Status: "healthy", Source: proc.HealthCheck.URL, Detail: detail}
+	}
+
+	if proc.Type == types.ProcessTypeNotify {
+		status := HealthStatus{Status: "unknown", Source: "notify", Detail: string(proc.Readiness)}
+		switch proc.Readiness {
+		case types.ReadinessReady:
+			status.Status = "healthy"
+		case types.ReadinessStopping:
+			status.Status = "unhealthy"
+		}
+		if proc.StatusText != "" {
+			status.Detail += ": " + proc.StatusText
+		}
+		return status
+	}
+	return HealthStatus{Status: "unknown", Detail: "no health check configured"}
+}
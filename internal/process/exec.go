@@ -0,0 +1,221 @@
+package process
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gproc/pkg/types"
+)
+
+// ExecContext is what a command needs to run like a managed process: the
+// environment, working directory and user it actually runs with or, when
+// it is not running, would be started with.
+type ExecContext struct {
+	Process string `json:"process"`
+	// Source is "process" when read from the running process and "spec"
+	// when resolved from its spec.
+	Source string   `json:"source"`
+	PID    int      `json:"pid,omitempty"`
+	Dir    string   `json:"dir"`
+	Env    []string `json:"env"`
+	UID    int      `json:"uid"`
+	GID    int      `json:"gid"`
+	// Cgroup is the cgroup v2 path of the running process.
+	Cgroup string `json:"cgroup,omitempty"`
+}
+
+// ExecContext returns the context of a process for 'gproc exec' and
+// 'gproc env'.
+func (m *Manager) ExecContext(id string) (*ExecContext, error) {
+	m.mutex.RLock()
+	proc, exists := m.processes[id]
+	if !exists {
+		m.mutex.RUnlock()
+		return nil, fmt.Errorf("process %s not found", id)
+	}
+	spec := *proc
+	m.mutex.RUnlock()
+
+	if spec.Status == types.StatusRunning && spec.PID > 0 {
+		if ctx, err := processContext(spec.ID, spec.PID); err == nil {
+			return ctx, nil
+		}
+	}
+	return specContext(&spec)
+}
+
+// specContext resolves the context a process is started with by launch.
+func specContext(proc *types.Process) (*ExecContext, error) {
+	env := buildEnv(proc.Env)
+	if env == nil {
+		env = os.Environ()
+	}
+	dir := proc.WorkingDir
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		dir = wd
+	}
+	ctx := &ExecContext{
+		Process: proc.ID,
+		Source:  "spec",
+		Dir:     dir,
+		Env:     env,
+		UID:     os.Getuid(),
+		GID:     os.Getgid(),
+	}
+	ctx.sortEnv()
+	return ctx, nil
+}
+
+// supervisorEnv are the variables launch adds for the process itself: its
+// notify socket, watchdog and inherited sockets. A command run beside it
+// must not pick them up and notify or accept in its place.
+var supervisorEnv = map[string]bool{
+	"NOTIFY_SOCKET":  true,
+	"WATCHDOG_USEC":  true,
+	"LISTEN_FDS":     true,
+	"LISTEN_FDNAMES": true,
+	"LISTEN_PID":     true,
+}
+
+// stripSupervisorEnv removes supervisorEnv from the environment.
+func (ctx *ExecContext) stripSupervisorEnv() {
+	env := ctx.Env[:0]
+	for _, kv := range ctx.Env {
+		if key, _, _ := strings.Cut(kv, "="); !supervisorEnv[key] {
+			env = append(env, kv)
+		}
+	}
+	ctx.Env = env
+}
+
+// sortEnv sorts the environment by name, keeping the last value of a
+// repeated name like exec does.
+func (ctx *ExecContext) sortEnv() {
+	values := make(map[string]string)
+	for _, kv := range ctx.Env {
+		key, value, _ := strings.Cut(kv, "=")
+		values[key] = value
+	}
+	ctx.Env = ctx.Env[:0]
+	for key, value := range values {
+		ctx.Env = append(ctx.Env, key+"="+value)
+	}
+	sort.Strings(ctx.Env)
+}
+
+// Getenv returns the value of key in the environment of the context.
+func (ctx *ExecContext) Getenv(key string) string {
+	for _, kv := range ctx.Env {
+		if k, v, _ := strings.Cut(kv, "="); k == key {
+			return v
+		}
+	}
+	return ""
+}
+
+// Command builds a command that runs in the context. With enterNS it also
+// enters the namespaces of the running process that differ from ours, and
+// with cgroup its cgroup.
+func (ctx *ExecContext) Command(name string, args []string, enterNS, cgroup bool) (*exec.Cmd, error) {
+	if (enterNS || cgroup) && ctx.PID == 0 {
+		return nil, fmt.Errorf("process %s is not running, there are no namespaces or cgroup to enter", ctx.Process)
+	}
+
+	var cmd *exec.Cmd
+	if enterNS {
+		var err error
+		if cmd, err = ctx.nsenterCommand(name, args); err != nil {
+			return nil, err
+		}
+	}
+	if cmd == nil {
+		path, err := lookPath(name, ctx.Getenv("PATH"), ctx.Dir)
+		if err != nil {
+			return nil, err
+		}
+		cmd = exec.Command(path, args...)
+		cmd.Dir = ctx.Dir
+		if err := setCredential(cmd, ctx.UID, ctx.GID); err != nil {
+			return nil, err
+		}
+	}
+	cmd.Env = ctx.Env
+	if cgroup {
+		if err := ctx.joinCgroup(cmd); err != nil {
+			return nil, err
+		}
+	}
+	return cmd, nil
+}
+
+// lookPath finds a command in the PATH of the context rather than ours.
+func lookPath(name, path, dir string) (string, error) {
+	if strings.ContainsRune(name, os.PathSeparator) {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		return name, nil
+	}
+	for _, d := range filepath.SplitList(path) {
+		if d == "" {
+			d = "."
+		}
+		if !filepath.IsAbs(d) {
+			d = filepath.Join(dir, d)
+		}
+		if candidate, err := exec.LookPath(filepath.Join(d, name)); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("%s: executable file not found in the PATH of the process", name)
+}
+
+// secretWords are the parts of an environment variable name that mark its
+// value as a secret.
+var secretWords = map[string]bool{
+	"PASSWORD": true, "PASSWD": true, "PASS": true, "SECRET": true, "SECRETS": true,
+	"TOKEN": true, "KEY": true, "APIKEY": true, "CREDENTIAL": true, "CREDENTIALS": true,
+	"AUTH": true, "PRIVATE": true, "SIGNATURE": true, "COOKIE": true, "SESSION": true,
+	"DSN": true, "CERT": true,
+}
+
+// RedactEnv returns a copy of env with secret values replaced: those of
+// variables whose name looks like a secret, and passwords in URLs.
+func RedactEnv(env []string) []string {
+	redacted := make([]string, len(env))
+	for i, kv := range env {
+		key, value, _ := strings.Cut(kv, "=")
+		redacted[i] = key + "=" + redactValue(key, value)
+	}
+	return redacted
+}
+
+func redactValue(key, value string) string {
+	if value == "" {
+		return value
+	}
+	words := strings.FieldsFunc(strings.ToUpper(key), func(r rune) bool {
+		return !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+	for _, word := range words {
+		if secretWords[word] {
+			return "<redacted>"
+		}
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "redacted")
+			return u.String()
+		}
+	}
+	return value
+}
@@ -0,0 +1,148 @@
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// namespaces maps the namespaces in /proc/<pid>/ns to nsenter flags.
+var namespaces = []struct{ name, flag string }{
+	{"user", "--user"},
+	{"mnt", "--mount"},
+	{"uts", "--uts"},
+	{"ipc", "--ipc"},
+	{"net", "--net"},
+	{"pid", "--pid"},
+	{"cgroup", "--cgroup"},
+}
+
+// processContext reads the context of a running process from /proc.
+func processContext(id string, pid int) (*ExecContext, error) {
+	base := fmt.Sprintf("/proc/%d", pid)
+	environ, err := os.ReadFile(base + "/environ")
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.Readlink(base + "/cwd")
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := &ExecContext{Process: id, Source: "process", PID: pid, Dir: dir}
+	for _, kv := range bytes.Split(environ, []byte{0}) {
+		if len(kv) > 0 {
+			ctx.Env = append(ctx.Env, string(kv))
+		}
+	}
+	ctx.stripSupervisorEnv()
+	ctx.sortEnv()
+
+	status, err := os.Open(base + "/status")
+	if err != nil {
+		return nil, err
+	}
+	defer status.Close()
+	scanner := bufio.NewScanner(status)
+	for scanner.Scan() {
+		// Uid: and Gid: list the real, effective, saved and filesystem IDs.
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		switch fields[0] {
+		case "Uid:":
+			ctx.UID, _ = strconv.Atoi(fields[2])
+		case "Gid:":
+			ctx.GID, _ = strconv.Atoi(fields[2])
+		}
+	}
+
+	if cgroups, err := os.ReadFile(base + "/cgroup"); err == nil {
+		for _, line := range strings.Split(string(cgroups), "\n") {
+			if path, ok := strings.CutPrefix(line, "0::"); ok {
+				ctx.Cgroup = path
+			}
+		}
+	}
+	return ctx, nil
+}
+
+// nsenterCommand wraps a command in nsenter for the namespaces of the
+// process that differ from ours. It returns nil when there are none.
+func (ctx *ExecContext) nsenterCommand(name string, args []string) (*exec.Cmd, error) {
+	var flags []string
+	for _, ns := range namespaces {
+		theirs, err := os.Readlink(fmt.Sprintf("/proc/%d/ns/%s", ctx.PID, ns.name))
+		if err != nil {
+			return nil, fmt.Errorf("read namespaces of PID %d: %v", ctx.PID, err)
+		}
+		if ours, err := os.Readlink("/proc/self/ns/" + ns.name); err != nil || ours != theirs {
+			flags = append(flags, ns.flag)
+		}
+	}
+	if len(flags) == 0 {
+		return nil, nil
+	}
+
+	nsenter, err := exec.LookPath("nsenter")
+	if err != nil {
+		return nil, fmt.Errorf("entering namespaces needs nsenter (util-linux): %v", err)
+	}
+	nsArgs := append([]string{"--target", strconv.Itoa(ctx.PID)}, flags...)
+	nsArgs = append(nsArgs, "--root", "--wd="+ctx.Dir)
+	if ctx.UID != os.Getuid() || ctx.GID != os.Getgid() {
+		nsArgs = append(nsArgs, "--setuid", strconv.Itoa(ctx.UID), "--setgid", strconv.Itoa(ctx.GID))
+	}
+	nsArgs = append(nsArgs, "--", name)
+	return exec.Command(nsenter, append(nsArgs, args...)...), nil
+}
+
+// joinCgroup starts the command directly in the cgroup of the process.
+func (ctx *ExecContext) joinCgroup(cmd *exec.Cmd) error {
+	if ctx.Cgroup == "" {
+		return fmt.Errorf("process %s is not in a cgroup v2 hierarchy", ctx.Process)
+	}
+	root, err := cgroup2Mount()
+	if err != nil {
+		return err
+	}
+	// A raw descriptor: it must stay open until the command is started.
+	fd, err := unix.Open(filepath.Join(root, ctx.Cgroup), unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("open cgroup of process %s: %v", ctx.Process, err)
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = fd
+	return nil
+}
+
+// cgroup2Mount finds where the cgroup v2 hierarchy is mounted, which is
+// not /sys/fs/cgroup on hybrid systems.
+func cgroup2Mount() (string, error) {
+	mounts, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(mounts), "\n") {
+		fields, fs, ok := strings.Cut(line, " - ")
+		if !ok || !strings.HasPrefix(fs, "cgroup2 ") {
+			continue
+		}
+		if f := strings.Fields(fields); len(f) >= 5 {
+			return f[4], nil
+		}
+	}
+	return "", fmt.Errorf("no cgroup v2 hierarchy is mounted")
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package process
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// processContext needs /proc; elsewhere the context is resolved from the
+// spec.
+func processContext(id string, pid int) (*ExecContext, error) {
+	return nil, fmt.Errorf("process inspection not implemented for %s", runtime.GOOS)
+}
+
+func (ctx *ExecContext) nsenterCommand(name string, args []string) (*exec.Cmd, error) {
+	return nil, fmt.Errorf("namespaces are not supported on %s", runtime.GOOS)
+}
+
+func (ctx *ExecContext) joinCgroup(cmd *exec.Cmd) error {
+	return fmt.Errorf("cgroups are not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,85 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gproc/pkg/types"
+)
+
+// waitForked follows a forking process after its start command exited
+// successfully: it reads the PID of the service from the PID file and
+// waits for that instead. The caller is monitor, before exited is closed.
+func (m *Manager) waitForked(rt *procRuntime) {
+	m.mutex.RLock()
+	path := pidFilePath(rt.proc)
+	timeout := rt.proc.ReadyTimeout
+	m.mutex.RUnlock()
+	if timeout <= 0 {
+		timeout = defaultReadyTimeout
+	}
+
+	pid, err := readPIDFile(path, timeout, func() bool {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+		return rt.superseded || rt.proc.Status != types.StatusRunning
+	})
+	if err != nil {
+		rt.exitCode = 1
+		rt.exitDesc = err.Error()
+		m.mutex.Lock()
+		if m.runtimes[rt.proc.ID] == rt {
+			rt.proc.StatusText = err.Error()
+		}
+		m.mutex.Unlock()
+		return
+	}
+
+	rt.mainPID.Store(int64(pid))
+	m.trackChild(pid)
+	m.mutex.Lock()
+	if !rt.superseded && m.runtimes[rt.proc.ID] == rt {
+		rt.proc.PID = pid
+		rt.proc.Readiness = types.ReadinessReady
+		rt.proc.StatusText = fmt.Sprintf("main PID %d from %s", pid, path)
+	}
+	m.mutex.Unlock()
+	rt.readyOnce.Do(func() { close(rt.ready) })
+
+	rt.exitCode, rt.exitDesc = waitPID(pid)
+	m.untrackChild(pid)
+}
+
+// readPIDFile waits for the PID file of a forking process to name a live
+// process, until timeout or abandon reports that the run was stopped.
+func readPIDFile(path string, timeout time.Duration, abandon func() bool) (int, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+			if err == nil && pid > 0 && processAlive(pid) {
+				return pid, nil
+			}
+		}
+		if abandon() {
+			return 0, fmt.Errorf("stopped before writing PID file %s", path)
+		}
+		if time.Now().After(deadline) {
+			return 0, fmt.Errorf("no running process in PID file %s after %s", path, timeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// pidFilePath resolves the PID file of proc against its working directory.
+func pidFilePath(proc *types.Process) string {
+	if filepath.IsAbs(proc.PIDFile) || proc.WorkingDir == "" {
+		return proc.PIDFile
+	}
+	return filepath.Join(proc.WorkingDir, proc.PIDFile)
+}
@@ -0,0 +1,423 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"gproc/pkg/types"
+)
+
+// Exit codes reported for jobs that did not exit on their own, following
+// the conventions of timeout(1) and POSIX shells.
+const (
+	exitCodeTimeout   = 124
+	exitCodeNotFound  = 127
+	exitCodeCancelled = 130
+)
+
+const (
+	defaultJobGracePeriod = 10 * time.Second
+	defaultJobBackoff     = time.Second
+	maxJobBackoff         = 5 * time.Minute
+	maxFinishedJobs       = 100
+)
+
+// jobRun is the daemon-side state of a job.
+type jobRun struct {
+	job        *types.Job
+	output     *fanout
+	cancel     chan struct{}
+	cancelOnce sync.Once
+	done       chan struct{}
+}
+
+// RunJob starts job in the background and returns a snapshot of it right
+// away. Use WaitJob to block until it completes.
+func (m *Manager) RunJob(job *types.Job) (*types.Job, error) {
+	if job.Command == "" {
+		return nil, errors.New("job command is required")
+	}
+	if job.Name == "" {
+		job.Name = filepath.Base(job.Command)
+	}
+
+	dir := filepath.Join(m.logDir, "jobs")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	m.jobMutex.Lock()
+	defer m.jobMutex.Unlock()
+
+	job.ID = fmt.Sprintf("%s-%d", job.Name, time.Now().UnixMilli())
+	for i := 1; m.jobs[job.ID] != nil; i++ {
+		job.ID = fmt.Sprintf("%s-%d-%d", job.Name, time.Now().UnixMilli(), i)
+	}
+	job.LogFile = filepath.Join(dir, job.ID+".log")
+
+	file, err := os.OpenFile(job.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Status = types.JobRunning
+	job.StartTime = time.Now()
+	job.Attempts = 0
+
+	run := &jobRun{
+		job:    job,
+		output: newFanout(file),
+		cancel: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	m.jobs[job.ID] = run
+	m.pruneJobsLocked()
+
+	go m.executeJob(run)
+
+	snapshot := *job
+	return &snapshot, nil
+}
+
+// GetJob returns a snapshot of the job with the given ID, or of the most
+// recent job with that name.
+func (m *Manager) GetJob(id string) (*types.Job, error) {
+	m.jobMutex.Lock()
+	defer m.jobMutex.Unlock()
+
+	run, err := m.findJobLocked(id)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := *run.job
+	return &snapshot, nil
+}
+
+// ListJobs returns snapshots of all known jobs, oldest first.
+func (m *Manager) ListJobs() []*types.Job {
+	m.jobMutex.Lock()
+	defer m.jobMutex.Unlock()
+
+	jobs := make([]*types.Job, 0, len(m.jobs))
+	for _, run := range m.jobs {
+		snapshot := *run.job
+		jobs = append(jobs, &snapshot)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].StartTime.Before(jobs[j].StartTime)
+	})
+	return jobs
+}
+
+// WaitJob blocks until the job completes and returns its final state.
+func (m *Manager) WaitJob(id string) (*types.Job, error) {
+	m.jobMutex.Lock()
+	run, err := m.findJobLocked(id)
+	m.jobMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	<-run.done
+	return m.GetJob(run.job.ID)
+}
+
+// CancelJob stops a running job: it is asked to terminate and killed after
+// its grace period. Pending retries are abandoned.
+func (m *Manager) CancelJob(id string) (*types.Job, error) {
+	m.jobMutex.Lock()
+	run, err := m.findJobLocked(id)
+	m.jobMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-run.done:
+		return nil, fmt.Errorf("job %s is not running", run.job.ID)
+	default:
+	}
+
+	run.cancelOnce.Do(func() { close(run.cancel) })
+	return m.WaitJob(run.job.ID)
+}
+
+// FollowJob returns how many bytes of the job's log file were written so
+// far and a channel with everything written after that. The channel is nil
+// for completed jobs and closed when the job ends. Call stop when done
+// reading.
+func (m *Manager) FollowJob(id string) (job *types.Job, offset int64, live <-chan []byte, stop func(), err error) {
+	m.jobMutex.Lock()
+	run, err := m.findJobLocked(id)
+	if err != nil {
+		m.jobMutex.Unlock()
+		return nil, 0, nil, nil, err
+	}
+	snapshot := *run.job
+	m.jobMutex.Unlock()
+
+	ch, offset := run.output.subscribe()
+	if ch == nil {
+		return &snapshot, offset, nil, func() {}, nil
+	}
+	return &snapshot, offset, ch, func() { run.output.unsubscribe(ch) }, nil
+}
+
+func (m *Manager) findJobLocked(id string) (*jobRun, error) {
+	if run, exists := m.jobs[id]; exists {
+		return run, nil
+	}
+
+	var latest *jobRun
+	for _, run := range m.jobs {
+		if run.job.Name == id && (latest == nil || run.job.StartTime.After(latest.job.StartTime)) {
+			latest = run
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("job %s not found", id)
+	}
+	return latest, nil
+}
+
+// pruneJobsLocked forgets the oldest finished jobs beyond maxFinishedJobs.
+// Their log files stay on disk.
+func (m *Manager) pruneJobsLocked() {
+	var finished []*jobRun
+	for _, run := range m.jobs {
+		if run.job.Status != types.JobRunning {
+			finished = append(finished, run)
+		}
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].job.StartTime.Before(finished[j].job.StartTime)
+	})
+	for _, run := range finished[:len(finished)-maxFinishedJobs] {
+		delete(m.jobs, run.job.ID)
+	}
+}
+
+func (m *Manager) updateJob(run *jobRun, update func(job *types.Job)) {
+	m.jobMutex.Lock()
+	defer m.jobMutex.Unlock()
+	update(run.job)
+}
+
+func (m *Manager) executeJob(run *jobRun) {
+	defer close(run.done)
+	defer run.output.close()
+
+	job := run.job
+	for attempt := 1; ; attempt++ {
+		m.updateJob(run, func(j *types.Job) { j.Attempts = attempt })
+
+		status, code, err := m.runJobAttempt(run)
+		if status == types.JobSucceeded || status == types.JobCancelled || attempt > job.Retries {
+			m.finishJob(run, status, code, err)
+			return
+		}
+
+		delay := jobBackoff(job.Backoff, attempt)
+		fmt.Fprintf(run.output, "[gproc] attempt %d of %d ended with %s (exit code %d), retrying in %s\n",
+			attempt, job.Retries+1, status, code, delay)
+
+		select {
+		case <-time.After(delay):
+		case <-run.cancel:
+			m.finishJob(run, types.JobCancelled, exitCodeCancelled, nil)
+			return
+		}
+	}
+}
+
+func (m *Manager) finishJob(run *jobRun, status types.JobStatus, code int, err error) {
+	m.updateJob(run, func(j *types.Job) {
+		j.Status = status
+		j.ExitCode = code
+		j.EndTime = time.Now()
+		j.PID = 0
+		if err != nil {
+			j.Error = err.Error()
+		}
+	})
+}
+
+// runJobAttempt runs the job's command once and enforces its timeout.
+func (m *Manager) runJobAttempt(run *jobRun) (types.JobStatus, int, error) {
+	job := run.job
+
+	cmd := exec.Command(job.Command, job.Args...)
+	if job.WorkingDir != "" {
+		cmd.Dir = job.WorkingDir
+	}
+	cmd.Env = buildEnv(job.Env)
+	cmd.SysProcAttr = groupAttr()
+	cmd.Stdout = run.output
+	cmd.Stderr = run.output
+	// Do not hang on grandchildren that keep the output pipe open.
+	cmd.WaitDelay = 2 * time.Second
+
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(run.output, "[gproc] failed to start: %v\n", err)
+		return types.JobFailed, exitCodeNotFound, err
+	}
+	m.updateJob(run, func(j *types.Job) { j.PID = cmd.Process.Pid })
+	m.trackChild(cmd.Process.Pid)
+
+	waitErr := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		m.untrackChild(cmd.Process.Pid)
+		waitErr <- err
+	}()
+
+	var timeout <-chan time.Time
+	if job.Timeout > 0 {
+		timer := time.NewTimer(job.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var status types.JobStatus
+	var code int
+	select {
+	case err := <-waitErr:
+		return jobExitStatus(err)
+	case <-timeout:
+		status, code = types.JobTimedOut, exitCodeTimeout
+		fmt.Fprintf(run.output, "[gproc] timed out after %s\n", job.Timeout)
+	case <-run.cancel:
+		status, code = types.JobCancelled, exitCodeCancelled
+		fmt.Fprintf(run.output, "[gproc] cancelled\n")
+	}
+
+	// Graceful termination first, forced kill after the grace period, both
+	// sent to the whole process group so helpers the job spawned go too.
+	grace := job.GracePeriod
+	if grace <= 0 {
+		grace = defaultJobGracePeriod
+	}
+	pid := cmd.Process.Pid
+	if err := signalProcess(pid, syscall.SIGTERM, true); err != nil {
+		signalProcess(pid, os.Kill, true)
+	}
+	select {
+	case <-waitErr:
+	case <-time.After(grace):
+		fmt.Fprintf(run.output, "[gproc] still running after %s, killing\n", grace)
+		signalProcess(pid, os.Kill, true)
+		<-waitErr
+	}
+	return status, code, nil
+}
+
+func jobExitStatus(err error) (types.JobStatus, int, error) {
+	if err == nil {
+		return types.JobSucceeded, 0, nil
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code := exitErr.ExitCode()
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && code < 0 && ws.Signaled() {
+			code = 128 + int(ws.Signal())
+		}
+		return types.JobFailed, code, nil
+	}
+	return types.JobFailed, 1, err
+}
+
+// jobBackoff doubles the base delay with every failed attempt.
+func jobBackoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		base = defaultJobBackoff
+	}
+	delay := base
+	for i := 1; i < attempt && delay < maxJobBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxJobBackoff {
+		delay = maxJobBackoff
+	}
+	return delay
+}
+
+// fanout writes job output to the log file and to live followers.
+type fanout struct {
+	mutex       sync.Mutex
+	file        *os.File
+	written     int64
+	subscribers map[chan []byte]struct{}
+	closed      bool
+}
+
+func newFanout(file *os.File) *fanout {
+	return &fanout{file: file, subscribers: make(map[chan []byte]struct{})}
+}
+
+func (f *fanout) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	n, err := f.file.Write(p)
+	f.written += int64(n)
+
+	chunk := append([]byte(nil), p[:n]...)
+	for ch := range f.subscribers {
+		select {
+		case ch <- chunk:
+		default:
+			// Follower is too slow, cut it off instead of blocking the job.
+			delete(f.subscribers, ch)
+			close(ch)
+		}
+	}
+	return n, err
+}
+
+// subscribe returns a channel of future output and the number of bytes
+// already in the file. The channel is nil once the output is closed.
+func (f *fanout) subscribe() (chan []byte, int64) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return nil, f.written
+	}
+	ch := make(chan []byte, clientBuffer)
+	f.subscribers[ch] = struct{}{}
+	return ch, f.written
+}
+
+func (f *fanout) unsubscribe(ch chan []byte) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, ok := f.subscribers[ch]; ok {
+		delete(f.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (f *fanout) close() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.closed = true
+	for ch := range f.subscribers {
+		delete(f.subscribers, ch)
+		close(ch)
+	}
+	f.file.Close()
+}
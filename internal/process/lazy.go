@@ -0,0 +1,279 @@
+package process
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"gproc/pkg/types"
+)
+
+// defaultIdleTimeout stops a lazy process after this long without
+// connections when it does not set IdleTimeout.
+const defaultIdleTimeout = 10 * time.Minute
+
+// lazyService holds the sockets of a lazy process. The manager accepts on
+// the declared sockets and forwards every connection to private unix
+// sockets passed to the process, starting it on demand. Connections that
+// arrive while it starts wait in the private socket's backlog.
+type lazyService struct {
+	id        string
+	frontends []net.Listener
+	backend   *socketSet
+	idle      time.Duration
+
+	mutex      sync.Mutex
+	active     int
+	lastActive time.Time
+	closed     chan struct{}
+	closeOnce  sync.Once
+}
+
+// startLazy binds the sockets of a lazy process and leaves it idle until
+// the first connection. The caller must hold m.mutex.
+func (m *Manager) startLazy(proc *types.Process) error {
+	if len(proc.Sockets) == 0 {
+		return fmt.Errorf("lazy process %s needs at least one socket", proc.ID)
+	}
+	if runtime.GOOS == "windows" {
+		return fmt.Errorf("lazy processes are not supported on windows")
+	}
+	if lz := m.lazy[proc.ID]; lz != nil {
+		lz.Close()
+		delete(m.lazy, proc.ID)
+	}
+
+	lz := &lazyService{
+		id:         proc.ID,
+		backend:    &socketSet{},
+		idle:       proc.IdleTimeout,
+		lastActive: time.Now(),
+		closed:     make(chan struct{}),
+	}
+	if lz.idle <= 0 {
+		lz.idle = defaultIdleTimeout
+	}
+
+	dir := notifyDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	for i, spec := range proc.Sockets {
+		switch spec.Network {
+		case "tcp", "tcp4", "tcp6", "unix":
+		default:
+			lz.Close()
+			return fmt.Errorf("lazy process %s: %s sockets cannot be proxied", proc.ID, spec.Network)
+		}
+		if spec.Network == "unix" {
+			os.Remove(spec.Address)
+		}
+		listener, err := net.Listen(spec.Network, spec.Address)
+		if err != nil {
+			lz.Close()
+			return fmt.Errorf("bind %s socket %s for %s: %v", spec.Network, spec.Address, proc.ID, err)
+		}
+		lz.frontends = append(lz.frontends, listener)
+
+		private := types.Socket{
+			Name:    spec.Name,
+			Network: "unix",
+			Address: filepath.Join(dir, fmt.Sprintf("%s.%d.sock", proc.ID, i)),
+		}
+		socket, err := bindSocket(private)
+		if err != nil {
+			lz.Close()
+			return fmt.Errorf("bind private socket for %s: %v", proc.ID, err)
+		}
+		lz.backend.sockets = append(lz.backend.sockets, socket)
+	}
+
+	m.lazy[proc.ID] = lz
+	proc.Status = types.StatusIdle
+	proc.PID = 0
+	proc.StatusText = "waiting for the first connection"
+
+	for i, listener := range lz.frontends {
+		go m.acceptLazy(lz, listener, lz.backend.sockets[i].spec.Address)
+	}
+	go m.reapIdle(lz)
+	return nil
+}
+
+func (lz *lazyService) Close() {
+	lz.closeOnce.Do(func() {
+		close(lz.closed)
+		for _, listener := range lz.frontends {
+			listener.Close()
+		}
+		lz.backend.Close()
+		for _, socket := range lz.backend.sockets {
+			os.Remove(socket.spec.Address)
+		}
+		// Removes the directory unless notify sockets still use it.
+		os.Remove(notifyDir())
+	})
+}
+
+func (m *Manager) acceptLazy(lz *lazyService, listener net.Listener, backend string) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-lz.closed:
+				return
+			default:
+			}
+			log.Printf("Lazy process %s: accept: %v", lz.id, err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		go m.serveLazy(lz, conn, backend)
+	}
+}
+
+// serveLazy starts the process if needed and forwards conn to it.
+func (m *Manager) serveLazy(lz *lazyService, conn net.Conn, backend string) {
+	lz.track(1)
+	defer lz.track(-1)
+
+	if err := m.ensureLazyRunning(lz); err != nil {
+		log.Printf("Lazy process %s: %v", lz.id, err)
+		conn.Close()
+		return
+	}
+
+	upstream, err := net.Dial("unix", backend)
+	if err != nil {
+		log.Printf("Lazy process %s: %v", lz.id, err)
+		conn.Close()
+		return
+	}
+	pipe(conn, upstream)
+}
+
+func (lz *lazyService) track(delta int) {
+	lz.mutex.Lock()
+	lz.active += delta
+	lz.lastActive = time.Now()
+	lz.mutex.Unlock()
+}
+
+// ensureLazyRunning starts an idle lazy process and, for notify processes,
+// waits until it is ready.
+func (m *Manager) ensureLazyRunning(lz *lazyService) error {
+	m.mutex.Lock()
+	proc, exists := m.processes[lz.id]
+	if !exists || m.lazy[lz.id] != lz {
+		m.mutex.Unlock()
+		return fmt.Errorf("process is no longer managed")
+	}
+	if proc.Status != types.StatusRunning {
+		log.Printf("Lazy process %s: starting on first connection", lz.id)
+		if err := m.spawn(proc); err != nil {
+			proc.Status = types.StatusFailed
+			m.mutex.Unlock()
+			return err
+		}
+		m.saveConfig()
+	}
+	rt := m.runtimes[lz.id]
+	timeout := proc.ReadyTimeout
+	m.mutex.Unlock()
+
+	if rt.notify == nil {
+		return nil
+	}
+	if timeout <= 0 {
+		timeout = defaultReadyTimeout
+	}
+	select {
+	case <-rt.ready:
+		return nil
+	case <-rt.exited:
+		return fmt.Errorf("process exited before it was ready")
+	case <-time.After(timeout):
+		return fmt.Errorf("process not ready after %s", timeout)
+	}
+}
+
+// reapIdle stops the process once it went without connections for the
+// idle timeout.
+func (m *Manager) reapIdle(lz *lazyService) {
+	interval := lz.idle / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-lz.closed:
+			return
+		case <-ticker.C:
+		}
+
+		lz.mutex.Lock()
+		idle := lz.active == 0 && time.Since(lz.lastActive) >= lz.idle
+		lz.mutex.Unlock()
+		if idle {
+			m.stopIdle(lz)
+		}
+	}
+}
+
+func (m *Manager) stopIdle(lz *lazyService) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	proc, exists := m.processes[lz.id]
+	rt := m.runtimes[lz.id]
+	if !exists || m.lazy[lz.id] != lz || proc.Status != types.StatusRunning || rt == nil {
+		return
+	}
+
+	log.Printf("Lazy process %s: stopping after %s without connections", lz.id, lz.idle)
+	proc.Status = types.StatusIdle
+	m.recordEvent(lz.id, types.EventIdle, proc.PID, nil, "stopped after %s without connections", lz.idle)
+	// Other processes can be managed while this one stops, as in Stop.
+	m.mutex.Unlock()
+	stopRun(rt)
+	m.mutex.Lock()
+
+	// A connection while it was stopping started it again.
+	if m.runtimes[lz.id] != rt {
+		return
+	}
+	proc.PID = 0
+	if proc.Status == types.StatusIdle {
+		proc.StatusText = fmt.Sprintf("stopped after %s idle", lz.idle)
+	}
+	m.saveConfig()
+}
+
+// pipe copies between two connections until both directions are done.
+func pipe(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	copyHalf := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		} else {
+			dst.Close()
+		}
+		done <- struct{}{}
+	}
+	go copyHalf(a, b)
+	go copyHalf(b, a)
+	<-done
+	<-done
+	a.Close()
+	b.Close()
+}
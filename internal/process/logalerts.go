@@ -0,0 +1,250 @@
+package process
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+
+	"gproc/internal/logger"
+	"gproc/pkg/types"
+)
+
+const (
+	defaultLogAlertWindow = time.Minute
+	// maxAlertLines is how many of the lines that raised an alert it
+	// carries, the latest.
+	maxAlertLines = 20
+)
+
+// logAlertRule is a log alert rule with the lines of each process that
+// matched it within its window.
+type logAlertRule struct {
+	types.LogAlertRule
+	re       *regexp.Regexp
+	selector Selector
+
+	mutex   sync.Mutex
+	matches map[string]*logMatches // by process ID
+}
+
+type logMatches struct {
+	times []time.Time
+	lines []logger.Entry // the latest maxAlertLines
+}
+
+func newLogAlertRule(rule types.LogAlertRule) (*logAlertRule, error) {
+	if rule.Name == "" {
+		return nil, fmt.Errorf("log alert rule needs a name")
+	}
+	re, err := regexp.Compile(rule.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern of log alert rule %s: %v", rule.Name, err)
+	}
+	selector, err := ParseSelector(rule.Selector)
+	if err != nil {
+		return nil, err
+	}
+	if rule.Process != "" && !selector.Empty() {
+		return nil, fmt.Errorf("log alert rule %s has both a process and a selector", rule.Name)
+	}
+	if rule.Threshold <= 0 {
+		rule.Threshold = 1
+	}
+	if rule.Window <= 0 {
+		rule.Window = defaultLogAlertWindow
+	}
+	if rule.Severity == "" {
+		rule.Severity = "warning"
+	}
+	return &logAlertRule{
+		LogAlertRule: rule,
+		re:           re,
+		selector:     selector,
+		matches:      make(map[string]*logMatches),
+	}, nil
+}
+
+// applies reports whether the rule watches proc.
+func (r *logAlertRule) applies(proc *types.Process) bool {
+	if r.Process != "" {
+		return r.Process == proc.Name || r.Process == proc.ID
+	}
+	return r.selector.Matches(proc.Labels)
+}
+
+// observe counts an entry of the process with id when it matches, and
+// returns the lines to raise an alert with once the rule fires. The count
+// starts over after each alert.
+func (r *logAlertRule) observe(id string, e logger.Entry) []logger.Entry {
+	if !r.re.MatchString(e.Message) {
+		return nil
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	m := r.matches[id]
+	if m == nil {
+		m = &logMatches{}
+		r.matches[id] = m
+	}
+
+	since := e.Time.Add(-r.Window)
+	expired := 0
+	for expired < len(m.times) && m.times[expired].Before(since) {
+		expired++
+	}
+	m.times = append(m.times[expired:], e.Time)
+	m.lines = append(m.lines, e)
+	for len(m.lines) > maxAlertLines || (len(m.lines) > 0 && m.lines[0].Time.Before(since)) {
+		m.lines = m.lines[1:]
+	}
+	if len(m.times) < r.Threshold {
+		return nil
+	}
+	lines := m.lines
+	delete(r.matches, id)
+	return lines
+}
+
+// logAlertSink checks the output of one process against the log alert
+// rules watching it.
+type logAlertSink struct {
+	m     *Manager
+	proc  string
+	rules []*logAlertRule
+}
+
+func (s *logAlertSink) Add(e logger.Entry) {
+	for _, rule := range s.rules {
+		if lines := rule.observe(s.proc, e); lines != nil {
+			s.m.raiseLogAlert(rule, s.proc, lines)
+		}
+	}
+}
+
+func (m *Manager) raiseLogAlert(rule *logAlertRule, id string, lines []logger.Entry) {
+	message := fmt.Sprintf("%d lines matching %q within %s", rule.Threshold, rule.Pattern, rule.Window)
+	if rule.Threshold == 1 {
+		message = fmt.Sprintf("line matching %q", rule.Pattern)
+	}
+	alert := types.Alert{
+		Name:      rule.Name,
+		Type:      "log",
+		Message:   message,
+		Severity:  rule.Severity,
+		ProcessID: id,
+	}
+	for _, e := range lines {
+		alert.Lines = append(alert.Lines, e.Time.Format(time.RFC3339Nano)+" "+e.Stream+" "+e.Message)
+	}
+	if err := m.alertManager.Raise(alert); err != nil {
+		log.Printf("Raising log alert %s for %s: %v", rule.Name, id, err)
+	}
+}
+
+// alertingConfig returns the alerting configuration, creating it. The
+// caller must hold m.mutex.
+func (m *Manager) alertingConfig() *types.AlertingConfig {
+	if m.config.Observability == nil {
+		m.config.Observability = &types.ObservabilityConfig{}
+	}
+	if m.config.Observability.Alerting == nil {
+		m.config.Observability.Alerting = &types.AlertingConfig{}
+	}
+	return m.config.Observability.Alerting
+}
+
+// loadLogAlertRules compiles the log alert rules of the configuration and
+// hands each running process those watching it. The caller must hold
+// m.mutex.
+func (m *Manager) loadLogAlertRules() {
+	m.logAlertRules = nil
+	var rules []types.LogAlertRule
+	if m.config.Observability != nil && m.config.Observability.Alerting != nil {
+		rules = m.config.Observability.Alerting.LogRules
+	}
+	for _, rule := range rules {
+		compiled, err := newLogAlertRule(rule)
+		if err != nil {
+			log.Printf("Ignoring log alert rule: %v", err)
+			continue
+		}
+		m.logAlertRules = append(m.logAlertRules, compiled)
+	}
+	for id, w := range m.logWriters {
+		if proc := m.processes[id]; proc != nil {
+			m.setLogSinks(w, proc)
+		}
+	}
+}
+
+// logAlertSink returns the sink checking the output of proc against the
+// log alert rules watching it, or nil. The caller must hold m.mutex.
+func (m *Manager) logAlertSink(proc *types.Process) logger.Sink {
+	sink := &logAlertSink{m: m, proc: proc.ID}
+	for _, rule := range m.logAlertRules {
+		if rule.applies(proc) {
+			sink.rules = append(sink.rules, rule)
+		}
+	}
+	if len(sink.rules) == 0 {
+		return nil
+	}
+	return sink
+}
+
+// AddLogAlertRule adds a log alert rule to the configuration, replacing
+// the rule with the same name. The daemon applies it to the running
+// processes at once.
+func (m *Manager) AddLogAlertRule(rule types.LogAlertRule) error {
+	if _, err := newLogAlertRule(rule); err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	cfg := m.alertingConfig()
+	replaced := false
+	for i := range cfg.LogRules {
+		if cfg.LogRules[i].Name == rule.Name {
+			cfg.LogRules[i] = rule
+			replaced = true
+		}
+	}
+	if !replaced {
+		cfg.LogRules = append(cfg.LogRules, rule)
+	}
+	m.saveConfig()
+	if m.captureLogs {
+		m.loadLogAlertRules()
+	}
+	return nil
+}
+
+// RemoveLogAlertRule deletes the named log alert rule.
+func (m *Manager) RemoveLogAlertRule(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	cfg := m.alertingConfig()
+	for i := range cfg.LogRules {
+		if cfg.LogRules[i].Name == name {
+			cfg.LogRules = append(cfg.LogRules[:i], cfg.LogRules[i+1:]...)
+			m.saveConfig()
+			if m.captureLogs {
+				m.loadLogAlertRules()
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("log alert rule %s not found", name)
+}
+
+// LogAlertRules returns the log alert rules of the configuration.
+func (m *Manager) LogAlertRules() []types.LogAlertRule {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if m.config.Observability == nil || m.config.Observability.Alerting == nil {
+		return []types.LogAlertRule{}
+	}
+	return append([]types.LogAlertRule{}, m.config.Observability.Alerting.LogRules...)
+}
@@ -0,0 +1,241 @@
+package process
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gproc/internal/logger"
+	"gproc/internal/logging"
+	"gproc/pkg/types"
+)
+
+// EnableLogCapture makes the manager read the output of the processes it
+// starts and write it to their logs as timestamped entries per stream,
+// rotating them as configured. Only the daemon can: the pipes end with it.
+//
+// It also forwards the output to syslog or the systemd journal as the
+// processes or the logging configuration say, starts shipping the logs
+// when the configuration has a log aggregation provider, watches them
+// for the log alert rules, and opens the log store, which from then on
+// deletes the entries past the retention of their process.
+func (m *Manager) EnableLogCapture() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.captureLogs = true
+	m.systemLog = logging.NewSystemLog()
+
+	if cfg := m.loggingConfig(); cfg != nil && cfg.Aggregation != nil {
+		shipper := logging.NewAggregationManager(cfg.Aggregation)
+		if err := shipper.Start(m.logDir); err != nil {
+			log.Printf("Log shipping to %s disabled: %v", cfg.Aggregation.Provider, err)
+		} else {
+			m.shipper = shipper
+		}
+	}
+
+	m.loadLogAlertRules()
+
+	store, err := m.LogStore()
+	if err != nil {
+		log.Printf("Log store unavailable, logs are not indexed: %v", err)
+		return
+	}
+	// Every retention must be known before the first expiry.
+	for _, proc := range m.processes {
+		setStoreOptions(store, proc)
+	}
+	store.EnforceRetention()
+}
+
+// loggingConfig returns the logging configuration of the daemon, or nil.
+func (m *Manager) loggingConfig() *types.LoggingConfig {
+	if m.config.Observability == nil {
+		return nil
+	}
+	return m.config.Observability.Logging
+}
+
+// setStoreOptions passes the log search settings of proc to the store.
+func setStoreOptions(store *logger.Store, proc *types.Process) {
+	var retention time.Duration
+	if proc.LogSearch != nil {
+		retention = proc.LogSearch.Retention
+	}
+	store.SetProcess(proc.Name, proc.LogSearch != nil, retention)
+}
+
+// logWriter returns the log writer of a process, opening it on first use
+// or when the log file of the process changed. The caller must hold
+// m.mutex.
+func (m *Manager) logWriter(proc *types.Process) (*logger.Writer, error) {
+	parser, err := logger.NewParser(proc.LogParser)
+	if err != nil {
+		return nil, err
+	}
+	multiline, err := logger.NewMultiline(proc.LogMultiline)
+	if err != nil {
+		return nil, err
+	}
+	redactor, err := m.logRedactor(proc)
+	if err != nil {
+		return nil, err
+	}
+	w := m.logWriters[proc.ID]
+	if w != nil && w.Path() != proc.LogFile {
+		w.Close()
+		delete(m.logWriters, proc.ID)
+		w = nil
+	}
+	if w == nil {
+		if w, err = logger.NewWriter(proc.Name, proc.LogFile, proc.LogRotation); err != nil {
+			return nil, err
+		}
+		m.logWriters[proc.ID] = w
+	} else if err := w.SetRotation(proc.LogRotation); err != nil {
+		return nil, err
+	}
+
+	w.SetParser(parser)
+	w.SetMultiline(multiline)
+	w.SetRedactor(redactor)
+	m.setLogSinks(w, proc)
+	return w, nil
+}
+
+// setLogSinks sets where the entries of the log of proc go besides its
+// file: the log store, log shipping, the system log and the log alert
+// rules. The caller must hold m.mutex.
+func (m *Manager) setLogSinks(w *logger.Writer, proc *types.Process) {
+	var sinks logger.Sinks
+	if store, err := m.LogStore(); err == nil {
+		setStoreOptions(store, proc)
+		sinks = append(sinks, store)
+	} else {
+		log.Printf("Log store unavailable, %s is not indexed: %v", proc.Name, err)
+	}
+	if m.shipper != nil {
+		sinks = append(sinks, m.shipper.Sink(proc.ID))
+	}
+	if out := logging.Output(proc, m.loggingConfig()); out != nil && m.systemLog != nil {
+		if sink, err := m.systemLog.Sink(out, proc); err == nil {
+			sinks = append(sinks, sink)
+		} else {
+			log.Printf("Log output of %s to %s disabled: %v", proc.Name, out.Type, err)
+		}
+	}
+	if sink := m.logAlertSink(proc); sink != nil {
+		sinks = append(sinks, sink)
+	}
+	w.SetSink(sinks)
+}
+
+// logRedactor returns the redaction rules of proc: those of the logging
+// configuration, then its own.
+func (m *Manager) logRedactor(proc *types.Process) (*logger.Redactor, error) {
+	var global *types.LogRedaction
+	if cfg := m.loggingConfig(); cfg != nil {
+		global = cfg.Redaction
+	}
+	return logger.NewRedactor(global, proc.LogRedaction)
+}
+
+// CloseLogs closes the log files and writes what is left to the log
+// store, the log shipping buffers and the system log. The processes must have been stopped.
+func (m *Manager) CloseLogs() {
+	m.mutex.Lock()
+	for id, w := range m.logWriters {
+		w.Close()
+		delete(m.logWriters, id)
+	}
+	m.mutex.Unlock()
+	if m.logStore != nil {
+		m.logStore.Close()
+	}
+	if m.shipper != nil {
+		m.shipper.Close()
+	}
+	if m.systemLog != nil {
+		m.systemLog.Close()
+	}
+}
+
+// LogStore returns the index of the captured logs, opening it on first
+// use.
+func (m *Manager) LogStore() (*logger.Store, error) {
+	m.logStoreOnce.Do(func() {
+		m.logStore, m.logStoreErr = logger.OpenStore(filepath.Join(m.logDir, "logs.db"))
+	})
+	return m.logStore, m.logStoreErr
+}
+
+// QueryLogs returns the last lines entries of the log of each process
+// that pass the filter, in time order; negative lines returns all of them.
+// Queries on the parsed level and fields are answered from the log store,
+// others, and those of logs written before it, by reading the files.
+func (m *Manager) QueryLogs(processes []types.Process, filter logger.Filter, lines int) ([]logger.Entry, error) {
+	query := &logger.Query{Filter: filter, Lines: lines}
+	for i := range processes {
+		query.Sources = append(query.Sources, m.LogSource(&processes[i]))
+	}
+
+	if filter.Level != "" || len(filter.Fields) > 0 {
+		if entries, err := m.storedLogs(query); err == nil && len(entries) > 0 {
+			return entries, nil
+		}
+	}
+	var entries []logger.Entry
+	err := query.Run(func(e logger.Entry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
+
+// storedLogs answers a query from the log store.
+func (m *Manager) storedLogs(query *logger.Query) ([]logger.Entry, error) {
+	store, err := m.LogStore()
+	if err != nil {
+		return nil, err
+	}
+	var entries []logger.Entry
+	for _, src := range query.Sources {
+		found, err := store.Query([]string{src.Process}, &query.Filter, query.Lines)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, found...)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, nil
+}
+
+// SearchLogs searches the logs of processes in the full-text index of the
+// log store; see logger.Store.Search.
+func (m *Manager) SearchLogs(processes []types.Process, text string, filter logger.Filter, limit, context int) ([]logger.Hit, error) {
+	store, err := m.LogStore()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(processes))
+	for i, proc := range processes {
+		if proc.LogSearch == nil {
+			return nil, fmt.Errorf("process %s is not indexed for search, start it with --log-search", proc.Name)
+		}
+		names[i] = proc.Name
+	}
+	return store.Search(names, text, &filter, limit, context)
+}
+
+// LogSource returns where the log of a process is, and how to parse it.
+func (m *Manager) LogSource(proc *types.Process) logger.Source {
+	path := proc.LogFile
+	if path == "" {
+		path = filepath.Join(m.logDir, proc.ID+".log")
+	}
+	// Start rejects invalid parsers.
+	parser, _ := logger.NewParser(proc.LogParser)
+	return logger.Source{Process: proc.Name, Path: path, Parser: parser}
+}
@@ -2,16 +2,22 @@ package process
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"gproc/internal/alerts"
 	"gproc/internal/cluster"
 	"gproc/internal/config"
+	"gproc/internal/logger"
+	"gproc/internal/logging"
 	"gproc/internal/metrics"
+	"gproc/internal/pty"
 	"gproc/internal/security"
 	"gproc/internal/tui"
 	"gproc/pkg/types"
@@ -27,6 +33,69 @@ type Manager struct {
 	clusterManager *cluster.ClusterManager
 	rbacManager    *security.RBACManager
 	tuiDashboard   *tui.TUIDashboard
+	runtimes       map[string]*procRuntime
+	sockets        map[string]*socketSet
+	lazy           map[string]*lazyService
+	events         map[string][]types.ProcessEvent
+	eventWatchers  map[chan types.ProcessEvent]string // SubscribeEvents, by watched ID or "" for all
+	reaper         *reaper
+	captureLogs    bool
+	logWriters     map[string]*logger.Writer
+	logStore       *logger.Store
+	logStoreErr    error
+	logStoreOnce   sync.Once
+	shipper        *logging.AggregationManager
+	systemLog      *logging.SystemLog
+	logAlertRules  []*logAlertRule
+	jobs           map[string]*jobRun
+	jobMutex       sync.Mutex
+	statsd         *statsdServer
+}
+
+// procRuntime holds the daemon-side state of one run of a process that is
+// not part of its persisted spec. A reload briefly has two runs of the same
+// process; only the current one, m.runtimes[id], updates the process.
+type procRuntime struct {
+	proc       *types.Process // guarded by m.mutex
+	cmd        *exec.Cmd
+	console    *Console
+	notify     *notifySocket
+	exited     chan struct{} // closed once the process has been waited for
+	ready      chan struct{} // closed on READY=1 from a notify process
+	readyOnce  sync.Once
+	pings      chan struct{}
+	superseded bool // replaced by a restart or reload, guarded by m.mutex
+	reloading  bool // a reload is starting its replacement, guarded by m.mutex
+	mainPID    atomic.Int64 // service PID of a forking process, from its PID file
+	exitCode   int          // set before exited is closed
+	exitDesc   string
+}
+
+func newProcRuntime(proc *types.Process) *procRuntime {
+	return &procRuntime{
+		proc:   proc,
+		exited: make(chan struct{}),
+		ready:  make(chan struct{}),
+		pings:  make(chan struct{}, 1),
+	}
+}
+
+// pid returns the PID of the service: the forked daemon of a forking
+// process once its PID file is read, otherwise the started command.
+func (rt *procRuntime) pid() int {
+	if pid := rt.mainPID.Load(); pid > 0 {
+		return int(pid)
+	}
+	return rt.cmd.Process.Pid
+}
+
+// signal sends sig to the service. A started command gets it together with
+// its process group, so helpers it spawned do not outlive it.
+func (rt *procRuntime) signal(sig os.Signal) error {
+	if pid := rt.mainPID.Load(); pid > 0 {
+		return signalProcess(int(pid), sig, false)
+	}
+	return signalProcess(rt.cmd.Process.Pid, sig, rt.cmd.SysProcAttr != nil && rt.console == nil)
 }
 
 // Get returns a process by ID (or nil if not found)
@@ -75,6 +144,14 @@ func NewManager(logDir string) *Manager {
 	
 	m := &Manager{
 		processes:      make(map[string]*types.Process),
+		runtimes:       make(map[string]*procRuntime),
+		sockets:        make(map[string]*socketSet),
+		lazy:           make(map[string]*lazyService),
+		events:         make(map[string][]types.ProcessEvent),
+		eventWatchers:  make(map[chan types.ProcessEvent]string),
+		reaper:         newReaper(),
+		logWriters:     make(map[string]*logger.Writer),
+		jobs:           make(map[string]*jobRun),
 		logDir:         logDir,
 		config:         cfg,
 		metricsStorage: metricsStorage,
@@ -90,7 +167,7 @@ func NewManager(logDir string) *Manager {
 func (m *Manager) loadProcesses() {
 	for i := range m.config.Processes {
 		proc := m.config.Processes[i]
-		if proc.Status == types.StatusRunning {
+		if proc.Status == types.StatusRunning || proc.Status == types.StatusIdle {
 			proc.Status = types.StatusStopped
 		}
 		m.processes[proc.ID] = &proc
@@ -113,44 +190,249 @@ func (m *Manager) Start(proc *types.Process) error {
 	if existing, exists := m.processes[proc.ID]; exists && existing.Status == types.StatusRunning {
 		return fmt.Errorf("process %s is already running", proc.ID)
 	}
+	if existing, exists := m.processes[proc.ID]; exists && existing.Status == types.StatusIdle {
+		return fmt.Errorf("process %s is already started and waiting for connections", proc.ID)
+	}
+	switch proc.Type {
+	case "", types.ProcessTypeSimple, types.ProcessTypeNotify:
+	case types.ProcessTypeForking:
+		if runtime.GOOS == "windows" {
+			return fmt.Errorf("forking processes are not supported on windows")
+		}
+		if proc.PIDFile == "" {
+			return fmt.Errorf("forking process %s needs a PID file", proc.ID)
+		}
+		if proc.TTY || proc.Lazy {
+			return fmt.Errorf("forking process %s cannot use tty or lazy mode", proc.ID)
+		}
+	default:
+		return fmt.Errorf("unknown process type %q", proc.Type)
+	}
+	if _, err := logger.NewParser(proc.LogParser); err != nil {
+		return err
+	}
+	if _, err := logger.NewMultiline(proc.LogMultiline); err != nil {
+		return err
+	}
+	if err := logging.CheckOutput(proc.LogOutput); err != nil {
+		return err
+	}
+	if _, err := m.logRedactor(proc); err != nil {
+		return err
+	}
+	if proc.MetricsEndpoint != "" {
+		if _, err := MetricsURL(proc); err != nil {
+			return err
+		}
+	}
+
+	if proc.Lazy {
+		// Started by the first connection on one of its sockets.
+		if err := m.startLazy(proc); err != nil {
+			return err
+		}
+	} else if err := m.spawn(proc); err != nil {
+		return err
+	}
+
+	m.processes[proc.ID] = proc
+	m.saveConfig()
+	return nil
+}
+
+// buildEnv returns the daemon environment extended with extra, or nil (the
+// daemon environment as is) when there is nothing to add.
+func buildEnv(extra map[string]string) []string {
+	if len(extra) == 0 {
+		return nil
+	}
+	env := os.Environ()
+	for k, v := range extra {
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
+// spawn launches the command of proc, wires up its output and starts
+// supervising it. The caller must hold m.mutex.
+func (m *Manager) spawn(proc *types.Process) error {
+	rt, err := m.launch(proc)
+	if err != nil {
+		return err
+	}
+	m.activate(rt)
+	m.recordEvent(proc.ID, types.EventStarted, proc.PID, nil, "started %s", proc.Command)
+	return nil
+}
+
+// activate makes rt the current run of its process. The caller must hold
+// m.mutex.
+func (m *Manager) activate(rt *procRuntime) {
+	if old := m.runtimes[rt.proc.ID]; old != nil && old != rt {
+		old.superseded = true
+	}
+	m.runtimes[rt.proc.ID] = rt
+}
 
+// launch starts a new run of proc and records it in proc (Cmd, PID,
+// status). The run is only watched until it is activated. The caller must
+// hold m.mutex.
+func (m *Manager) launch(proc *types.Process) (*procRuntime, error) {
 	cmd := exec.Command(proc.Command, proc.Args...)
 	if proc.WorkingDir != "" {
 		cmd.Dir = proc.WorkingDir
 	}
-	
-	// Set environment variables
-	if len(proc.Env) > 0 {
-		env := os.Environ()
-		for k, v := range proc.Env {
-			env = append(env, k+"="+v)
+	cmd.Env = buildEnv(proc.Env)
+
+	if lz := m.lazy[proc.ID]; lz != nil {
+		passSockets(cmd, lz.backend)
+	} else if len(proc.Sockets) > 0 {
+		set, err := m.processSockets(proc)
+		if err != nil {
+			return nil, err
+		}
+		passSockets(cmd, set)
+	}
+
+	rt := newProcRuntime(proc)
+	rt.cmd = cmd
+	if proc.Type == types.ProcessTypeNotify {
+		ns, err := listenNotify(proc.ID)
+		if err != nil {
+			return nil, err
+		}
+		rt.notify = ns
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(cmd.Env, "NOTIFY_SOCKET="+ns.path)
+		if proc.Watchdog > 0 {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("WATCHDOG_USEC=%d", proc.Watchdog.Microseconds()))
 		}
-		cmd.Env = env
 	}
 
-	logFile := filepath.Join(m.logDir, proc.ID+".log")
-	file, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if proc.LogFile == "" {
+		proc.LogFile = filepath.Join(m.logDir, proc.ID+".log")
+	}
+	// The daemon writes the output as timestamped entries; a process
+	// started without it writes straight to the file, as it outlives the
+	// command that started it.
+	var logs *logger.Writer
+	var file *os.File
+	var err error
+	if m.captureLogs {
+		logs, err = m.logWriter(proc)
+	} else {
+		file, err = os.OpenFile(proc.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	}
 	if err != nil {
-		return err
+		rt.close()
+		return nil, err
 	}
 
-	cmd.Stdout = file
-	cmd.Stderr = file
-	proc.LogFile = logFile
+	var slave *os.File
+	var pipes []*os.File
+	if proc.TTY {
+		var master *os.File
+		master, slave, err = pty.Open()
+		if err != nil {
+			if file != nil {
+				file.Close()
+			}
+			rt.close()
+			return nil, fmt.Errorf("allocate pty for %s: %v", proc.ID, err)
+		}
+		cmd.Stdin = slave
+		cmd.Stdout = slave
+		cmd.Stderr = slave
+		cmd.SysProcAttr = pty.SysProcAttr()
+		rt.console = newConsole(master)
+	} else if logs != nil {
+		for _, stream := range []string{logger.StreamStdout, logger.StreamStderr} {
+			pipe, err := logs.Pipe(stream)
+			if err != nil {
+				for _, p := range pipes {
+					p.Close()
+				}
+				rt.close()
+				return nil, err
+			}
+			pipes = append(pipes, pipe)
+		}
+		cmd.Stdout = pipes[0]
+		cmd.Stderr = pipes[1]
+		cmd.SysProcAttr = groupAttr()
+	} else {
+		cmd.Stdout = file
+		cmd.Stderr = file
+		cmd.SysProcAttr = groupAttr()
+	}
 	proc.Cmd = cmd
+	if proc.Type == types.ProcessTypeForking {
+		// A stale PID file would name the previous run.
+		os.Remove(pidFilePath(proc))
+	}
 
-	if err := cmd.Start(); err != nil {
-		return err
+	err = cmd.Start()
+	// The child holds its own copies of the pipes and the pty slave; the
+	// log and the console see EOF once the last holder exits.
+	for _, p := range pipes {
+		p.Close()
+	}
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		if slave != nil {
+			slave.Close()
+		}
+		rt.close()
+		return nil, err
+	}
+	m.trackChild(cmd.Process.Pid)
+
+	if rt.console != nil {
+		slave.Close()
+		var out io.WriteCloser = file
+		if logs != nil {
+			out = logs.Stream(logger.StreamStdout)
+		}
+		go func() {
+			rt.console.pump(out)
+			out.Close()
+		}()
+	} else if file != nil {
+		file.Close()
 	}
 
 	proc.PID = cmd.Process.Pid
 	proc.Status = types.StatusRunning
 	proc.StartTime = time.Now()
-	m.processes[proc.ID] = proc
-	m.saveConfig()
+	proc.StatusText = ""
+	proc.Readiness = ""
 
-	go m.monitor(proc)
-	return nil
+	if proc.Type == types.ProcessTypeForking {
+		// Ready once the service it forks writes its PID file.
+		proc.Readiness = types.ReadinessStarting
+	}
+	if rt.notify != nil {
+		proc.Readiness = types.ReadinessStarting
+		go m.serveNotify(rt)
+		go m.superviseNotify(rt)
+	}
+	go m.monitor(rt)
+	return rt, nil
+}
+
+// close releases what spawn set up for a process that did not start or
+// has exited.
+func (rt *procRuntime) close() {
+	if rt.notify != nil {
+		rt.notify.Close()
+	}
+	if rt.console != nil {
+		rt.console.Close()
+	}
 }
 
 func (m *Manager) Stop(id string) error {
@@ -162,35 +444,36 @@ func (m *Manager) Stop(id string) error {
 		return fmt.Errorf("process %s not found", id)
 	}
 
-	if proc.Status != types.StatusRunning {
-		return fmt.Errorf("process %s is not running", id)
+	if lz := m.lazy[id]; lz != nil {
+		lz.Close()
+		delete(m.lazy, id)
+		if proc.Status != types.StatusRunning {
+			proc.Status = types.StatusStopped
+			proc.StatusText = ""
+			m.saveConfig()
+			return nil
+		}
 	}
 
-	// Graceful shutdown: try SIGTERM first, then SIGKILL
-	if err := proc.Cmd.Process.Signal(os.Interrupt); err == nil {
-		// Wait 5 seconds for graceful shutdown
-		done := make(chan error, 1)
-		go func() {
-			done <- proc.Cmd.Wait()
-		}()
-		
-		select {
-		case <-time.After(5 * time.Second):
-			// Force kill if not stopped gracefully
-			if err := proc.Cmd.Process.Kill(); err != nil {
-				return err
-			}
-		case <-done:
-			// Process stopped gracefully
-		}
-	} else {
-		// Fallback to kill
-		if err := proc.Cmd.Process.Kill(); err != nil {
-			return err
-		}
+	rt := m.runtimes[id]
+	if proc.Status != types.StatusRunning || rt == nil {
+		return fmt.Errorf("process %s is not running", id)
 	}
 
+	// Graceful shutdown: interrupt first, kill after stopTimeout. Other
+	// processes can be managed meanwhile.
 	proc.Status = types.StatusStopped
+	m.mutex.Unlock()
+	stopRun(rt)
+	m.stopOrphans(id)
+	m.mutex.Lock()
+
+	m.recordEvent(id, types.EventStopped, rt.pid(), nil, "stopped on request")
+
+	// A start while this one was stopping owns the sockets now.
+	if m.runtimes[id] == rt {
+		m.releaseSockets(id)
+	}
 	m.saveConfig()
 	return nil
 }
@@ -206,6 +489,19 @@ func (m *Manager) List() []*types.Process {
 	return processes
 }
 
+// Processes returns a copy of every process, safe to use while the
+// processes keep changing.
+func (m *Manager) Processes() []types.Process {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	processes := make([]types.Process, 0, len(m.processes))
+	for _, proc := range m.processes {
+		processes = append(processes, *proc)
+	}
+	return processes
+}
+
 func (m *Manager) Restart(id string) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -216,49 +512,55 @@ func (m *Manager) Restart(id string) error {
 	}
 
 	if proc.Status == types.StatusRunning {
-		if err := proc.Cmd.Process.Kill(); err != nil {
-			return err
-		}
-		time.Sleep(1 * time.Second)
-	}
-
-	cmd := exec.Command(proc.Command, proc.Args...)
-	if proc.WorkingDir != "" {
-		cmd.Dir = proc.WorkingDir
-	}
-	
-	// Set environment variables
-	if len(proc.Env) > 0 {
-		env := os.Environ()
-		for k, v := range proc.Env {
-			env = append(env, k+"="+v)
+		if rt := m.runtimes[id]; rt != nil {
+			if err := rt.signal(os.Kill); err != nil {
+				return err
+			}
+			// The run is replaced; let its monitor finish without the lock.
+			rt.superseded = true
+			m.mutex.Unlock()
+			<-rt.exited
+			m.mutex.Lock()
+		} else {
+			if err := proc.Cmd.Process.Kill(); err != nil {
+				return err
+			}
+			time.Sleep(1 * time.Second)
 		}
-		cmd.Env = env
-	}
-
-	file, err := os.OpenFile(proc.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		return err
+		m.stopOrphans(id)
 	}
 
-	cmd.Stdout = file
-	cmd.Stderr = file
-	proc.Cmd = cmd
-
-	if err := cmd.Start(); err != nil {
+	m.recordEvent(id, types.EventRestarted, proc.PID, nil, "restarted on request")
+	if err := m.spawn(proc); err != nil {
+		proc.Status = types.StatusFailed
 		return err
 	}
 
-	proc.PID = cmd.Process.Pid
-	proc.Status = types.StatusRunning
-	proc.StartTime = time.Now()
 	proc.Restarts++
 	m.saveConfig()
-
-	go m.monitor(proc)
 	return nil
 }
 
+// Console returns the terminal of a running process started with tty mode.
+func (m *Manager) Console(id string) (*Console, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	proc, exists := m.processes[id]
+	if !exists {
+		return nil, fmt.Errorf("process %s not found", id)
+	}
+	if !proc.TTY {
+		return nil, fmt.Errorf("process %s was not started with a tty", id)
+	}
+
+	rt := m.runtimes[id]
+	if proc.Status != types.StatusRunning || rt == nil || rt.console == nil {
+		return nil, fmt.Errorf("process %s is not running", id)
+	}
+	return rt.console, nil
+}
+
 func (m *Manager) StartByName(name string) error {
 	m.mutex.RLock()
 	proc, exists := m.processes[name]
@@ -271,15 +573,61 @@ func (m *Manager) StartByName(name string) error {
 	return m.Start(proc)
 }
 
+// AddScheduledTask persists task, replacing a task with the same name.
 func (m *Manager) AddScheduledTask(task *types.ScheduledTask) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	
+	for i := range m.config.ScheduledTasks {
+		if m.config.ScheduledTasks[i].Name == task.Name {
+			m.config.ScheduledTasks[i] = *task
+			m.saveConfig()
+			return nil
+		}
+	}
 	m.config.ScheduledTasks = append(m.config.ScheduledTasks, *task)
 	m.saveConfig()
 	return nil
 }
 
+// RemoveScheduledTask deletes the named task from the configuration.
+func (m *Manager) RemoveScheduledTask(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for i := range m.config.ScheduledTasks {
+		if m.config.ScheduledTasks[i].Name == name {
+			m.config.ScheduledTasks = append(m.config.ScheduledTasks[:i], m.config.ScheduledTasks[i+1:]...)
+			m.saveConfig()
+			return nil
+		}
+	}
+	return fmt.Errorf("scheduled task %s not found", name)
+}
+
+// ScheduledTasks returns a copy of the persisted scheduled tasks.
+func (m *Manager) ScheduledTasks() []types.ScheduledTask {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return append([]types.ScheduledTask(nil), m.config.ScheduledTasks...)
+}
+
+// GRPCConfig returns a copy of the gRPC API configuration. The gRPC API is
+// off unless api.grpc is enabled, and listens on port 9090 by default.
+func (m *Manager) GRPCConfig() *types.GRPCConfig {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if m.config.API == nil || m.config.API.GRPC == nil {
+		return &types.GRPCConfig{}
+	}
+	cfg := *m.config.API.GRPC
+	if cfg.Port == 0 {
+		cfg.Port = 9090
+	}
+	return &cfg
+}
+
 func (m *Manager) StartWebDashboard(port int) error {
 	dashboard := &webDashboard{manager: m}
 	return dashboard.Start(port)
@@ -338,11 +686,6 @@ func (m *Manager) StartFromConfig(configFile string) error {
 }
 
 // Phase 1: Advanced Process Management
-func (m *Manager) ZeroDowntimeReload(processID string) error {
-	fmt.Printf("Performing zero-downtime reload for %s\n", processID)
-	return nil
-}
-
 func (m *Manager) ConfigWizard() error {
 	fmt.Println("Starting GProc configuration wizard...")
 	return nil
@@ -387,16 +730,6 @@ func (m *Manager) BlueGreenStatus(processName string) (string, error) {
 }
 
 // Phase 2: Monitoring & Observability
-func (m *Manager) ShowAllMetrics() error {
-	fmt.Println("Displaying metrics for all processes...")
-	return nil
-}
-
-func (m *Manager) ShowProcessMetrics(processName string) error {
-	fmt.Printf("Displaying metrics for %s...\n", processName)
-	return nil
-}
-
 func (m *Manager) ShowMetricsHistory(processName string) error {
 	fmt.Printf("Displaying metrics history for %s...\n", processName)
 	return nil
@@ -720,20 +1053,44 @@ type Hook struct {
 	Script string
 }
 
-func (m *Manager) monitor(proc *types.Process) {
-	proc.Cmd.Wait()
+func (m *Manager) monitor(rt *procRuntime) {
+	rt.cmd.Wait()
+	m.untrackChild(rt.cmd.Process.Pid)
+	rt.exitCode = rt.cmd.ProcessState.ExitCode()
+	rt.exitDesc = rt.cmd.ProcessState.String()
+	if rt.proc.Type == types.ProcessTypeForking && rt.exitCode == 0 {
+		m.waitForked(rt)
+	}
+	close(rt.exited)
+	if rt.notify != nil {
+		rt.notify.Close()
+	}
 	
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	if proc.Status == types.StatusStopped {
+	// Runs replaced by a restart, and reload candidates that did not take
+	// over, leave the process alone.
+	proc := rt.proc
+	if rt.superseded || m.runtimes[proc.ID] != rt {
+		return
+	}
+	exitCode := rt.exitCode
+	m.recordEvent(proc.ID, types.EventExited, rt.pid(), &exitCode, "%s", rt.exitDesc)
+	if proc.Status == types.StatusStopped || proc.Status == types.StatusIdle {
 		return
 	}
 
 	proc.Status = types.StatusFailed
+	if m.lazy[proc.ID] != nil {
+		// The next connection starts it again.
+		return
+	}
 	
 	if proc.AutoRestart && proc.Restarts < proc.MaxRestarts {
 		proc.Restarts++
+		m.recordEvent(proc.ID, types.EventRestarted, rt.pid(), &exitCode,
+			"restarting after failure (%d/%d)", proc.Restarts, proc.MaxRestarts)
 		go func() {
 			time.Sleep(2 * time.Second)
 			m.Start(proc)
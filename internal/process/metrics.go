@@ -0,0 +1,191 @@
+package process
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gproc/internal/metrics"
+	"gproc/internal/monitor"
+	"gproc/pkg/types"
+)
+
+// ProcessSample is what the daemon measured of a process at one time. The
+// resources add up the process, its descendants and its adopted orphans.
+type ProcessSample struct {
+	ID         string              `json:"id"`
+	Name       string              `json:"name"`
+	Group      string              `json:"group,omitempty"`
+	Status     types.ProcessStatus `json:"status"`
+	Health     string              `json:"health"` // healthy, unhealthy or unknown
+	PID        int                 `json:"pid,omitempty"`
+	Restarts   int                 `json:"restarts"`
+	Uptime     time.Duration       `json:"uptime"`
+	CPUPercent float64             `json:"cpu_percent"`
+	RSSBytes   uint64              `json:"rss_bytes"`
+	Threads    int                 `json:"threads"`
+	FDs        int                 `json:"fds"`
+	// LogRedactions counts the secrets redacted from the output by rule.
+	LogRedactions map[string]int64 `json:"log_redactions,omitempty"`
+	// MetricsURL is where the running process serves its own metrics.
+	MetricsURL string `json:"metrics_url,omitempty"`
+	// AppMetrics are what the process sent over StatsD.
+	AppMetrics []types.AppMetric `json:"app_metrics,omitempty"`
+}
+
+// MetricsURL resolves the metrics endpoint of proc to a URL.
+func MetricsURL(proc *types.Process) (string, error) {
+	endpoint := os.Expand(proc.MetricsEndpoint, func(name string) string {
+		if value, ok := proc.Env[name]; ok {
+			return value
+		}
+		return os.Getenv(name)
+	})
+	if !strings.Contains(endpoint, "://") {
+		if strings.HasPrefix(endpoint, ":") {
+			endpoint = "127.0.0.1" + endpoint
+		}
+		endpoint = "http://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid metrics endpoint %q: %v", proc.MetricsEndpoint, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid metrics endpoint %q, expected a URL or [host]:port[/path]", proc.MetricsEndpoint)
+	}
+	if u.Path == "" {
+		u.Path = "/metrics"
+	}
+	return u.String(), nil
+}
+
+// MetricsConfig returns the metrics configuration. Without one, metrics
+// are collected and served by the API server only.
+func (m *Manager) MetricsConfig() *types.MetricsConfig {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if m.config.Observability == nil || m.config.Observability.Metrics == nil {
+		return &types.MetricsConfig{Enabled: true}
+	}
+	cfg := *m.config.Observability.Metrics
+	return &cfg
+}
+
+// StartMetricsCompaction keeps the metrics history rolled up and within
+// the retention of the metrics configuration.
+func (m *Manager) StartMetricsCompaction() {
+	if m.metricsStorage == nil {
+		return
+	}
+	m.metricsStorage.SetRetention(m.MetricsConfig().Retention)
+	m.metricsStorage.StartCompaction()
+}
+
+// MetricsHistory returns the recorded metrics of a process from from until
+// to, at the resolution the history picks for the range.
+func (m *Manager) MetricsHistory(id string, from, to time.Time) ([]types.MetricPoint, metrics.Resolution, error) {
+	if m.metricsStorage == nil {
+		return nil, metrics.Raw, fmt.Errorf("metrics history is not available")
+	}
+	return m.metricsStorage.QueryMetrics(id, from, to)
+}
+
+// CollectMetrics measures every process, records the measurements of the
+// running ones in the metrics history and returns them all.
+func (m *Manager) CollectMetrics() []ProcessSample {
+	samples := m.Measure()
+	if m.metricsStorage != nil {
+		for _, sample := range samples {
+			if sample.Status != types.StatusRunning {
+				continue
+			}
+			err := m.metricsStorage.StoreMetrics(sample.ID, &types.ProcessMetrics{
+				CPUUsage:    sample.CPUPercent,
+				MemoryUsage: int64(sample.RSSBytes),
+				Uptime:      sample.Uptime,
+				Restarts:    sample.Restarts,
+			})
+			if err != nil {
+				log.Printf("Recording metrics of %s: %v", sample.ID, err)
+			}
+		}
+	}
+	return samples
+}
+
+// Measure measures every process, with the CPU usage of all of them
+// sampled over the same short interval.
+func (m *Manager) Measure() []ProcessSample {
+	m.mutex.RLock()
+	samples := make([]ProcessSample, 0, len(m.processes))
+	procs := make([]types.Process, 0, len(m.processes))
+	for id, proc := range m.processes {
+		sample := ProcessSample{
+			ID:       proc.ID,
+			Name:     proc.Name,
+			Group:    proc.Group,
+			Status:   proc.Status,
+			Restarts: proc.Restarts,
+		}
+		if proc.Status == types.StatusRunning {
+			sample.PID = proc.PID
+			sample.Uptime = time.Since(proc.StartTime)
+			if proc.MetricsEndpoint != "" {
+				// Start rejects invalid endpoints.
+				sample.MetricsURL, _ = MetricsURL(proc)
+			}
+		}
+		if w := m.logWriters[id]; w != nil {
+			sample.LogRedactions = w.Redactions()
+		}
+		sample.AppMetrics = m.appMetrics(id)
+		samples = append(samples, sample)
+		procs = append(procs, *proc)
+	}
+	m.mutex.RUnlock()
+
+	// One sweep of /proc for every tree, so that CPU is sampled once.
+	var pids []int
+	owners := make(map[int]int) // root PID to sample
+	for i := range samples {
+		if samples[i].PID <= 0 {
+			continue
+		}
+		for _, pid := range append([]int{samples[i].PID}, m.Orphans(samples[i].ID)...) {
+			pids = append(pids, pid)
+			owners[pid] = i
+		}
+	}
+	if len(pids) > 0 {
+		trees, err := monitor.GetProcessTrees(pids)
+		if err != nil {
+			log.Printf("Measuring processes: %v", err)
+		}
+		for _, tree := range trees {
+			sample := &samples[owners[tree.PID]]
+			tree.Walk(func(p *monitor.ProcessInfo, depth int) {
+				sample.CPUPercent += p.CPUPercent
+				sample.RSSBytes += p.RSSBytes
+				sample.Threads += p.Threads
+				sample.FDs += p.FDs
+			})
+		}
+	}
+
+	// Health checks may wait on slow services; probe them side by side.
+	var wg sync.WaitGroup
+	for i := range samples {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			samples[i].Health = checkHealth(&procs[i]).Status
+		}(i)
+	}
+	wg.Wait()
+	return samples
+}
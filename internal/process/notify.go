@@ -0,0 +1,207 @@
+package process
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"gproc/pkg/types"
+)
+
+// defaultReadyTimeout is how long a notify process may take to send
+// READY=1 when it does not set ReadyTimeout.
+const defaultReadyTimeout = 90 * time.Second
+
+// notifySocket is the datagram socket a notify process reports its state
+// on. Every process gets its own socket, so any process in its tree may
+// send notifications on its behalf.
+type notifySocket struct {
+	conn *net.UnixConn
+	path string
+}
+
+// notifyDir holds the notify sockets of this daemon.
+func notifyDir() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("gproc-%d", os.Getpid()))
+}
+
+// notifySeq tells apart the sockets of overlapping runs of a process.
+var notifySeq uint64
+
+func listenNotify(id string) (*notifySocket, error) {
+	dir := notifyDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s.%d.notify", id, atomic.AddUint64(&notifySeq, 1)))
+	os.Remove(path)
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("create notify socket for %s: %v", id, err)
+	}
+	return &notifySocket{conn: conn, path: path}, nil
+}
+
+func (n *notifySocket) Close() error {
+	err := n.conn.Close()
+	os.Remove(n.path)
+	// Removes the directory once the last socket is gone.
+	os.Remove(filepath.Dir(n.path))
+	return err
+}
+
+// parseNotify splits a notification datagram into its KEY=VALUE
+// assignments.
+func parseNotify(msg []byte) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(string(msg), "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok && key != "" {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// serveNotify applies the notifications sent by proc until its socket is
+// closed when the process exits.
+func (m *Manager) serveNotify(rt *procRuntime) {
+	buf := make([]byte, 4096)
+	for {
+		n, _, err := rt.notify.conn.ReadFromUnix(buf)
+		if err != nil {
+			return
+		}
+		m.applyNotify(rt, parseNotify(buf[:n]))
+	}
+}
+
+func (m *Manager) applyNotify(rt *procRuntime, fields map[string]string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// Ignore stragglers from a previous run of the process.
+	if rt.superseded {
+		return
+	}
+	proc := rt.proc
+
+	if text, ok := fields["STATUS"]; ok {
+		proc.StatusText = text
+	}
+	if usec, ok := fields["WATCHDOG_USEC"]; ok {
+		if n, err := strconv.ParseInt(usec, 10, 64); err == nil && n > 0 {
+			proc.Watchdog = time.Duration(n) * time.Microsecond
+			rt.ping()
+		}
+	}
+	if fields["RELOADING"] == "1" {
+		proc.Readiness = types.ReadinessReloading
+	}
+	if fields["STOPPING"] == "1" {
+		proc.Readiness = types.ReadinessStopping
+	}
+	if fields["READY"] == "1" {
+		proc.Readiness = types.ReadinessReady
+		rt.readyOnce.Do(func() { close(rt.ready) })
+	}
+	switch fields["WATCHDOG"] {
+	case "1":
+		rt.ping()
+	case "trigger":
+		go m.watchdogFailure(rt, "watchdog triggered by the process")
+	}
+}
+
+// ping records a watchdog keep-alive.
+func (rt *procRuntime) ping() {
+	select {
+	case rt.pings <- struct{}{}:
+	default:
+	}
+}
+
+// superviseNotify fails the process when it does not become ready within
+// its ready timeout or, once ready, misses a watchdog ping.
+func (m *Manager) superviseNotify(rt *procRuntime) {
+	m.mutex.RLock()
+	readyTimeout := rt.proc.ReadyTimeout
+	m.mutex.RUnlock()
+	if readyTimeout <= 0 {
+		readyTimeout = defaultReadyTimeout
+	}
+
+	select {
+	case <-rt.ready:
+	case <-rt.exited:
+		return
+	case <-time.After(readyTimeout):
+		m.watchdogFailure(rt, fmt.Sprintf("not ready after %s", readyTimeout))
+		return
+	}
+
+	for {
+		m.mutex.RLock()
+		interval := rt.proc.Watchdog
+		m.mutex.RUnlock()
+
+		// Without a watchdog interval only wait for pings that may set one.
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if interval > 0 {
+			timer = time.NewTimer(interval)
+			expired = timer.C
+		}
+
+		select {
+		case <-rt.pings:
+		case <-rt.exited:
+		case <-expired:
+			m.watchdogFailure(rt, fmt.Sprintf("watchdog timeout, no ping for %s", interval))
+			return
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+
+		select {
+		case <-rt.exited:
+			return
+		default:
+		}
+	}
+}
+
+// watchdogFailure aborts a process that failed its readiness or watchdog
+// contract. The monitor then handles it like any other crash.
+func (m *Manager) watchdogFailure(rt *procRuntime, reason string) {
+	m.mutex.Lock()
+	proc := rt.proc
+	if rt.superseded || proc.Status != types.StatusRunning {
+		m.mutex.Unlock()
+		return
+	}
+	proc.StatusText = reason
+	id := proc.ID
+	m.recordEvent(id, types.EventWatchdog, proc.PID, nil, "%s", reason)
+	m.mutex.Unlock()
+
+	log.Printf("Process %s failed: %s", id, reason)
+	m.alertManager.TriggerAlert(id, "watchdog", reason, "critical")
+
+	if err := rt.signal(syscall.SIGABRT); err != nil {
+		rt.signal(os.Kill)
+	}
+	select {
+	case <-rt.exited:
+	case <-time.After(5 * time.Second):
+		rt.signal(os.Kill)
+	}
+}
@@ -0,0 +1,53 @@
+//go:build !windows
+
+package process
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// groupAttr puts a process in a process group of its own, so signals sent
+// to the group also reach the helpers it spawns.
+func groupAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalProcess sends sig to pid and, with group, to the process group it
+// leads.
+func signalProcess(pid int, sig os.Signal, group bool) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		s = syscall.SIGINT
+	}
+	if group {
+		if err := syscall.Kill(-pid, s); err == nil {
+			return nil
+		}
+	}
+	return syscall.Kill(pid, s)
+}
+
+// processAlive reports whether pid exists.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// setCredential makes cmd run as uid and gid when they are not ours, which
+// only root may do.
+func setCredential(cmd *exec.Cmd, uid, gid int) error {
+	if uid == os.Getuid() && gid == os.Getgid() {
+		return nil
+	}
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("running as uid %d, gid %d needs root", uid, gid)
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	return nil
+}
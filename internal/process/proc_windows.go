@@ -0,0 +1,35 @@
+package process
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// groupAttr is a no-op on Windows, which has no process groups to signal.
+func groupAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+func signalProcess(pid int, sig os.Signal, group bool) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Signal(sig)
+}
+
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
+
+// setCredential cannot switch users on Windows; every process runs as the
+// daemon user there.
+func setCredential(cmd *exec.Cmd, uid, gid int) error {
+	return nil
+}
@@ -0,0 +1,204 @@
+package process
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"gproc/internal/monitor"
+	"gproc/pkg/types"
+)
+
+// reapInterval is how often the daemon looks for orphans when no SIGCHLD
+// arrives.
+const reapInterval = 5 * time.Second
+
+// reaper keeps track of the processes that end up as children of the
+// daemon once it is a child subreaper: its own children, which os/exec
+// waits for, and the orphaned descendants of managed processes, which it
+// reaps itself.
+type reaper struct {
+	mutex    sync.Mutex
+	children map[int]bool            // started and waited for by GProc
+	owners   map[int]string          // descendants seen under a managed process
+	orphans  map[string]map[int]bool // adopted descendants per process
+	zombies  map[int]bool            // unattributed zombies seen in the last scan
+}
+
+func newReaper() *reaper {
+	return &reaper{
+		children: make(map[int]bool),
+		owners:   make(map[int]string),
+		orphans:  make(map[string]map[int]bool),
+		zombies:  make(map[int]bool),
+	}
+}
+
+// trackChild marks pid as waited for by GProc so the reaper leaves it
+// alone.
+func (m *Manager) trackChild(pid int) {
+	m.reaper.mutex.Lock()
+	m.reaper.children[pid] = true
+	m.reaper.mutex.Unlock()
+}
+
+func (m *Manager) untrackChild(pid int) {
+	m.reaper.mutex.Lock()
+	delete(m.reaper.children, pid)
+	m.reaper.mutex.Unlock()
+}
+
+// Orphans returns the PIDs of the adopted orphans of a process.
+func (m *Manager) Orphans(id string) []int {
+	m.reaper.mutex.Lock()
+	defer m.reaper.mutex.Unlock()
+
+	var pids []int
+	for pid := range m.reaper.orphans[id] {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+	return pids
+}
+
+// orphanEvent is an event found by a scan, recorded once the reaper lock
+// is released.
+type orphanEvent struct {
+	id      string
+	pid     int
+	message string
+}
+
+// reapOrphans attributes the descendants of managed processes to them,
+// records descendants the daemon adopted and reaps those that exited.
+func (m *Manager) reapOrphans() {
+	processes, err := monitor.ListProcesses()
+	if err != nil {
+		return
+	}
+	self := os.Getpid()
+
+	m.mutex.RLock()
+	roots := make(map[int]string)
+	for id, rt := range m.runtimes {
+		roots[rt.cmd.Process.Pid] = id
+		roots[rt.pid()] = id
+	}
+	m.mutex.RUnlock()
+
+	children := make(map[int][]*monitor.ProcessInfo)
+	alive := make(map[int]bool)
+	for _, p := range processes {
+		children[p.PPID] = append(children[p.PPID], p)
+		alive[p.PID] = true
+	}
+
+	r := m.reaper
+	r.mutex.Lock()
+	for pid := range r.owners {
+		if !alive[pid] {
+			delete(r.owners, pid)
+		}
+	}
+	for root, id := range roots {
+		queue := children[root]
+		for len(queue) > 0 {
+			p := queue[0]
+			queue = queue[1:]
+			r.owners[p.PID] = id
+			queue = append(queue, children[p.PID]...)
+		}
+	}
+	// Descendants that were orphaned before a scan saw them still carry
+	// the process group or session of the process they came from.
+	for _, p := range processes {
+		if id, ok := roots[p.PGID]; ok && p.PID != p.PGID {
+			r.owners[p.PID] = id
+		} else if id, ok := roots[p.SID]; ok && p.PID != p.SID {
+			r.owners[p.PID] = id
+		}
+	}
+
+	var events []orphanEvent
+	zombies := make(map[int]bool)
+	adopted := make(map[int]bool)
+	for _, p := range children[self] {
+		if r.children[p.PID] || roots[p.PID] != "" {
+			continue
+		}
+		id := r.owners[p.PID]
+		if p.State != "Z" {
+			adopted[p.PID] = true
+			if id != "" && !r.orphans[id][p.PID] {
+				if r.orphans[id] == nil {
+					r.orphans[id] = make(map[int]bool)
+				}
+				r.orphans[id][p.PID] = true
+				events = append(events, orphanEvent{id, p.PID, fmt.Sprintf("adopted orphaned PID %d (%s)", p.PID, p.Command)})
+			}
+			continue
+		}
+
+		// A zombie nobody claims may be a child os/exec is about to wait
+		// for; only reap it once it is still there on the next scan.
+		if id == "" && !r.zombies[p.PID] {
+			zombies[p.PID] = true
+			continue
+		}
+		status, ok := reapPID(p.PID)
+		if !ok {
+			continue
+		}
+		if id == "" {
+			log.Printf("Reaped orphaned PID %d (%s): %s", p.PID, p.Command, status)
+			continue
+		}
+		delete(r.orphans[id], p.PID)
+		events = append(events, orphanEvent{id, p.PID, fmt.Sprintf("reaped orphaned PID %d (%s): %s", p.PID, p.Command, status)})
+	}
+	r.zombies = zombies
+	for id, pids := range r.orphans {
+		for pid := range pids {
+			if !adopted[pid] {
+				delete(pids, pid)
+			}
+		}
+		if len(pids) == 0 {
+			delete(r.orphans, id)
+		}
+	}
+	r.mutex.Unlock()
+
+	if len(events) == 0 {
+		return
+	}
+	m.mutex.Lock()
+	for _, event := range events {
+		m.recordEvent(event.id, types.EventOrphan, event.pid, nil, "%s", event.message)
+	}
+	m.mutex.Unlock()
+}
+
+// stopOrphans terminates the adopted orphans of a process, killing those
+// still there after stopTimeout.
+func (m *Manager) stopOrphans(id string) {
+	pids := m.Orphans(id)
+	if len(pids) == 0 {
+		return
+	}
+	for _, pid := range pids {
+		signalProcess(pid, syscall.SIGTERM, false)
+	}
+	go func() {
+		time.Sleep(stopTimeout)
+		for _, pid := range pids {
+			if processAlive(pid) {
+				signalProcess(pid, os.Kill, false)
+			}
+		}
+	}()
+}
@@ -0,0 +1,78 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// StartReaper makes the daemon a child subreaper, so descendants orphaned
+// by managed processes are re-parented to it instead of init, and starts
+// attributing and reaping them.
+func (m *Manager) StartReaper() error {
+	if err := unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("become child subreaper: %v", err)
+	}
+
+	sigchld := make(chan os.Signal, 1)
+	signal.Notify(sigchld, syscall.SIGCHLD)
+	go func() {
+		ticker := time.NewTicker(reapInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-sigchld:
+			case <-ticker.C:
+			}
+			m.reapOrphans()
+		}
+	}()
+	return nil
+}
+
+// reapPID collects the exit status of an exited child that os/exec does
+// not wait for.
+func reapPID(pid int) (string, bool) {
+	var ws unix.WaitStatus
+	got, err := unix.Wait4(pid, &ws, unix.WNOHANG, nil)
+	if err != nil || got != pid {
+		return "", false
+	}
+	return waitStatusString(ws), true
+}
+
+// waitPID waits for a process that is not a child started by os/exec, the
+// service of a forking process. It is a child of the daemon when the
+// daemon is a subreaper; otherwise its exit status is unknown.
+func waitPID(pid int) (int, string) {
+	for {
+		var ws unix.WaitStatus
+		_, err := unix.Wait4(pid, &ws, 0, nil)
+		if err == unix.EINTR {
+			continue
+		}
+		if err == nil {
+			code := ws.ExitStatus()
+			if ws.Signaled() {
+				code = 128 + int(ws.Signal())
+			}
+			return code, waitStatusString(ws)
+		}
+		break
+	}
+	for processAlive(pid) {
+		time.Sleep(time.Second)
+	}
+	return -1, "exited, status unknown"
+}
+
+func waitStatusString(ws unix.WaitStatus) string {
+	if ws.Signaled() {
+		return "signal: " + ws.Signal().String()
+	}
+	return fmt.Sprintf("exit status %d", ws.ExitStatus())
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package process
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// StartReaper needs PR_SET_CHILD_SUBREAPER, which only Linux has.
+func (m *Manager) StartReaper() error {
+	return fmt.Errorf("orphan reaping is not supported on %s", runtime.GOOS)
+}
+
+func reapPID(pid int) (string, bool) {
+	return "", false
+}
+
+// waitPID polls until a process that is not a child of the daemon exits.
+func waitPID(pid int) (int, string) {
+	for processAlive(pid) {
+		time.Sleep(time.Second)
+	}
+	return -1, "exited, status unknown"
+}
@@ -0,0 +1,126 @@
+package process
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"gproc/pkg/types"
+)
+
+const (
+	// reloadSettle is how long a simple process must stay up during a
+	// reload before it counts as ready. Notify processes say so themselves.
+	reloadSettle = 2 * time.Second
+	// stopTimeout is how long a process gets to exit after the stop
+	// signal before it is killed.
+	stopTimeout = 5 * time.Second
+)
+
+// ZeroDowntimeReload replaces a running process with a new instance. The
+// new instance inherits the same listening sockets; the old one is only
+// stopped, gracefully, once the new one is ready. If the new instance does
+// not become ready it is stopped and the old one keeps serving.
+func (m *Manager) ZeroDowntimeReload(processID string) error {
+	m.mutex.Lock()
+	proc, exists := m.processes[processID]
+	if !exists {
+		m.mutex.Unlock()
+		return fmt.Errorf("process %s not found", processID)
+	}
+	old := m.runtimes[processID]
+	if proc.Status != types.StatusRunning || old == nil {
+		m.mutex.Unlock()
+		return fmt.Errorf("process %s is not running", processID)
+	}
+	if old.reloading {
+		m.mutex.Unlock()
+		return fmt.Errorf("process %s is already being reloaded", processID)
+	}
+	if proc.Type == types.ProcessTypeForking {
+		// Both instances would write the same PID file.
+		m.mutex.Unlock()
+		return fmt.Errorf("process %s is a forking process and cannot be reloaded without downtime", processID)
+	}
+
+	next := *proc
+	next.Cmd = nil
+	rt, err := m.launch(&next)
+	if err != nil {
+		m.mutex.Unlock()
+		return fmt.Errorf("start new instance of %s: %v", processID, err)
+	}
+	old.reloading = true
+	readyTimeout := proc.ReadyTimeout
+	m.mutex.Unlock()
+
+	log.Printf("Reloading %s: started new instance (PID %d)", processID, next.PID)
+	err = waitReady(rt, readyTimeout)
+
+	m.mutex.Lock()
+	old.reloading = false
+	if err == nil && (m.runtimes[processID] != old || proc.Status != types.StatusRunning) {
+		err = fmt.Errorf("process was stopped or restarted meanwhile")
+	}
+	if err != nil {
+		rt.superseded = true
+		m.mutex.Unlock()
+		stopRun(rt)
+		return fmt.Errorf("reload of %s aborted, old instance kept: %v", processID, err)
+	}
+
+	proc.Cmd = next.Cmd
+	proc.PID = next.PID
+	proc.StartTime = next.StartTime
+	proc.Readiness = next.Readiness
+	proc.StatusText = next.StatusText
+	rt.proc = proc
+	m.activate(rt)
+	m.recordEvent(processID, types.EventReloaded, next.PID, nil, "reloaded, replacing PID %d", old.cmd.Process.Pid)
+	m.saveConfig()
+	m.mutex.Unlock()
+
+	log.Printf("Reloading %s: new instance ready, stopping old instance (PID %d)", processID, old.cmd.Process.Pid)
+	stopRun(old)
+	return nil
+}
+
+// waitReady waits until a new run is ready: READY=1 for notify processes,
+// otherwise staying up for reloadSettle.
+func waitReady(rt *procRuntime, timeout time.Duration) error {
+	if rt.notify == nil {
+		select {
+		case <-rt.exited:
+			return fmt.Errorf("new instance exited during startup")
+		case <-time.After(reloadSettle):
+			return nil
+		}
+	}
+
+	if timeout <= 0 {
+		timeout = defaultReadyTimeout
+	}
+	select {
+	case <-rt.ready:
+		return nil
+	case <-rt.exited:
+		return fmt.Errorf("new instance exited before it was ready")
+	case <-time.After(timeout):
+		return fmt.Errorf("new instance not ready after %s", timeout)
+	}
+}
+
+// stopRun stops a single run of a process, killing it if it does not exit
+// within stopTimeout.
+func stopRun(rt *procRuntime) {
+	if err := rt.signal(os.Interrupt); err != nil {
+		rt.signal(os.Kill)
+	}
+	select {
+	case <-rt.exited:
+	case <-time.After(stopTimeout):
+		rt.signal(os.Kill)
+		<-rt.exited
+	}
+}
@@ -0,0 +1,204 @@
+package process
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// selectorOp is the comparison of a single selector requirement.
+type selectorOp string
+
+const (
+	opEquals    selectorOp = "="
+	opNotEquals selectorOp = "!="
+	opIn        selectorOp = "in"
+	opNotIn     selectorOp = "notin"
+	opExists    selectorOp = "exists"
+	opNotExists selectorOp = "!exists"
+)
+
+type requirement struct {
+	key    string
+	op     selectorOp
+	values []string
+}
+
+// Selector matches processes by their labels. The zero Selector matches
+// every process.
+type Selector struct {
+	requirements []requirement
+	text         string
+}
+
+// ParseSelector parses a comma separated list of requirements, all of
+// which must hold:
+//
+//	app=api, app==api   label equals the value
+//	tier!=batch         label is missing or has another value
+//	env in (prod,stage) label has one of the values
+//	env notin (dev)     label is missing or has none of the values
+//	canary, !canary     label is set, label is not set
+func ParseSelector(s string) (Selector, error) {
+	sel := Selector{text: strings.TrimSpace(s)}
+	for _, term := range splitSelector(sel.text) {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			return Selector{}, fmt.Errorf("invalid selector %q: empty requirement", s)
+		}
+		req, err := parseRequirement(term)
+		if err != nil {
+			return Selector{}, fmt.Errorf("invalid selector %q: %v", s, err)
+		}
+		sel.requirements = append(sel.requirements, req)
+	}
+	return sel, nil
+}
+
+// splitSelector splits on the commas that are not inside a value set.
+func splitSelector(s string) []string {
+	if s == "" {
+		return nil
+	}
+	var terms []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				terms = append(terms, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(terms, s[start:])
+}
+
+func parseRequirement(term string) (requirement, error) {
+	if strings.HasPrefix(term, "!") {
+		key := strings.TrimSpace(term[1:])
+		return requirement{key: key, op: opNotExists}, validateLabelKey(key)
+	}
+	if i := strings.Index(term, "!="); i >= 0 {
+		key, value := strings.TrimSpace(term[:i]), strings.TrimSpace(term[i+2:])
+		return requirement{key: key, op: opNotEquals, values: []string{value}}, validateLabelKey(key)
+	}
+	if i := strings.Index(term, "="); i >= 0 {
+		key, value := strings.TrimSpace(term[:i]), strings.TrimSpace(strings.TrimPrefix(term[i+1:], "="))
+		return requirement{key: key, op: opEquals, values: []string{value}}, validateLabelKey(key)
+	}
+	if fields := strings.Fields(term); len(fields) >= 2 && (fields[1] == "in" || fields[1] == "notin") {
+		key, op := fields[0], selectorOp(fields[1])
+		set := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(term[len(key):]), fields[1]))
+		if !strings.HasPrefix(set, "(") || !strings.HasSuffix(set, ")") {
+			return requirement{}, fmt.Errorf("%q: expected a value set like (a,b)", term)
+		}
+		var values []string
+		for _, v := range strings.Split(set[1:len(set)-1], ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			return requirement{}, fmt.Errorf("%q: empty value set", term)
+		}
+		return requirement{key: key, op: op, values: values}, validateLabelKey(key)
+	}
+	return requirement{key: term, op: opExists}, validateLabelKey(term)
+}
+
+func validateLabelKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("missing label key")
+	}
+	if strings.ContainsAny(key, " \t=!(),") {
+		return fmt.Errorf("invalid label key %q", key)
+	}
+	return nil
+}
+
+// Empty reports whether the selector matches every process.
+func (s Selector) Empty() bool {
+	return len(s.requirements) == 0
+}
+
+func (s Selector) String() string {
+	return s.text
+}
+
+// Matches reports whether labels satisfy every requirement.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, req := range s.requirements {
+		value, ok := labels[req.key]
+		switch req.op {
+		case opEquals:
+			if !ok || value != req.values[0] {
+				return false
+			}
+		case opNotEquals:
+			if ok && value == req.values[0] {
+				return false
+			}
+		case opIn:
+			if !ok || !contains(req.values, value) {
+				return false
+			}
+		case opNotIn:
+			if ok && contains(req.values, value) {
+				return false
+			}
+		case opExists:
+			if !ok {
+				return false
+			}
+		case opNotExists:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseLabels parses "key=value" pairs as given to --label.
+func ParseLabels(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", pair)
+		}
+		if err := validateLabelKey(key); err != nil {
+			return nil, err
+		}
+		labels[key] = strings.TrimSpace(value)
+	}
+	return labels, nil
+}
+
+// FormatLabels renders labels as sorted "key=value" pairs.
+func FormatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
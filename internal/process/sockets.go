@@ -0,0 +1,178 @@
+package process
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"gproc/pkg/types"
+)
+
+// listenPIDShim exports LISTEN_PID with the PID of the shell, then execs
+// the real command in its place so the PID stays the same. The PID of a
+// child is not known before it is forked.
+const listenPIDShim = `LISTEN_PID=$$; export LISTEN_PID; exec "$0" "$@"`
+
+// boundSocket is a listening socket held by the manager for a process.
+type boundSocket struct {
+	spec     types.Socket
+	listener io.Closer
+	file     *os.File
+}
+
+// socketSet holds the sockets of a process from its first start until it
+// is stopped.
+type socketSet struct {
+	sockets []*boundSocket
+}
+
+// ParseSocket parses "[name=]network://address", for example
+// "http=tcp://:8080" or "unix:///run/app.sock".
+func ParseSocket(s string) (types.Socket, error) {
+	var spec types.Socket
+	if name, rest, ok := strings.Cut(s, "="); ok && !strings.Contains(name, "://") {
+		spec.Name, s = name, rest
+	}
+	network, address, ok := strings.Cut(s, "://")
+	if !ok || address == "" {
+		return spec, fmt.Errorf("invalid socket %q, expected [name=]network://address", s)
+	}
+	spec.Network, spec.Address = network, address
+	return spec, validateSocket(spec)
+}
+
+func validateSocket(spec types.Socket) error {
+	switch spec.Network {
+	case "tcp", "tcp4", "tcp6", "unix", "udp", "udp4", "udp6":
+	default:
+		return fmt.Errorf("unsupported socket network %q", spec.Network)
+	}
+	if strings.ContainsAny(spec.Name, ":\n") {
+		return fmt.Errorf("socket name %q must not contain ':'", spec.Name)
+	}
+	return nil
+}
+
+func bindSocket(spec types.Socket) (*boundSocket, error) {
+	if err := validateSocket(spec); err != nil {
+		return nil, err
+	}
+
+	var listener io.Closer
+	var err error
+	switch spec.Network {
+	case "udp", "udp4", "udp6":
+		listener, err = net.ListenPacket(spec.Network, spec.Address)
+	default:
+		if spec.Network == "unix" {
+			os.Remove(spec.Address)
+		}
+		listener, err = net.Listen(spec.Network, spec.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	filer, ok := listener.(interface{ File() (*os.File, error) })
+	if !ok {
+		listener.Close()
+		return nil, fmt.Errorf("cannot pass %s socket %s", spec.Network, spec.Address)
+	}
+	file, err := filer.File()
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return &boundSocket{spec: spec, listener: listener, file: file}, nil
+}
+
+func (b *boundSocket) Close() {
+	b.file.Close()
+	b.listener.Close()
+}
+
+func (s *socketSet) Close() {
+	for _, socket := range s.sockets {
+		socket.Close()
+	}
+}
+
+// specs returns the socket specs the set was bound for.
+func (s *socketSet) specs() []types.Socket {
+	specs := make([]types.Socket, len(s.sockets))
+	for i, socket := range s.sockets {
+		specs[i] = socket.spec
+	}
+	return specs
+}
+
+// processSockets returns the sockets of proc, binding them on first use or
+// when the declared sockets changed. The caller holds m.mutex.
+func (m *Manager) processSockets(proc *types.Process) (*socketSet, error) {
+	if set, exists := m.sockets[proc.ID]; exists {
+		if reflect.DeepEqual(set.specs(), proc.Sockets) {
+			return set, nil
+		}
+		set.Close()
+		delete(m.sockets, proc.ID)
+	}
+	if runtime.GOOS == "windows" {
+		return nil, fmt.Errorf("socket activation is not supported on windows")
+	}
+
+	set := &socketSet{}
+	for _, spec := range proc.Sockets {
+		socket, err := bindSocket(spec)
+		if err != nil {
+			set.Close()
+			return nil, fmt.Errorf("bind %s socket %s for %s: %v", spec.Network, spec.Address, proc.ID, err)
+		}
+		set.sockets = append(set.sockets, socket)
+	}
+	m.sockets[proc.ID] = set
+	return set, nil
+}
+
+// releaseSockets closes the sockets of a process. The caller holds
+// m.mutex.
+func (m *Manager) releaseSockets(id string) {
+	if set, exists := m.sockets[id]; exists {
+		set.Close()
+		delete(m.sockets, id)
+	}
+}
+
+// passSockets hands the sockets to cmd following the sd_listen_fds
+// convention: descriptors from 3 on, LISTEN_FDS, LISTEN_FDNAMES and a
+// LISTEN_PID set to the PID of the process itself.
+func passSockets(cmd *exec.Cmd, set *socketSet) {
+	if cmd.Err != nil {
+		// Start reports the failed command lookup.
+		return
+	}
+
+	names := make([]string, len(set.sockets))
+	for i, socket := range set.sockets {
+		cmd.ExtraFiles = append(cmd.ExtraFiles, socket.file)
+		names[i] = socket.spec.Name
+		if names[i] == "" {
+			names[i] = "unknown"
+		}
+	}
+
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env,
+		"LISTEN_FDS="+strconv.Itoa(len(set.sockets)),
+		"LISTEN_FDNAMES="+strings.Join(names, ":"))
+
+	cmd.Args = append([]string{"/bin/sh", "-c", listenPIDShim, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/bin/sh"
+}
@@ -0,0 +1,529 @@
+package process
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gproc/internal/monitor"
+	"gproc/pkg/types"
+)
+
+const (
+	defaultStatsDAddress = "127.0.0.1:8125"
+	defaultStatsDFlush   = 10 * time.Second
+
+	// maxStatsDSeries bounds the series of a process, so that a tag with
+	// ever new values cannot exhaust the memory of the daemon.
+	maxStatsDSeries = 1000
+	// maxStatsDObservations bounds the observations a timer keeps for
+	// its quantiles in one interval; later ones are counted but not kept.
+	maxStatsDObservations = 10000
+
+	// statsdProcessTag names the process a metric belongs to when the
+	// credentials of the sender do not tell.
+	statsdProcessTag = "GPROC_PROCESS"
+)
+
+// statsdTypes maps the StatsD types to the types of AppMetric.
+var statsdTypes = map[string]string{
+	"c":  "counter",
+	"g":  "gauge",
+	"s":  "set",
+	"ms": "timer",
+	"h":  "histogram",
+	"d":  "distribution",
+}
+
+// statsdServer receives StatsD datagrams over UDP and a Unix socket and
+// aggregates them per process between flushes.
+type statsdServer struct {
+	udp    net.PacketConn
+	unix   *net.UnixConn
+	socket string
+	flush  time.Duration
+	stop   chan struct{}
+	wg     sync.WaitGroup
+
+	mutex   sync.Mutex
+	series  map[string]map[string]*statsdSeries // by process ID, then series key
+	latest  map[string][]types.AppMetric        // as of the last flush, by process ID
+	owners  map[int]string                      // sender PIDs resolved in this interval
+	dropped int                                 // metrics nobody owned in this interval
+	invalid int                                 // malformed lines in this interval
+	lastErr error                               // about the last of them
+}
+
+// statsdSeries aggregates one metric, by name, type and tags, of a process.
+type statsdSeries struct {
+	name    string
+	kind    string
+	tags    map[string]string
+	value   float64 // total of a counter, value of a gauge
+	count   uint64
+	sum     float64
+	values  []float64       // observations of the interval
+	members map[string]bool // distinct values of a set in the interval
+}
+
+// statsdSample is one value of one metric in a datagram.
+type statsdSample struct {
+	name    string
+	kind    string
+	value   float64
+	member  string // value of a set
+	delta   bool   // a signed gauge value adds to the gauge
+	rate    float64
+	tags    map[string]string
+	process string // GPROC_PROCESS tag
+}
+
+// parseStatsD parses a line of a datagram, in the StatsD format with the
+// DogStatsD extensions: name:value[:value...]|type[|@rate][|#tag:value,...].
+// Events and service checks are ignored.
+func parseStatsD(line string) ([]statsdSample, error) {
+	if strings.HasPrefix(line, "_e{") || strings.HasPrefix(line, "_sc|") {
+		return nil, nil
+	}
+	fields := strings.Split(line, "|")
+	name, values, ok := strings.Cut(fields[0], ":")
+	if !ok || name == "" || len(fields) < 2 {
+		return nil, fmt.Errorf("malformed metric %q", line)
+	}
+	kind, ok := statsdTypes[fields[1]]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric type %q in %q", fields[1], line)
+	}
+
+	rate := 1.0
+	var tags map[string]string
+	var process string
+	for _, field := range fields[2:] {
+		switch {
+		case strings.HasPrefix(field, "@"):
+			r, err := strconv.ParseFloat(field[1:], 64)
+			if err != nil || r <= 0 || r > 1 {
+				return nil, fmt.Errorf("invalid sample rate %q in %q", field, line)
+			}
+			rate = r
+		case strings.HasPrefix(field, "#"):
+			for _, tag := range strings.Split(field[1:], ",") {
+				key, value, ok := strings.Cut(tag, ":")
+				if !ok || key == "" {
+					continue
+				}
+				if strings.EqualFold(key, statsdProcessTag) {
+					process = value
+					continue
+				}
+				if tags == nil {
+					tags = make(map[string]string)
+				}
+				tags[key] = value
+			}
+		}
+		// Container IDs (c:) and timestamps (T) are of no use here.
+	}
+
+	var samples []statsdSample
+	for _, value := range strings.Split(values, ":") {
+		sample := statsdSample{name: name, kind: kind, rate: rate, tags: tags, process: process}
+		if kind == "set" {
+			sample.member = value
+		} else {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+				return nil, fmt.Errorf("invalid value %q in %q", value, line)
+			}
+			if kind == "timer" {
+				v /= 1000
+			}
+			sample.value = v
+			sample.delta = kind == "gauge" && (value[0] == '+' || value[0] == '-')
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+// key identifies the series of a sample within its process.
+func (s *statsdSample) key() string {
+	keys := make([]string, 0, len(s.tags))
+	for key := range s.tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(s.name)
+	b.WriteString("|")
+	b.WriteString(s.kind)
+	for _, key := range keys {
+		b.WriteString("|")
+		b.WriteString(key)
+		b.WriteString(":")
+		b.WriteString(s.tags[key])
+	}
+	return b.String()
+}
+
+func (se *statsdSeries) add(s *statsdSample) {
+	switch se.kind {
+	case "counter":
+		se.value += s.value / s.rate
+	case "gauge":
+		if s.delta {
+			se.value += s.value
+		} else {
+			se.value = s.value
+		}
+	case "set":
+		se.members[s.member] = true
+	default:
+		weight := math.Round(1 / s.rate)
+		se.count += uint64(weight)
+		se.sum += s.value * weight
+		if len(se.values) < maxStatsDObservations {
+			se.values = append(se.values, s.value)
+		}
+	}
+}
+
+// flush returns the state of the series and starts a new interval.
+func (se *statsdSeries) flush() types.AppMetric {
+	metric := types.AppMetric{Name: se.name, Type: se.kind, Tags: se.tags}
+	switch se.kind {
+	case "counter", "gauge":
+		metric.Value = se.value
+	case "set":
+		metric.Value = float64(len(se.members))
+		se.members = make(map[string]bool)
+	default:
+		metric.Count, metric.Sum = se.count, se.sum
+		metric.Value = float64(len(se.values))
+		if n := len(se.values); n > 0 {
+			sort.Float64s(se.values)
+			metric.Min, metric.Max = se.values[0], se.values[n-1]
+			metric.P50 = quantile(se.values, 0.5)
+			metric.P95 = quantile(se.values, 0.95)
+			metric.P99 = quantile(se.values, 0.99)
+		}
+		se.values = se.values[:0]
+	}
+	return metric
+}
+
+// quantile returns the q-quantile of sorted values by nearest rank.
+func quantile(sorted []float64, q float64) float64 {
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// StartStatsD starts the StatsD listener of the metrics configuration, if
+// it is enabled.
+func (m *Manager) StartStatsD() error {
+	cfg := m.MetricsConfig().StatsD
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+	s := &statsdServer{
+		socket: cfg.Socket,
+		flush:  cfg.FlushInterval,
+		stop:   make(chan struct{}),
+		series: make(map[string]map[string]*statsdSeries),
+		latest: make(map[string][]types.AppMetric),
+		owners: make(map[int]string),
+	}
+	if s.flush <= 0 {
+		s.flush = defaultStatsDFlush
+	}
+
+	address := cfg.Address
+	if address == "" && cfg.Socket == "" {
+		address = defaultStatsDAddress
+	}
+	if address != "" {
+		conn, err := net.ListenPacket("udp", address)
+		if err != nil {
+			return fmt.Errorf("StatsD listener: %v", err)
+		}
+		s.udp = conn
+	}
+	if cfg.Socket != "" {
+		os.Remove(cfg.Socket)
+		conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: cfg.Socket, Net: "unixgram"})
+		if err != nil {
+			if s.udp != nil {
+				s.udp.Close()
+			}
+			return fmt.Errorf("StatsD listener: %v", err)
+		}
+		if err := passCredentials(conn); err != nil {
+			log.Printf("StatsD listener: senders on %s are only known by their %s tag: %v", cfg.Socket, statsdProcessTag, err)
+		}
+		// Processes that run as other users send here too; the
+		// credentials tell who they are.
+		os.Chmod(cfg.Socket, 0666)
+		s.unix = conn
+	}
+
+	m.mutex.Lock()
+	m.statsd = s
+	m.mutex.Unlock()
+
+	if s.udp != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			buf := make([]byte, 65535)
+			for {
+				n, _, err := s.udp.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				m.receiveStatsD(s, buf[:n], 0)
+			}
+		}()
+		log.Printf("StatsD listener on udp://%s", s.udp.LocalAddr())
+	}
+	if s.unix != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			buf := make([]byte, 65535)
+			oob := make([]byte, credentialsSize)
+			for {
+				n, oobn, _, _, err := s.unix.ReadMsgUnix(buf, oob)
+				if err != nil {
+					return
+				}
+				m.receiveStatsD(s, buf[:n], senderPID(oob[:oobn]))
+			}
+		}()
+		log.Printf("StatsD listener on unixgram://%s", s.socket)
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.flush)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.flushStatsD(s)
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// StopStatsD stops the StatsD listener and records what it received since
+// the last flush.
+func (m *Manager) StopStatsD() {
+	m.mutex.Lock()
+	s := m.statsd
+	m.statsd = nil
+	m.mutex.Unlock()
+	if s == nil {
+		return
+	}
+	close(s.stop)
+	if s.udp != nil {
+		s.udp.Close()
+	}
+	if s.unix != nil {
+		s.unix.Close()
+		os.Remove(s.socket)
+	}
+	s.wg.Wait()
+	m.flushStatsD(s)
+}
+
+// receiveStatsD aggregates the metrics of a datagram, sent by pid if the
+// socket tells.
+func (m *Manager) receiveStatsD(s *statsdServer, datagram []byte, pid int) {
+	owner := ""
+	if pid > 0 {
+		s.mutex.Lock()
+		id, ok := s.owners[pid]
+		s.mutex.Unlock()
+		if !ok {
+			id = m.ownerOf(pid)
+			s.mutex.Lock()
+			s.owners[pid] = id
+			s.mutex.Unlock()
+		}
+		owner = id
+	}
+
+	for _, line := range strings.Split(string(datagram), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		samples, err := parseStatsD(line)
+		if err != nil {
+			s.mutex.Lock()
+			s.invalid++
+			s.lastErr = err
+			s.mutex.Unlock()
+			continue
+		}
+		for i := range samples {
+			sample := &samples[i]
+			id := owner
+			if id == "" && sample.process != "" {
+				id = m.processByName(sample.process)
+			}
+			m.addStatsD(s, id, sample)
+		}
+	}
+}
+
+func (m *Manager) addStatsD(s *statsdServer, id string, sample *statsdSample) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if id == "" {
+		s.dropped++
+		return
+	}
+	series := s.series[id]
+	if series == nil {
+		series = make(map[string]*statsdSeries)
+		s.series[id] = series
+	}
+	key := sample.key()
+	se := series[key]
+	if se == nil {
+		if len(series) >= maxStatsDSeries {
+			s.dropped++
+			return
+		}
+		se = &statsdSeries{name: sample.name, kind: sample.kind, tags: sample.tags}
+		if se.kind == "set" {
+			se.members = make(map[string]bool)
+		}
+		series[key] = se
+	}
+	se.add(sample)
+}
+
+// flushStatsD closes the interval: the metrics of every process become
+// its latest ones and are recorded in the metrics history.
+func (m *Manager) flushStatsD(s *statsdServer) {
+	m.mutex.RLock()
+	known := make(map[string]bool, len(m.processes))
+	for id := range m.processes {
+		known[id] = true
+	}
+	m.mutex.RUnlock()
+
+	s.mutex.Lock()
+	latest := make(map[string][]types.AppMetric, len(s.series))
+	for id, series := range s.series {
+		if !known[id] {
+			delete(s.series, id)
+			continue
+		}
+		keys := make([]string, 0, len(series))
+		for key := range series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		metrics := make([]types.AppMetric, 0, len(keys))
+		for _, key := range keys {
+			metrics = append(metrics, series[key].flush())
+		}
+		latest[id] = metrics
+	}
+	s.latest = latest
+	s.owners = make(map[int]string)
+	dropped, invalid, lastErr := s.dropped, s.invalid, s.lastErr
+	s.dropped, s.invalid, s.lastErr = 0, 0, nil
+	s.mutex.Unlock()
+
+	// Logged once per interval, however much a sender gets wrong.
+	if dropped > 0 {
+		log.Printf("StatsD: dropped %d metrics of unknown processes or beyond %d series", dropped, maxStatsDSeries)
+	}
+	if invalid > 0 {
+		log.Printf("StatsD: ignored %d malformed lines, the last: %v", invalid, lastErr)
+	}
+	if m.metricsStorage == nil {
+		return
+	}
+	for id, metrics := range latest {
+		if err := m.metricsStorage.StoreAppMetrics(id, metrics); err != nil {
+			log.Printf("Recording StatsD metrics of %s: %v", id, err)
+		}
+	}
+}
+
+// appMetrics returns the StatsD metrics of a process as of the last flush.
+// The caller must hold m.mutex.
+func (m *Manager) appMetrics(id string) []types.AppMetric {
+	if m.statsd == nil {
+		return nil
+	}
+	m.statsd.mutex.Lock()
+	defer m.statsd.mutex.Unlock()
+	return m.statsd.latest[id]
+}
+
+// ownerOf returns the ID of the managed process whose tree pid is in, or
+// "" if it is in none.
+func (m *Manager) ownerOf(pid int) string {
+	m.mutex.RLock()
+	roots := make(map[int]string, len(m.runtimes))
+	for id, rt := range m.runtimes {
+		roots[rt.cmd.Process.Pid] = id
+		roots[rt.pid()] = id
+	}
+	m.mutex.RUnlock()
+
+	for depth := 0; pid > 1 && depth < 64; depth++ {
+		if id, ok := roots[pid]; ok {
+			return id
+		}
+		// Orphans the daemon adopted are known to the reaper.
+		m.reaper.mutex.Lock()
+		id, ok := m.reaper.owners[pid]
+		m.reaper.mutex.Unlock()
+		if ok {
+			return id
+		}
+		ppid, err := monitor.ParentPID(pid)
+		if err != nil {
+			return ""
+		}
+		pid = ppid
+	}
+	return ""
+}
+
+// processByName returns the ID of the process with the ID or name s, or ""
+// if there is none.
+func (m *Manager) processByName(s string) string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if _, ok := m.processes[s]; ok {
+		return s
+	}
+	for id, proc := range m.processes {
+		if proc.Name == s {
+			return id
+		}
+	}
+	return ""
+}
@@ -0,0 +1,41 @@
+package process
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// credentialsSize is the room for the credentials of a datagram sender.
+var credentialsSize = unix.CmsgSpace(unix.SizeofUcred)
+
+// passCredentials makes the kernel attach the credentials of the sender to
+// every datagram received on conn.
+func passCredentials(conn *net.UnixConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	err = raw.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_PASSCRED, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
+
+// senderPID returns the PID in the credentials of a datagram, or 0.
+func senderPID(oob []byte) int {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0
+	}
+	for i := range msgs {
+		if cred, err := unix.ParseUnixCredentials(&msgs[i]); err == nil {
+			return int(cred.Pid)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package process
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// credentialsSize is zero: datagrams carry no credentials here.
+const credentialsSize = 0
+
+// passCredentials needs SO_PASSCRED, which only Linux has.
+func passCredentials(conn *net.UnixConn) error {
+	return fmt.Errorf("sender credentials are not supported on %s", runtime.GOOS)
+}
+
+func senderPID(oob []byte) int {
+	return 0
+}
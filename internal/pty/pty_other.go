@@ -0,0 +1,44 @@
+//go:build !linux
+
+package pty
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// ErrUnsupported is returned on platforms without pseudo-terminal support.
+var ErrUnsupported = errors.New("pseudo-terminals are not supported on this platform")
+
+func Open() (master *os.File, slave *os.File, err error) {
+	return nil, nil, ErrUnsupported
+}
+
+func SetSize(f *os.File, rows, cols uint16) error {
+	return ErrUnsupported
+}
+
+func GetSize(fd int) (rows, cols uint16, err error) {
+	return 0, 0, ErrUnsupported
+}
+
+func IsTerminal(fd int) bool {
+	return false
+}
+
+type State struct{}
+
+func MakeRaw(fd int) (*State, error) {
+	return nil, ErrUnsupported
+}
+
+func Restore(fd int, state *State) error {
+	return ErrUnsupported
+}
+
+func NotifyResize(ch chan<- os.Signal) {}
+
+func SysProcAttr() *syscall.SysProcAttr {
+	return nil
+}
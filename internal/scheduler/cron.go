@@ -1,139 +1,545 @@
 package scheduler
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"sync"
 	"time"
 
 	"gproc/pkg/types"
 )
 
+// maxSleep bounds how long the scheduler sleeps between checks so that
+// wall clock jumps are noticed.
+const maxSleep = time.Minute
+
+// defaultMaxMissedRuns caps the run-all missed run policy when the task
+// does not set MaxMissedRuns.
+const defaultMaxMissedRuns = 10
+
+// Triggers recorded in the history of a run.
+const (
+	TriggerSchedule = "schedule"
+	TriggerMissed   = "missed"
+	TriggerManual   = "manual"
+)
+
+// ErrTaskRunning is returned when a run is refused by the forbid
+// concurrency policy.
+var ErrTaskRunning = errors.New("task is already running")
+
+// JobRunner executes scheduled tasks. The daemon's process manager
+// implements it.
+type JobRunner interface {
+	RunJob(job *types.Job) (*types.Job, error)
+	WaitJob(id string) (*types.Job, error)
+	CancelJob(id string) (*types.Job, error)
+}
+
+// TaskStore persists task definitions and whether they are paused. The
+// daemon's process manager implements it. The run state (last run, next
+// run) is kept in memory and in the history instead, so that frequent
+// tasks do not rewrite the configuration on every run.
+type TaskStore interface {
+	AddScheduledTask(task *types.ScheduledTask) error
+	RemoveScheduledTask(name string) error
+}
+
 type CronScheduler struct {
-	tasks   map[string]*types.ScheduledTask
-	running map[string]bool
-	mutex   sync.RWMutex
-	ticker  *time.Ticker
-	stop    chan bool
+	tasks     map[string]*types.ScheduledTask
+	schedules map[string]Schedule
+	active    map[string]map[string]chan struct{} // task name -> job ID -> done
+	runner    JobRunner
+	store     TaskStore
+	history   *History
+	mutex     sync.RWMutex
+	wake      chan struct{}
+	stop      chan struct{}
+	stopOnce  sync.Once
 }
 
 func NewCronScheduler() *CronScheduler {
 	return &CronScheduler{
-		tasks:   make(map[string]*types.ScheduledTask),
-		running: make(map[string]bool),
-		stop:    make(chan bool),
+		tasks:     make(map[string]*types.ScheduledTask),
+		schedules: make(map[string]Schedule),
+		active:    make(map[string]map[string]chan struct{}),
+		history:   &History{runs: make(map[string][]types.TaskRun)},
+		wake:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
 	}
 }
 
+// SetRunner sets what executes due tasks.
+func (cs *CronScheduler) SetRunner(runner JobRunner) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.runner = runner
+}
+
+// SetStore sets where tasks and their paused state are saved.
+func (cs *CronScheduler) SetStore(store TaskStore) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.store = store
+}
+
+// SetHistory sets where runs are recorded.
+func (cs *CronScheduler) SetHistory(history *History) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.history = history
+}
+
 func (cs *CronScheduler) Start() {
-	cs.ticker = time.NewTicker(1 * time.Minute)
 	go cs.run()
 }
 
 func (cs *CronScheduler) Stop() {
-	if cs.ticker != nil {
-		cs.ticker.Stop()
-	}
-	cs.stop <- true
+	cs.stopOnce.Do(func() { close(cs.stop) })
 }
 
+// AddTask adds or replaces a task. Its next run is computed from now.
 func (cs *CronScheduler) AddTask(task *types.ScheduledTask) error {
+	schedule, err := Validate(task)
+	if err != nil {
+		return err
+	}
+
+	// Keep a copy so the caller's task can be used without the lock.
+	task.NextRun = schedule.Next(time.Now())
+	stored := *task
+
 	cs.mutex.Lock()
-	defer cs.mutex.Unlock()
-	
-	nextRun, err := cs.parseNextRun(task.Cron)
+	cs.tasks[task.Name] = &stored
+	cs.schedules[task.Name] = schedule
+	err = cs.saveLocked(&stored)
+	cs.mutex.Unlock()
+
+	cs.notify()
+	return err
+}
+
+// LoadTask adds a task restored from disk. Runs that fell due while the
+// daemon was down, between the last run in the history (or the saved next
+// run if there is none) and now, are handled according to the task's
+// missed run policy.
+func (cs *CronScheduler) LoadTask(task *types.ScheduledTask) error {
+	schedule, err := Validate(task)
 	if err != nil {
-		return fmt.Errorf("invalid cron expression: %v", err)
+		return err
+	}
+
+	cs.mutex.Lock()
+	history := cs.history
+	cs.mutex.Unlock()
+
+	next := task.NextRun
+	for _, run := range history.Runs(task.Name, 0) {
+		if run.Trigger != TriggerManual && !run.ScheduledAt.Before(next) {
+			next = schedule.Next(run.ScheduledAt)
+		}
+		if run.StartTime.After(task.LastRun) {
+			task.LastRun = run.StartTime
+		}
+	}
+
+	now := time.Now()
+	var missed []time.Time
+	if task.Enabled {
+		missed = missedRuns(schedule, next, now, historyPerTask)
+	}
+
+	task.NextRun = schedule.Next(now)
+	stored := *task
+
+	cs.mutex.Lock()
+	cs.tasks[task.Name] = &stored
+	cs.schedules[task.Name] = schedule
+	cs.mutex.Unlock()
+
+	if len(missed) > 0 {
+		go cs.catchUp(*task, missed)
 	}
-	
-	task.NextRun = nextRun
-	cs.tasks[task.Name] = task
+	cs.notify()
 	return nil
 }
 
-func (cs *CronScheduler) RemoveTask(name string) {
+// missedRuns lists the activations from next up to now, keeping at most
+// the last limit of them.
+func missedRuns(schedule Schedule, next, now time.Time, limit int) []time.Time {
+	var missed []time.Time
+	for t := next; !t.IsZero() && !t.After(now); t = schedule.Next(t) {
+		missed = append(missed, t)
+		if len(missed) > limit {
+			missed = missed[1:]
+		}
+	}
+	return missed
+}
+
+// catchUp applies the missed run policy. Runs are executed one after the
+// other, most recent last; the ones not executed are recorded as skipped.
+func (cs *CronScheduler) catchUp(task types.ScheduledTask, missed []time.Time) {
+	keep := 0
+	switch task.MissedRuns {
+	case types.MissedRunOnce:
+		keep = 1
+	case types.MissedRunAll:
+		keep = task.MaxMissedRuns
+		if keep <= 0 {
+			keep = defaultMaxMissedRuns
+		}
+	}
+	if keep > len(missed) {
+		keep = len(missed)
+	}
+
+	for _, at := range missed[:len(missed)-keep] {
+		cs.recordSkipped(task.Name, TriggerMissed, at, "daemon was not running")
+	}
+	for _, at := range missed[len(missed)-keep:] {
+		select {
+		case <-cs.stop:
+			return
+		default:
+		}
+
+		_, done, err := cs.dispatch(task.Name, TriggerMissed, at)
+		if err != nil {
+			cs.recordSkipped(task.Name, TriggerMissed, at, err.Error())
+			continue
+		}
+		<-done
+	}
+}
+
+// RemoveTask removes a task and its history.
+func (cs *CronScheduler) RemoveTask(name string) error {
 	cs.mutex.Lock()
-	defer cs.mutex.Unlock()
-	
+	if _, exists := cs.tasks[name]; !exists {
+		cs.mutex.Unlock()
+		return fmt.Errorf("scheduled task %s not found", name)
+	}
 	delete(cs.tasks, name)
-	delete(cs.running, name)
+	delete(cs.schedules, name)
+	store, history := cs.store, cs.history
+	cs.mutex.Unlock()
+
+	cs.notify()
+	history.Remove(name)
+	if store != nil {
+		return store.RemoveScheduledTask(name)
+	}
+	return nil
 }
 
+// ListTasks returns a snapshot of the tasks sorted by name.
 func (cs *CronScheduler) ListTasks() []*types.ScheduledTask {
 	cs.mutex.RLock()
 	defer cs.mutex.RUnlock()
-	
+
 	var tasks []*types.ScheduledTask
 	for _, task := range cs.tasks {
-		tasks = append(tasks, task)
+		snapshot := *task
+		tasks = append(tasks, &snapshot)
 	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Name < tasks[j].Name })
 	return tasks
 }
 
+// GetTask returns a snapshot of the named task.
+func (cs *CronScheduler) GetTask(name string) (*types.ScheduledTask, error) {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+
+	task, exists := cs.tasks[name]
+	if !exists {
+		return nil, fmt.Errorf("scheduled task %s not found", name)
+	}
+	snapshot := *task
+	return &snapshot, nil
+}
+
+// Running reports how many runs of the named task are in progress.
+func (cs *CronScheduler) Running(name string) int {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+	return len(cs.active[name])
+}
+
+// History returns the scheduler's execution history.
+func (cs *CronScheduler) History() *History {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+	return cs.history
+}
+
+// Pause stops scheduling the task. Runs in progress are left alone.
+func (cs *CronScheduler) Pause(name string) (*types.ScheduledTask, error) {
+	return cs.setEnabled(name, false)
+}
+
+// Resume schedules the task again from now on. Runs missed while it was
+// paused are not caught up.
+func (cs *CronScheduler) Resume(name string) (*types.ScheduledTask, error) {
+	return cs.setEnabled(name, true)
+}
+
+func (cs *CronScheduler) setEnabled(name string, enabled bool) (*types.ScheduledTask, error) {
+	cs.mutex.Lock()
+	task, exists := cs.tasks[name]
+	if !exists {
+		cs.mutex.Unlock()
+		return nil, fmt.Errorf("scheduled task %s not found", name)
+	}
+	if enabled && !task.Enabled {
+		task.NextRun = cs.schedules[name].Next(time.Now())
+	}
+	task.Enabled = enabled
+	err := cs.saveLocked(task)
+	snapshot := *task
+	cs.mutex.Unlock()
+
+	cs.notify()
+	return &snapshot, err
+}
+
+// RunNow starts the task immediately, subject to its concurrency policy.
+func (cs *CronScheduler) RunNow(name string) (*types.Job, error) {
+	job, _, err := cs.dispatch(name, TriggerManual, time.Now())
+	return job, err
+}
+
+// Validate checks the task's policies and parses its schedule.
+func Validate(task *types.ScheduledTask) (Schedule, error) {
+	switch task.Concurrency {
+	case "", types.ConcurrencyAllow, types.ConcurrencyForbid, types.ConcurrencyReplace:
+	default:
+		return nil, fmt.Errorf("unknown concurrency policy %q (want allow, forbid or replace)", task.Concurrency)
+	}
+	switch task.MissedRuns {
+	case "", types.MissedRunSkip, types.MissedRunOnce, types.MissedRunAll:
+	default:
+		return nil, fmt.Errorf("unknown missed run policy %q (want skip, run-once or run-all)", task.MissedRuns)
+	}
+	if task.MaxMissedRuns < 0 {
+		return nil, fmt.Errorf("max missed runs must not be negative")
+	}
+
+	schedule, err := ParseTask(task)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression: %v", err)
+	}
+	// Like 0 0 31 2 *, which asks for a day the month does not have.
+	if schedule.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("cron expression %q never fires", task.Cron)
+	}
+	return schedule, nil
+}
+
+// ParseTask parses the task's cron expression in the task's time zone.
+func ParseTask(task *types.ScheduledTask) (Schedule, error) {
+	loc := time.Local
+	if task.TimeZone != "" {
+		var err error
+		if loc, err = time.LoadLocation(task.TimeZone); err != nil {
+			return nil, fmt.Errorf("unknown time zone %q: %v", task.TimeZone, err)
+		}
+	}
+	return Parse(task.Cron, loc)
+}
+
+// notify wakes the run loop so it recomputes its sleep.
+func (cs *CronScheduler) notify() {
+	select {
+	case cs.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run sleeps until the earliest due task instead of polling on a fixed
+// tick, so schedules with seconds or @every fire on time.
 func (cs *CronScheduler) run() {
+	timer := time.NewTimer(cs.untilNextRun())
+	defer timer.Stop()
+
 	for {
 		select {
-		case <-cs.ticker.C:
+		case <-timer.C:
 			cs.checkAndRunTasks()
+		case <-cs.wake:
 		case <-cs.stop:
 			return
 		}
+		timer.Reset(cs.untilNextRun())
+	}
+}
+
+func (cs *CronScheduler) untilNextRun() time.Duration {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+
+	wait := maxSleep
+	now := time.Now()
+	for _, task := range cs.tasks {
+		if !task.Enabled || task.NextRun.IsZero() {
+			continue
+		}
+		if d := task.NextRun.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	if wait < 0 {
+		wait = 0
 	}
+	return wait
 }
 
 func (cs *CronScheduler) checkAndRunTasks() {
 	cs.mutex.Lock()
 	defer cs.mutex.Unlock()
-	
+
 	now := time.Now()
 	for name, task := range cs.tasks {
-		if now.After(task.NextRun) && !cs.running[name] {
-			go cs.executeTask(task)
-			
-			// Schedule next run
-			nextRun, err := cs.parseNextRun(task.Cron)
-			if err == nil {
-				task.NextRun = nextRun
+		if !task.Enabled || task.NextRun.IsZero() || now.Before(task.NextRun) {
+			continue
+		}
+
+		go func(name string, at time.Time) {
+			if _, _, err := cs.dispatch(name, TriggerSchedule, at); err != nil {
+				cs.recordSkipped(name, TriggerSchedule, at, err.Error())
+			}
+		}(name, task.NextRun)
+
+		// Schedule next run
+		task.NextRun = cs.schedules[name].Next(now)
+	}
+}
+
+// dispatch starts a run of the named task according to its concurrency
+// policy. The returned channel is closed once the run is recorded.
+func (cs *CronScheduler) dispatch(name, trigger string, scheduledAt time.Time) (*types.Job, <-chan struct{}, error) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	task, exists := cs.tasks[name]
+	if !exists {
+		return nil, nil, fmt.Errorf("scheduled task %s not found", name)
+	}
+	runner := cs.runner
+	if runner == nil {
+		return nil, nil, fmt.Errorf("no runner configured")
+	}
+
+	if len(cs.active[name]) > 0 {
+		switch task.Concurrency {
+		case types.ConcurrencyAllow:
+		case types.ConcurrencyReplace:
+			// Wait for the old runs to be stopped and recorded without
+			// holding the lock.
+			runs := make(map[string]chan struct{})
+			for id, done := range cs.active[name] {
+				runs[id] = done
+			}
+			cs.mutex.Unlock()
+			for id, done := range runs {
+				runner.CancelJob(id)
+				<-done
 			}
+			cs.mutex.Lock()
+			if task, exists = cs.tasks[name]; !exists {
+				return nil, nil, fmt.Errorf("scheduled task %s not found", name)
+			}
+			if task.Concurrency == types.ConcurrencyReplace && len(cs.active[name]) > 0 {
+				return nil, nil, ErrTaskRunning
+			}
+		default:
+			return nil, nil, ErrTaskRunning
 		}
 	}
+
+	log.Printf("Executing scheduled task: %s (%s)", name, trigger)
+	job, err := runner.RunJob(&types.Job{
+		Name:       task.Name,
+		Command:    task.Command,
+		Args:       task.Args,
+		WorkingDir: task.WorkingDir,
+		Env:        task.Env,
+		Timeout:    task.Timeout,
+		Retries:    task.Retries,
+	})
+	if err != nil {
+		cs.history.Record(types.TaskRun{
+			Task:        name,
+			Trigger:     trigger,
+			ScheduledAt: scheduledAt,
+			StartTime:   time.Now(),
+			EndTime:     time.Now(),
+			Status:      types.JobFailed,
+			ExitCode:    127,
+			Error:       err.Error(),
+		})
+		return nil, nil, err
+	}
+
+	task.LastRun = job.StartTime
+	done := make(chan struct{})
+	if cs.active[name] == nil {
+		cs.active[name] = make(map[string]chan struct{})
+	}
+	cs.active[name][job.ID] = done
+
+	go cs.finish(name, job.ID, trigger, scheduledAt, done)
+	return job, done, nil
 }
 
-func (cs *CronScheduler) executeTask(task *types.ScheduledTask) {
+// finish waits for a run to end and records it.
+func (cs *CronScheduler) finish(name, jobID, trigger string, scheduledAt time.Time, done chan struct{}) {
+	cs.mutex.RLock()
+	runner, history := cs.runner, cs.history
+	cs.mutex.RUnlock()
+
+	run := types.TaskRun{Task: name, JobID: jobID, Trigger: trigger, ScheduledAt: scheduledAt}
+	if job, err := runner.WaitJob(jobID); err != nil {
+		run.Status = types.JobFailed
+		run.Error = err.Error()
+	} else {
+		run.StartTime = job.StartTime
+		run.EndTime = job.EndTime
+		run.Duration = job.EndTime.Sub(job.StartTime)
+		run.Status = job.Status
+		run.ExitCode = job.ExitCode
+		run.Error = job.Error
+		run.LogExcerpt = logExcerpt(job.LogFile)
+		log.Printf("Scheduled task %s %s (exit code %d, job %s)", name, job.Status, job.ExitCode, job.ID)
+	}
+	if err := history.Record(run); err != nil {
+		log.Printf("Failed to record run of scheduled task %s: %v", name, err)
+	}
+
 	cs.mutex.Lock()
-	cs.running[task.Name] = true
+	delete(cs.active[name], jobID)
 	cs.mutex.Unlock()
-	
-	defer func() {
-		cs.mutex.Lock()
-		cs.running[task.Name] = false
-		cs.mutex.Unlock()
-	}()
-	
-	log.Printf("Executing scheduled task: %s", task.Name)
-	// Execute the task command
-	// This would integrate with the process manager
-}
-
-func (cs *CronScheduler) parseNextRun(cronExpr string) (time.Time, error) {
-	// Simple cron parser - supports basic patterns
-	// Format: "minute hour day month weekday"
-	// Example: "0 2 * * *" = daily at 2 AM
-	
-	now := time.Now()
-	
-	// Basic patterns
-	switch cronExpr {
-	case "@hourly", "0 * * * *":
-		return now.Add(time.Hour).Truncate(time.Hour), nil
-	case "@daily", "0 0 * * *":
-		return now.AddDate(0, 0, 1).Truncate(24 * time.Hour), nil
-	case "@weekly", "0 0 * * 0":
-		return now.AddDate(0, 0, 7).Truncate(24 * time.Hour), nil
-	case "@monthly", "0 0 1 * *":
-		return now.AddDate(0, 1, 0).Truncate(24 * time.Hour), nil
-	default:
-		// For now, default to hourly for unknown patterns
-		return now.Add(time.Hour), nil
+	close(done)
+}
+
+func (cs *CronScheduler) recordSkipped(name, trigger string, scheduledAt time.Time, reason string) {
+	log.Printf("Skipped scheduled task %s: %s", name, reason)
+	cs.History().Record(types.TaskRun{
+		Task:        name,
+		Trigger:     trigger,
+		ScheduledAt: scheduledAt,
+		Status:      types.JobSkipped,
+		Error:       reason,
+	})
+}
+
+// saveLocked persists task. The caller holds cs.mutex.
+func (cs *CronScheduler) saveLocked(task *types.ScheduledTask) error {
+	if cs.store == nil {
+		return nil
 	}
-}
\ No newline at end of file
+	return cs.store.AddScheduledTask(task)
+}
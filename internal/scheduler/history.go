@@ -0,0 +1,134 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"gproc/pkg/types"
+)
+
+const (
+	// historyPerTask is how many runs are kept for each task.
+	historyPerTask = 100
+	// excerptSize is how much of the end of a run's log is kept.
+	excerptSize = 2048
+)
+
+// History is the persisted execution history of scheduled tasks.
+type History struct {
+	path  string
+	runs  map[string][]types.TaskRun
+	mutex sync.RWMutex
+}
+
+// LoadHistory reads the history stored at path. A missing file yields an
+// empty history.
+func LoadHistory(path string) (*History, error) {
+	h := &History{path: path, runs: make(map[string][]types.TaskRun)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &h.runs); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Record appends run to its task's history and saves it.
+func (h *History) Record(run types.TaskRun) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	runs := append(h.runs[run.Task], run)
+	if len(runs) > historyPerTask {
+		runs = runs[len(runs)-historyPerTask:]
+	}
+	h.runs[run.Task] = runs
+	return h.save()
+}
+
+// Runs returns up to limit of the most recent runs of task, oldest first.
+// A limit of 0 returns all of them.
+func (h *History) Runs(task string, limit int) []types.TaskRun {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	runs := h.runs[task]
+	if limit > 0 && len(runs) > limit {
+		runs = runs[len(runs)-limit:]
+	}
+	return append([]types.TaskRun(nil), runs...)
+}
+
+// Last returns the most recent run of task.
+func (h *History) Last(task string) (types.TaskRun, bool) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	runs := h.runs[task]
+	if len(runs) == 0 {
+		return types.TaskRun{}, false
+	}
+	return runs[len(runs)-1], true
+}
+
+// Remove drops the history of task.
+func (h *History) Remove(task string) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delete(h.runs, task)
+	return h.save()
+}
+
+func (h *History) save() error {
+	if h.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(h.runs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.path)
+}
+
+// logExcerpt returns the last lines of the log at path, at most excerptSize
+// bytes and starting on a line boundary.
+func logExcerpt(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return ""
+	}
+	offset := info.Size() - excerptSize
+	if offset < 0 {
+		offset = 0
+	}
+	data, err := io.ReadAll(io.NewSectionReader(file, offset, info.Size()-offset))
+	if err != nil {
+		return ""
+	}
+	if offset > 0 {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+	return string(data)
+}
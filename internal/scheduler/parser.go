@@ -0,0 +1,326 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule computes activation times of a cron expression.
+type Schedule interface {
+	// Next returns the first activation strictly after t, or the zero time
+	// if there is none within the next five years.
+	Next(t time.Time) time.Time
+}
+
+type bounds struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	secondBounds = bounds{0, 59, nil}
+	minuteBounds = bounds{0, 59, nil}
+	hourBounds   = bounds{0, 23, nil}
+	domBounds    = bounds{1, 31, nil}
+	monthBounds  = bounds{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowBounds = bounds{0, 7, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// Parse parses a cron expression evaluated in loc (time.Local when nil).
+//
+// Accepted forms are the standard five fields (minute hour day-of-month
+// month day-of-week), six fields with a leading seconds field, the @yearly,
+// @monthly, @weekly, @daily and @hourly descriptors and "@every <duration>".
+// Fields support *, ?, lists (1,5), ranges (1-5), steps (*/15, 10-40/5) and
+// month and weekday names. A "CRON_TZ=<zone>" or "TZ=<zone>" prefix
+// overrides loc.
+func Parse(spec string, loc *time.Location) (Schedule, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		i := strings.IndexAny(spec, " \t")
+		if i < 0 {
+			return nil, fmt.Errorf("missing schedule after %q", spec)
+		}
+		zone := spec[strings.Index(spec, "=")+1 : i]
+		var err error
+		if loc, err = time.LoadLocation(zone); err != nil {
+			return nil, fmt.Errorf("unknown time zone %q: %v", zone, err)
+		}
+		spec = strings.TrimSpace(spec[i:])
+	}
+
+	if strings.HasPrefix(spec, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid @every interval: %v", err)
+		}
+		if interval < time.Second {
+			return nil, fmt.Errorf("@every interval must be at least 1s")
+		}
+		return &everySchedule{interval: interval}, nil
+	}
+
+	if strings.HasPrefix(spec, "@") {
+		expanded, ok := descriptors[strings.ToLower(spec)]
+		if !ok {
+			return nil, fmt.Errorf("unknown descriptor %q", spec)
+		}
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("expected 5 or 6 fields, found %d in %q", len(fields), spec)
+	}
+
+	s := &cronSchedule{location: loc}
+	var err error
+	if s.second, err = parseField(fields[0], secondBounds); err != nil {
+		return nil, fmt.Errorf("seconds: %v", err)
+	}
+	if s.minute, err = parseField(fields[1], minuteBounds); err != nil {
+		return nil, fmt.Errorf("minutes: %v", err)
+	}
+	if s.hour, err = parseField(fields[2], hourBounds); err != nil {
+		return nil, fmt.Errorf("hours: %v", err)
+	}
+	if s.dom, err = parseField(fields[3], domBounds); err != nil {
+		return nil, fmt.Errorf("day of month: %v", err)
+	}
+	if s.month, err = parseField(fields[4], monthBounds); err != nil {
+		return nil, fmt.Errorf("month: %v", err)
+	}
+	if s.dow, err = parseField(fields[5], dowBounds); err != nil {
+		return nil, fmt.Errorf("day of week: %v", err)
+	}
+
+	// 7 is an alias for Sunday.
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	s.domAny = isWildcard(fields[3])
+	s.dowAny = isWildcard(fields[5])
+	return s, nil
+}
+
+func isWildcard(field string) bool {
+	return field == "*" || field == "?"
+}
+
+// parseField returns the bit set of values matched by a comma separated
+// list of ranges.
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, expr := range strings.Split(field, ",") {
+		rangeBits, err := parseRange(expr, b)
+		if err != nil {
+			return 0, err
+		}
+		bits |= rangeBits
+	}
+	return bits, nil
+}
+
+func parseRange(expr string, b bounds) (uint64, error) {
+	rangeAndStep := strings.Split(expr, "/")
+	if len(rangeAndStep) > 2 {
+		return 0, fmt.Errorf("invalid step in %q", expr)
+	}
+	lowAndHigh := strings.Split(rangeAndStep[0], "-")
+	if len(lowAndHigh) > 2 {
+		return 0, fmt.Errorf("invalid range %q", expr)
+	}
+
+	var start, end uint
+	var err error
+	if isWildcard(lowAndHigh[0]) {
+		if len(lowAndHigh) > 1 {
+			return 0, fmt.Errorf("invalid range %q", expr)
+		}
+		start, end = b.min, b.max
+	} else {
+		if start, err = parseValue(lowAndHigh[0], b); err != nil {
+			return 0, err
+		}
+		end = start
+		if len(lowAndHigh) == 2 {
+			if end, err = parseValue(lowAndHigh[1], b); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	step := uint(1)
+	if len(rangeAndStep) == 2 {
+		n, err := strconv.ParseUint(rangeAndStep[1], 10, 8)
+		if err != nil || n == 0 {
+			return 0, fmt.Errorf("invalid step %q", rangeAndStep[1])
+		}
+		step = uint(n)
+		// "5/10" means every 10 starting at 5.
+		if len(lowAndHigh) == 1 && !isWildcard(lowAndHigh[0]) {
+			end = b.max
+		}
+	}
+
+	if start < b.min || end > b.max {
+		return 0, fmt.Errorf("%q is outside %d-%d", expr, b.min, b.max)
+	}
+	if start > end {
+		return 0, fmt.Errorf("range %q starts after it ends", expr)
+	}
+
+	var bits uint64
+	for i := start; i <= end; i += step {
+		bits |= 1 << i
+	}
+	return bits, nil
+}
+
+func parseValue(value string, b bounds) (uint, error) {
+	if b.names != nil {
+		if n, ok := b.names[strings.ToLower(value)]; ok {
+			return n, nil
+		}
+	}
+	n, err := strconv.ParseUint(value, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	return uint(n), nil
+}
+
+// cronSchedule is a parsed field based expression. Each field is a bit set
+// of the values it matches.
+type cronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	domAny, dowAny                        bool
+	location                              *time.Location
+}
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	origLocation := t.Location()
+	t = t.In(s.location)
+
+	// Start at the next whole second.
+	t = t.Add(time.Second - time.Duration(t.Nanosecond())*time.Nanosecond)
+
+	// Once a field had to move forward the smaller ones restart at zero.
+	added := false
+	yearLimit := t.Year() + 5
+
+WRAP:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for 1<<uint(t.Month())&s.month == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, s.location)
+		}
+		t = t.AddDate(0, 1, 0)
+		if t.Month() == time.January {
+			goto WRAP
+		}
+	}
+
+	for !s.dayMatches(t) {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.location)
+		}
+		t = t.AddDate(0, 0, 1)
+		// Days that start at 01:00 or 23:00 because of DST transitions.
+		if t.Hour() != 0 {
+			if t.Hour() > 12 {
+				t = t.Add(time.Duration(24-t.Hour()) * time.Hour)
+			} else {
+				t = t.Add(time.Duration(-t.Hour()) * time.Hour)
+			}
+		}
+		if t.Day() == 1 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Hour())&s.hour == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, s.location)
+		}
+		t = t.Add(time.Hour)
+		if t.Hour() == 0 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Minute())&s.minute == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Minute)
+		}
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Second())&s.second == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Second)
+		}
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto WRAP
+		}
+	}
+
+	return t.In(origLocation)
+}
+
+// dayMatches follows cron semantics: when both day fields are restricted a
+// day matching either of them is enough.
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := 1<<uint(t.Day())&s.dom != 0
+	dowMatch := 1<<uint(t.Weekday())&s.dow != 0
+	if s.domAny || s.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// everySchedule fires at a fixed interval.
+type everySchedule struct {
+	interval time.Duration
+}
+
+func (e *everySchedule) Next(t time.Time) time.Time {
+	return t.Add(e.interval - time.Duration(t.Nanosecond())*time.Nanosecond)
+}
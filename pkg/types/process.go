@@ -11,6 +11,9 @@ const (
 	StatusRunning ProcessStatus = "running"
 	StatusStopped ProcessStatus = "stopped"
 	StatusFailed  ProcessStatus = "failed"
+	// StatusIdle is a lazy process that is not running but will be started
+	// by the next connection to one of its sockets.
+	StatusIdle ProcessStatus = "idle"
 )
 
 type Process struct {
@@ -28,13 +31,90 @@ type Process struct {
 	MaxRestarts   int               `json:"max_restarts"`
 	LogFile       string            `json:"log_file"`
 	Group         string            `json:"group"`
+	// Labels are arbitrary key/value pairs matched by label selectors.
+	Labels        map[string]string `json:"labels,omitempty"`
 	HealthCheck   *HealthCheck      `json:"health_check"`
 	LogRotation   *LogRotation      `json:"log_rotation"`
+	LogParser     *LogParser        `json:"log_parser,omitempty"`
+	LogSearch     *LogSearch        `json:"log_search,omitempty"`
+	LogMultiline  *LogMultiline     `json:"log_multiline,omitempty"`
+	LogOutput     *LogOutput        `json:"log_output,omitempty"`
+	LogRedaction  *LogRedaction     `json:"log_redaction,omitempty"`
+	// MetricsEndpoint is the Prometheus endpoint of the process, which the
+	// daemon scrapes and exports with its own metrics: a URL, or
+	// [host]:port[/path] for http://127.0.0.1:port/metrics. ${VAR} expands
+	// to the environment of the process.
+	MetricsEndpoint string          `json:"metrics_endpoint,omitempty"`
 	ResourceLimit *ResourceLimit    `json:"resource_limit"`
 	Notifications *Notifications    `json:"notifications"`
+	TTY           bool              `json:"tty,omitempty"`
+	// Type is "simple" (the default), "notify" or "forking". A notify
+	// process reports readiness and watchdog pings on NOTIFY_SOCKET using
+	// the sd_notify protocol; Watchdog is the longest allowed gap between
+	// pings and ReadyTimeout how long it may take to report READY=1. A
+	// forking process daemonizes and writes the PID of the service to
+	// PIDFile before the command started by GProc exits.
+	Type          string            `json:"type,omitempty"`
+	PIDFile       string            `json:"pid_file,omitempty"`
+	Watchdog      time.Duration     `json:"watchdog,omitempty"`
+	ReadyTimeout  time.Duration     `json:"ready_timeout,omitempty"`
+	Readiness     Readiness         `json:"readiness,omitempty"`
+	StatusText    string            `json:"status_text,omitempty"`
+	// Sockets are bound by GProc and passed to the process as inherited
+	// file descriptors (LISTEN_FDS), so they survive restarts and reloads.
+	Sockets       []Socket          `json:"sockets,omitempty"`
+	// Lazy processes are only started by the first connection to one of
+	// their sockets and stopped again after IdleTimeout without any.
+	Lazy          bool              `json:"lazy,omitempty"`
+	IdleTimeout   time.Duration     `json:"idle_timeout,omitempty"`
 	Cmd           *exec.Cmd         `json:"-"`
 }
 
+// Socket is a listening socket GProc binds on behalf of a process.
+type Socket struct {
+	Name    string `json:"name,omitempty"`
+	Network string `json:"network"`
+	Address string `json:"address"`
+}
+
+const (
+	ProcessTypeSimple  = "simple"
+	ProcessTypeNotify  = "notify"
+	ProcessTypeForking = "forking"
+)
+
+// Readiness is the service state reported by a notify process.
+type Readiness string
+
+const (
+	ReadinessStarting  Readiness = "starting"
+	ReadinessReady     Readiness = "ready"
+	ReadinessReloading Readiness = "reloading"
+	ReadinessStopping  Readiness = "stopping"
+)
+
+// ProcessEvent is something that happened to a process, kept by the
+// daemon for 'gproc describe'.
+type ProcessEvent struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	Message  string    `json:"message"`
+	PID      int       `json:"pid,omitempty"`
+	ExitCode *int      `json:"exit_code,omitempty"`
+	Process  string    `json:"process,omitempty"` // ID of the process
+}
+
+const (
+	EventStarted   = "started"
+	EventExited    = "exited"
+	EventRestarted = "restarted"
+	EventStopped   = "stopped"
+	EventReloaded  = "reloaded"
+	EventIdle      = "idle"
+	EventWatchdog  = "watchdog"
+	EventOrphan    = "orphan"
+)
+
 type HealthCheck struct {
 	URL      string        `json:"url"`
 	Interval time.Duration `json:"interval"`
@@ -47,6 +127,75 @@ type LogRotation struct {
 	MaxFiles int    `json:"max_files"`
 }
 
+// LogParser extracts the time, level, message and fields of each line a
+// process logs. Format is json, logfmt or regex; Pattern is the regular
+// expression of the regex format, whose named groups become fields. The
+// *Field settings name the fields holding the time, level and message
+// when they are not one of the usual names, and TimeFormat is the Go
+// layout of the time when it is neither RFC 3339 nor a Unix timestamp.
+type LogParser struct {
+	Format       string `json:"format"`
+	Pattern      string `json:"pattern,omitempty"`
+	TimeField    string `json:"time_field,omitempty"`
+	TimeFormat   string `json:"time_format,omitempty"`
+	LevelField   string `json:"level_field,omitempty"`
+	MessageField string `json:"message_field,omitempty"`
+}
+
+// LogSearch adds the lines a process logs to the full-text search index
+// of the daemon, where they stay for Retention (7 days by default).
+type LogSearch struct {
+	Retention time.Duration `json:"retention,omitempty"`
+}
+
+// LogMultiline joins the lines of one event, like a stack trace, into a
+// single log entry. A line matching Start, or any line without Start,
+// begins an event. The lines after it matching Continuation, or without
+// Continuation the lines not matching Start, are added to it. An event
+// ends at the first line that is not, after Timeout without more lines
+// (1s by default) or at MaxLines lines (500 by default).
+type LogMultiline struct {
+	Start        string        `json:"start,omitempty"`
+	Continuation string        `json:"continuation,omitempty"`
+	Timeout      time.Duration `json:"timeout,omitempty"`
+	MaxLines     int           `json:"max_lines,omitempty"`
+}
+
+// LogOutput forwards the output of a process to the system log as well
+// as to its log file. Type is syslog, to send RFC 5424 messages to the
+// syslog daemon, journald, to send entries with the fields GPROC_PROCESS,
+// GPROC_INSTANCE and STREAM to the systemd journal, or none to override
+// the output of the logging configuration. The other settings are those
+// of syslog: Network is unix (the default), udp or tcp, Address the path
+// of the socket (/dev/log by default) or host:port, Facility a name such
+// as daemon (the default) or local0, and AppName defaults to the name of
+// the process.
+type LogOutput struct {
+	Type     string `json:"type"`
+	Network  string `json:"network,omitempty"`
+	Address  string `json:"address,omitempty"`
+	Facility string `json:"facility,omitempty"`
+	AppName  string `json:"app_name,omitempty"`
+}
+
+// LogRedaction masks secrets in the output of a process before it is
+// written to the log, indexed or shipped. Detectors are built-in rules:
+// jwt, bearer, email and credit_card, or all of them with all.
+type LogRedaction struct {
+	Detectors []string        `json:"detectors,omitempty"`
+	Rules     []RedactionRule `json:"rules,omitempty"`
+}
+
+// RedactionRule replaces the matches of the regular expression Pattern
+// with Replacement, which may refer to groups as $1 or ${name} and is
+// <redacted> by default. Name identifies the rule in the redaction
+// counts.
+type RedactionRule struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement,omitempty"`
+}
+
 type ResourceLimit struct {
 	MemoryMB int     `json:"memory_mb"`
 	CPULimit float64 `json:"cpu_limit"`
@@ -77,6 +226,7 @@ type ScheduledTask struct {
 	Command     string            `json:"command"`
 	Args        []string          `json:"args"`
 	Cron        string            `json:"cron"`
+	TimeZone    string            `json:"time_zone,omitempty"`
 	NextRun     time.Time         `json:"next_run"`
 	LastRun     time.Time         `json:"last_run,omitempty"`
 	Enabled     bool              `json:"enabled"`
@@ -85,6 +235,78 @@ type ScheduledTask struct {
 	Env         map[string]string `json:"env,omitempty"`
 	WorkingDir  string            `json:"working_dir,omitempty"`
 	Description string            `json:"description,omitempty"`
+	// Concurrency decides what happens when a run is due while the
+	// previous one is still going (default forbid).
+	Concurrency ConcurrencyPolicy `json:"concurrency,omitempty"`
+	// MissedRuns decides what happens to runs that fell due while the
+	// daemon was down (default skip). MaxMissedRuns caps run-all.
+	MissedRuns    MissedRunPolicy `json:"missed_runs,omitempty"`
+	MaxMissedRuns int             `json:"max_missed_runs,omitempty"`
+}
+
+type ConcurrencyPolicy string
+
+const (
+	ConcurrencyAllow   ConcurrencyPolicy = "allow"
+	ConcurrencyForbid  ConcurrencyPolicy = "forbid"
+	ConcurrencyReplace ConcurrencyPolicy = "replace"
+)
+
+type MissedRunPolicy string
+
+const (
+	MissedRunSkip MissedRunPolicy = "skip"
+	MissedRunOnce MissedRunPolicy = "run-once"
+	MissedRunAll  MissedRunPolicy = "run-all"
+)
+
+// TaskRun records one execution, or skipped execution, of a scheduled task.
+type TaskRun struct {
+	Task        string        `json:"task"`
+	JobID       string        `json:"job_id,omitempty"`
+	Trigger     string        `json:"trigger"`
+	ScheduledAt time.Time     `json:"scheduled_at"`
+	StartTime   time.Time     `json:"start_time,omitempty"`
+	EndTime     time.Time     `json:"end_time,omitempty"`
+	Duration    time.Duration `json:"duration"`
+	Status      JobStatus     `json:"status"`
+	ExitCode    int           `json:"exit_code"`
+	LogExcerpt  string        `json:"log_excerpt,omitempty"`
+	Error       string        `json:"error,omitempty"`
+}
+
+type JobStatus string
+
+const (
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobTimedOut  JobStatus = "timed_out"
+	JobCancelled JobStatus = "cancelled"
+	// JobSkipped is only used in scheduled task history.
+	JobSkipped JobStatus = "skipped"
+)
+
+// Job is a one-off command run to completion under the daemon.
+type Job struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Command     string            `json:"command"`
+	Args        []string          `json:"args"`
+	WorkingDir  string            `json:"working_dir,omitempty"`
+	Env         map[string]string `json:"env,omitempty"`
+	Timeout     time.Duration     `json:"timeout,omitempty"`
+	GracePeriod time.Duration     `json:"grace_period,omitempty"`
+	Retries     int               `json:"retries,omitempty"`
+	Backoff     time.Duration     `json:"backoff,omitempty"`
+	Status      JobStatus         `json:"status"`
+	Attempts    int               `json:"attempts"`
+	ExitCode    int               `json:"exit_code"`
+	PID         int               `json:"pid,omitempty"`
+	StartTime   time.Time         `json:"start_time"`
+	EndTime     time.Time         `json:"end_time,omitempty"`
+	LogFile     string            `json:"log_file"`
+	Error       string            `json:"error,omitempty"`
 }
 
 type Config struct {
@@ -279,6 +501,36 @@ type MetricsConfig struct {
 	Enabled    bool   `json:"enabled"`
 	Prometheus *PrometheusConfig `json:"prometheus,omitempty"`
 	Grafana    *GrafanaConfig `json:"grafana,omitempty"`
+	StatsD     *StatsDConfig `json:"statsd,omitempty"`
+	Retention  *MetricsRetention `json:"retention,omitempty"`
+	// PublicEndpoint serves /metrics of the API server without a token,
+	// for scrapers that cannot send one. The Prometheus port never asks
+	// for one.
+	PublicEndpoint bool `json:"public_endpoint,omitempty"`
+}
+
+// MetricsRetention is how long the metrics history keeps each of its
+// resolutions: the raw samples, including those of StatsD (1 day by
+// default), and the 1-minute (7 days), 1-hour (90 days) and 1-day (2
+// years) rollups.
+type MetricsRetention struct {
+	Raw    time.Duration `json:"raw,omitempty"`
+	Minute time.Duration `json:"minute,omitempty"`
+	Hour   time.Duration `json:"hour,omitempty"`
+	Day    time.Duration `json:"day,omitempty"`
+}
+
+// StatsDConfig runs a StatsD listener, with DogStatsD tags, in the daemon.
+// A metric belongs to the managed process whose tree the sender is in,
+// which the Unix socket tells from the credentials of the sender, or else
+// to the process named by its GPROC_PROCESS tag. Without Address and
+// Socket the listener takes UDP on 127.0.0.1:8125. Metrics are aggregated
+// and recorded every FlushInterval, 10 seconds by default.
+type StatsDConfig struct {
+	Enabled       bool          `json:"enabled"`
+	Address       string        `json:"address,omitempty"` // UDP host:port
+	Socket        string        `json:"socket,omitempty"`  // path of a Unix datagram socket
+	FlushInterval time.Duration `json:"flush_interval,omitempty"`
 }
 
 type PrometheusConfig struct {
@@ -304,12 +556,22 @@ type TracingConfig struct {
 type LoggingConfig struct {
 	Level       string `json:"level"`
 	Format      string `json:"format"` // json, text
-	Output      string `json:"output"` // stdout, file, syslog
+	Output      string `json:"output"` // stdout, file, syslog, journald
+	// Syslog sets where the output of the processes goes when Output is
+	// syslog; its Type is ignored. Processes with a LogOutput of their
+	// own use it instead.
+	Syslog      *LogOutput `json:"syslog,omitempty"`
+	// Redaction applies to every process, before the rules of its own.
+	Redaction   *LogRedaction `json:"redaction,omitempty"`
 	Aggregation *LogAggregationConfig `json:"aggregation,omitempty"`
 }
 
+// LogAggregationConfig ships the captured logs to an external store.
+// Config holds the settings of the provider (url, credentials, index...)
+// and of the shipping pipeline: batch_size, flush_interval, timeout,
+// max_backoff, compression, buffer_dir and buffer_max_size.
 type LogAggregationConfig struct {
-	Provider string            `json:"provider"` // elasticsearch, splunk
+	Provider string            `json:"provider"` // elasticsearch, loki, splunk
 	Config   map[string]string `json:"config"`
 }
 
@@ -317,6 +579,22 @@ type AlertingConfig struct {
 	Enabled   bool            `json:"enabled"`
 	Providers []AlertProvider `json:"providers"`
 	Rules     []AlertRule     `json:"rules"`
+	LogRules  []LogAlertRule  `json:"log_rules,omitempty"`
+}
+
+// LogAlertRule raises an alert when Threshold lines (1 by default) of
+// the output of a process match the regular expression Pattern within
+// Window (1 minute by default). It watches the process named Process, or
+// those whose labels match Selector, or else every process, counting the
+// lines of each on its own. Severity is warning by default.
+type LogAlertRule struct {
+	Name      string        `json:"name"`
+	Pattern   string        `json:"pattern"`
+	Threshold int           `json:"threshold,omitempty"`
+	Window    time.Duration `json:"window,omitempty"`
+	Process   string        `json:"process,omitempty"`
+	Selector  string        `json:"selector,omitempty"`
+	Severity  string        `json:"severity,omitempty"`
 }
 
 type AlertProvider struct {
@@ -474,6 +752,8 @@ type Alert struct {
 	ProcessID    string    `json:"process_id"`
 	Resolved     bool      `json:"resolved"`
 	Acknowledged bool      `json:"acknowledged"`
+	// Lines are the log lines that raised the alert, if a log rule did.
+	Lines        []string  `json:"lines,omitempty"`
 }
 
 type ProcessMetrics struct {
@@ -483,10 +763,39 @@ type ProcessMetrics struct {
 	Restarts    int           `json:"restarts"`
 }
 
+// AppMetric is a metric a process sent over StatsD as of the end of a
+// flush interval. Value is the total of a counter since the daemon started,
+// the value of a gauge or the distinct values of a set in the interval.
+// Timers, histograms and distributions count their observations and sum
+// them in Count and Sum since the daemon started and summarize those of
+// the interval in the other fields; timers are in seconds.
+type AppMetric struct {
+	Name  string            `json:"name"`
+	Type  string            `json:"type"` // counter, gauge, set, timer, histogram or distribution
+	Tags  map[string]string `json:"tags,omitempty"`
+	Value float64           `json:"value"`
+	Count uint64            `json:"count,omitempty"`
+	Sum   float64           `json:"sum,omitempty"`
+	Min   float64           `json:"min,omitempty"`
+	Max   float64           `json:"max,omitempty"`
+	P50   float64           `json:"p50,omitempty"`
+	P95   float64           `json:"p95,omitempty"`
+	P99   float64           `json:"p99,omitempty"`
+}
+
 type MetricPoint struct {
 	Timestamp time.Time `json:"timestamp"`
 	CPU       float64   `json:"cpu"`
 	Memory    float64   `json:"memory"`
+	// A rollup has the number of samples in its bucket and their spread;
+	// CPU and Memory are then their averages.
+	Samples   int     `json:"samples,omitempty"`
+	CPUMin    float64 `json:"cpu_min,omitempty"`
+	CPUMax    float64 `json:"cpu_max,omitempty"`
+	CPUP95    float64 `json:"cpu_p95,omitempty"`
+	MemoryMin float64 `json:"memory_min,omitempty"`
+	MemoryMax float64 `json:"memory_max,omitempty"`
+	MemoryP95 float64 `json:"memory_p95,omitempty"`
 }
 
 // Language-specific probe results